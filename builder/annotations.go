@@ -0,0 +1,32 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"sort"
+	"strings"
+)
+
+// annotatedOutput adds an annotation.<key>=<value> option to the buildx output
+// for each of annotations, which the image and oci exporters write to the image
+// manifest. Options containing a comma or quote are quoted, as buildx parses the
+// output as CSV.
+func annotatedOutput(output string, annotations map[string]string) string {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	options := []string{output}
+	for _, k := range keys {
+		option := "annotation." + k + "=" + annotations[k]
+		if strings.ContainsAny(option, `,"`) {
+			option = `"` + strings.ReplaceAll(option, `"`, `""`) + `"`
+		}
+		options = append(options, option)
+	}
+
+	return strings.Join(options, ",")
+}
@@ -0,0 +1,97 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+func Test_annotatedOutput(t *testing.T) {
+	cases := []struct {
+		name        string
+		output      string
+		annotations map[string]string
+		want        string
+	}{
+		{
+			name:        "sorted by key",
+			output:      "type=image",
+			annotations: map[string]string{"org.opencontainers.image.source": "https://github.com/openfaas/faas-cli", "com.example.team": "functions"},
+			want:        "type=image,annotation.com.example.team=functions,annotation.org.opencontainers.image.source=https://github.com/openfaas/faas-cli",
+		},
+		{
+			name:        "oci exporter",
+			output:      "type=oci,dest=fn.tar",
+			annotations: map[string]string{"owner": "alex"},
+			want:        "type=oci,dest=fn.tar,annotation.owner=alex",
+		},
+		{
+			name:        "comma and quote are quoted",
+			output:      "type=image",
+			annotations: map[string]string{"authors": `alex,"han"`},
+			want:        `type=image,"annotation.authors=alex,""han"""`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := annotatedOutput(tc.output, tc.annotations); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_resolveOutput_Annotations(t *testing.T) {
+	output, _, err := resolveOutput(BuildImageConfig{
+		Output:      "type=image,push=true",
+		Annotations: map[string]string{"owner": "alex"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := "type=image,push=true,annotation.owner=alex"
+	if output != want {
+		t.Errorf("want output %q, got %q", want, output)
+	}
+
+	dockerBuildVal := dockerBuild{Image: "fn", Output: output}
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	wantArgs := "buildx build --output type=image,push=true,annotation.owner=alex --tag fn ."
+	if got := strings.Join(args, " "); got != wantArgs {
+		t.Errorf("want args %q, got %q", wantArgs, got)
+	}
+}
+
+func Test_BuildImage_AnnotationsWithClassicBuilder(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	var err error
+	out := test.CaptureStderr(func() {
+		err = BuildImage(BuildImageConfig{
+			Image:        "fn",
+			Handler:      "handler",
+			FunctionName: "fn",
+			Language:     "go",
+			QuiteBuild:   true,
+			Annotations:  map[string]string{"owner": "alex"},
+		})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := "Warning: annotations require buildx, set --output to build fn with buildx, the annotations are ignored"
+	if !strings.Contains(out, want) {
+		t.Errorf("want warning %q, got: %s", want, out)
+	}
+
+	args := strings.Join((*builds)[0].Args, " ")
+	if strings.Contains(args, "annotation") || strings.Contains(args, "buildx") {
+		t.Errorf("want a classic build without annotations, got: %s", args)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Compression algorithms for a shrink-wrapped build context archive
+const (
+	ShrinkWrapCompressionNone = "none"
+	ShrinkWrapCompressionGzip = "gzip"
+
+	// ShrinkWrapCompressionZstd is not available in this build, so it is
+	// rejected with a clear error rather than listed as an option
+	ShrinkWrapCompressionZstd = "zstd"
+)
+
+// ShrinkWrapCompressions are the values accepted for --shrinkwrap-compression
+var ShrinkWrapCompressions = []string{ShrinkWrapCompressionNone, ShrinkWrapCompressionGzip}
+
+// ValidateShrinkWrapCompression checks that compression is supported, an empty
+// value means gzip
+func ValidateShrinkWrapCompression(compression string) error {
+	switch compression {
+	case "", ShrinkWrapCompressionNone, ShrinkWrapCompressionGzip:
+		return nil
+	case ShrinkWrapCompressionZstd:
+		return fmt.Errorf("zstd compression is not available in this build of faas-cli, use gzip or none")
+	}
+
+	return fmt.Errorf("unknown shrinkwrap compression: %q, valid options are: %s", compression, strings.Join(ShrinkWrapCompressions, ", "))
+}
+
+// shrinkWrapArchivePath returns the path of the archive for the build context at
+// contextPath, alongside the context, i.e. ./build/fn.tar.gz for ./build/fn/
+func shrinkWrapArchivePath(contextPath string, compression string) string {
+	archive := filepath.Clean(contextPath) + ".tar"
+	if compression != ShrinkWrapCompressionNone {
+		archive += ".gz"
+	}
+	return archive
+}
+
+// writeContextArchive writes the files within contextPath to w as a tar archive,
+// compressed as per compression. The archive can be given to docker build on stdin.
+func writeContextArchive(contextPath string, w io.Writer, compression string) error {
+	if err := ValidateShrinkWrapCompression(compression); err != nil {
+		return err
+	}
+
+	var gz *gzip.Writer
+	if compression != ShrinkWrapCompressionNone {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+
+	tw := tar.NewWriter(w)
+
+	walkErr := filepath.Walk(contextPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(contextPath, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	if gz != nil {
+		return gz.Close()
+	}
+
+	return nil
+}
+
+// archiveBuildContext writes the build context at contextPath to an archive, and
+// returns the archive's path
+func archiveBuildContext(contextPath string, compression string) (string, error) {
+	if len(compression) == 0 {
+		compression = ShrinkWrapCompressionGzip
+	}
+
+	archive := shrinkWrapArchivePath(contextPath, compression)
+
+	f, err := os.Create(archive)
+	if err != nil {
+		return "", fmt.Errorf("unable to create the archive: %s", err.Error())
+	}
+
+	if err := writeContextArchive(contextPath, f, compression); err != nil {
+		f.Close()
+		return "", fmt.Errorf("unable to archive the build context: %s", err.Error())
+	}
+
+	return archive, f.Close()
+}
@@ -0,0 +1,180 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+func writeArchiveTestContext(t *testing.T) string {
+	t.Helper()
+
+	contextPath := filepath.Join(t.TempDir(), "fn")
+	files := map[string]string{
+		"Dockerfile":           "FROM scratch\n",
+		"function/handler.txt": "user handler\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(contextPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return contextPath
+}
+
+func Test_writeContextArchive_HeaderBytes(t *testing.T) {
+	contextPath := writeArchiveTestContext(t)
+
+	cases := []struct {
+		name        string
+		compression string
+		check       func(t *testing.T, data []byte)
+		wantErr     string
+	}{
+		{
+			name:        "none is a plain tar",
+			compression: ShrinkWrapCompressionNone,
+			check: func(t *testing.T, data []byte) {
+				if len(data) < 262 || string(data[257:262]) != "ustar" {
+					t.Errorf("want the ustar magic at offset 257")
+				}
+			},
+		},
+		{
+			name:        "gzip",
+			compression: ShrinkWrapCompressionGzip,
+			check: func(t *testing.T, data []byte) {
+				if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+					t.Errorf("want the gzip magic 1f 8b, got % x", data[:2])
+				}
+			},
+		},
+		{
+			name:        "empty defaults to gzip",
+			compression: "",
+			check: func(t *testing.T, data []byte) {
+				if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+					t.Errorf("want the gzip magic 1f 8b, got % x", data[:2])
+				}
+			},
+		},
+		{
+			name:        "zstd is not available",
+			compression: ShrinkWrapCompressionZstd,
+			wantErr:     "zstd compression is not available in this build of faas-cli",
+		},
+		{
+			name:        "unknown",
+			compression: "bzip2",
+			wantErr:     "unknown shrinkwrap compression",
+		},
+	}
+
+	for _, compression := range ShrinkWrapCompressions {
+		if err := ValidateShrinkWrapCompression(compression); err != nil {
+			t.Errorf("want each advertised compression to be accepted, %s: %s", compression, err)
+		}
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			err := writeContextArchive(contextPath, &buf, tc.compression)
+			if len(tc.wantErr) > 0 {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+					t.Fatalf("want error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			tc.check(t, buf.Bytes())
+		})
+	}
+}
+
+func Test_writeContextArchive_Contents(t *testing.T) {
+	contextPath := writeArchiveTestContext(t)
+
+	buf := bytes.Buffer{}
+	if err := writeContextArchive(contextPath, &buf, ShrinkWrapCompressionGzip); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[header.Name] = string(data)
+	}
+
+	want := map[string]string{
+		"Dockerfile":           "FROM scratch\n",
+		"function/":            "",
+		"function/handler.txt": "user handler\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func Test_BuildImage_ShrinkWrapTar(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	test.CaptureStdout(func() {
+		err := BuildImage(BuildImageConfig{
+			Image:                 "fn",
+			Handler:               "handler",
+			FunctionName:          "fn",
+			Language:              "go",
+			ShrinkWrap:            true,
+			ShrinkWrapTar:         true,
+			ShrinkWrapCompression: ShrinkWrapCompressionNone,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if _, err := os.Stat(filepath.Join("build", "fn.tar")); err != nil {
+		t.Errorf("want an archive of the build context: %s", err)
+	}
+
+	if len(*builds) != 0 {
+		t.Errorf("want docker build to be skipped, got %d builds", len(*builds))
+	}
+}
@@ -4,15 +4,21 @@
 package builder
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	v1execute "github.com/alexellis/go-execute/pkg/v1"
+	"github.com/openfaas/faas-cli/config"
 	"github.com/openfaas/faas-cli/schema"
 	"github.com/openfaas/faas-cli/stack"
 	vcs "github.com/openfaas/faas-cli/versioncontrol"
@@ -37,117 +43,1015 @@ type BuildImageConfig struct {
 	BuildOptions   []string
 	CopyExtraPaths []string
 	TagMode        schema.BuildFormat
+
+	// DescribeAlwaysDirty includes the commit SHA in a describe tag even when
+	// HEAD is on a tag, and marks uncommitted changes with -dirty
+	DescribeAlwaysDirty bool
+
+	// AllowNoVCS uses FallbackVersion for the image tag when TagMode requires
+	// Git metadata, but the working directory is not a Git repository
+	AllowNoVCS      bool
+	FallbackVersion string
+
+	// ExtraTags are applied to the image in addition to the tag from TagMode
+	ExtraTags []string
+
+	// AlsoTags are applied to the image as per ExtraTags, after {branch} and {sha}
+	// are replaced with the Git branch and short SHA, i.e. "{branch}-latest"
+	AlsoTags []string
+
+	// Verbose prints additional information about the build
+	Verbose bool
+
+	// KeepTemp keeps temporary files, such as a cloned remote handler, after the build
+	KeepTemp bool
+
+	// SquashMode is SquashRequire or SquashBestEffort, and decides what happens
+	// when the Docker daemon cannot --squash
+	SquashMode string
+
+	// Pull always attempts to pull newer versions of the base images
+	Pull bool
+
+	// Compress gzips the build context sent to the Docker daemon, which helps
+	// with a remote daemon over a slow link
+	Compress bool
+
+	// HandlerFolderOverride takes precedence over the template's handler_folder
+	// and the default "function" folder
+	HandlerFolderOverride string
+
+	// SkipProxy stops the http_proxy and https_proxy environment variables from
+	// being forwarded as build-args, explicit build-args are still passed
+	SkipProxy bool
+
+	// Offline makes the build predictable without network access or Git, it:
+	// - refuses to pull base images, so --pull cannot be combined with it
+	// - stops forwarding the http_proxy and https_proxy environment variables
+	// - refuses to clone a handler from a remote Git URL
+	// - skips Git lookups for labels
+	Offline bool
+
+	// PreBuild shell commands are run in the handler folder before the build
+	// context is created, so that generated files are included in it
+	PreBuild []string
+
+	// PostBuild shell commands are run in the handler folder after a successful
+	// build, with the image name available in the FAAS_IMAGE environment variable
+	// and its digest in FAAS_IMAGE_DIGEST
+	PostBuild []string
+
+	// DockerfileOverlay is a file within the handler which is merged into the
+	// template's Dockerfile, see parseDockerfileOverlay for its format
+	DockerfileOverlay string
+
+	// StrictTemplate fails the build when the language declared by the template's
+	// template.yml does not match Language, rather than printing a warning
+	StrictTemplate bool
+
+	// VerifyTemplate fails the build when the template does not match its
+	// recorded TemplateChecksumFile
+	VerifyTemplate bool
+
+	// BuildArgSecrets maps a build-arg to a file, the file is read at build time and
+	// passed to docker through its environment, rather than on the command line
+	BuildArgSecrets map[string]string
+
+	// BuildArgDefaults are build-args with the lowest precedence, each is only
+	// passed when it is not set by BuildArgMap, the template's build_args or
+	// BuildArgSecrets
+	BuildArgDefaults map[string]string
+
+	// FreezeBaseImages pins each FROM of the staged Dockerfile to the current digest
+	// of its base image, the digests are recorded in ./build/<function>.manifest.json
+	FreezeBaseImages bool
+
+	// Isolation is passed to docker as --isolation for Windows containers, one of
+	// the IsolationModes
+	Isolation string
+
+	// AddHosts adds custom host-to-IP mappings to the build, each in the form
+	// host:ip, i.e. registry.internal:10.0.0.10
+	AddHosts []string
+
+	// BuildNetwork sets the networking mode for the RUN instructions of the build,
+	// i.e. "host" so that a step can reach a service on the build host. Host
+	// networking removes the network isolation of the build, so should only be
+	// used with trusted Dockerfiles, and is not supported for multi-platform builds
+	BuildNetwork string
+
+	// ShrinkWrapTar writes the shrink-wrapped build context to an archive as
+	// well as a folder, which can be given to "docker buildx build -" on stdin
+	ShrinkWrapTar bool
+
+	// ShrinkWrapCompression is ShrinkWrapCompressionNone or ShrinkWrapCompressionGzip
+	// for the archive from ShrinkWrapTar, defaults to gzip
+	ShrinkWrapCompression string
+
+	// CopyExtraScopes are the folders which CopyExtraPaths may be copied from,
+	// i.e. "." and "../vendor", defaults to the current directory
+	CopyExtraScopes []string
+
+	// ExcludePaths are filepath.Match patterns, relative to the handler, for files
+	// and folders which are not copied into the build context, i.e. "fixtures"
+	// or "testdata/*.json"
+	ExcludePaths []string
+
+	// TemplateDir is the folder that language templates are read from, defaults
+	// to stack.DefaultTemplateDir
+	TemplateDir string
+
+	// KeepBuildArgWhitespace passes build-arg values as given, rather than
+	// trimming trailing whitespace and newlines with a warning
+	KeepBuildArgWhitespace bool
+
+	// ExpandBuildArgs resolves the variables in build-arg values, see
+	// expandBuildArgs. It is opt-in, so that a value containing {{ or ${, such
+	// as a password, is passed to docker as given.
+	ExpandBuildArgs bool
+
+	// GitLabels adds the faas.git.branch, faas.git.sha and faas.git.describe
+	// labels to the image, when the Git information is available
+	GitLabels bool
+
+	// GitDirtyLabel adds the faas.git.dirty label to the image, to record whether
+	// it was built from a working tree with uncommitted changes
+	GitDirtyLabel bool
+
+	// CheckRegistry verifies that the Docker client is logged into the image's
+	// registry before building, so that a later push does not fail
+	CheckRegistry bool
+
+	// Output is passed to docker buildx as --output, i.e. type=oci,dest=fn.tar,
+	// the image is written there instead of being loaded into the Docker daemon
+	Output string
+
+	// Annotations are added to the image manifest through the buildx Output, as
+	// distinct from the labels of the image config. They require an Output.
+	Annotations map[string]string
+
+	// DockerBinary is run in place of "docker" from the PATH for the build, i.e. a
+	// wrapper script or a docker installed to a non-standard path
+	DockerBinary string
+
+	// CacheDir holds a local BuildKit cache for each function, which is imported
+	// and exported with --cache-from and --cache-to. It builds with buildx, and
+	// loads the image into the Docker daemon when no Output is given.
+	CacheDir string
+
+	// InlineCache writes BuildKit's cache into the image with BUILDKIT_INLINE_CACHE,
+	// tags it as the rolling InlineCacheImage, and imports the cache from that tag
+	// with --cache-from. It requires BuildKit.
+	InlineCache bool
+
+	// SmokeTest starts the built image before the build is reported as a success,
+	// and fails the build when the container exits or SmokeTestPath does not return
+	// 200 OK on SmokeTestPort within SmokeTestTimeout. An empty SmokeTestPath only
+	// checks the container is still running after SmokeTestTimeout. A zero port or
+	// timeout uses DefaultSmokeTestPort or DefaultSmokeTestTimeout.
+	SmokeTest        bool
+	SmokeTestPort    int
+	SmokeTestPath    string
+	SmokeTestTimeout time.Duration
+
+	// ProgressFunc is called with a BuildEvent at each BuildPhase, in place of
+	// printing the equivalent messages, for consumers which display their own
+	// progress. When nil, progress is printed to stdout.
+	ProgressFunc func(event BuildEvent)
+
+	// BuildMemory limits the memory of the build's RUN instructions with --memory,
+	// i.e. 512m or 2g, and is only supported by the classic builder
+	BuildMemory string
+
+	// BuildCPUs limits the CPUs of the build's RUN instructions, i.e. 1.5, and is
+	// only supported by the classic builder
+	BuildCPUs string
+
+	// Ulimits are passed to the classic builder as --ulimit, i.e. nofile=65536:65536
+	Ulimits []string
+
+	// ExportRootFS writes the filesystem of the final stage as a tar to the given
+	// path with docker buildx, instead of building an image
+	ExportRootFS string
+
+	// Reproducible sets SOURCE_DATE_EPOCH from the time of the last commit, as a
+	// build-arg and in the environment of docker, and has buildx rewrite the
+	// timestamps of the image's files to match
+	Reproducible bool
+
+	// NoTemplateOverlay builds a language template function from its handler alone,
+	// which must contain a complete Dockerfile, rather than overlaying the handler
+	// onto the template
+	NoTemplateOverlay bool
+
+	// OnSuccess is called with the BuildResult after docker builds the image, and
+	// before any PostBuild commands, in place of printing that the image was built.
+	// An error from OnSuccess fails the build. It is passed the build's Context.
+	OnSuccess func(ctx context.Context, result BuildResult) error
+
+	// WorkingDir is the folder that the handler, template folder, extra paths and
+	// their scopes are relative to, and which the build folder is created in. It
+	// defaults to the current directory, which is left unchanged.
+	WorkingDir string
+
+	// VerifyCopies compares the sha256 checksum of each file copied into the build
+	// context with its source, as well as its size, to catch a corrupt copy on an
+	// unreliable filesystem
+	VerifyCopies bool
+
+	// DockerContext is passed to docker as --context, to build with the daemon of
+	// one of the contexts from "docker context ls" rather than the current one
+	DockerContext string
+
+	// Scan runs grype against the built image and prints a summary of the
+	// vulnerabilities found
+	Scan bool
+
+	// ScanFailOn fails the build when the scan finds a vulnerability of this
+	// severity or above, one of the Severities
+	ScanFailOn string
+
+	// ScanRequired fails the build when grype is not installed, rather than
+	// printing a warning
+	ScanRequired bool
+
+	// NoClear updates the existing build folder to match the new build context,
+	// rather than clearing it, see updateBuildContext
+	NoClear bool
+
+	// ContextReader is a tar stream of a build context assembled by the caller,
+	// which is passed to docker on stdin in place of staging ./build/<function>/,
+	// see buildFromReader
+	ContextReader io.Reader
+
+	// NoCacheSet and SquashSet record that NoCache and Squash were given
+	// explicitly, so that they take precedence over the no_cache and squash of
+	// the template
+	NoCacheSet bool
+	SquashSet  bool
+
+	// Context stops the build when it is cancelled, i.e. on SIGINT, by killing
+	// docker, the hooks, the scanner or the smoke test, and removing the build
+	// context, unless KeepTemp is set. A nil Context is never cancelled.
+	Context context.Context
 }
 
 // BuildImage construct Docker image from function parameters
 // TODO: refactor signature to a struct to simplify the length of the method header
 func BuildImage(config BuildImageConfig) error {
+	_, err := BuildImageWithResult(config)
+	return err
+}
+
+// BuildImageWithResult builds the image as per BuildImage, and returns a BuildResult
+// with as many of its fields populated as the build got to, i.e. the ExitCode of
+// a failed docker build, along with any error
+func BuildImageWithResult(config BuildImageConfig) (*BuildResult, error) {
+	result := &BuildResult{FunctionName: config.FunctionName}
+	err := buildImage(config, result)
+	return result, err
+}
+
+// resolveBuildImage resolves and validates the image name and the extra tags
+// for config, and checks the registry's credentials when asked to
+func resolveBuildImage(config BuildImageConfig, result *BuildResult) (string, []string, error) {
+	imageName, err := ResolveImageName(config)
+	if err != nil {
+		return "", nil, err
+	}
+	result.Image = imageName
+
+	if err := ValidateImageReference(imageName); err != nil {
+		return "", nil, newBuildError(ErrImageInvalid, "%s", err.Error())
+	}
+
+	alsoTags, err := expandTagPatterns(config.AlsoTags)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if config.CheckRegistry && !config.ShrinkWrap {
+		if err := CheckRegistryAuth(imageName); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return imageName, alsoTags, nil
+}
+
+// validateBuild checks the flags of config which do not need docker
+func validateBuild(config BuildImageConfig) error {
+	if err := checkBuildFlags(config.BuildFlags); err != nil {
+		return err
+	}
+
+	if err := ValidateIsolation(config.Isolation); err != nil {
+		return err
+	}
+
+	if err := ValidateAddHosts(config.AddHosts); err != nil {
+		return err
+	}
 
-	if stack.IsValidTemplate(config.Language) {
-		pathToTemplateYAML := fmt.Sprintf("./template/%s/template.yml", config.Language)
-		if _, err := os.Stat(pathToTemplateYAML); os.IsNotExist(err) {
+	if err := ValidateExcludePaths(config.ExcludePaths); err != nil {
+		return err
+	}
+
+	if err := ValidateShrinkWrapCompression(config.ShrinkWrapCompression); err != nil {
+		return err
+	}
+
+	if len(config.ScanFailOn) > 0 {
+		if err := ValidateSeverity(config.ScanFailOn); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
+
+// prepareDockerBuild resolves the output, the docker binary and the features of
+// the daemon which config asks for, and returns the updated config along with
+// the SOURCE_DATE_EPOCH for a reproducible build. A shrink-wrapped build never
+// runs docker, so only its resources are checked.
+func prepareDockerBuild(config BuildImageConfig, result *BuildResult) (BuildImageConfig, string, error) {
+	if err := checkBuildResources(config); err != nil {
+		return config, "", err
+	}
 
-		langTemplate, err := stack.ParseYAMLForLanguageTemplate(pathToTemplateYAML)
+	// Resolved before the output replaces the one given
+	outputFlag := buildxFlag(config)
+
+	var sourceDateEpoch string
+	var err error
+	if !config.ShrinkWrap {
+		config.Output, sourceDateEpoch, err = resolveOutput(config, &result.Warnings)
 		if err != nil {
-			return fmt.Errorf("error reading language template: %s", err.Error())
+			return config, "", err
+		}
+	}
+
+	if config.ShrinkWrap {
+		return config, sourceDateEpoch, nil
+	}
+
+	config.DockerBinary, err = resolveDockerBinary(config.DockerBinary)
+	if err != nil {
+		return config, "", err
+	}
+
+	if len(config.DockerContext) > 0 {
+		if err := checkDockerContext(config); err != nil {
+			return config, "", err
+		}
+	}
+
+	if config.SmokeTest {
+		if err := checkSmokeTestDaemon(config); err != nil {
+			return config, "", err
 		}
+	}
+
+	if len(config.Output) > 0 {
+		if err := checkOutputSupport(config, outputFlag); err != nil {
+			return config, "", err
+		}
+	}
 
-		branch, version, err := GetImageTagValues(config.TagMode)
+	if config.Squash {
+		supported, err := checkSquashSupport(config, &result.Warnings)
 		if err != nil {
+			return config, "", err
+		}
+		config.Squash = supported
+	}
+
+	return config, sourceDateEpoch, nil
+}
+
+// buildImage builds the image for config, and populates result as it goes
+func buildImage(config BuildImageConfig, result *BuildResult) error {
+
+	config, err := applyOffline(applyWorkingDir(config))
+	if err != nil {
+		return err
+	}
+
+	if config.ContextReader != nil {
+		return buildFromReader(config, result)
+	}
+
+	templateDir := templateDirOrDefault(config.TemplateDir)
+
+	if stack.IsValidTemplateIn(templateDir, config.Language) {
+		langTemplate, err := readLanguageTemplate(templateDir, config.Language)
+		if err != nil {
+			return err
+		}
+
+		if err := checkTemplateLanguage(config.Language, langTemplate, config.StrictTemplate, &result.Warnings); err != nil {
+			return err
+		}
+
+		if err := checkMinCLIVersion(config.Language, langTemplate.MinFaaSCLIVersion); err != nil {
 			return err
 		}
 
-		imageName := schema.BuildImageName(config.TagMode, config.Image, version, branch)
+		config = withTemplateDefaults(config, langTemplate)
+
+		config.BuildArgMap = withTemplateBuildArgs(langTemplate.BuildArgs, config.BuildArgMap)
+		config.BuildArgMap = withBuildArgDefaults(config.BuildArgDefaults, config.BuildArgMap, config.BuildArgSecrets)
+		if err := checkRequiredBuildArgs(config.Language, langTemplate.RequiredBuildArgs, config.BuildArgMap); err != nil {
+			return err
+		}
+
+		// Validated before the build context is staged, so that a typo fails fast
+		buildOptPackages, buildPackageErr := getBuildOptionPackages(config.BuildOptions, config.Language, langTemplate.BuildOptions)
+
+		if buildPackageErr != nil {
+			return buildPackageErr
+
+		}
+
+		if config.VerifyTemplate && isLanguageTemplate(config.Language) {
+			if err := VerifyTemplateChecksum(path.Join(templateDir, config.Language)); err != nil {
+				return err
+			}
+		}
+
+		imageName, alsoTags, err := resolveBuildImage(config, result)
+		if err != nil {
+			return err
+		}
+
+		handler, cleanup, err := resolveHandler(config)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		config.Handler = handler
 
 		if err := ensureHandlerPath(config.Handler); err != nil {
-			return fmt.Errorf("building %s, %s is an invalid path", imageName, config.Handler)
+			return newBuildError(ErrHandlerInvalid, "building %s, %s is an invalid path", imageName, config.Handler)
+		}
+
+		if config.Verbose {
+			printDockerVersion(config)
 		}
 
-		tempPath, buildErr := createBuildContext(config.FunctionName, config.Handler, config.Language, isLanguageTemplate(config.Language), langTemplate.HandlerFolder, config.CopyExtraPaths)
-		fmt.Printf("Building: %s with %s template. Please wait..\n", imageName, config.Language)
+		handlerFolder, err := resolveHandlerFolder(config.HandlerFolderOverride, langTemplate.HandlerFolder)
+		if err != nil {
+			return err
+		}
+
+		if err := validateBuild(config); err != nil {
+			return err
+		}
+
+		var sourceDateEpoch string
+		config, sourceDateEpoch, err = prepareDockerBuild(config, result)
+		if err != nil {
+			return err
+		}
+
+		if err := runHooks(config.Context, "pre_build", config.FunctionName, config.Handler, config.PreBuild, nil, config.QuiteBuild); err != nil {
+			return interruptedOr(config, err)
+		}
+
+		useFunction, err := useTemplateOverlay(config)
+		if err != nil {
+			return err
+		}
+
+		tempPath, buildErr := createBuildContext(buildContextOptions{
+			FunctionName:      config.FunctionName,
+			Handler:           config.Handler,
+			TemplateDir:       templateDir,
+			Language:          config.Language,
+			UseFunction:       useFunction,
+			HandlerFolder:     handlerFolder,
+			CopyExtraPaths:    config.CopyExtraPaths,
+			CopyExtraScopes:   config.CopyExtraScopes,
+			ExcludePaths:      config.ExcludePaths,
+			HandlerFiles:      expectedHandlerFiles(config.Language, langTemplate.HandlerFiles),
+			DockerfileOverlay: config.DockerfileOverlay,
+			WorkingDir:        config.WorkingDir,
+			VerifyCopies:      config.VerifyCopies,
+			NoClear:           config.NoClear,
+			FreezeBaseImages:  config.FreezeBaseImages,
+			Verbose:           config.Verbose,
+			DockerBinary:      config.DockerBinary,
+			DockerContext:     config.DockerContext,
+			Warnings:          &result.Warnings,
+			Progress:          config.ProgressFunc,
+		})
+		printProgress(config.ProgressFunc, "Building: %s with %s template. Please wait..\n", imageName, config.Language)
 		if buildErr != nil {
 			return buildErr
 		}
+		result.ContextPath = tempPath
 
 		if config.ShrinkWrap {
-			fmt.Printf("%s shrink-wrapped to %s\n", config.FunctionName, tempPath)
+			printProgress(config.ProgressFunc, "%s shrink-wrapped to %s\n", config.FunctionName, tempPath)
+
+			if config.ShrinkWrapTar {
+				archive, err := archiveBuildContext(tempPath, config.ShrinkWrapCompression)
+				if err != nil {
+					return err
+				}
+				printProgress(config.ProgressFunc, "%s shrink-wrapped archive written to %s\n", config.FunctionName, archive)
+			}
 			return nil
 		}
 
-		buildOptPackages, buildPackageErr := getBuildOptionPackages(config.BuildOptions, config.Language, langTemplate.BuildOptions)
+		defer removeInterruptedContext(config, tempPath)
 
-		if buildPackageErr != nil {
-			return buildPackageErr
+		if len(config.ExportRootFS) > 0 {
+			if err := checkFinalStageExportable(filepath.Join(tempPath, "Dockerfile")); err != nil {
+				return err
+			}
+		}
 
+		buildArgMap, buildLabelMap, err := resolveBuildArgsAndLabels(config, sourceDateEpoch, &result.Warnings)
+		if err != nil {
+			return err
+		}
+
+		buildArgSecrets, err := readBuildArgSecrets(config.BuildArgSecrets, buildArgMap, config.Verbose)
+		if err != nil {
+			return err
 		}
 
-		dockerBuildVal := dockerBuild{
-			Image:            imageName,
-			NoCache:          config.NoCache,
-			Squash:           config.Squash,
-			HTTPProxy:        os.Getenv("http_proxy"),
-			HTTPSProxy:       os.Getenv("https_proxy"),
-			BuildArgMap:      config.BuildArgMap,
-			BuildOptPackages: buildOptPackages,
-			BuildLabelMap:    config.BuildLabelMap,
-			BuildFlags:       config.BuildFlags,
+		dockerBuildVal, err := withBuildCache(config, newDockerBuild(config, imageName, alsoTags, buildOptPackages, buildArgMap, buildLabelMap, buildArgSecrets))
+		if err != nil {
+			return err
 		}
 
 		command, args := getDockerBuildCommand(dockerBuildVal)
+		verbosePrintf(config.Verbose, "Build command: %s %s\n", command, strings.Join(redactBuildArgs(args, buildArgSecrets), " "))
+
+		env := buildArgSecretEnv(buildArgSecrets)
+		if len(sourceDateEpoch) > 0 {
+			env = append(env, fmt.Sprintf("%s=%s", sourceDateEpochEnv, sourceDateEpoch))
+		}
+		if config.InlineCache {
+			env = append(env, buildkitEnv+"=1")
+		}
 
 		task := v1execute.ExecTask{
 			Cwd:         tempPath,
 			Command:     command,
 			Args:        args,
+			Env:         env,
 			StreamStdio: !config.QuiteBuild,
 		}
 
-		res, err := task.Execute()
+		if err := checkInterrupted(config); err != nil {
+			return err
+		}
+
+		reportProgress(config.ProgressFunc, BuildEvent{Phase: PhaseBuildStarted, FunctionName: config.FunctionName, Path: tempPath, Image: imageName, Language: config.Language})
+		started := time.Now()
+
+		res, err := execTaskContext(config.Context, task)
+		duration := time.Since(started)
+		reportProgress(config.ProgressFunc, BuildEvent{Phase: PhaseBuildFinished, FunctionName: config.FunctionName, Path: tempPath, Image: imageName, Language: config.Language, ExitCode: finishedExitCode(res, err), Duration: duration})
+
+		if interruptErr := checkInterrupted(config); interruptErr != nil {
+			return interruptErr
+		}
 
 		if err != nil {
 			return err
 		}
 
+		result.ExitCode, result.Duration = res.ExitCode, duration
+
 		if res.ExitCode != 0 {
-			return fmt.Errorf("[%s] received non-zero exit code from build, error: %s", config.FunctionName, res.Stderr)
+			return &BuildFailedError{FunctionName: config.FunctionName, ExitCode: res.ExitCode, Stderr: buildFailureOutput(res)}
+		}
+
+		if len(config.CacheDir) > 0 {
+			if err := commitCache(config.CacheDir, config.FunctionName); err != nil {
+				return err
+			}
 		}
 
-		fmt.Printf("Image: %s built.\n", imageName)
+		postBuildEnv, err := completeBuild(config, imageName, result)
+		if err != nil {
+			return err
+		}
+		if err := runHooks(config.Context, "post_build", config.FunctionName, config.Handler, config.PostBuild, postBuildEnv, config.QuiteBuild); err != nil {
+			return interruptedOr(config, err)
+		}
 
 	} else {
-		return fmt.Errorf("language template: %s not supported, build a custom Dockerfile", config.Language)
+		if err := templateParseError(templateDir, config.Language); err != nil {
+			return err
+		}
+		return newBuildError(ErrTemplateNotSupported, "language template: %s not supported, build a custom Dockerfile", config.Language)
 	}
 
 	return nil
 }
 
+// completeBuild scans and smoke tests the image built for config, finds its
+// digest and reports its success, returning the environment for the PostBuild hooks
+func completeBuild(config BuildImageConfig, imageName string, result *BuildResult) ([]string, error) {
+	if len(config.Output) > 0 && !outputLoadsImage(config.Output) {
+		if config.Scan {
+			warn(&result.Warnings, WarnScanSkipped, "unable to scan %s, it was not loaded into the Docker daemon", imageName)
+		}
+		if config.SmokeTest {
+			warn(&result.Warnings, WarnSmokeTestSkipped, "unable to smoke test %s, it was not loaded into the Docker daemon", imageName)
+		}
+	} else {
+		if err := scanImage(config, imageName, &result.Warnings); err != nil {
+			return nil, interruptedOr(config, err)
+		}
+		if err := smokeTest(config, imageName); err != nil {
+			return nil, interruptedOr(config, err)
+		}
+	}
+
+	postBuildEnv := []string{fmt.Sprintf("%s=%s", hookImageEnv, imageName)}
+
+	if len(config.Output) > 0 && !outputLoadsImage(config.Output) {
+		// The image is not loaded into the daemon, so there is no digest to inspect
+		result.Output = config.Output
+		if err := reportSuccess(config.Context, config.OnSuccess, *result); err != nil {
+			return nil, err
+		}
+		return postBuildEnv, nil
+	}
+
+	digest, digestErr := getImageDigest(config, imageName)
+	if digestErr == nil {
+		result.Digest = digest
+	} else {
+		recordWarning(&result.Warnings, WarnDigestUnavailable, "unable to find the digest of %s: %s", imageName, digestErr.Error())
+	}
+
+	if err := reportSuccess(config.Context, config.OnSuccess, *result); err != nil {
+		return nil, err
+	}
+
+	if digestErr != nil {
+		printProgress(config.ProgressFunc, "Warning: unable to find the digest of %s: %s\n", imageName, digestErr.Error())
+	} else {
+		printProgress(config.ProgressFunc, "Image digest: %s\n", digest)
+		postBuildEnv = append(postBuildEnv, fmt.Sprintf("%s=%s", hookImageDigestEnv, digest))
+	}
+
+	return postBuildEnv, nil
+}
+
+// resolveOutput returns the buildx output for config, from Output, ExportRootFS,
+// Reproducible, CacheDir and Annotations, along with the SOURCE_DATE_EPOCH for a
+// reproducible build. Annotations are ignored with a warning when the classic
+// builder is used.
+func resolveOutput(config BuildImageConfig, warnings *[]Warning) (output, sourceDateEpoch string, err error) {
+	output, err = outputInWorkingDir(config.WorkingDir, config.Output)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(config.ExportRootFS) > 0 {
+		if len(output) > 0 {
+			return "", "", fmt.Errorf("--export-rootfs cannot be used with --output")
+		}
+
+		output, err = rootFSOutput(config.ExportRootFS)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if config.Reproducible {
+		sourceDateEpoch, err = getSourceDateEpoch()
+		if err != nil {
+			return "", "", err
+		}
+		output = reproducibleOutput(output)
+	}
+
+	// A cache is only exported by buildx, which must then load the image
+	if len(config.CacheDir) > 0 && len(output) == 0 {
+		output = "type=docker"
+	}
+
+	if len(config.Annotations) > 0 {
+		if len(output) == 0 {
+			warn(warnings, WarnAnnotationsIgnored, "annotations require buildx, set --output to build %s with buildx, the annotations are ignored", config.FunctionName)
+		} else {
+			output = annotatedOutput(output, config.Annotations)
+		}
+	}
+
+	return output, sourceDateEpoch, nil
+}
+
+// resolveBuildArgsAndLabels returns the build-args and labels passed to docker for
+// config, with SOURCE_DATE_EPOCH added when sourceDateEpoch is given
+func resolveBuildArgsAndLabels(config BuildImageConfig, sourceDateEpoch string, warnings *[]Warning) (map[string]string, map[string]string, error) {
+	buildLabelMap := config.BuildLabelMap
+	if config.GitLabels {
+		buildLabelMap = withGitLabels(buildLabelMap)
+	}
+	if config.GitDirtyLabel {
+		buildLabelMap = withGitDirtyLabel(buildLabelMap)
+	}
+
+	buildArgMap := config.BuildArgMap
+	if !config.KeepBuildArgWhitespace {
+		buildArgMap = trimBuildArgValues(buildArgMap, warnings)
+	}
+
+	if config.ExpandBuildArgs {
+		expanded, err := expandBuildArgs(buildArgMap, config.FunctionName, config.DescribeAlwaysDirty)
+		if err != nil {
+			return nil, nil, err
+		}
+		buildArgMap = expanded
+	}
+
+	if len(sourceDateEpoch) > 0 {
+		buildArgMap, buildLabelMap = withSourceDateEpoch(sourceDateEpoch, buildArgMap, buildLabelMap, warnings)
+	}
+
+	return buildArgMap, buildLabelMap, nil
+}
+
+// newDockerBuild returns the options for "docker build" of imageName from config
+func newDockerBuild(config BuildImageConfig, imageName string, alsoTags, buildOptPackages []string, buildArgMap, buildLabelMap, buildArgSecrets map[string]string) dockerBuild {
+	return dockerBuild{
+		Image:            imageName,
+		NoCache:          config.NoCache,
+		Squash:           config.Squash,
+		Pull:             config.Pull,
+		Compress:         config.Compress,
+		Isolation:        config.Isolation,
+		AddHosts:         config.AddHosts,
+		BuildNetwork:     config.BuildNetwork,
+		HTTPProxy:        os.Getenv("http_proxy"),
+		HTTPSProxy:       os.Getenv("https_proxy"),
+		SkipProxy:        config.SkipProxy,
+		BuildArgMap:      buildArgMap,
+		BuildOptPackages: buildOptPackages,
+		BuildLabelMap:    buildLabelMap,
+		BuildFlags:       config.BuildFlags,
+		ExtraTags:        append(append([]string{}, config.ExtraTags...), alsoTags...),
+		BuildArgSecrets:  buildArgSecrets,
+		Output:           config.Output,
+		Memory:           config.BuildMemory,
+		CPUs:             config.BuildCPUs,
+		Ulimits:          config.Ulimits,
+		DockerBinary:     config.DockerBinary,
+		DockerContext:    config.DockerContext,
+	}
+}
+
+// CreateBuildContext stages the build context for config in ./build/<function>/,
+// within the WorkingDir when it is set, and returns its path, without running docker.
+// The template is copied, then the handler and any extra paths are overlaid, as per
+// a shrink-wrap build.
+func CreateBuildContext(config BuildImageConfig) (string, error) {
+	config, err := applyOffline(applyWorkingDir(config))
+	if err != nil {
+		return "", err
+	}
+
+	templateDir := templateDirOrDefault(config.TemplateDir)
+
+	if !stack.IsValidTemplateIn(templateDir, config.Language) {
+		if err := templateParseError(templateDir, config.Language); err != nil {
+			return "", err
+		}
+		return "", newBuildError(ErrTemplateNotSupported, "language template: %s not supported, build a custom Dockerfile", config.Language)
+	}
+
+	langTemplate, err := readLanguageTemplate(templateDir, config.Language)
+	if err != nil {
+		return "", err
+	}
+
+	handler, cleanup, err := resolveHandler(config)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	if err := ensureHandlerPath(handler); err != nil {
+		return "", newBuildError(ErrHandlerInvalid, "%s is an invalid path", handler)
+	}
+
+	handlerFolder, err := resolveHandlerFolder(config.HandlerFolderOverride, langTemplate.HandlerFolder)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ValidateExcludePaths(config.ExcludePaths); err != nil {
+		return "", err
+	}
+
+	config.Handler = handler
+	useFunction, err := useTemplateOverlay(config)
+	if err != nil {
+		return "", err
+	}
+
+	return createBuildContext(buildContextOptions{
+		FunctionName:      config.FunctionName,
+		Handler:           handler,
+		TemplateDir:       templateDir,
+		Language:          config.Language,
+		UseFunction:       useFunction,
+		HandlerFolder:     handlerFolder,
+		CopyExtraPaths:    config.CopyExtraPaths,
+		CopyExtraScopes:   config.CopyExtraScopes,
+		ExcludePaths:      config.ExcludePaths,
+		HandlerFiles:      expectedHandlerFiles(config.Language, langTemplate.HandlerFiles),
+		DockerfileOverlay: config.DockerfileOverlay,
+		WorkingDir:        config.WorkingDir,
+		VerifyCopies:      config.VerifyCopies,
+		NoClear:           config.NoClear,
+		FreezeBaseImages:  config.FreezeBaseImages,
+		Verbose:           config.Verbose,
+		DockerBinary:      config.DockerBinary,
+		DockerContext:     config.DockerContext,
+		Progress:          config.ProgressFunc,
+	})
+}
+
+// useTemplateOverlay returns true when the handler is overlaid onto a language
+// template. With NoTemplateOverlay, the handler is the whole build context, so it
+// must contain a Dockerfile.
+func useTemplateOverlay(config BuildImageConfig) (bool, error) {
+	if !config.NoTemplateOverlay {
+		return isLanguageTemplate(config.Language), nil
+	}
+
+	dockerfile := filepath.Join(config.Handler, "Dockerfile")
+	if info, err := os.Stat(dockerfile); err != nil || info.IsDir() {
+		return false, newBuildError(ErrHandlerInvalid, "--no-template-overlay requires a Dockerfile in the handler, %s was not found", dockerfile)
+	}
+
+	return false, nil
+}
+
+// templateDirOrDefault returns templateDir, or stack.DefaultTemplateDir when it is empty
+func templateDirOrDefault(templateDir string) string {
+	if len(templateDir) == 0 {
+		return stack.DefaultTemplateDir
+	}
+	return templateDir
+}
+
+// readLanguageTemplate reads the template.yml of the language template, merged with
+// the templates that it extends
+func readLanguageTemplate(templateDir, language string) (*stack.LanguageTemplate, error) {
+	pathToTemplateYAML := path.Join(templateDir, language, "template.yml")
+	if _, err := os.Stat(pathToTemplateYAML); os.IsNotExist(err) {
+		return nil, err
+	}
+
+	langTemplate, err := resolveLanguageTemplate(templateDir, language)
+	if err != nil {
+		return nil, newBuildError(ErrTemplateInvalid, "error reading language template: %s", err.Error())
+	}
+
+	return langTemplate, nil
+}
+
+// templateParseError returns the error from reading the template.yml of language
+// when the file exists but cannot be parsed, so that it is reported rather than the
+// template being treated as unsupported
+func templateParseError(templateDir, language string) error {
+	if _, err := readLanguageTemplate(templateDir, language); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// checkTemplateLanguage compares the language declared in a template.yml with the
+// requested language, to catch a template which was copied or pulled into the wrong
+// folder. A template for go may be named golang-middleware, so either one being a
+// prefix of the other is a match. A mismatch is a warning, or an error when strict.
+func checkTemplateLanguage(language string, langTemplate *stack.LanguageTemplate, strict bool, warnings *[]Warning) error {
+	declared := strings.ToLower(strings.TrimSpace(langTemplate.Language))
+	requested := strings.ToLower(language)
+
+	if len(declared) == 0 || strings.HasPrefix(requested, declared) || strings.HasPrefix(declared, requested) {
+		return nil
+	}
+
+	message := fmt.Sprintf("the template for %s declares the language %q in its template.yml, check that the right template was pulled", language, langTemplate.Language)
+	if strict {
+		return newBuildError(ErrTemplateInvalid, "%s", message)
+	}
+
+	warn(warnings, WarnTemplateLanguage, "%s", message)
+	return nil
+}
+
+// resolveHandler returns the path to the handler of config, cloning it first when
+// it is a Git URL. The cleanup function removes the clone, unless KeepTemp is set.
+func resolveHandler(config BuildImageConfig) (string, func(), error) {
+	if !isRemoteHandler(config.Handler) {
+		return config.Handler, func() {}, nil
+	}
+
+	clonePath, err := fetchRemoteHandler(config.Handler)
+	if err != nil {
+		return "", nil, newBuildError(ErrHandlerInvalid, "%s", err.Error())
+	}
+
+	if config.KeepTemp {
+		printProgress(config.ProgressFunc, "Keeping cloned handler: %s\n", clonePath)
+		return clonePath, func() {}, nil
+	}
+
+	return clonePath, func() { os.RemoveAll(clonePath) }, nil
+}
+
+// applyOffline disables the options of config which need network access when
+// config.Offline is set
+func applyOffline(config BuildImageConfig) (BuildImageConfig, error) {
+	if !config.Offline {
+		return config, nil
+	}
+
+	if config.Pull {
+		return config, fmt.Errorf("--pull cannot be used with --offline")
+	}
+
+	if isRemoteHandler(config.Handler) {
+		return config, fmt.Errorf("a handler from a Git URL cannot be used with --offline: %s", config.Handler)
+	}
+
+	config.SkipProxy = true
+	config.GitLabels = false
+	config.GitDirtyLabel = false
+
+	return config, nil
+}
+
+// ResolveImageName returns the image name and tag that BuildImage will produce for
+// the config, without building anything
+func ResolveImageName(config BuildImageConfig) (string, error) {
+	branch, version, err := GetImageTagValuesWithFallback(config.TagMode, config.DescribeAlwaysDirty, config.AllowNoVCS, config.FallbackVersion)
+	if err != nil {
+		return "", err
+	}
+
+	return schema.BuildImageName(config.TagMode, config.Image, version, branch), nil
+}
+
+// Git lookups used to compute image tags, these can be replaced in tests
+var (
+	getGitSHA      = vcs.GetGitSHA
+	getGitBranch   = vcs.GetGitBranch
+	getGitDescribe = vcs.GetGitDescribe
+	getGitDirty    = vcs.IsGitDirty
+
+	getGitCommitTime = vcs.GetGitCommitTime
+)
+
+// noVCSBranch is used in place of the Git branch when a fallback version is in use
+const noVCSBranch = "novcs"
+
 // GetImageTagValues returns the image tag format and component information determined via GIT
 func GetImageTagValues(tagType schema.BuildFormat) (branch, version string, err error) {
+	return GetImageTagValuesWithDescribe(tagType, false)
+}
+
+// GetImageTagValuesWithDescribe behaves like GetImageTagValues, describeAlwaysDirty
+// applies to DescribeFormat, see describeVersion
+func GetImageTagValuesWithDescribe(tagType schema.BuildFormat, describeAlwaysDirty bool) (branch, version string, err error) {
 	switch tagType {
 	case schema.SHAFormat:
-		version = vcs.GetGitSHA()
+		version = getGitSHA()
 		if len(version) == 0 {
 			err = fmt.Errorf("cannot tag image with Git SHA as this is not a Git repository")
 			return
 		}
 	case schema.BranchAndSHAFormat:
-		branch = vcs.GetGitBranch()
+		branch = getGitBranch()
 		if len(branch) == 0 {
 			err = fmt.Errorf("cannot tag image with Git branch and SHA as this is not a Git repository")
 			return
 
 		}
 
-		version = vcs.GetGitSHA()
+		version = getGitSHA()
 		if len(version) == 0 {
 			err = fmt.Errorf("cannot tag image with Git SHA as this is not a Git repository")
 			return
 
 		}
 	case schema.DescribeFormat:
-		version = vcs.GetGitDescribe()
+		version = describeVersion(describeAlwaysDirty)
 		if len(version) == 0 {
 			err = fmt.Errorf("cannot tag image with Git Tag and SHA as this is not a Git repository")
 			return
@@ -157,29 +1061,132 @@ func GetImageTagValues(tagType schema.BuildFormat) (branch, version string, err
 	return branch, version, nil
 }
 
+// describeVersion returns the output of git-describe. With alwaysDirty, the short SHA
+// is included even when HEAD is exactly on a tag, as per git describe --long, and
+// -dirty is appended when there are uncommitted changes, so that an image cannot be
+// mistaken for a clean build of an older tag.
+func describeVersion(alwaysDirty bool) string {
+	describe := getGitDescribe()
+	if !alwaysDirty || len(describe) == 0 {
+		return describe
+	}
+
+	// Without any tags, --always gives the short SHA on its own
+	sha := getGitSHA()
+	if len(sha) > 0 && describe != sha && !strings.HasSuffix(describe, "-g"+sha) {
+		describe = describe + "-0-g" + sha
+	}
+
+	if getGitDirty() {
+		describe = describe + "-dirty"
+	}
+
+	return describe
+}
+
+// GetImageTagValuesWithFallback behaves like GetImageTagValues, but when allowNoVCS is set
+// and the Git metadata cannot be read, fallbackVersion is used as the version instead of
+// returning an error. A fallbackVersion is required when allowNoVCS is set.
+func GetImageTagValuesWithFallback(tagType schema.BuildFormat, describeAlwaysDirty bool, allowNoVCS bool, fallbackVersion string) (branch, version string, err error) {
+	branch, version, err = GetImageTagValuesWithDescribe(tagType, describeAlwaysDirty)
+	if err == nil || !allowNoVCS {
+		return branch, version, err
+	}
+
+	if len(fallbackVersion) == 0 {
+		return "", "", fmt.Errorf("%s, and no fallback version was provided", err.Error())
+	}
+
+	if tagType == schema.BranchAndSHAFormat {
+		branch = noVCSBranch
+	}
+
+	return branch, fallbackVersion, nil
+}
+
+// getDockerBuildCommand returns the command for a classic "docker build", or for
+// "docker buildx build" when an Output is given, as only BuildKit supports --output.
+// Without --load, buildx writes the image to the Output rather than to the daemon,
+// with the tags used to name the image within it.
 func getDockerBuildCommand(build dockerBuild) (string, []string) {
 	flagSlice := buildFlagSlice(build)
-	args := []string{"build"}
+
+	// --context is a flag of docker itself, so must come before the build command
+	args := []string{}
+	if len(build.DockerContext) > 0 {
+		args = append(args, "--context", build.DockerContext)
+	}
+
+	if len(build.Output) > 0 {
+		args = append(args, "buildx")
+	}
+	args = append(args, "build")
 	args = append(args, flagSlice...)
 
-	args = append(args, "--tag", build.Image, ".")
+	for _, tag := range getImageTags(build) {
+		args = append(args, "--tag", tag)
+	}
+
+	if build.ContextFromStdin {
+		args = append(args, "-")
+	} else {
+		args = append(args, ".")
+	}
 
 	command := "docker"
+	if len(build.DockerBinary) > 0 {
+		command = build.DockerBinary
+	}
 
 	return command, args
 }
 
+// getImageTags returns the primary image followed by the image with each of the
+// ExtraTags applied, i.e. an extra tag of "latest" for "fn:0.1.0" gives "fn:latest"
+func getImageTags(build dockerBuild) []string {
+	tags := []string{build.Image}
+
+	for _, t := range build.ExtraTags {
+		var tag string
+		if i := strings.LastIndex(build.Image, ":"); i > -1 {
+			tag = applyTag(i, build.Image, t)
+		} else {
+			tag = applyTag(len(build.Image), build.Image, t)
+		}
+
+		if tag != build.Image {
+			tags = append(tags, tag)
+		}
+	}
+
+	return deDuplicate(tags)
+}
+
 type dockerBuild struct {
 	Image            string
 	Version          string
 	NoCache          bool
 	Squash           bool
+	Pull             bool
+	Compress         bool
 	HTTPProxy        string
 	HTTPSProxy       string
 	BuildArgMap      map[string]string
 	BuildOptPackages []string
 	BuildLabelMap    map[string]string
 
+	// SkipProxy disables forwarding of HTTPProxy and HTTPSProxy
+	SkipProxy bool
+
+	// Isolation sets the isolation technology for Windows containers
+	Isolation string
+
+	// AddHosts are passed as --add-host, each in the form host:ip
+	AddHosts []string
+
+	// BuildNetwork is passed as --network for the RUN instructions of the build
+	BuildNetwork string
+
 	// Optional flags
 	BuildFlags []string
 
@@ -188,134 +1195,387 @@ type dockerBuild struct {
 
 	// ExtraTags for published images like :latest
 	ExtraTags []string
+
+	// BuildArgSecrets are passed as "--build-arg KEY" with the value in the
+	// environment of docker, so that it is not shown on the command line
+	BuildArgSecrets map[string]string
+
+	// Output is passed as --output and requires buildx, i.e. type=oci,dest=fn.tar
+	Output string
+
+	// DockerContext is passed to docker as --context, before the build command
+	DockerContext string
+
+	// ContextFromStdin passes "-" as the build context, for docker to read a tar
+	// stream from stdin
+	ContextFromStdin bool
+
+	// Memory and CPUs limit the resources of the classic builder, CPUs is passed
+	// as --cpu-period and --cpu-quota
+	Memory string
+	CPUs   string
+
+	// Ulimits are each passed as --ulimit to the classic builder
+	Ulimits []string
+
+	// CacheFrom and CacheTo are passed to docker as --cache-from and --cache-to
+	CacheFrom string
+	CacheTo   string
+
+	// DockerBinary is the command for the build, "docker" when empty
+	DockerBinary string
 }
 
 var defaultDirPermissions os.FileMode = 0700
 
+// ciDirPermissions are used for the build folder when running in CI, so that
+// other users on shared runners can read the build context
+const ciDirPermissions os.FileMode = 0755
+
+// buildDirPermEnvironment overrides the permissions of the build folder with an
+// octal value, i.e. 0777 for runners which build as a different user
+const buildDirPermEnvironment = "FAAS_BUILD_DIR_PERM"
+
 const defaultHandlerFolder string = "function"
 
-// isRunningInCI checks the ENV var CI and returns true if it's set to true or 1
-func isRunningInCI() bool {
-	if env, ok := os.LookupEnv("CI"); ok {
-		if env == "true" || env == "1" {
-			return true
+// buildDirPermissions returns the permissions for the build folder, from the
+// FAAS_BUILD_DIR_PERM environment variable when set, or based upon config.IsRunningInCI
+func buildDirPermissions() (os.FileMode, error) {
+	if value, ok := os.LookupEnv(buildDirPermEnvironment); ok && len(value) > 0 {
+		perm, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || perm > 0777 {
+			return 0, fmt.Errorf("invalid %s: %q, must be an octal permission such as 0755", buildDirPermEnvironment, value)
 		}
+		return os.FileMode(perm), nil
 	}
-	return false
+
+	if config.IsRunningInCI() {
+		return ciDirPermissions, nil
+	}
+
+	return defaultDirPermissions, nil
+}
+
+// resolveTemplatePath returns the path to the language template with any symlinks
+// resolved, so that a symlinked ./template folder is copied as real files
+func resolveTemplatePath(templateDir, language string) (string, error) {
+	return filepath.EvalSymlinks(path.Join(templateDir, language))
+}
+
+// buildContextOptions are the inputs to createBuildContext, resolved from a
+// BuildImageConfig and its language template
+type buildContextOptions struct {
+	FunctionName string
+	Handler      string
+	TemplateDir  string
+	Language     string
+
+	// UseFunction copies the template, with the handler in HandlerFolder, or
+	// defaultHandlerFolder when it is empty
+	UseFunction   bool
+	HandlerFolder string
+
+	// CopyExtraPaths are copied into the context, each must be within one of
+	// CopyExtraScopes, which defaults to WorkingDir or the current directory
+	CopyExtraPaths  []string
+	CopyExtraScopes []string
+
+	// ExcludePaths are not copied from the handler
+	ExcludePaths []string
+
+	// HandlerFiles are the files expected by the template, a warning is given when
+	// the handler contains none of them
+	HandlerFiles []string
+
+	// DockerfileOverlay, relative to the handler, is merged into the template's
+	// Dockerfile
+	DockerfileOverlay string
+
+	// WorkingDir is the folder the build folder is created within
+	WorkingDir string
+
+	VerifyCopies     bool
+	NoClear          bool
+	FreezeBaseImages bool
+	Verbose          bool
+
+	// DockerBinary and DockerContext resolve the digests of the base images for
+	// FreezeBaseImages
+	DockerBinary  string
+	DockerContext string
+
+	// Warnings collects the warnings given, when it is not nil
+	Warnings *[]Warning
+
+	// Progress is sent milestones, when it is not nil
+	Progress func(event BuildEvent)
 }
 
 // createBuildContext creates temporary build folder to perform a Docker build with language template
-func createBuildContext(functionName string, handler string, language string, useFunction bool, handlerFolder string, copyExtraPaths []string) (string, error) {
-	tempPath := fmt.Sprintf("./build/%s/", functionName)
-	fmt.Printf("Clearing temporary build folder: %s\n", tempPath)
+// when Verbose is set, each source and destination that is copied into the context is printed.
+// Files and folders of the handler which match one of ExcludePaths are not copied, and a
+// warning is printed when the handler contains none of HandlerFiles. The DockerfileOverlay,
+// relative to the handler, is merged into the template's Dockerfile. Each of CopyExtraPaths
+// must be within one of CopyExtraScopes, which defaults to the current directory. Milestones
+// are reported to Progress when it is not nil. The build folder is created within
+// WorkingDir, which is also the default scope, when it is set. Each copied file is
+// checked against its size, and its checksum when VerifyCopies is set. With NoClear, the
+// context is staged separately and merged into the existing build folder with
+// updateBuildContext, rather than the build folder being cleared.
+func createBuildContext(opts buildContextOptions) (string, error) {
+	tempPath := buildContextPath(opts.WorkingDir, opts.FunctionName)
+
+	if opts.NoClear {
+		contextPath := tempPath
+		tempPath = stagingPath(contextPath)
+		defer os.RemoveAll(tempPath)
+
+		printProgress(opts.Progress, "Updating build folder: %s\n", contextPath)
+	} else {
+		printProgress(opts.Progress, "Clearing temporary build folder: %s\n", tempPath)
+	}
 
 	clearErr := os.RemoveAll(tempPath)
 	if clearErr != nil {
-		fmt.Printf("Error clearing temporary build folder: %s\n", tempPath)
+		printProgress(opts.Progress, "Error clearing temporary build folder: %s\n", tempPath)
 		return tempPath, clearErr
 	}
+	reportProgress(opts.Progress, BuildEvent{Phase: PhaseContextCleared, FunctionName: opts.FunctionName, Path: tempPath})
 
 	functionPath := tempPath
 
-	if useFunction {
-		if handlerFolder == "" {
+	if opts.UseFunction {
+		if opts.HandlerFolder == "" {
 			functionPath = path.Join(functionPath, defaultHandlerFolder)
 		} else {
-			functionPath = path.Join(functionPath, handlerFolder)
+			functionPath = path.Join(functionPath, opts.HandlerFolder)
 		}
 	}
 
-	fmt.Printf("Preparing: %s %s\n", handler+"/", functionPath)
+	printProgress(opts.Progress, "Preparing: %s %s\n", opts.Handler+"/", functionPath)
 
-	if isRunningInCI() {
-		defaultDirPermissions = 0777
+	dirPermissions, err := buildDirPermissions()
+	if err != nil {
+		return tempPath, err
 	}
 
-	mkdirErr := os.MkdirAll(functionPath, defaultDirPermissions)
+	mkdirErr := os.MkdirAll(functionPath, dirPermissions)
 	if mkdirErr != nil {
-		fmt.Printf("Error creating path: %s - %s.\n", functionPath, mkdirErr.Error())
+		printProgress(opts.Progress, "Error creating path: %s - %s.\n", functionPath, mkdirErr.Error())
 		return tempPath, mkdirErr
 	}
 
-	if useFunction {
-		copyErr := CopyFiles(path.Join("./template/", language), tempPath)
+	if opts.UseFunction {
+		templatePath, err := resolveTemplatePath(opts.TemplateDir, opts.Language)
+		if err != nil {
+			printProgress(opts.Progress, "Error resolving template directory: %s.\n", err.Error())
+			return tempPath, err
+		}
+		verbosePrintf(opts.Verbose, "Copying template: %s -> %s\n", templatePath, tempPath)
+
+		copyErr := copyFiles(templatePath, tempPath, opts.VerifyCopies)
 		if copyErr != nil {
-			fmt.Printf("Error copying template directory: %s.\n", copyErr.Error())
+			printProgress(opts.Progress, "Error copying template directory: %s.\n", copyErr.Error())
 			return tempPath, copyErr
 		}
+		reportProgress(opts.Progress, BuildEvent{Phase: PhaseTemplateCopied, FunctionName: opts.FunctionName, Path: tempPath})
 	}
 
 	// Overlay in user-function
 	// CopyFiles(handler, functionPath)
-	infos, readErr := ioutil.ReadDir(handler)
+	infos, readErr := ioutil.ReadDir(opts.Handler)
 	if readErr != nil {
-		fmt.Printf("Error reading the handler: %s - %s.\n", handler, readErr.Error())
+		printProgress(opts.Progress, "Error reading the handler: %s - %s.\n", opts.Handler, readErr.Error())
 		return tempPath, readErr
 	}
 
 	for _, info := range infos {
 		switch info.Name() {
 		case "build", "template":
-			fmt.Printf("Skipping \"%s\" folder\n", info.Name())
+			printProgress(opts.Progress, "Skipping \"%s\" folder\n", info.Name())
+			verbosePrintf(opts.Verbose, "Skipped: %s\n", filepath.Clean(path.Join(opts.Handler, info.Name())))
 			continue
 		default:
-			copyErr := CopyFiles(
-				filepath.Clean(path.Join(handler, info.Name())),
-				filepath.Clean(path.Join(functionPath, info.Name())),
-			)
+			src := filepath.Clean(path.Join(opts.Handler, info.Name()))
+			if isExcludedPath(info.Name(), opts.ExcludePaths) {
+				printProgress(opts.Progress, "Excluding \"%s\"\n", info.Name())
+				verbosePrintf(opts.Verbose, "Skipped: %s\n", src)
+				continue
+			}
 
+			dest := filepath.Clean(path.Join(functionPath, info.Name()))
+			verbosePrintf(opts.Verbose, "Copying: %s -> %s\n", src, dest)
+
+			copyErr := copyFilesExcluding(src, dest, info.Name(), opts.ExcludePaths, opts.VerifyCopies)
 			if copyErr != nil {
 				return tempPath, copyErr
 			}
 		}
 	}
 
-	for _, extraPath := range copyExtraPaths {
-		extraPathAbs, err := pathInScope(extraPath, ".")
+	if opts.UseFunction {
+		warnMissingHandlerFiles(opts.Handler, opts.HandlerFiles, opts.ExcludePaths, opts.Warnings, opts.Progress)
+	}
+
+	if len(opts.DockerfileOverlay) > 0 {
+		if !opts.UseFunction {
+			return tempPath, fmt.Errorf("dockerfile_overlay is only supported for language templates, edit the Dockerfile in the handler instead")
+		}
+
+		overlayPath, err := pathInScope(filepath.Join(opts.Handler, opts.DockerfileOverlay), opts.Handler)
 		if err != nil {
 			return tempPath, err
 		}
+		verbosePrintf(opts.Verbose, "Applying Dockerfile overlay: %s\n", overlayPath)
+
+		if err := overlayDockerfile(tempPath, overlayPath); err != nil {
+			return tempPath, err
+		}
+	}
+
+	projectRoot := "."
+	if len(opts.WorkingDir) > 0 {
+		projectRoot = opts.WorkingDir
+	}
+
+	copyExtraScopes := opts.CopyExtraScopes
+	if len(copyExtraScopes) == 0 {
+		copyExtraScopes = []string{projectRoot}
+	}
+
+	for _, extraPath := range opts.CopyExtraPaths {
+		extraPathAbs, err := pathInScope(extraPath, copyExtraScopes...)
+		if err != nil {
+			return tempPath, err
+		}
+
+		extraPathDest, err := copyExtraDestination(extraPathAbs, projectRoot, copyExtraScopes)
+		if err != nil {
+			return tempPath, err
+		}
+
 		// Note that if useFunction is false, ie is a `dockerfile` template, then
 		// functionPath == tempPath, the docker build context, not the `function` handler folder
 		// inside the docker build context
-		copyErr := CopyFiles(
-			extraPathAbs,
-			filepath.Clean(path.Join(functionPath, extraPath)),
-		)
+		dest := filepath.Clean(path.Join(functionPath, filepath.ToSlash(extraPathDest)))
+		verbosePrintf(opts.Verbose, "Copying extra path: %s (%s) -> %s\n", extraPath, extraPathAbs, dest)
+
+		copyErr := copyFiles(extraPathAbs, dest, opts.VerifyCopies)
 
 		if copyErr != nil {
 			return tempPath, copyErr
 		}
 	}
 
+	manifestPath := buildManifestPath(opts.WorkingDir, opts.FunctionName)
+	if opts.FreezeBaseImages {
+		docker := BuildImageConfig{FunctionName: opts.FunctionName, DockerBinary: opts.DockerBinary, DockerContext: opts.DockerContext, Verbose: opts.Verbose}
+		if err := freezeBaseImages(docker, tempPath, manifestPath, opts.Warnings); err != nil {
+			return tempPath, err
+		}
+		printProgress(opts.Progress, "Froze base images, see: %s\n", manifestPath)
+	} else if err := os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+		return tempPath, err
+	}
+
+	if opts.NoClear {
+		contextPath := buildContextPath(opts.WorkingDir, opts.FunctionName)
+
+		changes, err := updateBuildContext(tempPath, contextPath)
+		if err != nil {
+			return contextPath, fmt.Errorf("error updating build folder: %s - %s", contextPath, err.Error())
+		}
+		verbosePrintf(opts.Verbose, "Updated build folder: %d added, %d updated, %d removed\n", len(changes.Added), len(changes.Updated), len(changes.Removed))
+
+		return contextPath, nil
+	}
+
 	return tempPath, nil
 }
 
-// pathInScope returns the absolute path to `path` and ensures that it is located within the
-// provided scope. An error will be returned, if the path is outside of the provided scope.
-func pathInScope(path string, scope string) (string, error) {
-	scope, err := filepath.Abs(filepath.FromSlash(scope))
-	if err != nil {
-		return "", err
+// verbosePrintf prints the formatted message only when verbose output is enabled
+func verbosePrintf(verbose bool, format string, a ...interface{}) {
+	if verbose {
+		fmt.Printf(format, a...)
 	}
+}
 
+// resolveHandlerFolder returns the folder the function's code is copied into, an override
+// takes precedence over the template's value. An empty value means defaultHandlerFolder.
+func resolveHandlerFolder(override, templateFolder string) (string, error) {
+	if len(override) == 0 {
+		return templateFolder, nil
+	}
+
+	cleaned := filepath.Clean(filepath.FromSlash(override))
+	if filepath.IsAbs(cleaned) || cleaned == "." || cleaned == ".." ||
+		strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("handler folder override must be a relative path within the build context: %s", override)
+	}
+
+	return filepath.ToSlash(cleaned), nil
+}
+
+// pathInScope returns the absolute path to `path` and ensures that it is located within one
+// of the provided scopes. An error will be returned, if the path is outside of every scope.
+func pathInScope(path string, scopes ...string) (string, error) {
 	abs, err := filepath.Abs(filepath.FromSlash(path))
 	if err != nil {
 		return "", err
 	}
 
-	if abs == scope {
-		return "", fmt.Errorf("forbidden path appears to equal the entire project: %s (%s)", path, abs)
-	}
+	for _, scope := range scopes {
+		scopeAbs, err := filepath.Abs(filepath.FromSlash(scope))
+		if err != nil {
+			return "", err
+		}
 
-	if strings.HasPrefix(abs, scope) {
-		return abs, nil
+		if abs == scopeAbs {
+			return "", fmt.Errorf("forbidden path appears to equal the entire project: %s (%s)", path, abs)
+		}
+
+		if isWithin(abs, scopeAbs) {
+			return abs, nil
+		}
 	}
 
 	// default return is an error
 	return "", fmt.Errorf("forbidden path appears to be outside of the build context: %s (%s)", path, abs)
 }
 
+// isWithin returns true when the absolute path abs is inside of the folder dir
+func isWithin(abs, dir string) bool {
+	return strings.HasPrefix(abs, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// copyExtraDestination returns the path that an extra path is copied to, relative to
+// the function's folder. A path within the projectRoot keeps its relative path,
+// i.e. common/models, otherwise the path is relative to the parent of its scope, so
+// ../vendor/lib with a scope of ../vendor is copied to vendor/lib.
+func copyExtraDestination(abs string, projectRoot string, scopes []string) (string, error) {
+	rootAbs, err := filepath.Abs(projectRoot)
+	if err != nil {
+		return "", err
+	}
+
+	if isWithin(abs, rootAbs) {
+		return filepath.Rel(rootAbs, abs)
+	}
+
+	for _, scope := range scopes {
+		scopeAbs, err := filepath.Abs(filepath.FromSlash(scope))
+		if err != nil {
+			return "", err
+		}
+
+		if isWithin(abs, scopeAbs) {
+			return filepath.Rel(filepath.Dir(scopeAbs), abs)
+		}
+	}
+
+	return "", fmt.Errorf("forbidden path appears to be outside of the build context: %s", abs)
+}
+
 // appears to be unused???
 func dockerBuildFolder(functionName string, handler string, language string) string {
 	tempPath := fmt.Sprintf("./build/%s/", functionName)
@@ -359,6 +1619,133 @@ func dockerBuildFolder(functionName string, handler string, language string) str
 	return tempPath
 }
 
+// managedBuildFlags are always set by faas-cli, so cannot be passed as build flags
+var managedBuildFlags = map[string]string{
+	"--tag":  "use --tag or --extra-tag to change the image tags",
+	"-t":     "use --tag or --extra-tag to change the image tags",
+	"--file": "the Dockerfile is provided by the template",
+	"-f":     "the Dockerfile is provided by the template",
+}
+
+// splitBuildFlags splits each of the user's build flags into shell words, so that
+// a flag and its value can be given together, i.e. "--progress plain", and values
+// containing spaces can be quoted
+func splitBuildFlags(buildFlags []string) ([]string, error) {
+	var flags []string
+	for _, v := range buildFlags {
+		words, err := splitShellWords(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid build flag: %s", err.Error())
+		}
+		flags = append(flags, words...)
+	}
+	return flags, nil
+}
+
+// buildFlagName returns the name of a flag given as --name=value
+func buildFlagName(flag string) string {
+	if i := strings.Index(flag, "="); i > -1 {
+		return flag[:i]
+	}
+	return flag
+}
+
+// checkBuildFlags returns an error when a build flag conflicts with one of
+// the managedBuildFlags
+func checkBuildFlags(buildFlags []string) error {
+	flags, err := splitBuildFlags(buildFlags)
+	if err != nil {
+		return err
+	}
+
+	for _, flag := range flags {
+		if reason, ok := managedBuildFlags[buildFlagName(flag)]; ok {
+			return fmt.Errorf("build flag %q conflicts with a flag set by faas-cli, %s", flag, reason)
+		}
+	}
+
+	return nil
+}
+
+// isDuplicateBuildFlag returns true when a build flag is already set by one
+// of the options in build, such as --no-cache
+func isDuplicateBuildFlag(flag string, build dockerBuild) bool {
+	switch flag {
+	case "--no-cache":
+		return build.NoCache
+	case "--squash":
+		return build.Squash
+	case "--pull":
+		return build.Pull
+	case "--compress":
+		return build.Compress
+	}
+	return false
+}
+
+// IsolationModes are the values accepted by docker build --isolation
+var IsolationModes = []string{"default", "process", "hyperv"}
+
+// ValidateIsolation returns an error when isolation is set and is not one of the
+// IsolationModes
+func ValidateIsolation(isolation string) error {
+	if len(isolation) == 0 {
+		return nil
+	}
+
+	for _, mode := range IsolationModes {
+		if isolation == mode {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid isolation: %q, use one of: %s", isolation, strings.Join(IsolationModes, ", "))
+}
+
+// hostGateway can be used in place of an IP with --add-host to refer to the host
+const hostGateway = "host-gateway"
+
+// ValidateAddHosts returns an error for any entry which is not in the form host:ip
+func ValidateAddHosts(hosts []string) error {
+	for _, entry := range hosts {
+		i := strings.Index(entry, ":")
+		if i < 1 {
+			return fmt.Errorf("invalid add-host: %q, must take the form host:ip", entry)
+		}
+
+		host, ip := entry[:i], entry[i+1:]
+		if strings.ContainsAny(host, " \t/") {
+			return fmt.Errorf("invalid add-host: %q, invalid host name: %q", entry, host)
+		}
+		if ip != hostGateway && net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid add-host: %q, invalid IP address: %q", entry, ip)
+		}
+	}
+
+	return nil
+}
+
+// trimBuildArgValues returns a copy of buildArgMap with trailing whitespace and
+// newlines removed from each value, a warning is printed for each value changed
+// as the whitespace usually comes from a file or command substitution by mistake
+func trimBuildArgValues(buildArgMap map[string]string, warnings *[]Warning) map[string]string {
+	if buildArgMap == nil {
+		return nil
+	}
+
+	trimmed := make(map[string]string, len(buildArgMap))
+	for _, k := range sortedKeys(buildArgMap) {
+		v := buildArgMap[k]
+		trimmed[k] = strings.TrimRight(v, " \t\r\n")
+
+		if trimmed[k] != v {
+			warn(warnings, WarnBuildArgWhitespace, "removed trailing whitespace from build-arg %s, use --keep-build-arg-whitespace to keep it", k)
+		}
+	}
+
+	return trimmed
+}
+
 func buildFlagSlice(build dockerBuild) []string {
 
 	var spaceSafeBuildFlags []string
@@ -369,20 +1756,63 @@ func buildFlagSlice(build dockerBuild) []string {
 	if build.Squash {
 		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--squash")
 	}
+	if build.Pull {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--pull")
+	}
+	if build.Compress {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--compress")
+	}
+	if len(build.Isolation) > 0 {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--isolation", build.Isolation)
+	}
+	for _, host := range build.AddHosts {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--add-host", host)
+	}
+	if len(build.BuildNetwork) > 0 {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--network", build.BuildNetwork)
+	}
+	if len(build.Output) > 0 {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--output", build.Output)
+	}
+	if len(build.CacheFrom) > 0 {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--cache-from", build.CacheFrom)
+	}
+	if len(build.CacheTo) > 0 {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--cache-to", build.CacheTo)
+	}
+	if len(build.Memory) > 0 {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--memory", build.Memory)
+	}
+	if len(build.CPUs) > 0 {
+		// Invalid values are reported by ValidateBuildResources before a build
+		if quota, err := parseBuildCPUs(build.CPUs); err == nil {
+			spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--cpu-period", strconv.Itoa(cpuPeriod), "--cpu-quota", strconv.FormatInt(quota, 10))
+		}
+	}
+	for _, ulimit := range build.Ulimits {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--ulimit", ulimit)
+	}
 
-	if len(build.HTTPProxy) > 0 {
+	if len(build.HTTPProxy) > 0 && !build.SkipProxy {
 		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--build-arg", fmt.Sprintf("http_proxy=%s", build.HTTPProxy))
 	}
 
-	if len(build.HTTPSProxy) > 0 {
+	if len(build.HTTPSProxy) > 0 && !build.SkipProxy {
 		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--build-arg", fmt.Sprintf("https_proxy=%s", build.HTTPSProxy))
 	}
 
-	for _, v := range build.BuildFlags {
-		spaceSafeBuildFlags = append(spaceSafeBuildFlags, strings.Split(v, " ")...)
+	// Flags which cannot be split are reported by checkBuildFlags before a build
+	userFlags, _ := splitBuildFlags(build.BuildFlags)
+	for _, flag := range userFlags {
+		if isDuplicateBuildFlag(flag, build) {
+			fmt.Printf("Ignoring duplicate build flag: %s\n", flag)
+			continue
+		}
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, flag)
 	}
 
-	for k, v := range build.BuildArgMap {
+	for _, k := range sortedKeys(build.BuildArgMap) {
+		v := build.BuildArgMap[k]
 
 		if k != AdditionalPackageBuildArg {
 			spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--build-arg", fmt.Sprintf("%s=%s", k, v))
@@ -390,13 +1820,17 @@ func buildFlagSlice(build dockerBuild) []string {
 			build.BuildOptPackages = append(build.BuildOptPackages, strings.Split(v, " ")...)
 		}
 	}
+	for _, key := range sortedKeys(build.BuildArgSecrets) {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--build-arg", key)
+	}
+
 	if len(build.BuildOptPackages) > 0 {
 		build.BuildOptPackages = deDuplicate(build.BuildOptPackages)
 		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--build-arg", fmt.Sprintf("%s=%s", AdditionalPackageBuildArg, strings.Join(build.BuildOptPackages, " ")))
 	}
 
-	for k, v := range build.BuildLabelMap {
-		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--label", fmt.Sprintf("%s=%s", k, v))
+	for _, k := range sortedKeys(build.BuildLabelMap) {
+		spaceSafeBuildFlags = append(spaceSafeBuildFlags, "--label", fmt.Sprintf("%s=%s", k, build.BuildLabelMap[k]))
 	}
 
 	return spaceSafeBuildFlags
@@ -431,18 +1865,18 @@ Please check /template/%s/template.yml for supported build options`, language, l
 	return buildPackages, nil
 }
 
-func getBuildOptionsFor(language string) ([]stack.BuildOption, error) {
+func getBuildOptionsFor(templateDir, language string) ([]stack.BuildOption, error) {
 
 	var buildOptions = []stack.BuildOption{}
 
-	pathToTemplateYAML := fmt.Sprintf("./template/%s/template.yml", language)
+	pathToTemplateYAML := path.Join(templateDirOrDefault(templateDir), language, "template.yml")
 
 	if _, err := os.Stat(pathToTemplateYAML); os.IsNotExist(err) {
 		return buildOptions, err
 	}
 
 	var langTemplate stack.LanguageTemplate
-	parsedLangTemplate, err := stack.ParseYAMLForLanguageTemplate(pathToTemplateYAML)
+	parsedLangTemplate, err := resolveLanguageTemplate(templateDir, language)
 
 	if err != nil {
 		return buildOptions, err
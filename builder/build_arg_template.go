@@ -0,0 +1,128 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// buildArgEnvVariable matches ${NAME} within a build-arg value, $NAME is not
+// matched so that values such as passwords may contain a $
+var buildArgEnvVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// buildArgTemplateVariables describes the variables available to build-arg values
+const buildArgTemplateVariables = "{{.Git.SHA}}, {{.Git.Branch}}, {{.Git.Describe}}, {{.Function.Name}}, {{.Env.NAME}} and ${NAME}"
+
+// buildArgVariables are available to build-arg values as a Go template, each is a
+// map so that a variable without a value, such as Git outside of a repository, is
+// an error rather than an empty string
+type buildArgVariables struct {
+	Git      map[string]string
+	Function map[string]string
+	Env      map[string]string
+}
+
+// newBuildArgVariables looks up the variables for functionName, the Git describe
+// value matches the "describe" image tag
+func newBuildArgVariables(functionName string, describeAlwaysDirty bool) buildArgVariables {
+	vars := buildArgVariables{
+		Git:      map[string]string{},
+		Function: map[string]string{"Name": functionName},
+		Env:      map[string]string{},
+	}
+
+	gitValues := map[string]string{
+		"SHA":      getGitSHA(),
+		"Branch":   getGitBranch(),
+		"Describe": describeVersion(describeAlwaysDirty),
+	}
+	for k, v := range gitValues {
+		if len(v) > 0 {
+			vars.Git[k] = v
+		}
+	}
+
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			vars.Env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	return vars
+}
+
+// expandBuildArgs returns a copy of buildArgs with each {{.Variable}} and ${NAME}
+// in the values resolved, see buildArgTemplateVariables. Variables are only looked
+// up when a value refers to them, and any which cannot be resolved is an error.
+func expandBuildArgs(buildArgs map[string]string, functionName string, describeAlwaysDirty bool) (map[string]string, error) {
+	var vars *buildArgVariables
+
+	expanded := make(map[string]string, len(buildArgs))
+	for _, k := range sortedKeys(buildArgs) {
+		v := buildArgs[k]
+		if !strings.Contains(v, "{{") && !strings.Contains(v, "${") {
+			expanded[k] = v
+			continue
+		}
+
+		if vars == nil {
+			found := newBuildArgVariables(functionName, describeAlwaysDirty)
+			vars = &found
+		}
+
+		value, err := expandBuildArgValue(k, v, *vars)
+		if err != nil {
+			return nil, err
+		}
+		expanded[k] = value
+	}
+
+	return expanded, nil
+}
+
+// expandBuildArgValue resolves the template and environment variables in value
+func expandBuildArgValue(name, value string, vars buildArgVariables) (string, error) {
+	if strings.Contains(value, "{{") {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid template in build-arg %s: %s", name, err.Error())
+		}
+
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, vars); err != nil {
+			return "", fmt.Errorf("unable to resolve build-arg %s=%s: %s, available variables are: %s", name, value, templateErrorReason(err), buildArgTemplateVariables)
+		}
+		value = sb.String()
+	}
+
+	var missing []string
+	value = buildArgEnvVariable.ReplaceAllStringFunc(value, func(match string) string {
+		env := buildArgEnvVariable.FindStringSubmatch(match)[1]
+		if v, ok := vars.Env[env]; ok {
+			return v
+		}
+		missing = append(missing, env)
+		return match
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unable to resolve build-arg %s, environment variable not set: %s", name, strings.Join(missing, ", "))
+	}
+
+	return value, nil
+}
+
+// templateErrorReason returns the part of a text/template execution error which
+// names the missing variable, i.e. <.Git.SHA>: map has no entry for key "SHA"
+func templateErrorReason(err error) string {
+	message := err.Error()
+	if i := strings.Index(message, " at <"); i > -1 {
+		return message[i+len(" at "):]
+	}
+	return message
+}
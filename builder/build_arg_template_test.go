@@ -0,0 +1,139 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_expandBuildArgs(t *testing.T) {
+	stubGit(t, "a1b2c3d", "master", "0.1.0")
+	t.Setenv("FAAS_TEST_REGION", "eu-west-1")
+
+	cases := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "plain value", value: "1.2.3", want: "1.2.3"},
+		{name: "Git SHA", value: "{{.Git.SHA}}", want: "a1b2c3d"},
+		{name: "Git branch", value: "{{.Git.Branch}}", want: "master"},
+		{name: "Git describe", value: "v{{.Git.Describe}}", want: "v0.1.0"},
+		{name: "function name", value: "{{.Function.Name}}-build", want: "fn-build"},
+		{name: "environment template", value: "{{.Env.FAAS_TEST_REGION}}", want: "eu-west-1"},
+		{name: "environment variable", value: "${FAAS_TEST_REGION}/{{.Git.SHA}}", want: "eu-west-1/a1b2c3d"},
+		{name: "dollar without braces", value: "pa$$word", want: "pa$$word"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := expandBuildArgs(map[string]string{"VALUE": tc.value}, "fn", false)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got["VALUE"] != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got["VALUE"])
+			}
+		})
+	}
+}
+
+func Test_expandBuildArgs_DescribeAlwaysDirty(t *testing.T) {
+	stubGit(t, "a1b2c3d", "master", "0.1.0")
+
+	orig := getGitDirty
+	getGitDirty = func() bool { return false }
+	t.Cleanup(func() { getGitDirty = orig })
+
+	got, err := expandBuildArgs(map[string]string{"VERSION": "{{.Git.Describe}}"}, "fn", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got["VERSION"] != "0.1.0-0-ga1b2c3d" {
+		t.Errorf("want the same value as --tag describe, got %q", got["VERSION"])
+	}
+}
+
+func Test_expandBuildArgs_Errors(t *testing.T) {
+	stubGit(t, "", "", "")
+
+	cases := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{
+			name:    "Git outside of a repository",
+			value:   "{{.Git.SHA}}",
+			wantErr: `unable to resolve build-arg VALUE={{.Git.SHA}}: <.Git.SHA>: map has no entry for key "SHA"`,
+		},
+		{
+			name:    "unknown variable",
+			value:   "{{.Version}}",
+			wantErr: "unable to resolve build-arg VALUE={{.Version}}: <.Version>: can't evaluate field Version",
+		},
+		{
+			name:    "unset environment variable",
+			value:   "${FAAS_TEST_MISSING}",
+			wantErr: "unable to resolve build-arg VALUE, environment variable not set: FAAS_TEST_MISSING",
+		},
+		{
+			name:    "invalid template",
+			value:   "{{.Git.SHA",
+			wantErr: "invalid template in build-arg VALUE",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := expandBuildArgs(map[string]string{"VALUE": tc.value}, "fn", false)
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				t.Errorf("want error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_BuildImage_ExpandsBuildArgs(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubGit(t, "a1b2c3d", "master", "0.1.0")
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:           "fn",
+		Handler:         "handler",
+		FunctionName:    "fn",
+		Language:        "go",
+		QuiteBuild:      true,
+		BuildArgMap:     map[string]string{"VERSION": "{{.Git.Describe}}"},
+		ExpandBuildArgs: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if args := strings.Join((*builds)[0].Args, " "); !strings.Contains(args, "--build-arg VERSION=0.1.0") {
+		t.Errorf("want the resolved build-arg, got %q", args)
+	}
+}
+
+func Test_BuildImage_BuildArgsAreLiteralByDefault(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		BuildArgMap:  map[string]string{"PASSWORD": "p@${s}{{w}}rd"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if args := strings.Join((*builds)[0].Args, " "); !strings.Contains(args, "--build-arg PASSWORD=p@${s}{{w}}rd") {
+		t.Errorf("want the build-arg passed as given, got %q", args)
+	}
+}
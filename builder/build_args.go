@@ -0,0 +1,62 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"strings"
+)
+
+// withTemplateBuildArgs returns buildArgs with the template's build args added, a
+// build arg given for the function takes precedence
+func withTemplateBuildArgs(templateArgs, buildArgs map[string]string) map[string]string {
+	if len(templateArgs) == 0 {
+		return buildArgs
+	}
+
+	merged := map[string]string{}
+	for k, v := range templateArgs {
+		merged[k] = v
+	}
+	for k, v := range buildArgs {
+		merged[k] = v
+	}
+	return merged
+}
+
+// withBuildArgDefaults returns buildArgMap with each of the defaults added which
+// is not already set, or given as one of the secrets
+func withBuildArgDefaults(defaults, buildArgMap, secrets map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return buildArgMap
+	}
+
+	merged := map[string]string{}
+	for k, v := range defaults {
+		if _, ok := secrets[k]; !ok {
+			merged[k] = v
+		}
+	}
+	for k, v := range buildArgMap {
+		merged[k] = v
+	}
+	return merged
+}
+
+// checkRequiredBuildArgs returns an error listing each of the template's required
+// build args which has no value within buildArgs
+func checkRequiredBuildArgs(language string, required []string, buildArgs map[string]string) error {
+	var missing []string
+	for _, name := range required {
+		if len(buildArgs[name]) == 0 {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return newBuildError(ErrBuildArgsMissing, "the %s template requires build args which were not given: %s, set them with --build-arg or build_args",
+			language, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
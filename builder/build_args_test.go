@@ -0,0 +1,115 @@
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func Test_BuildImage_RequiredBuildArgs(t *testing.T) {
+	cases := []struct {
+		name      string
+		template  string
+		buildArgs map[string]string
+		wantErr   string
+	}{
+		{
+			name:     "missing",
+			template: "language: go\nrequired_build_args:\n  - BASE_TAG\n  - GO_VERSION\n",
+			wantErr:  "the go template requires build args which were not given: BASE_TAG, GO_VERSION, set them with --build-arg or build_args",
+		},
+		{
+			name:      "one missing",
+			template:  "language: go\nrequired_build_args:\n  - BASE_TAG\n  - GO_VERSION\n",
+			buildArgs: map[string]string{"GO_VERSION": "1.19", "BASE_TAG": ""},
+			wantErr:   "the go template requires build args which were not given: BASE_TAG, set them with --build-arg or build_args",
+		},
+		{
+			name:      "provided",
+			template:  "language: go\nrequired_build_args:\n  - BASE_TAG\n",
+			buildArgs: map[string]string{"BASE_TAG": "3.16"},
+		},
+		{
+			name:     "satisfied by a template default",
+			template: "language: go\nbuild_args:\n  BASE_TAG: \"3.16\"\nrequired_build_args:\n  - BASE_TAG\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupBuildContextTest(t, "go")
+			builds := stubDockerBuild(t, 0)
+
+			if err := ioutil.WriteFile("template/go/template.yml", []byte(tc.template), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := BuildImage(BuildImageConfig{
+				Image:        "fn",
+				Handler:      "handler",
+				FunctionName: "fn",
+				Language:     "go",
+				QuiteBuild:   true,
+				BuildArgMap:  tc.buildArgs,
+			})
+
+			if len(tc.wantErr) > 0 {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("want error %q, got %v", tc.wantErr, err)
+				}
+				if !errors.Is(err, ErrBuildArgsMissing) {
+					t.Errorf("want ErrBuildArgsMissing, got %v", err)
+				}
+				if len(*builds) != 0 {
+					t.Errorf("want no build, got %d", len(*builds))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if args := strings.Join((*builds)[0].Args, " "); !strings.Contains(args, "--build-arg BASE_TAG=3.16") {
+				t.Errorf("want BASE_TAG in the build args, got: %s", args)
+			}
+		})
+	}
+}
+
+func Test_BuildImage_BuildArgDefaults(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	templateYAML := "language: go\nbuild_args:\n  FROM_TEMPLATE: template\nrequired_build_args:\n  - ONLY_DEFAULT\n"
+	if err := ioutil.WriteFile("template/go/template.yml", []byte(templateYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("secret.txt", []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := BuildImage(BuildImageConfig{
+		Image:           "fn",
+		Handler:         "handler",
+		FunctionName:    "fn",
+		Language:        "go",
+		QuiteBuild:      true,
+		BuildArgMap:     map[string]string{"FROM_ARGS": "args"},
+		BuildArgSecrets: map[string]string{"FROM_SECRET": "secret.txt"},
+		BuildArgDefaults: map[string]string{
+			"FROM_ARGS":     "default",
+			"FROM_TEMPLATE": "default",
+			"FROM_SECRET":   "default",
+			"ONLY_DEFAULT":  "default",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := "build --build-arg FROM_ARGS=args --build-arg FROM_TEMPLATE=template --build-arg ONLY_DEFAULT=default --build-arg FROM_SECRET --tag fn:latest ."
+	if got := strings.Join((*builds)[0].Args, " "); got != want {
+		t.Errorf("want args %q, got %q", want, got)
+	}
+}
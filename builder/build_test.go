@@ -1,12 +1,19 @@
 package builder
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/openfaas/faas-cli/config"
+	"github.com/openfaas/faas-cli/schema"
 	"github.com/openfaas/faas-cli/stack"
+	"github.com/openfaas/faas-cli/test"
 )
 
 func Test_isLanguageTemplate_Dockerfile(t *testing.T) {
@@ -86,6 +93,165 @@ func Test_getDockerBuildCommand_WithNoCache(t *testing.T) {
 	}
 }
 
+func Test_getDockerBuildCommand_WithPull(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "imagename:latest",
+		Pull:             true,
+		BuildArgMap:      make(map[string]string),
+		BuildOptPackages: []string{},
+	}
+
+	want := "build --pull --tag imagename:latest ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+
+	if joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_getDockerBuildCommand_WithNoCacheSquashAndPull(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "imagename:latest",
+		NoCache:          true,
+		Squash:           true,
+		Pull:             true,
+		HTTPProxy:        "http://127.0.0.1:3128",
+		BuildArgMap:      make(map[string]string),
+		BuildOptPackages: []string{},
+	}
+
+	want := "build --no-cache --squash --pull --build-arg http_proxy=http://127.0.0.1:3128 --tag imagename:latest ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+
+	if joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_getDockerBuildCommand_WithCompress(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "imagename:latest",
+		NoCache:          true,
+		Squash:           true,
+		Pull:             true,
+		Compress:         true,
+		HTTPProxy:        "http://127.0.0.1:3128",
+		BuildArgMap:      make(map[string]string),
+		BuildOptPackages: []string{},
+	}
+
+	want := "build --no-cache --squash --pull --compress --build-arg http_proxy=http://127.0.0.1:3128 --tag imagename:latest ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+
+	if joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_getDockerBuildCommand_WithOutput(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "imagename:latest",
+		Pull:             true,
+		BuildArgMap:      make(map[string]string),
+		BuildOptPackages: []string{},
+		Output:           "type=oci,dest=imagename.tar",
+	}
+
+	want := "buildx build --pull --output type=oci,dest=imagename.tar --tag imagename:latest ."
+
+	command, args := getDockerBuildCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+
+	if command != "docker" {
+		t.Errorf("want command docker, got %q", command)
+	}
+	if joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_getDockerBuildCommand_WithDockerContext(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name: "classic builder",
+			want: "--context remote-builder build --tag imagename:latest .",
+		},
+		{
+			name:   "buildx",
+			output: "type=oci,dest=imagename.tar",
+			want:   "--context remote-builder buildx build --output type=oci,dest=imagename.tar --tag imagename:latest .",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, args := getDockerBuildCommand(dockerBuild{
+				Image:         "imagename:latest",
+				BuildArgMap:   make(map[string]string),
+				Output:        tc.output,
+				DockerContext: "remote-builder",
+			})
+
+			if joined := strings.Join(args, " "); joined != tc.want {
+				t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", tc.want, joined)
+			}
+		})
+	}
+}
+
+func Test_getDockerBuildCommand_WithExtraTags(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "registry:5000/org/imagename:latest-a1b2c3d",
+		BuildArgMap:      make(map[string]string),
+		BuildOptPackages: []string{},
+		ExtraTags:        []string{"latest", "0.1.0", "latest-a1b2c3d"},
+	}
+
+	want := "build --tag registry:5000/org/imagename:latest-a1b2c3d --tag registry:5000/org/imagename:latest --tag registry:5000/org/imagename:0.1.0 ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+
+	if joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_getDockerBuildxCommand_WithExtraTags(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "imagename:latest-a1b2c3d",
+		Platforms:        "linux/amd64",
+		BuildArgMap:      make(map[string]string),
+		BuildOptPackages: []string{},
+		ExtraTags:        []string{"latest"},
+	}
+
+	want := "buildx build --progress=plain --platform=linux/amd64 --output=type=registry,push=true --tag imagename:latest-a1b2c3d --tag imagename:latest ."
+
+	_, args := getDockerBuildxCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+
+	if joined != want {
+		t.Errorf("getDockerBuildxCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
 func Test_getDockerBuildCommand_WithProxies(t *testing.T) {
 	dockerBuildVal := dockerBuild{
 		Image:            "imagename:latest",
@@ -114,6 +280,32 @@ func Test_getDockerBuildCommand_WithProxies(t *testing.T) {
 	}
 }
 
+func Test_getDockerBuildCommand_WithSkipProxy(t *testing.T) {
+	t.Setenv("http_proxy", "http://127.0.0.1:3128")
+	t.Setenv("https_proxy", "https://127.0.0.1:3128")
+
+	dockerBuildVal := dockerBuild{
+		Image:      "imagename:latest",
+		HTTPProxy:  os.Getenv("http_proxy"),
+		HTTPSProxy: os.Getenv("https_proxy"),
+		SkipProxy:  true,
+		BuildArgMap: map[string]string{
+			"https_proxy": "https://proxy.internal:3128",
+		},
+		BuildOptPackages: []string{},
+	}
+
+	want := "build --build-arg https_proxy=https://proxy.internal:3128 --tag imagename:latest ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+
+	if joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
 func Test_getDockerBuildCommand_WithBuildArg(t *testing.T) {
 	dockerBuildVal := dockerBuild{
 		Image:   "imagename:latest",
@@ -595,3 +787,1320 @@ func Test_pathInScope(t *testing.T) {
 		})
 	}
 }
+
+func Test_pathInScope_MultipleScopes(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "project")
+	vendor := filepath.Join(root, "vendor")
+
+	cases := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "allowed within the project",
+			path: filepath.Join(project, "common"),
+			want: filepath.Join(project, "common"),
+		},
+		{
+			name: "allowed within the vendor scope",
+			path: filepath.Join(project, "..", "vendor", "lib"),
+			want: filepath.Join(vendor, "lib"),
+		},
+		{
+			name:    "denied outside of every scope",
+			path:    filepath.Join(root, "private"),
+			wantErr: "forbidden path appears to be outside of the build context",
+		},
+		{
+			name:    "denied for a sibling which shares the scope's prefix",
+			path:    filepath.Join(root, "vendor-secrets", "key"),
+			wantErr: "forbidden path appears to be outside of the build context",
+		},
+		{
+			name:    "denied when equal to the entire vendor scope",
+			path:    vendor,
+			wantErr: "forbidden path appears to equal the entire project",
+		},
+		{
+			name:    "denied when equal to the entire project scope",
+			path:    project,
+			wantErr: "forbidden path appears to equal the entire project",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			abs, err := pathInScope(tc.path, project, vendor)
+			if len(tc.wantErr) > 0 {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+					t.Fatalf("want error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if abs != tc.want {
+				t.Errorf("want %s, got %s", tc.want, abs)
+			}
+		})
+	}
+}
+
+func Test_createBuildContext_CopyExtraScopes(t *testing.T) {
+	dir := setupBuildContextTest(t, "go")
+
+	vendorLib := filepath.Join(filepath.Dir(dir), "vendor", "lib")
+	if err := os.MkdirAll(vendorLib, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(vendorLib, "lib.txt"), []byte("lib\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	test.CaptureStdout(func() {
+		_, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, CopyExtraPaths: []string{"../vendor/lib"}})
+		if err == nil || !strings.Contains(err.Error(), "outside of the build context") {
+			t.Errorf("want ../vendor/lib to be denied by default, got %v", err)
+		}
+
+		_, err = createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, CopyExtraPaths: []string{"common", "../vendor/lib"}, CopyExtraScopes: []string{".", "../vendor"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	for _, name := range []string{"common/shared.txt", "vendor/lib/lib.txt"} {
+		if _, err := os.Stat(filepath.Join("build", "fn", "function", name)); err != nil {
+			t.Errorf("want %s in the build context: %s", name, err)
+		}
+	}
+}
+
+func stubGit(t *testing.T, sha, branch, describe string) {
+	origSHA, origBranch, origDescribe := getGitSHA, getGitBranch, getGitDescribe
+	getGitSHA = func() string { return sha }
+	getGitBranch = func() string { return branch }
+	getGitDescribe = func() string { return describe }
+
+	t.Cleanup(func() {
+		getGitSHA, getGitBranch, getGitDescribe = origSHA, origBranch, origDescribe
+	})
+}
+
+func Test_GetImageTagValuesWithFallback(t *testing.T) {
+	cases := []struct {
+		name            string
+		inRepo          bool
+		tagMode         schema.BuildFormat
+		allowNoVCS      bool
+		fallbackVersion string
+		wantBranch      string
+		wantVersion     string
+		wantErr         string
+	}{
+		{
+			name:        "git repository uses the git sha",
+			inRepo:      true,
+			tagMode:     schema.SHAFormat,
+			allowNoVCS:  true,
+			wantVersion: "a1b2c3d",
+		},
+		{
+			name:    "strict by default outside of a git repository",
+			tagMode: schema.SHAFormat,
+			wantErr: "cannot tag image with Git SHA as this is not a Git repository",
+		},
+		{
+			name:            "strict by default even with a fallback version",
+			tagMode:         schema.DescribeFormat,
+			fallbackVersion: "0.1.0",
+			wantErr:         "cannot tag image with Git Tag and SHA as this is not a Git repository",
+		},
+		{
+			name:            "fallback version is used for sha format",
+			tagMode:         schema.SHAFormat,
+			allowNoVCS:      true,
+			fallbackVersion: "0.1.0",
+			wantVersion:     "0.1.0",
+		},
+		{
+			name:            "fallback version and placeholder branch are used for branch format",
+			tagMode:         schema.BranchAndSHAFormat,
+			allowNoVCS:      true,
+			fallbackVersion: "0.1.0",
+			wantBranch:      noVCSBranch,
+			wantVersion:     "0.1.0",
+		},
+		{
+			name:       "allow-no-vcs requires a fallback version",
+			tagMode:    schema.DescribeFormat,
+			allowNoVCS: true,
+			wantErr:    "cannot tag image with Git Tag and SHA as this is not a Git repository, and no fallback version was provided",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.inRepo {
+				stubGit(t, "a1b2c3d", "master", "0.1.0-1-ga1b2c3d")
+			} else {
+				stubGit(t, "", "", "")
+			}
+
+			branch, version, err := GetImageTagValuesWithFallback(tc.tagMode, false, tc.allowNoVCS, tc.fallbackVersion)
+			if len(tc.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("want error %q, got nil", tc.wantErr)
+				}
+				if err.Error() != tc.wantErr {
+					t.Fatalf("want error %q, got %q", tc.wantErr, err.Error())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if branch != tc.wantBranch {
+				t.Errorf("want branch %q, got %q", tc.wantBranch, branch)
+			}
+			if version != tc.wantVersion {
+				t.Errorf("want version %q, got %q", tc.wantVersion, version)
+			}
+		})
+	}
+}
+
+func Test_GetImageTagValuesWithDescribe(t *testing.T) {
+	cases := []struct {
+		name        string
+		describe    string
+		dirty       bool
+		alwaysDirty bool
+		wantVersion string
+	}{
+		{
+			name:        "on tag",
+			describe:    "0.1.0",
+			wantVersion: "0.1.0",
+		},
+		{
+			name:        "on tag always dirty",
+			describe:    "0.1.0",
+			alwaysDirty: true,
+			wantVersion: "0.1.0-0-ga1b2c3d",
+		},
+		{
+			name:        "ahead of tag always dirty",
+			describe:    "0.1.0-3-ga1b2c3d",
+			alwaysDirty: true,
+			wantVersion: "0.1.0-3-ga1b2c3d",
+		},
+		{
+			name:        "dirty on tag always dirty",
+			describe:    "0.1.0",
+			dirty:       true,
+			alwaysDirty: true,
+			wantVersion: "0.1.0-0-ga1b2c3d-dirty",
+		},
+		{
+			name:        "dirty without always dirty",
+			describe:    "0.1.0",
+			dirty:       true,
+			wantVersion: "0.1.0",
+		},
+		{
+			name:        "no tags always dirty",
+			describe:    "a1b2c3d",
+			alwaysDirty: true,
+			wantVersion: "a1b2c3d",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stubGit(t, "a1b2c3d", "master", tc.describe)
+
+			origDirty := getGitDirty
+			getGitDirty = func() bool { return tc.dirty }
+			t.Cleanup(func() { getGitDirty = origDirty })
+
+			_, version, err := GetImageTagValuesWithDescribe(schema.DescribeFormat, tc.alwaysDirty)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if version != tc.wantVersion {
+				t.Errorf("want version %q, got %q", tc.wantVersion, version)
+			}
+		})
+	}
+}
+
+func Test_BuildImage_InvalidBuildOptionFailsBeforeStaging(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		BuildOptions: []string{"dve"},
+	})
+
+	want := `Error: You're using a build option unavailable for go.
+Please check /template/go/template.yml for supported build options`
+	if err == nil || err.Error() != want {
+		t.Fatalf("want error %q, got %v", want, err)
+	}
+
+	if _, err := os.Stat("build"); !os.IsNotExist(err) {
+		t.Errorf("want no temporary build folder to be created")
+	}
+
+	if len(*builds) != 0 {
+		t.Errorf("want docker build to be skipped, got %d builds", len(*builds))
+	}
+}
+
+func Test_checkTemplateLanguage(t *testing.T) {
+	cases := []struct {
+		name     string
+		language string
+		declared string
+		strict   bool
+		wantWarn bool
+		wantErr  bool
+	}{
+		{name: "matching", language: "python3", declared: "python3"},
+		{name: "case insensitive", language: "Python3", declared: "python3"},
+		{name: "template named after its variant", language: "golang-middleware", declared: "go"},
+		{name: "no language declared", language: "python3", declared: ""},
+		{name: "mismatch warns", language: "python3", declared: "node", wantWarn: true},
+		{name: "mismatch fails when strict", language: "python3", declared: "node", strict: true, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			out := test.CaptureStderr(func() {
+				err = checkTemplateLanguage(tc.language, &stack.LanguageTemplate{Language: tc.declared}, tc.strict, nil)
+			})
+
+			if tc.wantErr {
+				if !errors.Is(err, ErrTemplateInvalid) {
+					t.Fatalf("want ErrTemplateInvalid, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got := strings.Contains(out, "Warning: the template for"); got != tc.wantWarn {
+				t.Errorf("want warning %v, got output: %q", tc.wantWarn, out)
+			}
+		})
+	}
+}
+
+func Test_BuildImage_StrictTemplateMismatch(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	if err := ioutil.WriteFile(filepath.Join("template", "go", "template.yml"), []byte("language: node\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:          "fn",
+		Handler:        "handler",
+		FunctionName:   "fn",
+		Language:       "go",
+		QuiteBuild:     true,
+		StrictTemplate: true,
+	})
+
+	want := `the template for go declares the language "node" in its template.yml, check that the right template was pulled`
+	if err == nil || err.Error() != want {
+		t.Fatalf("want error %q, got %v", want, err)
+	}
+
+	if len(*builds) != 0 {
+		t.Errorf("want docker build to be skipped, got %d builds", len(*builds))
+	}
+}
+
+func Test_BuildImage_MalformedTemplate(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	if err := ioutil.WriteFile(filepath.Join("template", "go", "template.yml"), []byte("language: go\nfprocess: ./handler\nbuild_options: dev\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+	})
+	if !errors.Is(err, ErrTemplateInvalid) {
+		t.Fatalf("want %v, got %v", ErrTemplateInvalid, err)
+	}
+
+	want := `error reading language template: invalid template/go/template.yml, line 3, field "build_options": cannot unmarshal !!str ` + "`dev`" + ` into []stack.BuildOption`
+	if err.Error() != want {
+		t.Errorf("want error:\n%s\ngot:\n%s", want, err.Error())
+	}
+
+	if len(*builds) != 0 {
+		t.Errorf("want docker build to be skipped, got %d builds", len(*builds))
+	}
+}
+
+func Test_resolveHandlerFolder(t *testing.T) {
+	cases := []struct {
+		name           string
+		override       string
+		templateFolder string
+		want           string
+		wantErr        bool
+	}{
+		{
+			name: "default folder when nothing is set",
+			want: "",
+		},
+		{
+			name:           "template folder when no override",
+			templateFolder: "src",
+			want:           "src",
+		},
+		{
+			name:     "override when template has no folder",
+			override: "app",
+			want:     "app",
+		},
+		{
+			name:           "override takes precedence over template folder",
+			override:       "app",
+			templateFolder: "src",
+			want:           "app",
+		},
+		{
+			name:           "nested override is cleaned",
+			override:       "./src/app/",
+			templateFolder: "src",
+			want:           "src/app",
+		},
+		{
+			name:     "override escaping the context",
+			override: "../app",
+			wantErr:  true,
+		},
+		{
+			name:     "override escaping the context in the middle of the path",
+			override: "src/../../app",
+			wantErr:  true,
+		},
+		{
+			name:     "absolute override",
+			override: "/app",
+			wantErr:  true,
+		},
+		{
+			name:     "override equal to the context",
+			override: "./",
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := resolveHandlerFolder(tc.override, tc.templateFolder)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got folder %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+// setupBuildContextTest creates a project with a template and handler in a temporary
+// folder and changes into it for the duration of the test
+func setupBuildContextTest(t *testing.T, language string) string {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	files := map[string]string{
+		"template/" + language + "/template.yml":         "language: " + language + "\n",
+		"template/" + language + "/Dockerfile":           "FROM scratch\n",
+		"template/" + language + "/function/handler.txt": "template handler\n",
+		"handler/handler.txt":                            "user handler\n",
+		"handler/build/stale.txt":                        "skipped\n",
+		"common/shared.txt":                              "shared\n",
+	}
+
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func Test_createBuildContext_VerboseReportsCopies(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	out := test.CaptureStdout(func() {
+		if _, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, CopyExtraPaths: []string{"common"}, Verbose: true}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	abs, _ := filepath.Abs("common")
+	for _, want := range []string{
+		"Copying template: template/go -> ./build/fn/",
+		"Skipped: handler/build",
+		"Copying: handler/handler.txt -> build/fn/function/handler.txt",
+		"Copying extra path: common (" + abs + ") -> build/fn/function/common",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func Test_createBuildContext_QuietWithoutVerbose(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	out := test.CaptureStdout(func() {
+		if _, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, CopyExtraPaths: []string{"common"}}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if strings.Contains(out, "Copying") {
+		t.Errorf("want no copy report without verbose, got:\n%s", out)
+	}
+}
+
+func Test_createBuildContext_ExcludePaths(t *testing.T) {
+	cases := []struct {
+		name     string
+		exclude  []string
+		excluded []string
+		kept     []string
+	}{
+		{
+			name:     "top-level folder",
+			exclude:  []string{"fixtures"},
+			excluded: []string{"fixtures/large.json", "fixtures"},
+			kept:     []string{"handler.txt", "testdata/small.json", "testdata/notes.txt"},
+		},
+		{
+			name:     "nested glob",
+			exclude:  []string{"testdata/*.json"},
+			excluded: []string{"testdata/small.json"},
+			kept:     []string{"handler.txt", "fixtures/large.json", "testdata/notes.txt"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupBuildContextTest(t, "go")
+
+			for _, name := range []string{"handler/fixtures/large.json", "handler/testdata/small.json", "handler/testdata/notes.txt"} {
+				if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(name, []byte("data\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			test.CaptureStdout(func() {
+				if _, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, ExcludePaths: tc.exclude}); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			})
+
+			for _, name := range tc.excluded {
+				if _, err := os.Stat(filepath.Join("build", "fn", "function", name)); !os.IsNotExist(err) {
+					t.Errorf("want %s to be excluded from the build context", name)
+				}
+			}
+
+			for _, name := range tc.kept {
+				if _, err := os.Stat(filepath.Join("build", "fn", "function", name)); err != nil {
+					t.Errorf("want %s in the build context: %s", name, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_ValidateExcludePaths(t *testing.T) {
+	if err := ValidateExcludePaths([]string{"fixtures", "testdata/*.json", "*.log"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if err := ValidateExcludePaths([]string{"fixtures/["}); err == nil {
+		t.Errorf("want error for a malformed pattern")
+	}
+}
+
+func Test_ResolveImageName(t *testing.T) {
+	stubGit(t, "a1b2c3d", "master", "0.1.0")
+
+	cases := []struct {
+		name    string
+		config  BuildImageConfig
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "default tag",
+			config: BuildImageConfig{Image: "alexellis/fn"},
+			want:   "alexellis/fn:latest",
+		},
+		{
+			name:   "sha tag",
+			config: BuildImageConfig{Image: "alexellis/fn:0.2", TagMode: schema.SHAFormat},
+			want:   "alexellis/fn:0.2-a1b2c3d",
+		},
+		{
+			name:   "branch tag",
+			config: BuildImageConfig{Image: "alexellis/fn", TagMode: schema.BranchAndSHAFormat},
+			want:   "alexellis/fn:latest-master-a1b2c3d",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ResolveImageName(tc.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_ResolveImageName_NotAGitRepository(t *testing.T) {
+	stubGit(t, "", "", "")
+
+	_, err := ResolveImageName(BuildImageConfig{Image: "alexellis/fn", TagMode: schema.SHAFormat})
+	want := "cannot tag image with Git SHA as this is not a Git repository"
+	if err == nil || err.Error() != want {
+		t.Fatalf("want error %q, got %v", want, err)
+	}
+
+	got, err := ResolveImageName(BuildImageConfig{
+		Image:           "alexellis/fn",
+		TagMode:         schema.SHAFormat,
+		AllowNoVCS:      true,
+		FallbackVersion: "0.1.0",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != "alexellis/fn:latest-0.1.0" {
+		t.Errorf("want alexellis/fn:latest-0.1.0, got %q", got)
+	}
+}
+
+func Test_applyOffline(t *testing.T) {
+	cases := []struct {
+		name          string
+		config        BuildImageConfig
+		wantSkipProxy bool
+		wantNoCache   bool
+		wantGitLabels bool
+		wantErr       string
+	}{
+		{
+			name:          "online leaves the config unchanged",
+			config:        BuildImageConfig{Handler: "./handler", Pull: true, GitLabels: true},
+			wantGitLabels: true,
+		},
+		{
+			name:          "offline skips git labels",
+			config:        BuildImageConfig{Handler: "./handler", Offline: true, GitLabels: true},
+			wantSkipProxy: true,
+		},
+		{
+			name:          "offline disables proxy forwarding",
+			config:        BuildImageConfig{Handler: "./handler", Offline: true},
+			wantSkipProxy: true,
+		},
+		{
+			name:          "offline composes with no-cache",
+			config:        BuildImageConfig{Handler: "./handler", Offline: true, NoCache: true},
+			wantSkipProxy: true,
+			wantNoCache:   true,
+		},
+		{
+			name:    "offline cannot pull",
+			config:  BuildImageConfig{Handler: "./handler", Offline: true, Pull: true},
+			wantErr: "--pull cannot be used with --offline",
+		},
+		{
+			name:    "offline cannot clone a remote handler",
+			config:  BuildImageConfig{Handler: "https://github.com/org/fn.git", Offline: true},
+			wantErr: "a handler from a Git URL cannot be used with --offline: https://github.com/org/fn.git",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := applyOffline(tc.config)
+			if len(tc.wantErr) > 0 {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("want error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got.SkipProxy != tc.wantSkipProxy {
+				t.Errorf("want SkipProxy %v, got %v", tc.wantSkipProxy, got.SkipProxy)
+			}
+			if got.NoCache != tc.wantNoCache {
+				t.Errorf("want NoCache %v, got %v", tc.wantNoCache, got.NoCache)
+			}
+			if got.GitLabels != tc.wantGitLabels {
+				t.Errorf("want GitLabels %v, got %v", tc.wantGitLabels, got.GitLabels)
+			}
+		})
+	}
+}
+
+func Test_createBuildContext_SymlinkedTemplateRoot(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	if err := os.MkdirAll("shared", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename("template", filepath.Join("shared", "template")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("shared", "template"), "template"); err != nil {
+		t.Fatal(err)
+	}
+
+	test.CaptureStdout(func() {
+		if _, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	for _, name := range []string{"build/fn/Dockerfile", "build/fn/template.yml"} {
+		info, err := os.Lstat(name)
+		if err != nil {
+			t.Fatalf("want %s to be staged: %s", name, err)
+		}
+		if !info.Mode().IsRegular() {
+			t.Errorf("want %s to be a regular file, got mode: %s", name, info.Mode())
+		}
+	}
+}
+
+func Test_resolveTemplatePath_Symlink(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	if err := os.Rename(filepath.Join("template", "go"), "go-template"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "go-template"), filepath.Join("template", "go")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := resolveTemplatePath("./template", "go")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != "go-template" {
+		t.Errorf("want go-template, got %q", got)
+	}
+}
+
+// clearCIEnvironment unsets CI and each of config.CIEnvironmentVariables for the test
+func clearCIEnvironment(t *testing.T) {
+	t.Setenv("CI", "")
+	for _, name := range config.CIEnvironmentVariables {
+		t.Setenv(name, "")
+	}
+}
+
+func Test_buildDirPermissions(t *testing.T) {
+	cases := []struct {
+		name    string
+		ci      string
+		perm    string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{name: "default", want: 0700},
+		{name: "ci default", ci: "true", want: 0755},
+		{name: "override outside ci", perm: "0750", want: 0750},
+		{name: "override in ci", ci: "1", perm: "0777", want: 0777},
+		{name: "without leading zero", ci: "true", perm: "775", want: 0775},
+		{name: "not octal", perm: "0789", wantErr: true},
+		{name: "not a number", perm: "rwxr-xr-x", wantErr: true},
+		{name: "out of range", perm: "01777", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clearCIEnvironment(t)
+			t.Setenv("CI", tc.ci)
+			t.Setenv(buildDirPermEnvironment, tc.perm)
+
+			got, err := buildDirPermissions()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error for %q", tc.perm)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("want %o, got %o", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_checkBuildFlags(t *testing.T) {
+	cases := []struct {
+		name       string
+		buildFlags []string
+		wantErr    string
+	}{
+		{name: "no flags"},
+		{name: "unmanaged flags", buildFlags: []string{"--progress plain", "--disable-content-trust"}},
+		{name: "tag", buildFlags: []string{"--tag fn:latest"}, wantErr: `build flag "--tag" conflicts`},
+		{name: "short tag", buildFlags: []string{"-t fn:latest"}, wantErr: `build flag "-t" conflicts`},
+		{name: "tag with equals", buildFlags: []string{"--tag=fn:latest"}, wantErr: `build flag "--tag=fn:latest" conflicts`},
+		{name: "file", buildFlags: []string{"--progress plain", "--file Dockerfile.dev"}, wantErr: `build flag "--file" conflicts`},
+		{name: "short file", buildFlags: []string{"-f Dockerfile.dev"}, wantErr: `build flag "-f" conflicts`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkBuildFlags(tc.buildFlags)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				t.Fatalf("want error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_buildFlagSlice_DuplicateFlags(t *testing.T) {
+	b := dockerBuild{
+		NoCache:    true,
+		Pull:       true,
+		BuildFlags: []string{"--no-cache", "--pull", "--squash", "--progress plain"},
+	}
+
+	var got []string
+	test.CaptureStdout(func() {
+		got = buildFlagSlice(b)
+	})
+
+	want := []string{"--no-cache", "--pull", "--squash", "--progress", "plain"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func Test_buildFlagSlice_QuotedValues(t *testing.T) {
+	b := dockerBuild{
+		BuildFlags: []string{`--label description="my service"`, `--label 'owner=team a'`, `--label tier=web\ app`},
+	}
+
+	got := buildFlagSlice(b)
+	want := []string{"--label", "description=my service", "--label", "owner=team a", "--label", "tier=web app"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if err := checkBuildFlags([]string{`--label "description=my service`}); err == nil {
+		t.Errorf("want error for an unterminated quote")
+	}
+}
+
+func Test_CreateBuildContext(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	var tempPath string
+	test.CaptureStdout(func() {
+		var err error
+		tempPath, err = CreateBuildContext(BuildImageConfig{
+			FunctionName:   "fn",
+			Handler:        "handler",
+			Language:       "go",
+			CopyExtraPaths: []string{"common"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if tempPath != "./build/fn/" {
+		t.Errorf("want ./build/fn/, got %q", tempPath)
+	}
+
+	want := map[string]string{
+		"Dockerfile":                 "FROM scratch\n",
+		"function/handler.txt":       "user handler\n",
+		"function/common/shared.txt": "shared\n",
+	}
+
+	for name, content := range want {
+		got, err := ioutil.ReadFile(filepath.Join(tempPath, name))
+		if err != nil {
+			t.Errorf("want %s to be staged: %s", name, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("want %s to contain %q, got %q", name, content, string(got))
+		}
+	}
+}
+
+func Test_CreateBuildContext_NoTemplateOverlay(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	if err := ioutil.WriteFile(filepath.Join("handler", "Dockerfile"), []byte("FROM alpine:3.16\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var tempPath string
+	test.CaptureStdout(func() {
+		var err error
+		tempPath, err = CreateBuildContext(BuildImageConfig{
+			FunctionName:      "fn",
+			Handler:           "handler",
+			Language:          "go",
+			CopyExtraPaths:    []string{"common"},
+			NoTemplateOverlay: true,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	want := map[string]string{
+		"Dockerfile":        "FROM alpine:3.16\n",
+		"handler.txt":       "user handler\n",
+		"common/shared.txt": "shared\n",
+	}
+
+	for name, content := range want {
+		got, err := ioutil.ReadFile(filepath.Join(tempPath, name))
+		if err != nil {
+			t.Errorf("want %s to be staged: %s", name, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("want %s to contain %q, got %q", name, content, string(got))
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tempPath, "function")); !os.IsNotExist(err) {
+		t.Errorf("want the template's function folder not to be staged")
+	}
+}
+
+func Test_CreateBuildContext_Errors(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	cases := []struct {
+		name     string
+		config   BuildImageConfig
+		wantKind error
+	}{
+		{
+			name:     "unknown template",
+			config:   BuildImageConfig{FunctionName: "fn", Handler: "handler", Language: "cobol"},
+			wantKind: ErrTemplateNotSupported,
+		},
+		{
+			name:     "missing handler",
+			config:   BuildImageConfig{FunctionName: "fn", Handler: "missing", Language: "go"},
+			wantKind: ErrHandlerInvalid,
+		},
+		{
+			name:     "no template overlay without a Dockerfile",
+			config:   BuildImageConfig{FunctionName: "fn", Handler: "handler", Language: "go", NoTemplateOverlay: true},
+			wantKind: ErrHandlerInvalid,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CreateBuildContext(tc.config)
+			if !errors.Is(err, tc.wantKind) {
+				t.Errorf("want %v, got %v", tc.wantKind, err)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join("build", "fn")); !os.IsNotExist(err) {
+		t.Errorf("want no build context to be staged on error")
+	}
+}
+
+func Test_trimBuildArgValues(t *testing.T) {
+	buildArgs := map[string]string{
+		"VERSION": "1.2.3\n",
+		"WINDOWS": "1.2.3\r\n",
+		"SPACES":  "value \t ",
+		"LEADING": "  value",
+		"CLEAN":   "value",
+	}
+
+	var got map[string]string
+	out := test.CaptureStderr(func() {
+		got = trimBuildArgValues(buildArgs, nil)
+	})
+
+	want := map[string]string{
+		"VERSION": "1.2.3",
+		"WINDOWS": "1.2.3",
+		"SPACES":  "value",
+		"LEADING": "  value",
+		"CLEAN":   "value",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	for _, key := range []string{"SPACES", "VERSION", "WINDOWS"} {
+		if !strings.Contains(out, "Warning: removed trailing whitespace from build-arg "+key) {
+			t.Errorf("want a warning for %s, got: %s", key, out)
+		}
+	}
+	for _, key := range []string{"LEADING", "CLEAN"} {
+		if strings.Contains(out, "build-arg "+key) {
+			t.Errorf("want no warning for %s, got: %s", key, out)
+		}
+	}
+
+	if buildArgs["VERSION"] != "1.2.3\n" {
+		t.Errorf("want the original map to be unchanged")
+	}
+}
+
+func Test_BuildImage_KeepBuildArgWhitespace(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep %v", keep), func(t *testing.T) {
+			setupBuildContextTest(t, "go")
+			builds := stubDockerBuild(t, 0)
+
+			test.CaptureStdout(func() {
+				err := BuildImage(BuildImageConfig{
+					Image:                  "fn",
+					Handler:                "handler",
+					FunctionName:           "fn",
+					Language:               "go",
+					QuiteBuild:             true,
+					BuildArgMap:            map[string]string{"VERSION": "1.2.3\n"},
+					KeepBuildArgWhitespace: keep,
+				})
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			})
+
+			want := "VERSION=1.2.3"
+			if keep {
+				want = "VERSION=1.2.3\n"
+			}
+
+			args := (*builds)[0].Args
+			found := false
+			for _, arg := range args {
+				if arg == want {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("want build-arg %q, got %q", want, args)
+			}
+		})
+	}
+}
+
+func Test_getDockerBuildCommand_WithIsolation(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "imagename:latest",
+		NoCache:          true,
+		Pull:             true,
+		Isolation:        "hyperv",
+		HTTPProxy:        "http://127.0.0.1:3128",
+		BuildArgMap:      make(map[string]string),
+		BuildOptPackages: []string{},
+		BuildFlags:       []string{"--progress plain"},
+	}
+
+	want := "build --no-cache --pull --isolation hyperv --build-arg http_proxy=http://127.0.0.1:3128 --progress plain --tag imagename:latest ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+	if joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_getDockerBuildCommand_WithoutIsolation(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:       "imagename:latest",
+		BuildArgMap: make(map[string]string),
+	}
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	if joined := strings.Join(args, " "); strings.Contains(joined, "--isolation") {
+		t.Errorf("want no --isolation flag, got: %s", joined)
+	}
+}
+
+func Test_ValidateIsolation(t *testing.T) {
+	for _, isolation := range []string{"", "default", "process", "hyperv"} {
+		if err := ValidateIsolation(isolation); err != nil {
+			t.Errorf("want %q to be valid, got: %s", isolation, err)
+		}
+	}
+
+	err := ValidateIsolation("Hyper-V")
+	if err == nil {
+		t.Fatalf("want error for an unknown isolation mode")
+	}
+
+	want := `invalid isolation: "Hyper-V", use one of: default, process, hyperv`
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
+
+func Test_BuildImage_TemplateDir(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	templateDir := filepath.Join("infra", "faas", "template")
+	if err := os.MkdirAll(filepath.Dir(templateDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename("template", templateDir); err != nil {
+		t.Fatal(err)
+	}
+
+	config := BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+	}
+
+	test.CaptureStdout(func() {
+		if err := BuildImage(config); !errors.Is(err, ErrTemplateNotSupported) {
+			t.Errorf("want ErrTemplateNotSupported without --template-dir, got %v", err)
+		}
+
+		config.TemplateDir = templateDir
+		if err := BuildImage(config); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if len(*builds) != 1 {
+		t.Errorf("want docker build to run once, got %d", len(*builds))
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join("build", "fn", "Dockerfile"))
+	if err != nil {
+		t.Fatalf("want the template to be staged: %s", err)
+	}
+	if string(got) != "FROM scratch\n" {
+		t.Errorf("want the template Dockerfile, got %q", string(got))
+	}
+}
+
+func Test_getBuildOptionsFor_TemplateDir(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	templateDir := filepath.Join("infra", "template")
+	if err := os.MkdirAll(filepath.Join(templateDir, "python3"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	templateYAML := `language: python3
+build_options:
+  - name: dev
+    packages:
+      - make
+`
+	if err := ioutil.WriteFile(filepath.Join(templateDir, "python3", "template.yml"), []byte(templateYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := getBuildOptionsFor(templateDir, "python3")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(options) != 1 || options[0].Name != "dev" {
+		t.Errorf("want the dev build option, got %v", options)
+	}
+
+	if _, err := getBuildOptionsFor("", "python3"); err == nil {
+		t.Errorf("want error when the template is not in the default folder")
+	}
+}
+
+func Test_getDockerBuildCommand_WithAddHosts(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:       "imagename:latest",
+		Pull:        true,
+		AddHosts:    []string{"registry.internal:10.0.0.10", "git.internal:10.0.0.11"},
+		BuildArgMap: make(map[string]string),
+	}
+
+	want := "build --pull --add-host registry.internal:10.0.0.10 --add-host git.internal:10.0.0.11 --tag imagename:latest ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+	if joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_ValidateAddHosts(t *testing.T) {
+	valid := []string{"registry.internal:10.0.0.10", "ipv6.internal:::1", "docker.host:host-gateway"}
+	if err := ValidateAddHosts(valid); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	cases := map[string]string{
+		"registry.internal":           `invalid add-host: "registry.internal", must take the form host:ip`,
+		":10.0.0.10":                  `invalid add-host: ":10.0.0.10", must take the form host:ip`,
+		"registry.internal:10.0.0":    `invalid add-host: "registry.internal:10.0.0", invalid IP address: "10.0.0"`,
+		"registry.internal:":          `invalid add-host: "registry.internal:", invalid IP address: ""`,
+		"registry internal:10.0.0.10": `invalid add-host: "registry internal:10.0.0.10", invalid host name: "registry internal"`,
+	}
+
+	for entry, want := range cases {
+		err := ValidateAddHosts([]string{"ok.internal:10.0.0.1", entry})
+		if err == nil {
+			t.Errorf("want error for %q", entry)
+			continue
+		}
+		if err.Error() != want {
+			t.Errorf("want error %q, got %q", want, err.Error())
+		}
+	}
+}
+
+func Test_getDockerBuildCommand_WithBuildNetwork(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:        "imagename:latest",
+		AddHosts:     []string{"registry.internal:10.0.0.10"},
+		BuildNetwork: "host",
+		BuildArgMap:  make(map[string]string),
+	}
+
+	want := "build --add-host registry.internal:10.0.0.10 --network host --tag imagename:latest ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+	if joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_getDockerBuildxCommand_WithBuildNetwork(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:        "imagename:latest",
+		Platforms:    "linux/arm64",
+		BuildNetwork: "build-net",
+		BuildArgMap:  make(map[string]string),
+	}
+
+	want := "buildx build --progress=plain --platform=linux/arm64 --output=type=registry,push=true --network build-net --tag imagename:latest ."
+
+	_, args := getDockerBuildxCommand(dockerBuildVal)
+
+	joined := strings.Join(args, " ")
+	if joined != want {
+		t.Errorf("getDockerBuildxCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_validateBuildxNetwork(t *testing.T) {
+	cases := []struct {
+		name      string
+		network   string
+		platforms string
+		wantErr   bool
+	}{
+		{name: "no network", platforms: "linux/amd64,linux/arm64"},
+		{name: "host network single platform", network: "host", platforms: "linux/amd64"},
+		{name: "named network multi-platform", network: "build-net", platforms: "linux/amd64,linux/arm64"},
+		{name: "host network multi-platform", network: "host", platforms: "linux/amd64,linux/arm64", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateBuildxNetwork(dockerBuild{BuildNetwork: tc.network, Platforms: tc.platforms})
+			if tc.wantErr && err == nil {
+				t.Errorf("want error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
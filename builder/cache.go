@@ -0,0 +1,119 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheIndexFile is written by BuildKit at the root of a local cache
+const cacheIndexFile = "index.json"
+
+// inlineCacheTag is the rolling tag of an image built with InlineCache, which
+// holds the cache for the next build
+const inlineCacheTag = "buildcache"
+
+// inlineCacheArg asks BuildKit to write its cache metadata into the image
+const inlineCacheArg = "BUILDKIT_INLINE_CACHE"
+
+// buildkitEnv enables BuildKit for "docker build", as the classic builder ignores
+// the inline cache
+const buildkitEnv = "DOCKER_BUILDKIT"
+
+// functionCacheDir returns the absolute path to the local BuildKit cache of a
+// function within cacheDir. Each function has its own cache, so that parallel
+// builds of a stack never write to the same cache.
+func functionCacheDir(cacheDir, functionName string) (string, error) {
+	return filepath.Abs(filepath.Join(cacheDir, functionName))
+}
+
+// cacheArgs returns the --cache-from and --cache-to values for the build of
+// functionName with a local cache in cacheDir. The cache is only imported once it
+// exists, and is exported to a new folder which replaces it after a successful
+// build, see commitCache, as BuildKit adds to a local cache without removing
+// stale blobs.
+func cacheArgs(cacheDir, functionName string) (cacheFrom, cacheTo string, err error) {
+	dir, err := functionCacheDir(cacheDir, functionName)
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, cacheIndexFile)); err == nil {
+		cacheFrom = fmt.Sprintf("type=local,src=%s", dir)
+	}
+
+	cacheTo = fmt.Sprintf("type=local,dest=%s,mode=max", dir+".new")
+
+	return cacheFrom, cacheTo, nil
+}
+
+// commitCache replaces the local cache of functionName within cacheDir with the
+// cache exported by its last build
+func commitCache(cacheDir, functionName string) error {
+	dir, err := functionCacheDir(cacheDir, functionName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dir + ".new"); err != nil {
+		return fmt.Errorf("no build cache was exported to %s: %s", dir+".new", err.Error())
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("unable to replace the build cache %s: %s", dir, err.Error())
+	}
+
+	if err := os.Rename(dir+".new", dir); err != nil {
+		return fmt.Errorf("unable to replace the build cache %s: %s", dir, err.Error())
+	}
+
+	return nil
+}
+
+// InlineCacheImage returns the rolling :buildcache tag of image, i.e.
+// alexellis/fn:0.1 gives alexellis/fn:buildcache
+func InlineCacheImage(image string) string {
+	return imageRepository(image) + ":" + inlineCacheTag
+}
+
+// withInlineCache returns build with the cache written into the image, which is
+// also tagged as InlineCacheImage, and imported from InlineCacheImage, so that a
+// build on a fresh runner reuses the layers of the last pushed build
+func withInlineCache(build dockerBuild) dockerBuild {
+	buildArgMap := map[string]string{}
+	for k, v := range build.BuildArgMap {
+		buildArgMap[k] = v
+	}
+	buildArgMap[inlineCacheArg] = "1"
+
+	build.BuildArgMap = buildArgMap
+	build.ExtraTags = append(append([]string{}, build.ExtraTags...), inlineCacheTag)
+	build.CacheFrom = InlineCacheImage(build.Image)
+	return build
+}
+
+// withBuildCache returns build with the --cache-from and --cache-to of the
+// CacheDir of config, or the inline cache, when either is set
+func withBuildCache(config BuildImageConfig, build dockerBuild) (dockerBuild, error) {
+	if config.InlineCache {
+		if len(config.CacheDir) > 0 {
+			return build, fmt.Errorf("--inline-cache cannot be used with --cache-dir, choose one cache")
+		}
+		return withInlineCache(build), nil
+	}
+
+	if len(config.CacheDir) == 0 {
+		return build, nil
+	}
+
+	cacheFrom, cacheTo, err := cacheArgs(config.CacheDir, config.FunctionName)
+	if err != nil {
+		return build, err
+	}
+
+	build.CacheFrom, build.CacheTo = cacheFrom, cacheTo
+	return build, nil
+}
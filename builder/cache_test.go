@@ -0,0 +1,186 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_cacheArgs(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(cacheDir, "fn1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cacheDir, "fn1", cacheIndexFile), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		function      string
+		wantCacheFrom string
+		wantCacheTo   string
+	}{
+		{
+			function:      "fn1",
+			wantCacheFrom: "type=local,src=" + filepath.Join(cacheDir, "fn1"),
+			wantCacheTo:   "type=local,dest=" + filepath.Join(cacheDir, "fn1.new") + ",mode=max",
+		},
+		{
+			function:    "fn2",
+			wantCacheTo: "type=local,dest=" + filepath.Join(cacheDir, "fn2.new") + ",mode=max",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.function, func(t *testing.T) {
+			cacheFrom, cacheTo, err := cacheArgs(cacheDir, tc.function)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if cacheFrom != tc.wantCacheFrom {
+				t.Errorf("want --cache-from %q, got %q", tc.wantCacheFrom, cacheFrom)
+			}
+			if cacheTo != tc.wantCacheTo {
+				t.Errorf("want --cache-to %q, got %q", tc.wantCacheTo, cacheTo)
+			}
+		})
+	}
+}
+
+func Test_cacheArgs_RelativeCacheDir(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, cacheTo, err := cacheArgs(".cache", "fn")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// docker runs within the build context, so the cache must be an absolute path
+	want := "type=local,dest=" + filepath.Join(wd, ".cache", "fn.new") + ",mode=max"
+	if cacheTo != want {
+		t.Errorf("want --cache-to %q, got %q", want, cacheTo)
+	}
+}
+
+func Test_commitCache(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	files := map[string]string{
+		"fn/index.json":     "old",
+		"fn/blobs/stale":    "stale",
+		"fn.new/index.json": "new",
+	}
+	for name, content := range files {
+		name = filepath.Join(cacheDir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := commitCache(cacheDir, "fn"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(cacheDir, "fn", cacheIndexFile))
+	if err != nil || string(data) != "new" {
+		t.Errorf("want the exported cache in place, got %q, %v", string(data), err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "fn", "blobs", "stale")); !os.IsNotExist(err) {
+		t.Errorf("want the stale cache removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "fn.new")); !os.IsNotExist(err) {
+		t.Errorf("want no export folder left behind, got %v", err)
+	}
+}
+
+func Test_BuildImage_CacheDir(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubBuildxBuild(t)
+
+	cacheDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(cacheDir, "fn.new"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		CacheDir:     cacheDir,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := "buildx build --output type=docker --cache-to type=local,dest=" + filepath.Join(cacheDir, "fn.new") + ",mode=max --tag fn:latest ."
+	if got := strings.Join((*builds)[0].Args, " "); got != want {
+		t.Errorf("want args %q, got %q", want, got)
+	}
+
+	if _, err := os.Stat(filepath.Join(cacheDir, "fn")); err != nil {
+		t.Errorf("want the exported cache to replace the cache of the function: %s", err)
+	}
+}
+
+func Test_InlineCacheImage(t *testing.T) {
+	cases := map[string]string{
+		"fn":                            "fn:buildcache",
+		"alexellis/fn:0.1":              "alexellis/fn:buildcache",
+		"registry:5000/fn:0.1":          "registry:5000/fn:buildcache",
+		"alexellis/fn:0.1@sha256:abcd0": "alexellis/fn:buildcache",
+	}
+
+	for image, want := range cases {
+		if got := InlineCacheImage(image); got != want {
+			t.Errorf("%s: want %q, got %q", image, want, got)
+		}
+	}
+}
+
+func Test_BuildImage_InlineCache(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		InlineCache:  true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	args := strings.Join((*builds)[0].Args, " ")
+	for _, want := range []string{"--build-arg BUILDKIT_INLINE_CACHE=1", "--cache-from alexellis/fn:buildcache", "--tag alexellis/fn:buildcache"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("want %q in args, got: %s", want, args)
+		}
+	}
+
+	if env := strings.Join((*builds)[0].Env, " "); !strings.Contains(env, "DOCKER_BUILDKIT=1") {
+		t.Errorf("want BuildKit enabled, got env: %s", env)
+	}
+}
+
+func Test_withBuildCache_InlineCacheWithCacheDir(t *testing.T) {
+	_, err := withBuildCache(BuildImageConfig{InlineCache: true, CacheDir: t.TempDir()}, dockerBuild{Image: "fn"})
+	if err == nil || !strings.Contains(err.Error(), "--inline-cache cannot be used with --cache-dir") {
+		t.Errorf("want an error for both caches, got: %v", err)
+	}
+}
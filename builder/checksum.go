@@ -0,0 +1,103 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TemplateChecksumFile is written to the root of a language template and holds
+// the expected checksum of the rest of the template's files
+const TemplateChecksumFile = ".template-checksum"
+
+// ComputeTemplateChecksum returns a sha256 checksum of every file within templateDir,
+// the checksum covers the relative path and contents of each file, visited in lexical
+// order, so that it is stable across machines.
+func ComputeTemplateChecksum(templateDir string) (string, error) {
+	hash := sha256.New()
+
+	err := filepath.Walk(templateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(templateDir, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || rel == TemplateChecksumFile {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fmt.Fprintf(hash, "%s\x00", filepath.ToSlash(rel))
+		if _, err := io.Copy(hash, f); err != nil {
+			return err
+		}
+		hash.Write([]byte{0})
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// WriteTemplateChecksum computes the checksum of templateDir and records it in
+// the TemplateChecksumFile for later use with VerifyTemplateChecksum
+func WriteTemplateChecksum(templateDir string) (string, error) {
+	checksum, err := ComputeTemplateChecksum(templateDir)
+	if err != nil {
+		return "", err
+	}
+
+	checksumPath := filepath.Join(templateDir, TemplateChecksumFile)
+	if err := ioutil.WriteFile(checksumPath, []byte(checksum+"\n"), 0644); err != nil {
+		return "", err
+	}
+
+	return checksum, nil
+}
+
+// VerifyTemplateChecksum compares the recorded TemplateChecksumFile against the
+// current contents of templateDir and returns an error on a mismatch
+func VerifyTemplateChecksum(templateDir string) error {
+	checksumPath := filepath.Join(templateDir, TemplateChecksumFile)
+
+	recorded, err := ioutil.ReadFile(checksumPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("template checksum file not found: %s", checksumPath)
+		}
+		return err
+	}
+
+	checksum, err := ComputeTemplateChecksum(templateDir)
+	if err != nil {
+		return err
+	}
+
+	want := strings.TrimSpace(string(recorded))
+	if checksum != want {
+		return fmt.Errorf("template %s does not match its checksum, want: %s, got: %s", templateDir, want, checksum)
+	}
+
+	return nil
+}
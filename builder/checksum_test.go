@@ -0,0 +1,126 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplateTree(t *testing.T, dir string) {
+	t.Helper()
+
+	files := map[string]string{
+		"template.yml":        "language: python3\n",
+		"Dockerfile":          "FROM python:3\n",
+		"function/handler.py": "def handle(req):\n    return req\n",
+	}
+
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_VerifyTemplateChecksum_Matching(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateTree(t, dir)
+
+	if _, err := WriteTemplateChecksum(dir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := VerifyTemplateChecksum(dir); err != nil {
+		t.Errorf("want matching checksum, got: %s", err)
+	}
+}
+
+func Test_VerifyTemplateChecksum_StableAcrossCopies(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeTemplateTree(t, a)
+	writeTemplateTree(t, b)
+
+	sumA, err := ComputeTemplateChecksum(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sumB, err := ComputeTemplateChecksum(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sumA != sumB {
+		t.Errorf("want identical trees to have the same checksum, got %s and %s", sumA, sumB)
+	}
+}
+
+func Test_VerifyTemplateChecksum_Tampered(t *testing.T) {
+	cases := []struct {
+		name   string
+		tamper func(dir string) error
+	}{
+		{
+			name: "modified file",
+			tamper: func(dir string) error {
+				return ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM python:2\n"), 0600)
+			},
+		},
+		{
+			name: "added file",
+			tamper: func(dir string) error {
+				return ioutil.WriteFile(filepath.Join(dir, "function", "extra.py"), []byte(""), 0600)
+			},
+		},
+		{
+			name: "removed file",
+			tamper: func(dir string) error {
+				return os.Remove(filepath.Join(dir, "function", "handler.py"))
+			},
+		},
+		{
+			name: "renamed file",
+			tamper: func(dir string) error {
+				return os.Rename(filepath.Join(dir, "Dockerfile"), filepath.Join(dir, "Dockerfile.old"))
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplateTree(t, dir)
+
+			if _, err := WriteTemplateChecksum(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tc.tamper(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			err := VerifyTemplateChecksum(dir)
+			if err == nil {
+				t.Fatalf("want error for a tampered template")
+			}
+			if !strings.Contains(err.Error(), "does not match its checksum") {
+				t.Errorf("want checksum mismatch error, got: %s", err)
+			}
+		})
+	}
+}
+
+func Test_VerifyTemplateChecksum_MissingFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateTree(t, dir)
+
+	err := VerifyTemplateChecksum(dir)
+	if err == nil || !strings.HasPrefix(err.Error(), "template checksum file not found") {
+		t.Errorf("want checksum file not found error, got: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ContextHash stages the build context for config, as per CreateBuildContext, and
+// returns a sha256 of its files and of the inputs to the build: the image name and
+// its tags, once expanded, the build-args, labels and build option packages. Two builds with the
+// same hash would be given the same inputs, so an external cache can use it to
+// decide whether to build. Modification times are ignored and entries are visited
+// in lexical order, so that the hash is stable across machines.
+func ContextHash(config BuildImageConfig) (string, error) {
+	plan, err := PlanBuild(config)
+	if err != nil {
+		return "", err
+	}
+
+	// The build context is staged quietly, as the hash is the output
+	if config.ProgressFunc == nil {
+		config.ProgressFunc = func(event BuildEvent) {}
+	}
+	config.Verbose = false
+
+	contextPath, err := CreateBuildContext(config)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+
+	fmt.Fprintf(h, "image\x00%s\x00", plan.Image)
+
+	tags := append([]string{}, plan.Tags...)
+	sort.Strings(tags)
+	for _, tag := range tags {
+		fmt.Fprintf(h, "tag\x00%s\x00", tag)
+	}
+
+	for _, k := range sortedKeys(plan.BuildArgs) {
+		fmt.Fprintf(h, "build-arg\x00%s\x00%s\x00", k, plan.BuildArgs[k])
+	}
+
+	for _, k := range sortedKeys(plan.Labels) {
+		fmt.Fprintf(h, "label\x00%s\x00%s\x00", k, plan.Labels[k])
+	}
+
+	for _, pkg := range plan.Packages {
+		fmt.Fprintf(h, "package\x00%s\x00", pkg)
+	}
+
+	if err := hashTree(h, contextPath); err != nil {
+		return "", fmt.Errorf("unable to hash the build context %s: %s", contextPath, err.Error())
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashTree writes the relative path of each entry within dir to h, along with the
+// contents and executable bit of a file, or the target of a symlink. Other modes
+// and modification times are ignored, as they depend on the machine.
+func hashTree(h hash.Hash, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case info.IsDir():
+			fmt.Fprintf(h, "dir\x00%s\x00", rel)
+
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "symlink\x00%s\x00%s\x00", rel, filepath.ToSlash(target))
+
+		default:
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			fmt.Fprintf(h, "file\x00%s\x00%t\x00%d\x00", rel, info.Mode()&0111 != 0, info.Size())
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
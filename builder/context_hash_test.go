@@ -0,0 +1,117 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+func Test_ContextHash(t *testing.T) {
+	setupBuildContextTest(t, "hash-lang")
+
+	config := BuildImageConfig{
+		Image:         "ghcr.io/org/fn:0.1.0",
+		Handler:       "./handler",
+		FunctionName:  "fn",
+		Language:      "hash-lang",
+		BuildArgMap:   map[string]string{"B": "2", "A": "1"},
+		BuildLabelMap: map[string]string{"team": "images"},
+	}
+
+	want, err := ContextHash(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(want, "sha256:") || len(want) != len("sha256:")+64 {
+		t.Fatalf("want a sha256 hash, got %q", want)
+	}
+
+	t.Run("stable across runs and modification times", func(t *testing.T) {
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes("handler/handler.txt", later, later); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ContextHash(config)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != want {
+			t.Errorf("want the same hash %s for a second run, got %s", want, got)
+		}
+	})
+
+	t.Run("changes with a build-arg", func(t *testing.T) {
+		changed := config
+		changed.BuildArgMap = map[string]string{"B": "2", "A": "3"}
+
+		got, err := ContextHash(changed)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got == want {
+			t.Errorf("want a new hash when a build-arg changes, got %s", got)
+		}
+	})
+
+	t.Run("changes with an expanded tag", func(t *testing.T) {
+		tagged := config
+		tagged.AlsoTags = []string{"{sha}"}
+
+		stubGit(t, "a1b2c3d", "master", "")
+		first, err := ContextHash(tagged)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		stubGit(t, "e4f5a6b", "master", "")
+		second, err := ContextHash(tagged)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if first == second {
+			t.Errorf("want a new hash when {sha} expands to another commit, got %s", first)
+		}
+	})
+
+	t.Run("no staging output", func(t *testing.T) {
+		if err := os.MkdirAll("handler/build", 0700); err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll("handler/build")
+
+		excluded := config
+		excluded.ExcludePaths = []string{"*.txt"}
+		excluded.Verbose = true
+
+		out := test.CaptureStdout(func() {
+			if _, err := ContextHash(excluded); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+
+		if len(out) > 0 {
+			t.Errorf("want no output while hashing, got:\n%s", out)
+		}
+	})
+
+	t.Run("changes with the handler", func(t *testing.T) {
+		if err := ioutil.WriteFile("handler/handler.txt", []byte("changed handler\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		defer ioutil.WriteFile("handler/handler.txt", []byte("user handler\n"), 0600)
+
+		got, err := ContextHash(config)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got == want {
+			t.Errorf("want a new hash when the handler changes, got %s", got)
+		}
+	})
+}
@@ -2,6 +2,8 @@ package builder
 
 // Copy "recursivelies copy a file object from source to dest while perserving
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,8 +12,19 @@ import (
 	"path/filepath"
 )
 
-// CopyFiles copies files from src to destination.
+// copyContents copies the contents of a file, it can be replaced in tests to
+// simulate a short write
+var copyContents = io.Copy
+
+// CopyFiles copies files from src to destination. The size of each copied file is
+// checked against its source, so that a partial copy is an error.
 func CopyFiles(src, dest string) error {
+	return copyFiles(src, dest, false)
+}
+
+// copyFiles copies src to dest as per CopyFiles, when checksum is set the sha256 of
+// each copied file is also compared with its source
+func copyFiles(src, dest string, checksum bool) error {
 	info, err := os.Stat(src)
 	if err != nil {
 		return err
@@ -19,15 +32,15 @@ func CopyFiles(src, dest string) error {
 
 	if info.IsDir() {
 		debugPrint(fmt.Sprintf("Creating directory: %s at %s", info.Name(), dest))
-		return copyDir(src, dest)
+		return copyDir(src, dest, checksum)
 	}
 
 	debugPrint(fmt.Sprintf("cp - %s %s", src, dest))
-	return copyFile(src, dest)
+	return copyFile(src, dest, checksum)
 }
 
 // copyDir will recursively copy a directory to dest
-func copyDir(src, dest string) error {
+func copyDir(src, dest string, checksum bool) error {
 	info, err := os.Stat(src)
 	if err != nil {
 		return fmt.Errorf("error reading dest stats: %s", err.Error())
@@ -43,9 +56,54 @@ func copyDir(src, dest string) error {
 	}
 
 	for _, info := range infos {
-		if err := CopyFiles(
+		if err := copyFiles(
+			filepath.Join(src, info.Name()),
+			filepath.Join(dest, info.Name()),
+			checksum,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyFilesExcluding copies src to dest as per CopyFiles, skipping any file or folder
+// whose path relative to the root of the copy matches one of the exclude patterns,
+// rel is the path of src relative to that root
+func copyFilesExcluding(src, dest, rel string, exclude []string, checksum bool) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		debugPrint(fmt.Sprintf("cp - %s %s", src, dest))
+		return copyFile(src, dest, checksum)
+	}
+
+	if err := os.MkdirAll(dest, info.Mode()); err != nil {
+		return fmt.Errorf("error creating path: %s - %s", dest, err.Error())
+	}
+
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		childRel := filepath.Join(rel, info.Name())
+		if isExcludedPath(childRel, exclude) {
+			debugPrint(fmt.Sprintf("Excluded: %s", childRel))
+			continue
+		}
+
+		if err := copyFilesExcluding(
 			filepath.Join(src, info.Name()),
 			filepath.Join(dest, info.Name()),
+			childRel,
+			exclude,
+			checksum,
 		); err != nil {
 			return err
 		}
@@ -54,8 +112,29 @@ func copyDir(src, dest string) error {
 	return nil
 }
 
-// copyFile will copy a file with the same mode as the src file
-func copyFile(src, dest string) error {
+// isExcludedPath returns true when rel matches one of the patterns, as per filepath.Match
+func isExcludedPath(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(filepath.Clean(pattern), rel); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateExcludePaths checks that each pattern is valid for filepath.Match
+func ValidateExcludePaths(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %s", pattern, err.Error())
+		}
+	}
+	return nil
+}
+
+// copyFile will copy a file with the same mode as the src file, then check that
+// the size of dest, and its sha256 when checksum is set, match src
+func copyFile(src, dest string, checksum bool) error {
 	info, err := os.Stat(src)
 	if err != nil {
 		return fmt.Errorf("error reading src file stats: %s", err.Error())
@@ -82,11 +161,50 @@ func copyFile(src, dest string) error {
 	}
 	defer s.Close()
 
-	_, err = io.Copy(f, s)
+	hash := sha256.New()
+	_, err = copyContents(f, io.TeeReader(s, hash))
 	if err != nil {
 		return fmt.Errorf("Error copying dest file: %s\n" + err.Error())
 	}
 
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing dest file: %s", err.Error())
+	}
+
+	return verifyCopy(src, dest, info.Size(), hash.Sum(nil), checksum)
+}
+
+// verifyCopy returns an error when the copy of src at dest is not size bytes, or
+// when checksum is set and its sha256 is not srcSum
+func verifyCopy(src, dest string, size int64, srcSum []byte, checksum bool) error {
+	destInfo, err := os.Stat(dest)
+	if err != nil {
+		return fmt.Errorf("error reading dest file stats: %s", err.Error())
+	}
+
+	if destInfo.Size() != size {
+		return fmt.Errorf("incomplete copy of %s to %s: %d of %d bytes written", src, dest, destInfo.Size(), size)
+	}
+
+	if !checksum {
+		return nil
+	}
+
+	d, err := os.Open(dest)
+	if err != nil {
+		return fmt.Errorf("error opening dest file: %s", err.Error())
+	}
+	defer d.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, d); err != nil {
+		return fmt.Errorf("error reading dest file: %s", err.Error())
+	}
+
+	if !bytes.Equal(hash.Sum(nil), srcSum) {
+		return fmt.Errorf("corrupt copy of %s to %s: the sha256 checksum does not match", src, dest)
+	}
+
 	return nil
 }
 
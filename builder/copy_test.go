@@ -1,12 +1,18 @@
 package builder
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/openfaas/faas-cli/test"
 )
 
 func Test_CopyFiles(t *testing.T) {
@@ -113,3 +119,101 @@ func checkDestinationFiles(dir string, numberOfFiles, mode int) error {
 
 	return nil
 }
+
+// stubCopyContents replaces copyContents for the duration of a test
+func stubCopyContents(t *testing.T, fn func(dst io.Writer, src io.Reader) (int64, error)) {
+	orig := copyContents
+	copyContents = fn
+	t.Cleanup(func() { copyContents = orig })
+}
+
+func Test_CopyFiles_ShortWrite(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "handler.go")
+	if err := ioutil.WriteFile(src, []byte("package function\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a network filesystem which drops the end of the file
+	stubCopyContents(t, func(dst io.Writer, src io.Reader) (int64, error) {
+		return io.CopyN(dst, src, 4)
+	})
+
+	dest := filepath.Join(dir, "build", "handler.go")
+	err := CopyFiles(src, dest)
+	if err == nil {
+		t.Fatal("want an error for a truncated copy")
+	}
+
+	want := fmt.Sprintf("incomplete copy of %s to %s: 4 of 17 bytes written", src, dest)
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
+
+func Test_copyFiles_ChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "handler.go")
+	if err := ioutil.WriteFile(src, []byte("package function\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a copy of the right size, with corrupt contents
+	stubCopyContents(t, func(dst io.Writer, src io.Reader) (int64, error) {
+		data, err := ioutil.ReadAll(src)
+		if err != nil {
+			return 0, err
+		}
+		n, err := dst.Write(bytes.ToUpper(data))
+		return int64(n), err
+	})
+
+	dest := filepath.Join(dir, "build", "handler.go")
+
+	if err := copyFiles(src, dest, false); err != nil {
+		t.Fatalf("want the size check alone to pass, got: %s", err)
+	}
+
+	err := copyFiles(src, dest, true)
+	if err == nil {
+		t.Fatal("want an error for a corrupt copy")
+	}
+
+	want := fmt.Sprintf("corrupt copy of %s to %s: the sha256 checksum does not match", src, dest)
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
+
+func Test_copyFiles_ChecksumMatch(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"handler.go", "go.mod"} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(name+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := copyFiles(src, filepath.Join(dir, "dest"), true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func Test_createBuildContext_ShortWriteFailsBuild(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	stubCopyContents(t, func(dst io.Writer, src io.Reader) (int64, error) {
+		return io.CopyN(dst, src, 1)
+	})
+
+	test.CaptureStdout(func() {
+		_, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true})
+		if err == nil || !strings.Contains(err.Error(), "incomplete copy of") {
+			t.Errorf("want an incomplete copy error, got: %v", err)
+		}
+	})
+}
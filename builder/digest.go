@@ -0,0 +1,96 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// imageDigestFormat prints each of the image's RepoDigests on its own line,
+// followed by the image ID
+const imageDigestFormat = "{{range .RepoDigests}}{{println .}}{{end}}{{.Id}}"
+
+// inspectImageDigest returns the output of "docker image inspect" for image with
+// imageDigestFormat, from the DockerBinary and DockerContext of config, it can be
+// replaced in tests
+var inspectImageDigest = func(config BuildImageConfig, image string) (string, error) {
+	command, args := dockerCommand(config, "image", "inspect", "--format", imageDigestFormat, image)
+
+	task := v1execute.ExecTask{
+		Command:     command,
+		Args:        args,
+		StreamStdio: false,
+	}
+
+	res, err := execTask(task)
+	if err != nil {
+		return "", err
+	}
+
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf("docker image inspect %s failed: %s", image, strings.TrimSpace(res.Stderr))
+	}
+
+	return res.Stdout, nil
+}
+
+// imageRepository returns image without its tag or digest, i.e. alexellis/fn:0.1
+// gives alexellis/fn, a registry port is kept
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i > -1 {
+		image = image[:i]
+	}
+
+	slash := strings.LastIndex(image, "/")
+	if i := strings.LastIndex(image, ":"); i > slash {
+		image = image[:i]
+	}
+
+	return image
+}
+
+// parseImageDigest returns the repository digest of image from the output of
+// inspectImageDigest, i.e. alexellis/fn@sha256:..., which can be used to pin a
+// deployment. An image which has not been pushed has no repository digest, so
+// its image ID is returned instead.
+func parseImageDigest(output string, image string) (string, error) {
+	lines := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if trimmed := strings.TrimSpace(line); len(trimmed) > 0 {
+			lines = append(lines, trimmed)
+		}
+	}
+
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no image ID found for %s", image)
+	}
+
+	imageID := lines[len(lines)-1]
+	if !strings.HasPrefix(imageID, "sha256:") {
+		return "", fmt.Errorf("unexpected image ID for %s: %s", image, imageID)
+	}
+
+	repository := imageRepository(image)
+	for _, repoDigest := range lines[:len(lines)-1] {
+		if imageRepository(repoDigest) == repository {
+			return repoDigest, nil
+		}
+	}
+
+	return imageID, nil
+}
+
+// getImageDigest returns the digest of an image built for config, see
+// parseImageDigest
+func getImageDigest(config BuildImageConfig, image string) (string, error) {
+	output, err := inspectImageDigest(config, image)
+	if err != nil {
+		return "", err
+	}
+
+	return parseImageDigest(output, image)
+}
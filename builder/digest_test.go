@@ -0,0 +1,127 @@
+package builder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+func Test_parseImageDigest(t *testing.T) {
+	const imageID = "sha256:4f1b2d3c4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9"
+	const repoDigest = "sha256:9a8b7c6d5e4f30211203f4e5d6c7b8a90f1e2d3c4b5a69788796a5b4c3d2e1f0"
+
+	cases := []struct {
+		name    string
+		output  string
+		image   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "local build without a push",
+			output: imageID + "\n",
+			image:  "alexellis/fn:0.1",
+			want:   imageID,
+		},
+		{
+			name:   "repository digest",
+			output: "alexellis/fn@" + repoDigest + "\n" + imageID,
+			image:  "alexellis/fn:0.1",
+			want:   "alexellis/fn@" + repoDigest,
+		},
+		{
+			name:   "repository digest of another repository",
+			output: "alexellis/other@" + repoDigest + "\n" + imageID,
+			image:  "alexellis/fn:0.1",
+			want:   imageID,
+		},
+		{
+			name:   "registry with a port",
+			output: "registry.local:5000/fn@" + repoDigest + "\n" + imageID,
+			image:  "registry.local:5000/fn:latest",
+			want:   "registry.local:5000/fn@" + repoDigest,
+		},
+		{
+			name:    "empty output",
+			output:  "\n",
+			image:   "alexellis/fn:0.1",
+			wantErr: "no image ID found for alexellis/fn:0.1",
+		},
+		{
+			name:    "unexpected output",
+			output:  "Error: No such image: alexellis/fn:0.1",
+			image:   "alexellis/fn:0.1",
+			wantErr: "unexpected image ID",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseImageDigest(tc.output, tc.image)
+			if len(tc.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("want error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_imageRepository(t *testing.T) {
+	cases := map[string]string{
+		"fn":                               "fn",
+		"alexellis/fn:0.1":                 "alexellis/fn",
+		"registry.local:5000/fn":           "registry.local:5000/fn",
+		"registry.local:5000/fn:latest":    "registry.local:5000/fn",
+		"alexellis/fn@sha256:0123456789ab": "alexellis/fn",
+	}
+
+	for image, want := range cases {
+		if got := imageRepository(image); got != want {
+			t.Errorf("imageRepository(%q) want %q, got %q", image, want, got)
+		}
+	}
+}
+
+func Test_inspectImageDigest_DockerContext(t *testing.T) {
+	var got v1execute.ExecTask
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		got = task
+		return v1execute.ExecResult{Stdout: "sha256:1234\n"}, nil
+	})
+
+	if _, err := getImageDigest(BuildImageConfig{DockerContext: "remote"}, "fn:0.1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"--context", "remote", "image", "inspect", "--format", imageDigestFormat, "fn:0.1"}
+	if got.Command != "docker" || !reflect.DeepEqual(got.Args, want) {
+		t.Errorf("want docker %v, got %s %v", want, got.Command, got.Args)
+	}
+}
+
+func Test_inspectImageDigest_DockerBinary(t *testing.T) {
+	var got v1execute.ExecTask
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		got = task
+		return v1execute.ExecResult{Stdout: "sha256:1234\n"}, nil
+	})
+
+	if _, err := getImageDigest(BuildImageConfig{DockerBinary: "/usr/local/bin/podman"}, "fn:0.1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"image", "inspect", "--format", imageDigestFormat, "fn:0.1"}
+	if got.Command != "/usr/local/bin/podman" || !reflect.DeepEqual(got.Args, want) {
+		t.Errorf("want /usr/local/bin/podman %v, got %s %v", want, got.Command, got.Args)
+	}
+}
@@ -0,0 +1,435 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// execTask runs an external command, it can be replaced in tests
+var execTask = func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+	return task.Execute()
+}
+
+// Minimum Docker versions required by optional build features
+const (
+	minSquashVersion = "1.13.0"
+	minBuildxVersion = "19.03.0"
+)
+
+// DockerVersion holds the versions reported by the Docker client and daemon
+type DockerVersion struct {
+	Client string
+	Server string
+
+	// Experimental is true when the daemon has experimental features enabled
+	Experimental bool
+}
+
+// Squash modes for when the Docker daemon does not support --squash
+const (
+	// SquashRequire fails the build when --squash is not supported
+	SquashRequire = "require"
+
+	// SquashBestEffort prints a warning and builds without --squash
+	SquashBestEffort = "best-effort"
+)
+
+// dockerVersionResult and buildxVersionResult are the cached results of "docker
+// version" and "docker buildx version"
+type dockerVersionResult struct {
+	version DockerVersion
+	err     error
+}
+
+type buildxVersionResult struct {
+	version string
+	err     error
+}
+
+var (
+	versionCacheMu sync.Mutex
+	dockerVersions = map[string]dockerVersionResult{}
+	buildxVersions = map[string]buildxVersionResult{}
+)
+
+// dockerTarget identifies the docker binary and context of config, as the versions
+// are cached for each of them
+func dockerTarget(config BuildImageConfig) string {
+	return config.DockerBinary + "\x00" + config.DockerContext
+}
+
+// GetDockerVersion runs "docker version" with the DockerBinary and DockerContext of
+// config once, and caches the client and server versions for the rest of the
+// invocation.
+func GetDockerVersion(config BuildImageConfig) (DockerVersion, error) {
+	versionCacheMu.Lock()
+	defer versionCacheMu.Unlock()
+
+	if cached, ok := dockerVersions[dockerTarget(config)]; ok {
+		return cached.version, cached.err
+	}
+
+	version, err := readDockerVersion(config)
+	dockerVersions[dockerTarget(config)] = dockerVersionResult{version: version, err: err}
+
+	return version, err
+}
+
+// readDockerVersion runs "docker version" for config and parses its output. A
+// non-zero exit code, i.e. when the daemon cannot be reached, is an error even
+// though the client's version may have been printed.
+func readDockerVersion(config BuildImageConfig) (DockerVersion, error) {
+	command, args := dockerCommand(config, "version", "--format", "{{.Client.Version}} {{.Server.Version}} {{.Server.Experimental}}")
+
+	res, err := execTask(v1execute.ExecTask{
+		Command:     command,
+		Args:        args,
+		StreamStdio: false,
+	})
+	if err != nil {
+		return DockerVersion{}, err
+	}
+
+	if res.ExitCode != 0 {
+		return DockerVersion{}, fmt.Errorf("%s version exited with code %d: %s", command, res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+
+	version, err := parseDockerVersion(res.Stdout)
+	if err != nil && len(res.Stderr) > 0 {
+		err = fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(res.Stderr))
+	}
+
+	return version, err
+}
+
+// parseDockerVersion parses the output of:
+// docker version --format "{{.Client.Version}} {{.Server.Version}} {{.Server.Experimental}}"
+func parseDockerVersion(output string) (DockerVersion, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return DockerVersion{}, fmt.Errorf("unable to detect the Docker version")
+	}
+
+	version := DockerVersion{Client: fields[0]}
+	if len(fields) > 1 {
+		version.Server = fields[1]
+	}
+	if len(fields) > 2 {
+		version.Experimental = fields[2] == "true"
+	}
+
+	if _, err := parseVersion(version.Client); err != nil {
+		return DockerVersion{}, err
+	}
+
+	return version, nil
+}
+
+// GetBuildxVersion runs "docker buildx version" with the DockerBinary and
+// DockerContext of config once, and caches the result
+func GetBuildxVersion(config BuildImageConfig) (string, error) {
+	versionCacheMu.Lock()
+	defer versionCacheMu.Unlock()
+
+	if cached, ok := buildxVersions[dockerTarget(config)]; ok {
+		return cached.version, cached.err
+	}
+
+	version, err := readBuildxVersion(config)
+	buildxVersions[dockerTarget(config)] = buildxVersionResult{version: version, err: err}
+
+	return version, err
+}
+
+// readBuildxVersion runs "docker buildx version" for config and parses its output
+func readBuildxVersion(config BuildImageConfig) (string, error) {
+	command, args := dockerCommand(config, "buildx", "version")
+
+	res, err := execTask(v1execute.ExecTask{
+		Command:     command,
+		Args:        args,
+		StreamStdio: false,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf("docker buildx is not available: %s", strings.TrimSpace(res.Stderr))
+	}
+
+	return parseBuildxVersion(res.Stdout)
+}
+
+// parseBuildxVersion parses the output of "docker buildx version" i.e.
+// github.com/docker/buildx v0.8.2 6224def4dd2c3d347eee19db595348c50d7cb491
+func parseBuildxVersion(output string) (string, error) {
+	for _, field := range strings.Fields(output) {
+		if strings.HasPrefix(field, "v") {
+			if _, err := parseVersion(field); err == nil {
+				return field, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("unable to detect the buildx version from: %q", strings.TrimSpace(output))
+}
+
+// printDockerVersion prints the detected Docker versions of config for verbose output
+func printDockerVersion(config BuildImageConfig) {
+	version, err := GetDockerVersion(config)
+	if err != nil {
+		fmt.Printf("Unable to detect the Docker version: %s\n", err.Error())
+		return
+	}
+
+	fmt.Printf("Docker client: %s, server: %s\n", version.Client, version.Server)
+}
+
+// requireDockerVersion returns an error when the Docker daemon of config, or the
+// client if the daemon version is unknown, is older than minVersion.
+func requireDockerVersion(config BuildImageConfig, feature, minVersion string) error {
+	version, err := GetDockerVersion(config)
+	if err != nil {
+		return fmt.Errorf("%s requires Docker >= %s, but the version could not be detected: %s", feature, minVersion, err.Error())
+	}
+
+	current := version.Server
+	if len(current) == 0 {
+		current = version.Client
+	}
+
+	if compareVersions(current, minVersion) < 0 {
+		return fmt.Errorf("%s requires Docker >= %s, found: %s", feature, minVersion, current)
+	}
+
+	return nil
+}
+
+// checkSquashSupport returns whether --squash can be passed to docker, the daemon
+// of config must be recent enough and have experimental features enabled. In
+// SquashBestEffort mode a warning is printed instead of returning an error.
+func checkSquashSupport(config BuildImageConfig, warnings *[]Warning) (bool, error) {
+	err := requireDockerVersion(config, "--squash", minSquashVersion)
+	if err == nil {
+		if version, _ := GetDockerVersion(config); !version.Experimental {
+			err = fmt.Errorf("--squash requires experimental features to be enabled on the Docker daemon, see: https://docs.docker.com/engine/reference/commandline/dockerd/#daemon-configuration-file")
+		}
+	}
+
+	if err == nil {
+		return true, nil
+	}
+
+	if config.SquashMode == SquashBestEffort {
+		warn(warnings, WarnSquashSkipped, "building without --squash, %s", err.Error())
+		return false, nil
+	}
+
+	return false, err
+}
+
+// buildxFlag returns the flag which has config built with docker buildx rather
+// than the classic builder, or an empty string when the classic builder is used,
+// so that errors name a flag that was given rather than --output
+func buildxFlag(config BuildImageConfig) string {
+	switch {
+	case len(config.Output) > 0:
+		return "--output"
+	case len(config.ExportRootFS) > 0:
+		return "--export-rootfs"
+	case config.Reproducible:
+		return "--reproducible"
+	case len(config.CacheDir) > 0:
+		return "--cache-dir"
+	}
+	return ""
+}
+
+// checkOutputSupport returns an error when the buildx output requested by flag
+// cannot be used for config, it is only supported by BuildKit through docker
+// buildx, which does not support --squash
+func checkOutputSupport(config BuildImageConfig, flag string) error {
+	if config.Squash {
+		return fmt.Errorf("%s cannot be used with --squash, which is not supported by buildx", flag)
+	}
+
+	if err := requireDockerVersion(config, flag, minBuildxVersion); err != nil {
+		return err
+	}
+
+	if _, err := GetBuildxVersion(config); err != nil {
+		return fmt.Errorf("%s requires docker buildx: %s", flag, err.Error())
+	}
+
+	if len(config.CacheDir) > 0 {
+		return checkCacheExportDriver(config)
+	}
+
+	return nil
+}
+
+// checkCacheExportDriver returns an error when the active buildx builder uses the
+// docker driver, which cannot export a local cache for --cache-dir
+func checkCacheExportDriver(config BuildImageConfig) error {
+	command, args := dockerCommand(config, "buildx", "inspect")
+
+	res, err := execTask(v1execute.ExecTask{
+		Command:     command,
+		Args:        args,
+		StreamStdio: false,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to inspect the buildx builder: %s", err.Error())
+	}
+
+	if res.ExitCode != 0 {
+		return fmt.Errorf("unable to inspect the buildx builder: %s", strings.TrimSpace(res.Stderr))
+	}
+
+	if driver := parseBuildxDriver(res.Stdout); driver == "docker" {
+		return fmt.Errorf("--cache-dir requires a buildx builder with the docker-container driver, but the active builder uses the docker driver, create one with: docker buildx create --use --driver docker-container")
+	}
+
+	return nil
+}
+
+// parseBuildxDriver returns the driver from the output of "docker buildx inspect"
+// i.e. "Driver: docker-container"
+func parseBuildxDriver(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Driver:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Driver:"))
+		}
+	}
+	return ""
+}
+
+// ValidateDockerBinary returns an error when binary cannot be found on the PATH,
+// or when a path to it is given, is not an executable file
+func ValidateDockerBinary(binary string) error {
+	_, err := resolveDockerBinary(binary)
+	return err
+}
+
+// resolveDockerBinary validates binary as per ValidateDockerBinary, and returns it
+// as an absolute path when it is a relative path, as docker runs from within the
+// build context
+func resolveDockerBinary(binary string) (string, error) {
+	if len(binary) == 0 {
+		return "", nil
+	}
+
+	if _, err := lookPath(binary); err != nil {
+		return "", fmt.Errorf("the docker binary %s is not executable: %s", binary, err.Error())
+	}
+
+	if strings.ContainsRune(binary, filepath.Separator) {
+		return filepath.Abs(binary)
+	}
+
+	return binary, nil
+}
+
+// checkDockerContext returns an error when the DockerContext of config is not one
+// of the contexts listed by "docker context ls" of its DockerBinary
+func checkDockerContext(config BuildImageConfig) error {
+	name := config.DockerContext
+	command, args := dockerCommand(BuildImageConfig{DockerBinary: config.DockerBinary}, "context", "ls", "--format", "{{.Name}}")
+
+	task := v1execute.ExecTask{
+		Command:     command,
+		Args:        args,
+		StreamStdio: false,
+	}
+
+	res, err := execTask(task)
+	if err != nil {
+		return fmt.Errorf("unable to list the docker contexts: %s", err.Error())
+	}
+
+	if res.ExitCode != 0 {
+		return fmt.Errorf("unable to list the docker contexts: %s", strings.TrimSpace(res.Stderr))
+	}
+
+	contexts := strings.Fields(res.Stdout)
+	for _, context := range contexts {
+		if context == name {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("docker context %q not found, available: %s", name, strings.Join(contexts, ", "))
+}
+
+// ValidateSquashMode returns an error for an unknown squash mode
+func ValidateSquashMode(mode string) error {
+	switch mode {
+	case "", SquashRequire, SquashBestEffort:
+		return nil
+	}
+
+	return fmt.Errorf("unknown squash mode: %q, use %q or %q", mode, SquashRequire, SquashBestEffort)
+}
+
+// parseVersion reads the numeric major, minor and patch components from versions
+// such as "20.10.17", "17.12.0-ce" or "v0.8.2", missing components are treated as 0.
+func parseVersion(version string) ([3]int, error) {
+	var parsed [3]int
+
+	trimmed := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(trimmed, "-+"); i > -1 {
+		trimmed = trimmed[:i]
+	}
+
+	parts := strings.Split(trimmed, ".")
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return parsed, fmt.Errorf("unable to parse version: %q", version)
+		}
+		parsed[i] = value
+	}
+
+	return parsed, nil
+}
+
+// compareVersions returns -1, 0 or 1 when a is older, equal to or newer than b.
+// Unparseable versions are treated as the oldest possible version.
+func compareVersions(a, b string) int {
+	av, aErr := parseVersion(a)
+	bv, bErr := parseVersion(b)
+
+	switch {
+	case aErr != nil && bErr != nil:
+		return 0
+	case aErr != nil:
+		return -1
+	case bErr != nil:
+		return 1
+	}
+
+	for i := range av {
+		if av[i] < bv[i] {
+			return -1
+		}
+		if av[i] > bv[i] {
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,542 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// stubExec replaces execTask for the duration of a test and resets any cached versions
+func stubExec(t *testing.T, fn func(task v1execute.ExecTask) (v1execute.ExecResult, error)) {
+	orig := execTask
+	execTask = fn
+	resetVersionCache()
+
+	t.Cleanup(func() {
+		execTask = orig
+		resetVersionCache()
+	})
+}
+
+func resetVersionCache() {
+	versionCacheMu.Lock()
+	defer versionCacheMu.Unlock()
+
+	dockerVersions = map[string]dockerVersionResult{}
+	buildxVersions = map[string]buildxVersionResult{}
+}
+
+func Test_parseDockerVersion(t *testing.T) {
+	cases := []struct {
+		name       string
+		output     string
+		wantClient string
+		wantServer string
+		wantErr    bool
+	}{
+		{
+			name:       "client and server",
+			output:     "20.10.17 20.10.17\n",
+			wantClient: "20.10.17",
+			wantServer: "20.10.17",
+		},
+		{
+			name:       "legacy ce suffix",
+			output:     "17.12.0-ce 17.09.1-ce\n",
+			wantClient: "17.12.0-ce",
+			wantServer: "17.09.1-ce",
+		},
+		{
+			name:       "daemon not reachable",
+			output:     "20.10.17 \n",
+			wantClient: "20.10.17",
+		},
+		{
+			name:    "empty output",
+			output:  "",
+			wantErr: true,
+		},
+		{
+			name:    "unexpected output",
+			output:  "Cannot connect to the Docker daemon",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseDockerVersion(tc.output)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got.Client != tc.wantClient {
+				t.Errorf("want client %q, got %q", tc.wantClient, got.Client)
+			}
+			if got.Server != tc.wantServer {
+				t.Errorf("want server %q, got %q", tc.wantServer, got.Server)
+			}
+		})
+	}
+}
+
+func Test_parseBuildxVersion(t *testing.T) {
+	got, err := parseBuildxVersion("github.com/docker/buildx v0.8.2 6224def4dd2c3d347eee19db595348c50d7cb491\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != "v0.8.2" {
+		t.Errorf("want v0.8.2, got %q", got)
+	}
+
+	if _, err := parseBuildxVersion("docker: 'buildx' is not a docker command."); err == nil {
+		t.Errorf("want error for unexpected output")
+	}
+}
+
+func Test_compareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"20.10.17", "20.10.17", 0},
+		{"20.10.17", "19.03.0", 1},
+		{"1.12.6", "1.13.0", -1},
+		{"17.12.0-ce", "17.12.0", 0},
+		{"v0.8.2", "0.8.1", 1},
+		{"20.10", "20.10.0", 0},
+		{"unknown", "1.0.0", -1},
+	}
+
+	for _, tc := range cases {
+		if got := compareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareVersions(%q, %q) want %d, got %d", tc.a, tc.b, tc.want, got)
+		}
+	}
+}
+
+func Test_requireDockerVersion(t *testing.T) {
+	calls := 0
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		calls++
+		return v1execute.ExecResult{Stdout: "20.10.17 1.12.6\n"}, nil
+	})
+
+	err := requireDockerVersion(BuildImageConfig{}, "--squash", minSquashVersion)
+	if err == nil {
+		t.Fatalf("want error for an old Docker daemon")
+	}
+
+	want := "--squash requires Docker >= 1.13.0, found: 1.12.6"
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+
+	if err := requireDockerVersion(BuildImageConfig{}, "buildx", "1.0.0"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("want docker version to be run once, got %d", calls)
+	}
+}
+
+func Test_GetDockerVersion_DockerContext(t *testing.T) {
+	var tasks []v1execute.ExecTask
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		tasks = append(tasks, task)
+		return v1execute.ExecResult{Stdout: "20.10.17 20.10.17 false\n"}, nil
+	})
+
+	remote := BuildImageConfig{DockerContext: "remote"}
+	for _, config := range []BuildImageConfig{remote, {}, remote} {
+		if _, err := GetDockerVersion(config); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if len(tasks) != 2 {
+		t.Fatalf("want docker version to be run once for each context, got %d", len(tasks))
+	}
+
+	want := "--context remote version"
+	if got := strings.Join(tasks[0].Args[:3], " "); got != want {
+		t.Errorf("want args to start with %q, got %q", want, got)
+	}
+	if tasks[1].Args[0] != "version" {
+		t.Errorf("want no --context for the default context, got %v", tasks[1].Args)
+	}
+}
+
+func Test_requireDockerVersion_NotDetected(t *testing.T) {
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		return v1execute.ExecResult{Stderr: "command not found", ExitCode: 127}, nil
+	})
+
+	err := requireDockerVersion(BuildImageConfig{}, "--squash", minSquashVersion)
+	if err == nil {
+		t.Fatalf("want error when the version cannot be detected")
+	}
+
+	if !strings.Contains(err.Error(), "could not be detected") {
+		t.Errorf("want detection error, got %q", err.Error())
+	}
+}
+
+func Test_GetDockerVersion_NonZeroExitCode(t *testing.T) {
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		return v1execute.ExecResult{
+			Stdout:   "20.10.17 \n",
+			Stderr:   "Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?\n",
+			ExitCode: 1,
+		}, nil
+	})
+
+	_, err := GetDockerVersion(BuildImageConfig{})
+
+	want := "docker version exited with code 1: Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
+
+func Test_parseDockerVersion_Experimental(t *testing.T) {
+	got, err := parseDockerVersion("20.10.17 20.10.17 true\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !got.Experimental {
+		t.Errorf("want experimental to be detected")
+	}
+
+	got, err = parseDockerVersion("20.10.17 20.10.17 false\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got.Experimental {
+		t.Errorf("want experimental to be false")
+	}
+}
+
+func Test_checkSquashSupport(t *testing.T) {
+	cases := []struct {
+		name       string
+		output     string
+		mode       string
+		wantSquash bool
+		wantErr    string
+	}{
+		{
+			name:       "experimental daemon",
+			output:     "20.10.17 20.10.17 true",
+			mode:       SquashRequire,
+			wantSquash: true,
+		},
+		{
+			name:    "non-experimental daemon requires squash",
+			output:  "20.10.17 20.10.17 false",
+			mode:    SquashRequire,
+			wantErr: "--squash requires experimental features to be enabled on the Docker daemon",
+		},
+		{
+			name:    "default mode requires squash",
+			output:  "20.10.17 20.10.17 false",
+			wantErr: "--squash requires experimental features to be enabled on the Docker daemon",
+		},
+		{
+			name:       "non-experimental daemon best-effort",
+			output:     "20.10.17 20.10.17 false",
+			mode:       SquashBestEffort,
+			wantSquash: false,
+		},
+		{
+			name:    "old daemon requires squash",
+			output:  "20.10.17 1.12.6 true",
+			mode:    SquashRequire,
+			wantErr: "--squash requires Docker >= 1.13.0, found: 1.12.6",
+		},
+		{
+			name:       "old daemon best-effort",
+			output:     "20.10.17 1.12.6 true",
+			mode:       SquashBestEffort,
+			wantSquash: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+				return v1execute.ExecResult{Stdout: tc.output}, nil
+			})
+
+			got, err := checkSquashSupport(BuildImageConfig{SquashMode: tc.mode}, nil)
+			if len(tc.wantErr) > 0 {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+					t.Fatalf("want error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.wantSquash {
+				t.Errorf("want squash %v, got %v", tc.wantSquash, got)
+			}
+		})
+	}
+}
+
+func Test_ValidateSquashMode(t *testing.T) {
+	for _, mode := range []string{"", SquashRequire, SquashBestEffort} {
+		if err := ValidateSquashMode(mode); err != nil {
+			t.Errorf("want %q to be valid, got: %s", mode, err)
+		}
+	}
+
+	if err := ValidateSquashMode("sometimes"); err == nil {
+		t.Errorf("want error for an unknown squash mode")
+	}
+}
+
+func Test_checkOutputSupport(t *testing.T) {
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		if len(task.Args) > 0 && task.Args[0] == "buildx" {
+			return v1execute.ExecResult{Stdout: "github.com/docker/buildx v0.8.2 6224def\n"}, nil
+		}
+		return v1execute.ExecResult{Stdout: "20.10.17 20.10.17\n"}, nil
+	})
+
+	if err := checkOutputSupport(BuildImageConfig{Output: "type=oci,dest=fn.tar"}, "--output"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	err := checkOutputSupport(BuildImageConfig{Output: "type=oci,dest=fn.tar", Squash: true}, "--output")
+	if err == nil || !strings.Contains(err.Error(), "--squash") {
+		t.Errorf("want error for --squash, got %v", err)
+	}
+}
+
+func Test_checkOutputSupport_NoBuildx(t *testing.T) {
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		if len(task.Args) > 0 && task.Args[0] == "buildx" {
+			return v1execute.ExecResult{Stderr: "docker: 'buildx' is not a docker command.", ExitCode: 1}, nil
+		}
+		return v1execute.ExecResult{Stdout: "20.10.17 20.10.17\n"}, nil
+	})
+
+	err := checkOutputSupport(BuildImageConfig{Output: "type=oci,dest=fn.tar"}, "--output")
+	if err == nil {
+		t.Fatalf("want error when buildx is not available")
+	}
+
+	want := "--output requires docker buildx: docker buildx is not available: docker: 'buildx' is not a docker command."
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
+
+func Test_checkOutputSupport_NamesFlag(t *testing.T) {
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		return v1execute.ExecResult{Stdout: "20.10.17 20.10.17\n"}, nil
+	})
+
+	config := BuildImageConfig{CacheDir: ".cache", Squash: true}
+	err := checkOutputSupport(config, buildxFlag(config))
+
+	want := "--cache-dir cannot be used with --squash, which is not supported by buildx"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
+
+func Test_checkOutputSupport_CacheDirDriver(t *testing.T) {
+	cases := []struct {
+		name    string
+		inspect string
+		wantErr bool
+	}{
+		{name: "docker driver", inspect: "Name:   default\nDriver: docker\n", wantErr: true},
+		{name: "docker-container driver", inspect: "Name:   builder\nDriver: docker-container\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+				switch strings.Join(task.Args, " ") {
+				case "buildx version":
+					return v1execute.ExecResult{Stdout: "github.com/docker/buildx v0.8.2 6224def\n"}, nil
+				case "buildx inspect":
+					return v1execute.ExecResult{Stdout: tc.inspect}, nil
+				}
+				return v1execute.ExecResult{Stdout: "20.10.17 20.10.17\n"}, nil
+			})
+
+			err := checkOutputSupport(BuildImageConfig{CacheDir: ".cache", Output: "type=docker"}, "--cache-dir")
+			if tc.wantErr && (err == nil || !strings.Contains(err.Error(), "docker-container")) {
+				t.Errorf("want an error naming the docker-container driver, got %v", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func Test_checkDockerContext(t *testing.T) {
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		if strings.Join(task.Args, " ") != "context ls --format {{.Name}}" {
+			t.Fatalf("unexpected command: %v", task.Args)
+		}
+		return v1execute.ExecResult{Stdout: "default\nremote-builder\n"}, nil
+	})
+
+	if err := checkDockerContext(BuildImageConfig{DockerContext: "remote-builder"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	err := checkDockerContext(BuildImageConfig{DockerContext: "remote"})
+	want := `docker context "remote" not found, available: default, remote-builder`
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
+
+func Test_checkDockerContext_ListFails(t *testing.T) {
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		return v1execute.ExecResult{Stderr: "Cannot connect to the Docker daemon\n", ExitCode: 1}, nil
+	})
+
+	err := checkDockerContext(BuildImageConfig{DockerContext: "remote-builder"})
+	want := "unable to list the docker contexts: Cannot connect to the Docker daemon"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
+
+func Test_BuildImage_UnknownDockerContext(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	var builds int
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		if len(task.Args) > 0 && task.Args[0] == "context" {
+			return v1execute.ExecResult{Stdout: "default\n"}, nil
+		}
+		builds++
+		return v1execute.ExecResult{}, nil
+	})
+
+	err := BuildImage(BuildImageConfig{
+		Image:         "fn",
+		Handler:       "handler",
+		FunctionName:  "fn",
+		Language:      "go",
+		QuiteBuild:    true,
+		DockerContext: "remote-builder",
+	})
+	if err == nil || !strings.Contains(err.Error(), `docker context "remote-builder" not found`) {
+		t.Fatalf("want an error for the unknown context, got: %v", err)
+	}
+
+	if builds != 0 {
+		t.Errorf("want no build run, got %d", builds)
+	}
+}
+
+func Test_ValidateDockerBinary(t *testing.T) {
+	dir := t.TempDir()
+
+	executable := filepath.Join(dir, "docker-wrapper")
+	if err := ioutil.WriteFile(executable, []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	notExecutable := filepath.Join(dir, "docker.txt")
+	if err := ioutil.WriteFile(notExecutable, []byte("docker"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		binary  string
+		wantErr string
+	}{
+		{name: "default"},
+		{name: "executable", binary: executable},
+		{name: "not executable", binary: notExecutable, wantErr: "the docker binary " + notExecutable + " is not executable: "},
+		{name: "missing", binary: filepath.Join(dir, "missing"), wantErr: "the docker binary " + filepath.Join(dir, "missing") + " is not executable: "},
+		{name: "not on the PATH", binary: "faas-cli-no-such-docker", wantErr: "the docker binary faas-cli-no-such-docker is not executable: "},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateDockerBinary(tc.binary)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				t.Errorf("want error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_getDockerBuildCommand_DockerBinary(t *testing.T) {
+	command, args := getDockerBuildCommand(dockerBuild{Image: "fn", DockerBinary: "/opt/docker/bin/docker"})
+
+	if command != "/opt/docker/bin/docker" {
+		t.Errorf("want the docker binary as the command, got %q", command)
+	}
+	if got := strings.Join(args, " "); got != "build --tag fn ." {
+		t.Errorf("want args %q, got %q", "build --tag fn .", got)
+	}
+
+	if command, _ := getDockerBuildCommand(dockerBuild{Image: "fn"}); command != "docker" {
+		t.Errorf("want docker by default, got %q", command)
+	}
+}
+
+func Test_BuildImage_DockerBinary(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	if err := os.MkdirAll("bin", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("bin", "docker"), []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		DockerBinary: "./bin/docker",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// docker runs within the build context, so a relative path is made absolute
+	want := filepath.Join(wd, "bin", "docker")
+	if got := (*builds)[0].Command; got != want {
+		t.Errorf("want the build to run %q, got %q", want, got)
+	}
+}
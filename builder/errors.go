@@ -0,0 +1,102 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// Kinds of failure returned by BuildImage, use errors.Is to check for them
+var (
+	// ErrTemplateNotSupported is returned when no template is available for the language
+	ErrTemplateNotSupported = errors.New("language template not supported")
+
+	// ErrTemplateInvalid is returned when the template.yml cannot be read, or with
+	// StrictTemplate, when it declares a different language
+	ErrTemplateInvalid = errors.New("language template invalid")
+
+	// ErrHandlerInvalid is returned when the handler path cannot be used
+	ErrHandlerInvalid = errors.New("handler invalid")
+
+	// ErrImageInvalid is returned when the image name is not a valid reference
+	ErrImageInvalid = errors.New("image invalid")
+
+	// ErrBuildArgsMissing is returned when a build arg required by the template
+	// has not been given a value
+	ErrBuildArgsMissing = errors.New("required build args missing")
+
+	// ErrCLITooOld is returned when the template requires a newer faas-cli
+	ErrCLITooOld = errors.New("faas-cli too old for template")
+
+	// ErrVulnerabilitiesFound is returned when the scan of a built image finds
+	// vulnerabilities at or above the ScanFailOn severity
+	ErrVulnerabilitiesFound = errors.New("vulnerabilities found")
+
+	// ErrSmokeTestFailed is returned when the container started from the built
+	// image by SmokeTest exits, or does not become healthy in time
+	ErrSmokeTestFailed = errors.New("smoke test failed")
+
+	// ErrInterrupted is returned when the Context of the build is cancelled, i.e.
+	// on SIGINT
+	ErrInterrupted = errors.New("build interrupted")
+)
+
+// buildError keeps the human-readable message of an error, whilst allowing
+// callers to check its kind with errors.Is
+type buildError struct {
+	kind    error
+	message string
+}
+
+func (e *buildError) Error() string {
+	return e.message
+}
+
+func (e *buildError) Unwrap() error {
+	return e.kind
+}
+
+// newBuildError returns an error of the given kind with a formatted message
+func newBuildError(kind error, format string, a ...interface{}) error {
+	return &buildError{kind: kind, message: fmt.Sprintf(format, a...)}
+}
+
+// BuildFailedError is returned when docker exits with a non-zero exit code,
+// use errors.As to access the exit code and stderr
+type BuildFailedError struct {
+	FunctionName string
+	ExitCode     int
+	Stderr       string
+}
+
+func (e *BuildFailedError) Error() string {
+	return fmt.Sprintf("[%s] received non-zero exit code from build, error: %s", e.FunctionName, e.Stderr)
+}
+
+// buildFailureLines is the number of lines of output kept for a BuildFailedError
+const buildFailureLines = 20
+
+// buildFailureOutput returns the last buildFailureLines of a failed build's stderr,
+// which is captured whether or not the output was streamed. When stderr is empty,
+// such as with the classic builder which writes its errors to stdout, the end of
+// stdout is used instead.
+func buildFailureOutput(res v1execute.ExecResult) string {
+	if output := tailLines(res.Stderr, buildFailureLines); len(output) > 0 {
+		return output
+	}
+	return tailLines(res.Stdout, buildFailureLines)
+}
+
+// tailLines returns the last n lines of output, without a trailing newline
+func tailLines(output string, n int) string {
+	lines := strings.Split(strings.TrimRight(output, "\r\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
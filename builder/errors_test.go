@@ -0,0 +1,185 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+	"github.com/openfaas/faas-cli/test"
+)
+
+func Test_BuildImage_ErrTemplateNotSupported(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "ruby",
+	})
+
+	if !errors.Is(err, ErrTemplateNotSupported) {
+		t.Fatalf("want ErrTemplateNotSupported, got %v", err)
+	}
+
+	want := "language template: ruby not supported, build a custom Dockerfile"
+	if err.Error() != want {
+		t.Errorf("want message %q, got %q", want, err.Error())
+	}
+}
+
+func Test_BuildImage_ErrHandlerInvalid(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "missing",
+		FunctionName: "fn",
+		Language:     "go",
+	})
+
+	if !errors.Is(err, ErrHandlerInvalid) {
+		t.Fatalf("want ErrHandlerInvalid, got %v", err)
+	}
+
+	want := "building fn:latest, missing is an invalid path"
+	if err.Error() != want {
+		t.Errorf("want message %q, got %q", want, err.Error())
+	}
+}
+
+func Test_BuildImage_ErrImageInvalid(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "alexellis/MyFunction",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+	})
+
+	if !errors.Is(err, ErrImageInvalid) {
+		t.Fatalf("want ErrImageInvalid, got %v", err)
+	}
+
+	if _, statErr := os.Stat("build"); !os.IsNotExist(statErr) {
+		t.Errorf("want no build context to be created for an invalid image")
+	}
+}
+
+func Test_BuildImage_BuildFailedError(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		return v1execute.ExecResult{ExitCode: 2, Stderr: "unknown instruction: FRUM"}, nil
+	})
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+	})
+
+	var buildErr *BuildFailedError
+	if !errors.As(err, &buildErr) {
+		t.Fatalf("want BuildFailedError, got %v", err)
+	}
+
+	if buildErr.ExitCode != 2 {
+		t.Errorf("want exit code 2, got %d", buildErr.ExitCode)
+	}
+	if buildErr.Stderr != "unknown instruction: FRUM" {
+		t.Errorf("want stderr to be captured, got %q", buildErr.Stderr)
+	}
+
+	want := "[fn] received non-zero exit code from build, error: unknown instruction: FRUM"
+	if err.Error() != want {
+		t.Errorf("want message %q, got %q", want, err.Error())
+	}
+
+	if errors.Is(err, ErrHandlerInvalid) || errors.Is(err, ErrTemplateNotSupported) {
+		t.Errorf("want build failure to be distinct from the other kinds")
+	}
+}
+
+func Test_BuildImage_BuildFailedErrorWhileStreaming(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	var stderr []string
+	for i := 1; i <= 50; i++ {
+		stderr = append(stderr, fmt.Sprintf("#%d step output", i))
+	}
+	stderr = append(stderr, "ERROR: failed to solve: process \"/bin/sh -c go build\" did not complete successfully: exit code: 1")
+
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		if !task.StreamStdio {
+			t.Errorf("want the build output to be streamed")
+		}
+
+		// A streaming executor writes the output as it runs, and keeps a copy
+		output := strings.Join(stderr, "\n") + "\n"
+		fmt.Print(output)
+		return v1execute.ExecResult{ExitCode: 1, Stderr: output}, nil
+	})
+
+	var err error
+	test.CaptureStdout(func() {
+		err = BuildImage(BuildImageConfig{
+			Image:        "fn",
+			Handler:      "handler",
+			FunctionName: "fn",
+			Language:     "go",
+		})
+	})
+
+	var buildErr *BuildFailedError
+	if !errors.As(err, &buildErr) {
+		t.Fatalf("want BuildFailedError, got %v", err)
+	}
+
+	want := strings.Join(stderr[len(stderr)-buildFailureLines:], "\n")
+	if buildErr.Stderr != want {
+		t.Errorf("want the last %d lines of stderr, got:\n%s", buildFailureLines, buildErr.Stderr)
+	}
+
+	if !strings.Contains(err.Error(), "did not complete successfully: exit code: 1") {
+		t.Errorf("want the cause of the failure in the error, got %q", err.Error())
+	}
+}
+
+func Test_buildFailureOutput(t *testing.T) {
+	cases := []struct {
+		name string
+		res  v1execute.ExecResult
+		want string
+	}{
+		{
+			name: "stderr",
+			res:  v1execute.ExecResult{Stdout: "Step 1/2 : FROM scratch\n", Stderr: "unknown instruction: FRUM\n"},
+			want: "unknown instruction: FRUM",
+		},
+		{
+			name: "classic builder writes to stdout",
+			res:  v1execute.ExecResult{Stdout: "Step 1/2 : FROM scratch\nStep 2/2 : RUN false\nThe command '/bin/sh -c false' returned a non-zero code: 1\n"},
+			want: "Step 1/2 : FROM scratch\nStep 2/2 : RUN false\nThe command '/bin/sh -c false' returned a non-zero code: 1",
+		},
+		{
+			name: "no output",
+			res:  v1execute.ExecResult{},
+			want: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := buildFailureOutput(tc.res); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
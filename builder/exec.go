@@ -0,0 +1,97 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// execTaskContext runs an external command which is killed when ctx is cancelled,
+// it can be replaced in tests. A ctx which can never be cancelled, or a nil ctx,
+// runs the command with execTask.
+var execTaskContext = func(ctx context.Context, task v1execute.ExecTask) (v1execute.ExecResult, error) {
+	if ctx == nil || ctx.Done() == nil {
+		return execTask(task)
+	}
+	return runTask(ctx, task)
+}
+
+// runTask runs task with exec.CommandContext, so that the command is killed when
+// ctx is cancelled, in which case ctx.Err() is returned along with any output so
+// far. On a SIGINT from the terminal, docker gets the signal too and stops the
+// build on the daemon.
+func runTask(ctx context.Context, task v1execute.ExecTask) (v1execute.ExecResult, error) {
+	if task.PrintCommand {
+		fmt.Println("exec: ", task.Command, strings.Join(task.Args, " "))
+	}
+
+	cmd := exec.CommandContext(ctx, task.Command, task.Args...)
+	if task.Shell {
+		cmd = exec.CommandContext(ctx, "/bin/bash", "-c", strings.TrimSpace(task.Command+" "+strings.Join(task.Args, " ")))
+	}
+	cmd.Dir, cmd.Stdin = task.Cwd, task.Stdin
+	if len(task.Env) > 0 {
+		cmd.Env = append(os.Environ(), task.Env...)
+	}
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = io.Writer(&stdout), io.Writer(&stderr)
+	if task.StreamStdio {
+		cmd.Stdout, cmd.Stderr = io.MultiWriter(os.Stdout, &stdout), io.MultiWriter(os.Stderr, &stderr)
+	}
+
+	err := cmd.Run()
+	res := v1execute.ExecResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return res, ctxErr
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		res.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// checkInterrupted returns an ErrInterrupted error when the Context of config
+// has been cancelled
+func checkInterrupted(config BuildImageConfig) error {
+	if config.Context == nil || config.Context.Err() == nil {
+		return nil
+	}
+	return newBuildError(ErrInterrupted, "[%s] the build was interrupted", config.FunctionName)
+}
+
+// interruptedOr returns the ErrInterrupted error when the Context of config has
+// been cancelled, which takes the place of err from a command it stopped
+func interruptedOr(config BuildImageConfig, err error) error {
+	if interruptErr := checkInterrupted(config); interruptErr != nil {
+		return interruptErr
+	}
+	return err
+}
+
+// removeInterruptedContext removes the build context at contextPath when the build
+// was interrupted, unless KeepTemp is set
+func removeInterruptedContext(config BuildImageConfig, contextPath string) {
+	if checkInterrupted(config) == nil || config.KeepTemp {
+		return
+	}
+
+	if err := os.RemoveAll(contextPath); err != nil {
+		fmt.Printf("Unable to remove the build context %s: %s\n", contextPath, err.Error())
+		return
+	}
+	fmt.Printf("Removed the build context: %s\n", contextPath)
+}
@@ -0,0 +1,145 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// stubBlockingBuild replaces execTaskContext with a docker build which blocks
+// until its context is cancelled, and cancels the context once it has started
+func stubBlockingBuild(t *testing.T, cancel context.CancelFunc) {
+	orig := execTaskContext
+	execTaskContext = func(ctx context.Context, task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		go cancel()
+
+		<-ctx.Done()
+		return v1execute.ExecResult{ExitCode: 130}, ctx.Err()
+	}
+	t.Cleanup(func() { execTaskContext = orig })
+}
+
+func Test_BuildImage_Interrupted(t *testing.T) {
+	cases := []struct {
+		name        string
+		keepTemp    bool
+		wantContext bool
+	}{
+		{name: "the build context is removed"},
+		{name: "the build context is kept with KeepTemp", keepTemp: true, wantContext: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupBuildContextTest(t, "go")
+			stubDockerBuild(t, 0)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stubBlockingBuild(t, cancel)
+
+			result, err := BuildImageWithResult(BuildImageConfig{
+				Image:        "fn",
+				Handler:      "handler",
+				FunctionName: "fn",
+				Language:     "go",
+				QuiteBuild:   true,
+				KeepTemp:     tc.keepTemp,
+				PostBuild:    []string{"echo built > built.txt"},
+				Context:      ctx,
+			})
+			if !errors.Is(err, ErrInterrupted) {
+				t.Fatalf("want an ErrInterrupted error, got: %v", err)
+			}
+
+			if want := "[fn] the build was interrupted"; err.Error() != want {
+				t.Errorf("want error %q, got %q", want, err.Error())
+			}
+
+			_, statErr := os.Stat(result.ContextPath)
+			if tc.wantContext && statErr != nil {
+				t.Errorf("want the build context to be kept, got: %s", statErr)
+			}
+			if !tc.wantContext && !os.IsNotExist(statErr) {
+				t.Errorf("want the build context to be removed, got: %v", statErr)
+			}
+
+			if _, err := os.Stat(filepath.Join("handler", "built.txt")); !os.IsNotExist(err) {
+				t.Errorf("want post_build to be skipped after an interrupt")
+			}
+		})
+	}
+}
+
+func Test_BuildImage_CancelledBeforeBuild(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		Context:      ctx,
+	})
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("want an ErrInterrupted error, got: %v", err)
+	}
+
+	for _, build := range *builds {
+		if len(build.Args) > 0 && build.Args[0] == "build" {
+			t.Errorf("want docker build not to run, got: %v", build.Args)
+		}
+	}
+}
+
+func Test_runTask_StopsCommandWhenCancelled(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err := runTask(ctx, v1execute.ExecTask{Command: "sleep", Args: []string{"30"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want the context's error, got: %v", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("want the command to be stopped, it ran for %s", elapsed)
+	}
+}
+
+func Test_runTask_MatchesExecute(t *testing.T) {
+	task := v1execute.ExecTask{
+		Command: "echo $GREETING && echo failed >&2; exit 3",
+		Shell:   true,
+		Env:     []string{"GREETING=hello"},
+	}
+
+	want, err := task.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := runTask(context.Background(), task)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got != want {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
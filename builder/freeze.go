@@ -0,0 +1,188 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// buildManifestSuffix is appended to the function's name for the build manifest,
+// which is written next to its build context so that it is not sent to docker
+const buildManifestSuffix = ".manifest.json"
+
+// FrozenImage is a base image of a Dockerfile and the digest it was pinned to
+type FrozenImage struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+}
+
+// BuildManifest records the base images pinned by a build with FreezeBaseImages
+type BuildManifest struct {
+	FunctionName string        `json:"function"`
+	BaseImages   []FrozenImage `json:"base_images"`
+}
+
+// inspectRemoteDigest returns the digest of image in its registry, for a multi-arch
+// image this is the digest of its manifest list, so that a pinned FROM still
+// resolves for each platform. "docker manifest inspect" re-formats the manifest
+// list it fetches, so its digest cannot be computed from the output, and buildx
+// imagetools of the DockerBinary and DockerContext of config is used instead. It
+// can be replaced in tests.
+var inspectRemoteDigest = func(config BuildImageConfig, image string) (string, error) {
+	command, args := dockerCommand(config, "buildx", "imagetools", "inspect", "--format", "{{json .Manifest}}", image)
+
+	task := v1execute.ExecTask{
+		Command:     command,
+		Args:        args,
+		StreamStdio: false,
+	}
+
+	res, err := execTask(task)
+	if err != nil {
+		return "", err
+	}
+
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf("docker buildx imagetools inspect %s failed: %s", image, strings.TrimSpace(res.Stderr))
+	}
+
+	var descriptor struct {
+		Digest string `json:"digest"`
+	}
+	if err := json.Unmarshal([]byte(res.Stdout), &descriptor); err != nil {
+		return "", fmt.Errorf("unable to parse the manifest for %s: %s", image, err.Error())
+	}
+
+	if !strings.HasPrefix(descriptor.Digest, "sha256:") {
+		return "", fmt.Errorf("no digest found for %s", image)
+	}
+
+	return descriptor.Digest, nil
+}
+
+// freezeDockerfile rewrites each FROM instruction of dockerfile to pin its base
+// image to the digest given by resolve, i.e. FROM golang:1.20 AS build becomes
+// FROM golang:1.20@sha256:... AS build. The --platform flag and stage name are
+// kept. A FROM which is already pinned, scratch, or an earlier build stage is left
+// alone. One which uses an ARG is also left, with a warning, as its image is only
+// known to docker. Each image is only resolved once.
+func freezeDockerfile(dockerfile string, resolve func(image string) (string, error), warnings *[]Warning) (string, []FrozenImage, error) {
+	lines := strings.Split(dockerfile, "\n")
+	stages := map[string]bool{}
+	digests := map[string]string{}
+	frozen := []FrozenImage{}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		fields := strings.Fields(trimmed)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+
+		if strings.HasSuffix(trimmed, "\\") {
+			warn(warnings, WarnBaseImageNotFrozen, "unable to freeze a FROM instruction split over several lines: %s", trimmed)
+			continue
+		}
+
+		imageIndex := 1
+		for imageIndex < len(fields) && strings.HasPrefix(fields[imageIndex], "--") {
+			imageIndex++
+		}
+		if imageIndex == len(fields) {
+			return "", nil, fmt.Errorf("invalid FROM instruction: %s", trimmed)
+		}
+
+		image := fields[imageIndex]
+		earlierStage := stages[strings.ToLower(image)]
+		if rest := fields[imageIndex+1:]; len(rest) == 2 && strings.EqualFold(rest[0], "AS") {
+			stages[strings.ToLower(rest[1])] = true
+		}
+
+		switch {
+		case strings.Contains(image, "@"), strings.EqualFold(image, "scratch"), earlierStage:
+			continue
+		case strings.Contains(image, "$"):
+			warn(warnings, WarnBaseImageNotFrozen, "unable to freeze %s, its image is set by an ARG", image)
+			continue
+		}
+
+		digest, ok := digests[image]
+		if !ok {
+			var err error
+			digest, err = resolve(image)
+			if err != nil {
+				return "", nil, fmt.Errorf("unable to freeze %s: %s", image, err.Error())
+			}
+			digests[image] = digest
+			frozen = append(frozen, FrozenImage{Image: image, Digest: digest})
+		}
+
+		fields[imageIndex] = image + "@" + digest
+		indent := line[:strings.Index(line, fields[0])]
+		lines[i] = indent + strings.Join(fields, " ")
+		if strings.HasSuffix(line, "\r") {
+			lines[i] += "\r"
+		}
+	}
+
+	return strings.Join(lines, "\n"), frozen, nil
+}
+
+// buildManifestPath returns the path of the build manifest of functionName, i.e.
+// ./build/fn.manifest.json
+func buildManifestPath(workingDir, functionName string) string {
+	return filepath.Clean(buildContextPath(workingDir, functionName)) + buildManifestSuffix
+}
+
+// freezeBaseImages pins the base images of the Dockerfile within contextPath to
+// their current digests, see freezeDockerfile, and records them in manifestPath
+// for the FunctionName of config. The digests are looked up with the DockerBinary
+// and DockerContext of config.
+func freezeBaseImages(config BuildImageConfig, contextPath, manifestPath string, warnings *[]Warning) error {
+	dockerfilePath := filepath.Join(contextPath, "Dockerfile")
+	data, err := ioutil.ReadFile(dockerfilePath)
+	if err != nil {
+		return fmt.Errorf("unable to read the Dockerfile to freeze its base images: %s", err.Error())
+	}
+
+	resolve := func(image string) (string, error) {
+		return inspectRemoteDigest(config, image)
+	}
+
+	dockerfile, frozen, err := freezeDockerfile(string(data), resolve, warnings)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(dockerfilePath)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(dockerfilePath, []byte(dockerfile), info.Mode()); err != nil {
+		return err
+	}
+
+	for _, image := range frozen {
+		verbosePrintf(config.Verbose, "Froze base image: %s -> %s\n", image.Image, image.Digest)
+	}
+
+	manifest, err := json.MarshalIndent(BuildManifest{FunctionName: config.FunctionName, BaseImages: frozen}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(manifestPath, append(manifest, '\n'), 0600); err != nil {
+		return fmt.Errorf("unable to write the build manifest %s: %s", manifestPath, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testDigests = map[string]string{
+	"ghcr.io/openfaas/of-watchdog:0.9.6": "sha256:1111",
+	"golang:1.18-alpine":                 "sha256:2222",
+	"alpine:3.16":                        "sha256:3333",
+}
+
+func resolveTestDigest(image string) (string, error) {
+	digest, ok := testDigests[image]
+	if !ok {
+		return "", fmt.Errorf("no such image: %s", image)
+	}
+	return digest, nil
+}
+
+func Test_freezeDockerfile(t *testing.T) {
+	cases := []struct {
+		name       string
+		dockerfile string
+		want       string
+		wantFrozen []FrozenImage
+		wantErr    bool
+	}{
+		{
+			name:       "single stage",
+			dockerfile: "FROM alpine:3.16\nRUN apk add curl\n",
+			want:       "FROM alpine:3.16@sha256:3333\nRUN apk add curl\n",
+			wantFrozen: []FrozenImage{{Image: "alpine:3.16", Digest: "sha256:3333"}},
+		},
+		{
+			name: "multi-stage keeps platforms, stage names and earlier stages",
+			dockerfile: `FROM --platform=${TARGETPLATFORM:-linux/amd64} ghcr.io/openfaas/of-watchdog:0.9.6 as watchdog
+FROM --platform=${BUILDPLATFORM:-linux/amd64} golang:1.18-alpine AS build
+COPY --from=watchdog /fwatchdog /usr/bin/fwatchdog
+FROM build AS test
+RUN go test ./...
+FROM alpine:3.16 as ship
+COPY --from=build /go/bin/handler .
+`,
+			want: `FROM --platform=${TARGETPLATFORM:-linux/amd64} ghcr.io/openfaas/of-watchdog:0.9.6@sha256:1111 as watchdog
+FROM --platform=${BUILDPLATFORM:-linux/amd64} golang:1.18-alpine@sha256:2222 AS build
+COPY --from=watchdog /fwatchdog /usr/bin/fwatchdog
+FROM build AS test
+RUN go test ./...
+FROM alpine:3.16@sha256:3333 as ship
+COPY --from=build /go/bin/handler .
+`,
+			wantFrozen: []FrozenImage{
+				{Image: "ghcr.io/openfaas/of-watchdog:0.9.6", Digest: "sha256:1111"},
+				{Image: "golang:1.18-alpine", Digest: "sha256:2222"},
+				{Image: "alpine:3.16", Digest: "sha256:3333"},
+			},
+		},
+		{
+			name:       "already pinned, scratch and comments are left",
+			dockerfile: "# FROM alpine:3.16\nFROM golang:1.18-alpine@sha256:abcd AS build\nfrom scratch\n",
+			want:       "# FROM alpine:3.16\nFROM golang:1.18-alpine@sha256:abcd AS build\nfrom scratch\n",
+			wantFrozen: []FrozenImage{},
+		},
+		{
+			name:       "an image from an ARG is left",
+			dockerfile: "ARG BASE=alpine:3.16\nFROM ${BASE}\n",
+			want:       "ARG BASE=alpine:3.16\nFROM ${BASE}\n",
+			wantFrozen: []FrozenImage{},
+		},
+		{
+			name:       "duplicate images are resolved once",
+			dockerfile: "FROM alpine:3.16 AS one\nFROM alpine:3.16 AS two\n",
+			want:       "FROM alpine:3.16@sha256:3333 AS one\nFROM alpine:3.16@sha256:3333 AS two\n",
+			wantFrozen: []FrozenImage{{Image: "alpine:3.16", Digest: "sha256:3333"}},
+		},
+		{
+			name:       "a stage name only applies to later stages",
+			dockerfile: "FROM alpine:3.16 AS alpine\nFROM alpine\n",
+			want:       "FROM alpine:3.16@sha256:3333 AS alpine\nFROM alpine\n",
+			wantFrozen: []FrozenImage{{Image: "alpine:3.16", Digest: "sha256:3333"}},
+		},
+		{
+			name:       "indentation and CRLF are kept",
+			dockerfile: "  FROM alpine:3.16\r\nRUN true\r\n",
+			want:       "  FROM alpine:3.16@sha256:3333\r\nRUN true\r\n",
+			wantFrozen: []FrozenImage{{Image: "alpine:3.16", Digest: "sha256:3333"}},
+		},
+		{
+			name:       "unresolvable image",
+			dockerfile: "FROM missing:latest\n",
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, frozen, err := freezeDockerfile(tc.dockerfile, resolveTestDigest, nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tc.want {
+				t.Errorf("want Dockerfile:\n%s\ngot:\n%s", tc.want, got)
+			}
+			if !reflect.DeepEqual(frozen, tc.wantFrozen) {
+				t.Errorf("want frozen images %v, got %v", tc.wantFrozen, frozen)
+			}
+		})
+	}
+}
+
+func Test_createBuildContext_FreezeBaseImages(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	if err := ioutil.WriteFile("template/go/Dockerfile", []byte("FROM golang:1.18-alpine AS build\nFROM alpine:3.16\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var binaries []string
+	orig := inspectRemoteDigest
+	inspectRemoteDigest = func(config BuildImageConfig, image string) (string, error) {
+		binaries = append(binaries, config.DockerBinary)
+		return resolveTestDigest(image)
+	}
+	t.Cleanup(func() { inspectRemoteDigest = orig })
+
+	tempPath, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, FreezeBaseImages: true, DockerBinary: "podman"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dockerfile, err := ioutil.ReadFile(filepath.Join(tempPath, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "FROM golang:1.18-alpine@sha256:2222 AS build\nFROM alpine:3.16@sha256:3333\n"
+	if string(dockerfile) != want {
+		t.Errorf("want Dockerfile:\n%s\ngot:\n%s", want, dockerfile)
+	}
+
+	data, err := ioutil.ReadFile("build/fn.manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest BuildManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"podman", "podman"}; !reflect.DeepEqual(binaries, want) {
+		t.Errorf("want the digests looked up with %v, got %v", want, binaries)
+	}
+
+	wantManifest := BuildManifest{
+		FunctionName: "fn",
+		BaseImages: []FrozenImage{
+			{Image: "golang:1.18-alpine", Digest: "sha256:2222"},
+			{Image: "alpine:3.16", Digest: "sha256:3333"},
+		},
+	}
+	if !reflect.DeepEqual(manifest, wantManifest) {
+		t.Errorf("want manifest %v, got %v", wantManifest, manifest)
+	}
+
+	t.Run("a build without freezing removes the stale manifest", func(t *testing.T) {
+		if _, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat("build/fn.manifest.json"); !os.IsNotExist(err) {
+			t.Errorf("want the manifest to be removed, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHandlerFiles lists the files expected within a handler for common template
+// languages, by prefix of the language name, i.e. python3-http matches python
+var defaultHandlerFiles = []struct {
+	prefix string
+	files  []string
+}{
+	{prefix: "python", files: []string{"handler.py"}},
+	{prefix: "node", files: []string{"handler.js", "handler.ts"}},
+	{prefix: "go", files: []string{"handler.go"}},
+	{prefix: "ruby", files: []string{"handler.rb"}},
+	{prefix: "csharp", files: []string{"FunctionHandler.cs"}},
+}
+
+// expectedHandlerFiles returns the files which a handler for language should contain,
+// the handler_files of the template take precedence over the defaults. No files are
+// returned for an unknown language.
+func expectedHandlerFiles(language string, templateFiles []string) []string {
+	if len(templateFiles) > 0 {
+		return templateFiles
+	}
+
+	for _, defaults := range defaultHandlerFiles {
+		if strings.HasPrefix(strings.ToLower(language), defaults.prefix) {
+			return defaults.files
+		}
+	}
+
+	return nil
+}
+
+// warnMissingHandlerFiles prints a warning when the handler contains none of the
+// expected files, which usually means the handler path points at the wrong folder.
+// The handler is checked rather than the build context, since the template's own
+// sample handler is also staged there. Excluded files are treated as missing. The
+// warning is only printed when there is no progress callback, see printProgress.
+func warnMissingHandlerFiles(handler string, expected []string, excludePaths []string, warnings *[]Warning, progress func(event BuildEvent)) {
+	if len(expected) == 0 {
+		return
+	}
+
+	for _, name := range expected {
+		if isExcludedPath(filepath.Clean(name), excludePaths) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(handler, name)); err == nil && !info.IsDir() {
+			return
+		}
+	}
+
+	recordWarning(warnings, WarnHandlerFilesMissing, "none of the expected files (%s) were found in the handler: %s", strings.Join(expected, ", "), handler)
+	printProgress(progress, `
+WARNING: none of the expected files (%s) were found in the handler: %s
+The image may not contain your function's code, check the handler path in the stack file.
+
+`, strings.Join(expected, ", "), handler)
+}
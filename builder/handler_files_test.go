@@ -0,0 +1,66 @@
+package builder
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+func Test_expectedHandlerFiles(t *testing.T) {
+	cases := []struct {
+		name          string
+		language      string
+		templateFiles []string
+		want          []string
+	}{
+		{name: "python default", language: "python3-http", want: []string{"handler.py"}},
+		{name: "node default", language: "node18", want: []string{"handler.js", "handler.ts"}},
+		{name: "go default", language: "golang-middleware", want: []string{"handler.go"}},
+		{name: "template declares files", language: "python3", templateFiles: []string{"main.py"}, want: []string{"main.py"}},
+		{name: "unknown language", language: "cobol", want: nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := expectedHandlerFiles(tc.language, tc.templateFiles)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_warnMissingHandlerFiles(t *testing.T) {
+	handler := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(handler, "handler.py"), []byte("def handle(req):\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		expected []string
+		exclude  []string
+		wantWarn bool
+	}{
+		{name: "file present", expected: []string{"handler.js", "handler.py"}},
+		{name: "file missing", expected: []string{"handler.go"}, wantWarn: true},
+		{name: "file excluded", expected: []string{"handler.py"}, exclude: []string{"*.py"}, wantWarn: true},
+		{name: "nothing expected", expected: nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := test.CaptureStdout(func() {
+				warnMissingHandlerFiles(handler, tc.expected, tc.exclude, nil, nil)
+			})
+
+			if got := strings.Contains(out, "WARNING: none of the expected files"); got != tc.wantWarn {
+				t.Errorf("want warning %v, got output:\n%s", tc.wantWarn, out)
+			}
+		})
+	}
+}
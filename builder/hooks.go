@@ -0,0 +1,48 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// hookImageEnv is set to the built image's name for post_build commands
+const hookImageEnv = "FAAS_IMAGE"
+
+// hookImageDigestEnv is set to the built image's digest for post_build commands,
+// when it is available
+const hookImageDigestEnv = "FAAS_IMAGE_DIGEST"
+
+// runHooks runs each of the shell commands in dir for the given stage, i.e. pre_build,
+// and stops at the first command to fail. env is added to the environment of each command,
+// and the running command is killed when ctx is cancelled.
+func runHooks(ctx context.Context, stage, functionName, dir string, commands []string, env []string, quiet bool) error {
+	for _, command := range commands {
+		fmt.Printf("[%s] Running %s: %s\n", functionName, stage, command)
+
+		task := v1execute.ExecTask{
+			Cwd:         dir,
+			Command:     command,
+			Shell:       true,
+			Env:         env,
+			StreamStdio: !quiet,
+		}
+
+		res, err := execTaskContext(ctx, task)
+		if err != nil {
+			return fmt.Errorf("[%s] %s command failed: %s, error: %s", functionName, stage, command, err.Error())
+		}
+
+		if res.ExitCode != 0 {
+			return fmt.Errorf("[%s] %s command failed: %s, exit code: %d, error: %s",
+				functionName, stage, command, res.ExitCode, strings.TrimSpace(res.Stderr))
+		}
+	}
+
+	return nil
+}
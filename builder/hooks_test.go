@@ -0,0 +1,223 @@
+package builder
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// testImageID is returned for the digest of images built with stubDockerBuild
+const testImageID = "sha256:0d8b1b8d3c7a5e0b52ab2f8e5ae0bd9b1eb19e9d0c0b1c17e3b7f2c1a5d6e4f3"
+
+// stubDockerBuild runs shell tasks, such as hooks, and fakes the docker build
+func stubDockerBuild(t *testing.T, exitCode int) *[]v1execute.ExecTask {
+	var builds []v1execute.ExecTask
+
+	origInspect := inspectImageDigest
+	inspectImageDigest = func(config BuildImageConfig, image string) (string, error) {
+		return testImageID + "\n", nil
+	}
+	t.Cleanup(func() { inspectImageDigest = origInspect })
+
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		if task.Shell {
+			return task.Execute()
+		}
+
+		builds = append(builds, task)
+		return v1execute.ExecResult{ExitCode: exitCode}, nil
+	})
+
+	return &builds
+}
+
+func Test_BuildImage_PreBuildGeneratesFiles(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		PreBuild:     []string{"echo generated > generated.txt"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join("build", "fn", "function", "generated.txt")); err != nil {
+		t.Errorf("want generated file in the build context: %s", err)
+	}
+
+	if len(*builds) != 1 {
+		t.Errorf("want docker build to run once, got %d", len(*builds))
+	}
+}
+
+func Test_BuildImage_PreBuildFailureAbortsBuild(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		PreBuild:     []string{"echo first > first.txt", "echo protoc failed >&2; exit 3", "echo never > never.txt"},
+	})
+	if err == nil {
+		t.Fatalf("want error from a failing pre_build command")
+	}
+
+	want := "[fn] pre_build command failed: echo protoc failed >&2; exit 3, exit code: 3, error: protoc failed"
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+
+	if _, err := os.Stat(filepath.Join("handler", "never.txt")); !os.IsNotExist(err) {
+		t.Errorf("want commands after the failure to be skipped")
+	}
+
+	if _, err := os.Stat("build"); !os.IsNotExist(err) {
+		t.Errorf("want no build context to be created")
+	}
+
+	if len(*builds) != 0 {
+		t.Errorf("want docker build to be skipped, got %d builds", len(*builds))
+	}
+}
+
+func Test_runHooks_NoCommands(t *testing.T) {
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		t.Fatalf("unexpected command: %s", strings.Join(append([]string{task.Command}, task.Args...), " "))
+		return v1execute.ExecResult{}, nil
+	})
+
+	if err := runHooks(context.Background(), "pre_build", "fn", ".", nil, nil, true); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func Test_BuildImage_PostBuildReceivesImage(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		PostBuild:    []string{"echo -n $FAAS_IMAGE > image.txt"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join("handler", "image.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "alexellis/fn:0.1" {
+		t.Errorf("want FAAS_IMAGE=alexellis/fn:0.1, got %q", string(got))
+	}
+}
+
+func Test_BuildImage_PostBuildReceivesDigest(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		PostBuild:    []string{"echo -n $FAAS_IMAGE_DIGEST > digest.txt"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join("handler", "digest.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != testImageID {
+		t.Errorf("want FAAS_IMAGE_DIGEST=%s, got %q", testImageID, string(got))
+	}
+}
+
+func Test_BuildImage_PostBuildFailureFailsBuild(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		PostBuild:    []string{"echo smoke test failed >&2; exit 1"},
+	})
+	if err == nil {
+		t.Fatalf("want error from a failing post_build command")
+	}
+
+	want := "[fn] post_build command failed: echo smoke test failed >&2; exit 1, exit code: 1, error: smoke test failed"
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
+
+func Test_BuildImage_PostBuildSkippedWhenBuildFails(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 1)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		PostBuild:    []string{"touch ran.txt"},
+	})
+	if err == nil {
+		t.Fatalf("want error from the failed build")
+	}
+
+	if _, err := os.Stat(filepath.Join("handler", "ran.txt")); !os.IsNotExist(err) {
+		t.Errorf("want post_build to be skipped after a failed build")
+	}
+}
+
+func Test_runHooks_Interrupted(t *testing.T) {
+	if _, err := exec.LookPath("/bin/bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := runHooks(ctx, "pre_build", "fn", ".", []string{"sleep 30"}, nil, true)
+	if err == nil {
+		t.Fatalf("want an error when the hook is interrupted")
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("want the hook to be stopped, it ran for %s", elapsed)
+	}
+}
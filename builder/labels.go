@@ -0,0 +1,80 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Labels populated from Git metadata when GitLabels is enabled
+const (
+	GitBranchLabel   = "faas.git.branch"
+	GitSHALabel      = "faas.git.sha"
+	GitDescribeLabel = "faas.git.describe"
+
+	// GitDirtyLabel is "true" when the image was built with uncommitted changes
+	GitDirtyLabel = "faas.git.dirty"
+)
+
+// The working tree is checked once per invocation, so that every function of a
+// stack is labelled from the same state
+var (
+	gitDirtyOnce  sync.Once
+	gitDirtyValue string
+)
+
+// withGitLabels returns a copy of labels with the faas.git.* labels added from the
+// Git repository in the working directory. Labels supplied by the user take
+// precedence and any Git value which is unavailable is omitted.
+func withGitLabels(labels map[string]string) map[string]string {
+	merged := make(map[string]string, len(labels)+3)
+
+	gitValues := map[string]string{
+		GitBranchLabel:   getGitBranch(),
+		GitSHALabel:      getGitSHA(),
+		GitDescribeLabel: getGitDescribe(),
+	}
+
+	for k, v := range gitValues {
+		if len(v) > 0 {
+			merged[k] = v
+		}
+	}
+
+	for k, v := range labels {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// gitDirtyLabelValue returns "true" or "false" for the GitDirtyLabel, or an empty
+// string outside of a Git repository
+func gitDirtyLabelValue() string {
+	gitDirtyOnce.Do(func() {
+		if len(getGitSHA()) == 0 {
+			return
+		}
+		gitDirtyValue = strconv.FormatBool(getGitDirty())
+	})
+
+	return gitDirtyValue
+}
+
+// withGitDirtyLabel returns a copy of labels with the GitDirtyLabel added, unless
+// supplied by the user or outside of a Git repository
+func withGitDirtyLabel(labels map[string]string) map[string]string {
+	merged := make(map[string]string, len(labels)+1)
+
+	if dirty := gitDirtyLabelValue(); len(dirty) > 0 {
+		merged[GitDirtyLabel] = dirty
+	}
+
+	for k, v := range labels {
+		merged[k] = v
+	}
+
+	return merged
+}
@@ -0,0 +1,139 @@
+package builder
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func Test_withGitLabels(t *testing.T) {
+	stubGit(t, "a1b2c3d", "master", "0.1.0-1-ga1b2c3d")
+
+	labels := map[string]string{
+		"org.label-schema.name": "figlet",
+		GitBranchLabel:          "release",
+	}
+
+	got := withGitLabels(labels)
+	want := map[string]string{
+		"org.label-schema.name": "figlet",
+		GitBranchLabel:          "release",
+		GitSHALabel:             "a1b2c3d",
+		GitDescribeLabel:        "0.1.0-1-ga1b2c3d",
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if len(labels) != 2 {
+		t.Errorf("want user labels to be left unchanged, got %v", labels)
+	}
+}
+
+func Test_withGitLabels_NoGit(t *testing.T) {
+	stubGit(t, "", "", "")
+
+	got := withGitLabels(map[string]string{"team": "a"})
+	want := map[string]string{"team": "a"}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if got := withGitLabels(nil); len(got) != 0 {
+		t.Errorf("want no labels, got %v", got)
+	}
+}
+
+func Test_withGitLabels_PartialGit(t *testing.T) {
+	stubGit(t, "a1b2c3d", "master", "")
+
+	got := withGitLabels(nil)
+	if _, ok := got[GitDescribeLabel]; ok {
+		t.Errorf("want %s to be omitted, got %v", GitDescribeLabel, got)
+	}
+	if got[GitSHALabel] != "a1b2c3d" || got[GitBranchLabel] != "master" {
+		t.Errorf("want sha and branch labels, got %v", got)
+	}
+}
+
+// stubGitDirty replaces the working tree check and resets the cached value for the
+// duration of a test, calls counts how often the working tree was checked
+func stubGitDirty(t *testing.T, dirty bool) *int {
+	calls := 0
+	orig := getGitDirty
+	getGitDirty = func() bool {
+		calls++
+		return dirty
+	}
+
+	gitDirtyOnce, gitDirtyValue = sync.Once{}, ""
+	t.Cleanup(func() {
+		getGitDirty = orig
+		gitDirtyOnce, gitDirtyValue = sync.Once{}, ""
+	})
+
+	return &calls
+}
+
+func Test_withGitDirtyLabel(t *testing.T) {
+	cases := []struct {
+		name   string
+		sha    string
+		dirty  bool
+		labels map[string]string
+		want   map[string]string
+	}{
+		{
+			name:   "clean tree",
+			sha:    "a1b2c3d",
+			labels: map[string]string{"team": "a"},
+			want:   map[string]string{"team": "a", GitDirtyLabel: "false"},
+		},
+		{
+			name:  "dirty tree",
+			sha:   "a1b2c3d",
+			dirty: true,
+			want:  map[string]string{GitDirtyLabel: "true"},
+		},
+		{
+			name:   "not a repository",
+			dirty:  true,
+			labels: map[string]string{"team": "a"},
+			want:   map[string]string{"team": "a"},
+		},
+		{
+			name:   "user label takes precedence",
+			sha:    "a1b2c3d",
+			dirty:  true,
+			labels: map[string]string{GitDirtyLabel: "unknown"},
+			want:   map[string]string{GitDirtyLabel: "unknown"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stubGit(t, tc.sha, "master", "")
+			stubGitDirty(t, tc.dirty)
+
+			got := withGitDirtyLabel(tc.labels)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_withGitDirtyLabel_CheckedOnce(t *testing.T) {
+	stubGit(t, "a1b2c3d", "master", "")
+	calls := stubGitDirty(t, true)
+
+	for i := 0; i < 3; i++ {
+		withGitDirtyLabel(nil)
+	}
+
+	if *calls != 1 {
+		t.Errorf("want the working tree to be checked once, got %d", *calls)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Markers which start each section of a Dockerfile overlay, any lines before the
+// first marker are appended to the Dockerfile.
+//
+//	# @append                 lines are added to the end of the Dockerfile
+//	# @before-final-stage     lines are inserted before the last FROM instruction
+//	# @replace <instruction>  the first line equal to <instruction> is replaced
+const (
+	overlayMarkerPrefix     = "# @"
+	overlayAppend           = "append"
+	overlayBeforeFinalStage = "before-final-stage"
+	overlayReplace          = "replace"
+)
+
+// overlaySection is a set of lines to be merged into a Dockerfile
+type overlaySection struct {
+	Mode string
+
+	// Target is the instruction replaced by an overlayReplace section
+	Target string
+
+	Lines []string
+}
+
+// parseDockerfileOverlay splits an overlay into its sections
+func parseDockerfileOverlay(overlay string) ([]overlaySection, error) {
+	sections := []overlaySection{}
+	current := overlaySection{Mode: overlayAppend}
+
+	for _, line := range strings.Split(strings.TrimRight(overlay, "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, overlayMarkerPrefix) {
+			current.Lines = append(current.Lines, line)
+			continue
+		}
+
+		sections = append(sections, current)
+
+		marker := strings.TrimSpace(strings.TrimPrefix(trimmed, overlayMarkerPrefix))
+		mode, target := marker, ""
+		if i := strings.IndexAny(marker, " \t"); i > -1 {
+			mode, target = marker[:i], strings.TrimSpace(marker[i+1:])
+		}
+
+		switch mode {
+		case overlayAppend, overlayBeforeFinalStage:
+			if len(target) > 0 {
+				return nil, fmt.Errorf("unexpected value for %s%s: %s", overlayMarkerPrefix, mode, target)
+			}
+		case overlayReplace:
+			if len(target) == 0 {
+				return nil, fmt.Errorf("%s%s requires the instruction to replace", overlayMarkerPrefix, mode)
+			}
+		default:
+			return nil, fmt.Errorf("unknown overlay marker: %s, use append, before-final-stage or replace", trimmed)
+		}
+
+		current = overlaySection{Mode: mode, Target: target}
+	}
+
+	sections = append(sections, current)
+
+	merged := []overlaySection{}
+	for _, section := range sections {
+		if section.Mode == overlayAppend && len(strings.TrimSpace(strings.Join(section.Lines, ""))) == 0 {
+			continue
+		}
+		merged = append(merged, section)
+	}
+
+	return merged, nil
+}
+
+// applyDockerfileOverlay merges each section of the overlay into dockerfile, in
+// the order that they are written
+func applyDockerfileOverlay(dockerfile string, sections []overlaySection) (string, error) {
+	lines := strings.Split(strings.TrimRight(dockerfile, "\n"), "\n")
+
+	for _, section := range sections {
+		switch section.Mode {
+		case overlayAppend:
+			lines = append(lines, section.Lines...)
+
+		case overlayBeforeFinalStage:
+			final := -1
+			for i, line := range lines {
+				fields := strings.Fields(line)
+				if len(fields) > 0 && strings.EqualFold(fields[0], "FROM") {
+					final = i
+				}
+			}
+			if final == -1 {
+				return "", fmt.Errorf("unable to apply %s%s, the Dockerfile has no FROM instruction", overlayMarkerPrefix, section.Mode)
+			}
+
+			merged := append([]string{}, lines[:final]...)
+			merged = append(merged, section.Lines...)
+			lines = append(merged, lines[final:]...)
+
+		case overlayReplace:
+			found := -1
+			for i, line := range lines {
+				if strings.TrimSpace(line) == section.Target {
+					found = i
+					break
+				}
+			}
+			if found == -1 {
+				return "", fmt.Errorf("unable to apply %s%s, instruction not found in the Dockerfile: %s", overlayMarkerPrefix, section.Mode, section.Target)
+			}
+
+			merged := append([]string{}, lines[:found]...)
+			merged = append(merged, section.Lines...)
+			lines = append(merged, lines[found+1:]...)
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// overlayDockerfile applies the overlay file at overlayPath to the Dockerfile
+// within the build context at contextPath
+func overlayDockerfile(contextPath, overlayPath string) error {
+	overlay, err := ioutil.ReadFile(overlayPath)
+	if err != nil {
+		return fmt.Errorf("unable to read the Dockerfile overlay: %s", err.Error())
+	}
+
+	sections, err := parseDockerfileOverlay(string(overlay))
+	if err != nil {
+		return fmt.Errorf("invalid Dockerfile overlay %s: %s", overlayPath, err.Error())
+	}
+
+	dockerfilePath := filepath.Join(contextPath, "Dockerfile")
+	info, err := os.Stat(dockerfilePath)
+	if err != nil {
+		return fmt.Errorf("unable to find the template's Dockerfile: %s", err.Error())
+	}
+
+	dockerfile, err := ioutil.ReadFile(dockerfilePath)
+	if err != nil {
+		return err
+	}
+
+	merged, err := applyDockerfileOverlay(string(dockerfile), sections)
+	if err != nil {
+		return fmt.Errorf("invalid Dockerfile overlay %s: %s", overlayPath, err.Error())
+	}
+
+	return ioutil.WriteFile(dockerfilePath, []byte(merged), info.Mode())
+}
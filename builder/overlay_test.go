@@ -0,0 +1,151 @@
+package builder
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+const overlayTestDockerfile = `FROM golang:1.18 as build
+WORKDIR /go/src/handler
+RUN go build -o /usr/bin/fn .
+
+FROM alpine:3.16 as ship
+COPY --from=build /usr/bin/fn /usr/bin/fn
+CMD ["fn"]
+`
+
+func Test_applyDockerfileOverlay(t *testing.T) {
+	cases := []struct {
+		name    string
+		overlay string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "lines without a marker are appended",
+			overlay: "ENV mode=production\n",
+			want: `FROM golang:1.18 as build
+WORKDIR /go/src/handler
+RUN go build -o /usr/bin/fn .
+
+FROM alpine:3.16 as ship
+COPY --from=build /usr/bin/fn /usr/bin/fn
+CMD ["fn"]
+ENV mode=production
+`,
+		},
+		{
+			name:    "before final stage",
+			overlay: "# @before-final-stage\nRUN go test ./...\n",
+			want: `FROM golang:1.18 as build
+WORKDIR /go/src/handler
+RUN go build -o /usr/bin/fn .
+
+RUN go test ./...
+FROM alpine:3.16 as ship
+COPY --from=build /usr/bin/fn /usr/bin/fn
+CMD ["fn"]
+`,
+		},
+		{
+			name:    "replace an instruction",
+			overlay: "# @replace FROM alpine:3.16 as ship\nFROM alpine:3.17 as ship\n# @append\nUSER app\n",
+			want: `FROM golang:1.18 as build
+WORKDIR /go/src/handler
+RUN go build -o /usr/bin/fn .
+
+FROM alpine:3.17 as ship
+COPY --from=build /usr/bin/fn /usr/bin/fn
+CMD ["fn"]
+USER app
+`,
+		},
+		{
+			name:    "replace a missing instruction",
+			overlay: "# @replace FROM debian\nFROM ubuntu\n",
+			wantErr: "instruction not found in the Dockerfile: FROM debian",
+		},
+		{
+			name:    "unknown marker",
+			overlay: "# @prepend\nARG A\n",
+			wantErr: "unknown overlay marker: # @prepend",
+		},
+		{
+			name:    "replace without an instruction",
+			overlay: "# @replace\nFROM ubuntu\n",
+			wantErr: "# @replace requires the instruction to replace",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sections, err := parseDockerfileOverlay(tc.overlay)
+			var got string
+			if err == nil {
+				got, err = applyDockerfileOverlay(overlayTestDockerfile, sections)
+			}
+
+			if len(tc.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("want error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("want Dockerfile:\n%s\ngot:\n%s", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_createBuildContext_DockerfileOverlay(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	if err := ioutil.WriteFile(filepath.Join("handler", "Dockerfile.overlay"), []byte("# @append\nUSER app\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var tempPath string
+	test.CaptureStdout(func() {
+		var err error
+		tempPath, err = createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, DockerfileOverlay: "Dockerfile.overlay"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	got, err := ioutil.ReadFile(filepath.Join(tempPath, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "FROM scratch\nUSER app\n"; string(got) != want {
+		t.Errorf("want Dockerfile %q, got %q", want, string(got))
+	}
+
+	template, err := ioutil.ReadFile(filepath.Join("template", "go", "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(template) != "FROM scratch\n" {
+		t.Errorf("want the template's Dockerfile to be unchanged, got %q", string(template))
+	}
+}
+
+func Test_createBuildContext_DockerfileOverlayOutsideHandler(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	test.CaptureStdout(func() {
+		_, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, DockerfileOverlay: "../common/shared.txt"})
+		if err == nil || !strings.Contains(err.Error(), "outside of the build context") {
+			t.Errorf("want an error for an overlay outside of the handler, got %v", err)
+		}
+	})
+}
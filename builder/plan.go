@@ -0,0 +1,132 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+// BuildPlan describes what BuildImage would do for a function, without building it
+type BuildPlan struct {
+	FunctionName string
+	Language     string
+	Image        string
+
+	// Tags are the image and the image with each of its extra tags, once {branch}
+	// and {sha} are expanded
+	Tags []string
+
+	// BuildOptions are the requested build options, and Packages the packages
+	// they add from the template
+	BuildOptions []string
+	Packages     []string
+
+	BuildArgs map[string]string
+	Labels    map[string]string
+
+	// Command is the docker command line, build-arg secrets are shown by name only
+	Command string
+}
+
+// PlanBuild returns the BuildPlan for config, resolving the image name, build-args,
+// labels and docker command as BuildImage would, but without staging a build
+// context, reading build-arg secrets or running docker
+func PlanBuild(config BuildImageConfig) (*BuildPlan, error) {
+	config, err := applyOffline(applyWorkingDir(config))
+	if err != nil {
+		return nil, err
+	}
+
+	templateDir := templateDirOrDefault(config.TemplateDir)
+
+	if !stack.IsValidTemplateIn(templateDir, config.Language) {
+		if err := templateParseError(templateDir, config.Language); err != nil {
+			return nil, err
+		}
+		return nil, newBuildError(ErrTemplateNotSupported, "language template: %s not supported, build a custom Dockerfile", config.Language)
+	}
+
+	langTemplate, err := readLanguageTemplate(templateDir, config.Language)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMinCLIVersion(config.Language, langTemplate.MinFaaSCLIVersion); err != nil {
+		return nil, err
+	}
+
+	config = withTemplateDefaults(config, langTemplate)
+	config.BuildArgMap = withTemplateBuildArgs(langTemplate.BuildArgs, config.BuildArgMap)
+	config.BuildArgMap = withBuildArgDefaults(config.BuildArgDefaults, config.BuildArgMap, config.BuildArgSecrets)
+	if err := checkRequiredBuildArgs(config.Language, langTemplate.RequiredBuildArgs, config.BuildArgMap); err != nil {
+		return nil, err
+	}
+
+	buildOptPackages, err := getBuildOptionPackages(config.BuildOptions, config.Language, langTemplate.BuildOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	imageName, err := ResolveImageName(config)
+	if err != nil {
+		return nil, err
+	}
+
+	alsoTags, err := expandTagPatterns(config.AlsoTags)
+	if err != nil {
+		return nil, err
+	}
+
+	var sourceDateEpoch string
+	config.Output, sourceDateEpoch, err = resolveOutput(config, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	buildArgMap, buildLabelMap, err := resolveBuildArgsAndLabels(config, sourceDateEpoch, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the names of build-arg secrets are passed on the command line
+	buildArgSecrets := map[string]string{}
+	for name := range config.BuildArgSecrets {
+		buildArgSecrets[name] = ""
+	}
+
+	dockerBuildVal, err := withBuildCache(config, newDockerBuild(config, imageName, alsoTags, buildOptPackages, buildArgMap, buildLabelMap, buildArgSecrets))
+	if err != nil {
+		return nil, err
+	}
+
+	command, args := getDockerBuildCommand(dockerBuildVal)
+
+	return &BuildPlan{
+		FunctionName: config.FunctionName,
+		Language:     config.Language,
+		Image:        imageName,
+		Tags:         getImageTags(dockerBuildVal),
+		BuildOptions: config.BuildOptions,
+		Packages:     deDuplicate(buildOptPackages),
+		BuildArgs:    buildArgMap,
+		Labels:       buildLabelMap,
+		Command:      fmt.Sprintf("%s %s", command, strings.Join(quoteArgs(args), " ")),
+	}, nil
+}
+
+// quoteArgs single-quotes each argument containing whitespace or quotes, so that
+// the command can be copied into a shell
+func quoteArgs(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, " \t\n'\"") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return quoted
+}
@@ -0,0 +1,63 @@
+package builder
+
+import (
+	"os"
+	"testing"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+	"github.com/openfaas/faas-cli/schema"
+)
+
+func Test_PlanBuild(t *testing.T) {
+	setupBuildContextTest(t, "plan-lang")
+	stubGit(t, "a1b2c3d", "main", "0.1.0")
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		t.Fatalf("want no commands run for a plan, got: %s %v", task.Command, task.Args)
+		return v1execute.ExecResult{}, nil
+	})
+
+	plan, err := PlanBuild(BuildImageConfig{
+		Image:           "ghcr.io/org/fn",
+		Handler:         "./handler",
+		FunctionName:    "fn",
+		Language:        "plan-lang",
+		TagMode:         schema.SHAFormat,
+		BuildArgMap:     map[string]string{"VERSION": "{{.Git.SHA}}"},
+		BuildLabelMap:   map[string]string{"team": "images"},
+		BuildArgSecrets: map[string]string{"NPM_TOKEN": "./missing-token"},
+		ExpandBuildArgs: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if plan.Image != "ghcr.io/org/fn:latest-a1b2c3d" {
+		t.Errorf("want image ghcr.io/org/fn:latest-a1b2c3d, got %s", plan.Image)
+	}
+	if plan.BuildArgs["VERSION"] != "a1b2c3d" {
+		t.Errorf("want VERSION build-arg a1b2c3d, got %q", plan.BuildArgs["VERSION"])
+	}
+	if plan.Labels["team"] != "images" {
+		t.Errorf("want team label, got %v", plan.Labels)
+	}
+
+	want := "docker build --build-arg VERSION=a1b2c3d --build-arg NPM_TOKEN --label team=images --tag ghcr.io/org/fn:latest-a1b2c3d ."
+	if plan.Command != want {
+		t.Errorf("want command:\n%s\ngot:\n%s", want, plan.Command)
+	}
+
+	if _, err := os.Stat("build"); err == nil {
+		t.Errorf("want no build context staged for a plan")
+	}
+}
+
+func Test_quoteArgs(t *testing.T) {
+	got := quoteArgs([]string{"--build-arg", "ADDITIONAL_PACKAGE=make gcc", "--label", "note=it's"})
+	want := []string{"--build-arg", "'ADDITIONAL_PACKAGE=make gcc'", "--label", `'note=it'\''s'`}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("arg %d want %s, got %s", i, want[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// dockerfileVariable matches $NAME, ${NAME} and ${NAME:-default} within a Dockerfile instruction
+var dockerfileVariable = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// inspectManifest returns the output of "docker manifest inspect" for image, from
+// the DockerBinary and DockerContext of config, it can be replaced in tests
+var inspectManifest = func(config BuildImageConfig, image string) ([]byte, error) {
+	command, args := dockerCommand(config, "manifest", "inspect", image)
+
+	task := v1execute.ExecTask{
+		Command:     command,
+		Args:        args,
+		StreamStdio: false,
+	}
+
+	res, err := execTask(task)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("docker manifest inspect %s failed: %s", image, strings.TrimSpace(res.Stderr))
+	}
+
+	return []byte(res.Stdout), nil
+}
+
+// manifestList holds the fields needed from a manifest list or OCI image index
+type manifestList struct {
+	Manifests []struct {
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+			Variant      string `json:"variant,omitempty"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// parseDockerfileBaseImages returns the base image of each FROM instruction in the
+// Dockerfile, with ARG values substituted. Earlier build stages, scratch and stages
+// pinned to a platform other than $TARGETPLATFORM, such as --platform=$BUILDPLATFORM,
+// are not returned as they are not pulled for each of the target platforms.
+func parseDockerfileBaseImages(dockerfile string, buildArgs map[string]string) ([]string, error) {
+	args := map[string]string{}
+	stages := map[string]bool{}
+	images := []string{}
+	seenFrom := false
+
+	for _, line := range dockerfileInstructions(dockerfile) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			// Only ARGs before the first FROM apply to FROM instructions
+			if seenFrom {
+				continue
+			}
+
+			name, value := fields[1], ""
+			if i := strings.Index(name, "="); i > -1 {
+				name, value = name[:i], strings.Trim(name[i+1:], `"'`)
+			}
+			if override, ok := buildArgs[name]; ok {
+				value = override
+			}
+			args[name] = value
+
+		case "FROM":
+			seenFrom = true
+
+			pinned := false
+			rest := []string{}
+			for _, field := range fields[1:] {
+				if strings.HasPrefix(field, "--platform") {
+					pinned = !strings.Contains(field, "TARGETPLATFORM")
+					continue
+				}
+				rest = append(rest, field)
+			}
+
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("invalid FROM instruction: %s", line)
+			}
+
+			image, err := expandDockerfileArgs(rest[0], args)
+			if err != nil {
+				return nil, err
+			}
+
+			if !pinned && !strings.EqualFold(image, "scratch") && !stages[strings.ToLower(image)] {
+				images = append(images, image)
+			}
+
+			if len(rest) == 3 && strings.EqualFold(rest[1], "AS") {
+				stages[strings.ToLower(rest[2])] = true
+			}
+		}
+	}
+
+	return deDuplicate(images), nil
+}
+
+// dockerfileInstructions returns each instruction of a Dockerfile on a single line,
+// with comments removed and line continuations joined
+func dockerfileInstructions(dockerfile string) []string {
+	instructions := []string{}
+	current := ""
+
+	for _, line := range strings.Split(dockerfile, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasSuffix(trimmed, "\\") {
+			current += strings.TrimSuffix(trimmed, "\\") + " "
+			continue
+		}
+
+		current += trimmed
+		if len(strings.TrimSpace(current)) > 0 {
+			instructions = append(instructions, strings.TrimSpace(current))
+		}
+		current = ""
+	}
+
+	if len(strings.TrimSpace(current)) > 0 {
+		instructions = append(instructions, strings.TrimSpace(current))
+	}
+
+	return instructions
+}
+
+// expandDockerfileArgs substitutes $NAME and ${NAME} with the values of args, or
+// the default given with ${NAME:-default}
+func expandDockerfileArgs(value string, args map[string]string) (string, error) {
+	var missing []string
+
+	expanded := dockerfileVariable.ReplaceAllStringFunc(value, func(match string) string {
+		groups := dockerfileVariable.FindStringSubmatch(match)
+		name, fallback := groups[1], groups[2]
+		if len(name) == 0 {
+			name = groups[3]
+		}
+
+		if v := args[name]; len(v) > 0 {
+			return v
+		}
+		if len(fallback) > 0 {
+			return fallback
+		}
+
+		missing = append(missing, name)
+		return ""
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unable to resolve %s in FROM %s, set a default with ARG or pass a --build-arg", strings.Join(missing, ", "), value)
+	}
+
+	return expanded, nil
+}
+
+// normalizePlatform returns a platform as os/arch[/variant], with a "v" prefix
+// on the variant, i.e. linux/arm/7 becomes linux/arm/v7
+func normalizePlatform(platform string) string {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(platform)), "/")
+	if len(parts) == 3 && !strings.HasPrefix(parts[2], "v") {
+		parts[2] = "v" + parts[2]
+	}
+	return strings.Join(parts, "/")
+}
+
+// imagePlatforms returns the platforms advertised by the manifest list of image
+func imagePlatforms(config BuildImageConfig, image string) ([]string, error) {
+	data, err := inspectManifest(config, image)
+	if err != nil {
+		return nil, err
+	}
+
+	var list manifestList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("unable to parse the manifest for %s: %s", image, err.Error())
+	}
+
+	platforms := []string{}
+	for _, manifest := range list.Manifests {
+		p := manifest.Platform
+		if len(p.OS) == 0 || p.OS == "unknown" {
+			continue
+		}
+
+		platform := p.OS + "/" + p.Architecture
+		if len(p.Variant) > 0 {
+			platform += "/" + p.Variant
+		}
+		platforms = append(platforms, normalizePlatform(platform))
+	}
+
+	return platforms, nil
+}
+
+// platformSupported returns true when want is one of the available platforms,
+// a platform without a variant, i.e. linux/arm64, matches any variant
+func platformSupported(want string, available []string) bool {
+	want = normalizePlatform(want)
+
+	for _, platform := range available {
+		if platform == want || strings.HasPrefix(platform, want+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckBaseImagePlatforms checks that each base image within dockerfilePath
+// advertises every one of the comma-separated platforms, so that a multi-arch
+// build does not fail part of the way through. Images which cannot be inspected,
+// or which are not multi-arch, are reported as a warning. The images are inspected
+// with the DockerBinary and DockerContext of config.
+func CheckBaseImagePlatforms(config BuildImageConfig, dockerfilePath string, platforms string, buildArgs map[string]string) error {
+	data, err := ioutil.ReadFile(dockerfilePath)
+	if err != nil {
+		return err
+	}
+
+	images, err := parseDockerfileBaseImages(string(data), buildArgs)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, image := range images {
+		available, err := imagePlatforms(config, image)
+		if err != nil {
+			fmt.Printf("Warning: unable to check the platforms of %s: %s\n", image, err.Error())
+			continue
+		}
+
+		if len(available) == 0 {
+			fmt.Printf("Warning: %s is not a multi-arch image, unable to check its platforms\n", image)
+			continue
+		}
+
+		var missing []string
+		for _, platform := range strings.Split(platforms, ",") {
+			if len(strings.TrimSpace(platform)) > 0 && !platformSupported(platform, available) {
+				missing = append(missing, strings.TrimSpace(platform))
+			}
+		}
+
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Sprintf("%s does not support: %s, available: %s", image, strings.Join(missing, ", "), strings.Join(available, ", ")))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("base images do not support the requested platforms:\n%s", strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
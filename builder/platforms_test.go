@@ -0,0 +1,198 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+func Test_parseDockerfileBaseImages(t *testing.T) {
+	cases := []struct {
+		name       string
+		dockerfile string
+		buildArgs  map[string]string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:       "single stage",
+			dockerfile: "FROM alpine:3.16\nRUN apk add curl\n",
+			want:       []string{"alpine:3.16"},
+		},
+		{
+			name: "multi-stage with build platform and earlier stages",
+			dockerfile: `FROM --platform=${TARGETPLATFORM:-linux/amd64} ghcr.io/openfaas/of-watchdog:0.9.6 as watchdog
+FROM --platform=${BUILDPLATFORM:-linux/amd64} golang:1.18-alpine AS build
+COPY --from=watchdog /fwatchdog /usr/bin/fwatchdog
+FROM build AS test
+RUN go test ./...
+FROM --platform=${TARGETPLATFORM:-linux/amd64} alpine:3.16 as ship
+COPY --from=build /go/bin/handler .
+`,
+			want: []string{"ghcr.io/openfaas/of-watchdog:0.9.6", "alpine:3.16"},
+		},
+		{
+			name:       "scratch, comments and lowercase",
+			dockerfile: "# FROM ignored:latest\nfrom node:16 AS build\nfrom scratch\n",
+			want:       []string{"node:16"},
+		},
+		{
+			name:       "ARG defaults and build-arg overrides",
+			dockerfile: "ARG BASE=alpine\nARG VERSION=3.15\nFROM ${BASE}:$VERSION\n",
+			buildArgs:  map[string]string{"VERSION": "3.16"},
+			want:       []string{"alpine:3.16"},
+		},
+		{
+			name:       "line continuation",
+			dockerfile: "FROM \\\n  python:3.10-slim\n",
+			want:       []string{"python:3.10-slim"},
+		},
+		{
+			name:       "duplicate images",
+			dockerfile: "FROM alpine:3.16 AS one\nFROM alpine:3.16 AS two\n",
+			want:       []string{"alpine:3.16"},
+		},
+		{
+			name:       "unresolved ARG",
+			dockerfile: "FROM ${BASE}\n",
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseDockerfileBaseImages(tc.dockerfile, tc.buildArgs)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_platformSupported(t *testing.T) {
+	available := []string{"linux/amd64", "linux/arm/v7", "linux/arm64/v8"}
+
+	cases := map[string]bool{
+		"linux/amd64":   true,
+		"linux/arm/7":   true,
+		"linux/arm/v7":  true,
+		"linux/arm64":   true,
+		"linux/arm/v6":  false,
+		"linux/ppc64le": false,
+	}
+
+	for platform, want := range cases {
+		if got := platformSupported(platform, available); got != want {
+			t.Errorf("platformSupported(%q) want %v, got %v", platform, want, got)
+		}
+	}
+}
+
+const amd64OnlyManifest = `{
+  "schemaVersion": 2,
+  "mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+  "manifests": [
+    {"digest": "sha256:aaa", "platform": {"architecture": "amd64", "os": "linux"}},
+    {"digest": "sha256:bbb", "platform": {"architecture": "unknown", "os": "unknown"}}
+  ]
+}`
+
+const multiArchManifest = `{
+  "manifests": [
+    {"platform": {"architecture": "amd64", "os": "linux"}},
+    {"platform": {"architecture": "arm64", "os": "linux", "variant": "v8"}}
+  ]
+}`
+
+func stubManifests(t *testing.T, manifests map[string]string) {
+	orig := inspectManifest
+	inspectManifest = func(config BuildImageConfig, image string) ([]byte, error) {
+		manifest, ok := manifests[image]
+		if !ok {
+			return nil, fmt.Errorf("no such manifest: %s", image)
+		}
+		return []byte(manifest), nil
+	}
+	t.Cleanup(func() { inspectManifest = orig })
+}
+
+func writeDockerfile(t *testing.T, content string) string {
+	dockerfile := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := ioutil.WriteFile(dockerfile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dockerfile
+}
+
+func Test_CheckBaseImagePlatforms_MissingPlatform(t *testing.T) {
+	stubManifests(t, map[string]string{
+		"ghcr.io/openfaas/of-watchdog:0.9.6": multiArchManifest,
+		"example/amd64-only:1.0":             amd64OnlyManifest,
+	})
+
+	dockerfile := writeDockerfile(t, `FROM --platform=${TARGETPLATFORM:-linux/amd64} ghcr.io/openfaas/of-watchdog:0.9.6 as watchdog
+FROM --platform=${TARGETPLATFORM:-linux/amd64} example/amd64-only:1.0
+`)
+
+	err := CheckBaseImagePlatforms(BuildImageConfig{}, dockerfile, "linux/amd64,linux/arm64", nil)
+	if err == nil {
+		t.Fatalf("want error for a missing platform")
+	}
+
+	want := "example/amd64-only:1.0 does not support: linux/arm64, available: linux/amd64"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("want error to contain %q, got: %s", want, err)
+	}
+	if strings.Contains(err.Error(), "of-watchdog") {
+		t.Errorf("want only the unsupported image to be reported, got: %s", err)
+	}
+}
+
+func Test_CheckBaseImagePlatforms_Supported(t *testing.T) {
+	stubManifests(t, map[string]string{
+		"ghcr.io/openfaas/of-watchdog:0.9.6": multiArchManifest,
+	})
+
+	dockerfile := writeDockerfile(t, "FROM ghcr.io/openfaas/of-watchdog:0.9.6\n")
+
+	if err := CheckBaseImagePlatforms(BuildImageConfig{}, dockerfile, "linux/amd64,linux/arm64", nil); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func Test_CheckBaseImagePlatforms_WarnsWhenUnavailable(t *testing.T) {
+	stubManifests(t, map[string]string{
+		"example/single:1.0": `{"schemaVersion": 2, "config": {}}`,
+	})
+
+	dockerfile := writeDockerfile(t, "FROM example/single:1.0 AS one\nFROM example/private:1.0\n")
+
+	out := test.CaptureStdout(func() {
+		if err := CheckBaseImagePlatforms(BuildImageConfig{}, dockerfile, "linux/arm64", nil); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+
+	for _, want := range []string{
+		"Warning: example/single:1.0 is not a multi-arch image",
+		"Warning: unable to check the platforms of example/private:1.0",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want output to contain %q, got: %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"time"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// BuildPhase is a milestone of a build reported through BuildImageConfig.ProgressFunc
+type BuildPhase int
+
+const (
+	// PhaseContextCleared is reported once the build folder has been removed
+	PhaseContextCleared BuildPhase = iota
+
+	// PhaseTemplateCopied is reported once the language template has been copied
+	// into the build context, it is not reported for the dockerfile language
+	PhaseTemplateCopied
+
+	// PhaseBuildStarted is reported just before docker is run
+	PhaseBuildStarted
+
+	// PhaseBuildFinished is reported when docker exits, with its ExitCode and the
+	// Duration of the build
+	PhaseBuildFinished
+)
+
+func (p BuildPhase) String() string {
+	switch p {
+	case PhaseContextCleared:
+		return "context-cleared"
+	case PhaseTemplateCopied:
+		return "template-copied"
+	case PhaseBuildStarted:
+		return "build-started"
+	case PhaseBuildFinished:
+		return "build-finished"
+	}
+	return fmt.Sprintf("BuildPhase(%d)", int(p))
+}
+
+// BuildEvent describes the progress of the build of a function
+type BuildEvent struct {
+	Phase        BuildPhase
+	FunctionName string
+
+	// Path is the build context, i.e. ./build/fn/
+	Path string
+
+	// Image and Language are set from PhaseBuildStarted
+	Image    string
+	Language string
+
+	// ExitCode and Duration are set for PhaseBuildFinished, ExitCode is -1 when
+	// docker could not be run, or was interrupted
+	ExitCode int
+	Duration time.Duration
+}
+
+// reportProgress calls progress with event, when there is a progress callback
+func reportProgress(progress func(event BuildEvent), event BuildEvent) {
+	if progress != nil {
+		progress(event)
+	}
+}
+
+// printProgress prints the formatted message when there is no progress callback,
+// which reports the build's progress in its place
+func printProgress(progress func(event BuildEvent), format string, a ...interface{}) {
+	if progress == nil {
+		fmt.Printf(format, a...)
+	}
+}
+
+// finishedExitCode returns the exit code of docker for PhaseBuildFinished, or -1
+// when err means that docker could not be run, or was interrupted
+func finishedExitCode(res v1execute.ExecResult, err error) int {
+	if err != nil {
+		return -1
+	}
+	return res.ExitCode
+}
@@ -0,0 +1,177 @@
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+	"github.com/openfaas/faas-cli/test"
+)
+
+func Test_BuildImage_ProgressFunc(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	var events []BuildEvent
+	var err error
+
+	stdout := test.CaptureStdout(func() {
+		err = BuildImage(BuildImageConfig{
+			Image:        "fn",
+			Handler:      "handler",
+			FunctionName: "fn",
+			Language:     "go",
+			QuiteBuild:   true,
+			ProgressFunc: func(event BuildEvent) {
+				events = append(events, event)
+			},
+		})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var phases []BuildPhase
+	for _, event := range events {
+		phases = append(phases, event.Phase)
+	}
+
+	want := []BuildPhase{PhaseContextCleared, PhaseTemplateCopied, PhaseBuildStarted, PhaseBuildFinished}
+	if !reflect.DeepEqual(phases, want) {
+		t.Fatalf("want phases %v, got %v", want, phases)
+	}
+
+	for _, event := range events {
+		if event.FunctionName != "fn" || event.Path != "./build/fn/" {
+			t.Errorf("want function fn in ./build/fn/, got %+v", event)
+		}
+	}
+
+	finished := events[3]
+	if finished.Image != "fn:latest" || finished.Language != "go" || finished.ExitCode != 0 {
+		t.Errorf("unexpected build-finished event: %+v", finished)
+	}
+
+	for _, message := range []string{"Clearing temporary build folder", "Please wait"} {
+		if strings.Contains(stdout, message) {
+			t.Errorf("want %q to be reported through ProgressFunc instead of stdout, got:\n%s", message, stdout)
+		}
+	}
+}
+
+func Test_BuildImage_ProgressFunc_BuildFailed(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 2)
+
+	var events []BuildEvent
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		ProgressFunc: func(event BuildEvent) {
+			events = append(events, event)
+		},
+	})
+	if err == nil {
+		t.Fatalf("want error for a failed build")
+	}
+
+	if len(events) == 0 || events[len(events)-1].Phase != PhaseBuildFinished {
+		t.Fatalf("want the last event to be %s, got %+v", PhaseBuildFinished, events)
+	}
+	if got := events[len(events)-1].ExitCode; got != 2 {
+		t.Errorf("want exit code 2, got %d", got)
+	}
+}
+
+func Test_BuildImage_ProgressFunc_DockerNotRun(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		if len(task.Args) > 0 && task.Args[0] == "build" {
+			return v1execute.ExecResult{}, errors.New("exec: \"docker\": executable file not found in $PATH")
+		}
+		return v1execute.ExecResult{}, nil
+	})
+
+	var events []BuildEvent
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		ProgressFunc: func(event BuildEvent) {
+			events = append(events, event)
+		},
+	})
+	if err == nil {
+		t.Fatalf("want error when docker cannot be run")
+	}
+
+	if len(events) == 0 || events[len(events)-1].Phase != PhaseBuildFinished {
+		t.Fatalf("want the last event to be %s, got %+v", PhaseBuildFinished, events)
+	}
+	if got := events[len(events)-1].ExitCode; got != -1 {
+		t.Errorf("want exit code -1, got %d", got)
+	}
+}
+
+func Test_createBuildContext_WithoutProgressFunc(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	stdout := test.CaptureStdout(func() {
+		if _, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if !strings.Contains(stdout, "Clearing temporary build folder: ./build/fn/") {
+		t.Errorf("want progress printed to stdout, got:\n%s", stdout)
+	}
+}
+
+func Test_createBuildContext_ProgressFuncSilencesStaging(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	if err := os.MkdirAll(filepath.Join("handler", "build"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("handler", "notes.md"), []byte("notes\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := test.CaptureStdout(func() {
+		_, err := createBuildContext(buildContextOptions{
+			FunctionName: "fn",
+			Handler:      "handler",
+			TemplateDir:  "./template",
+			Language:     "go",
+			UseFunction:  true,
+			ExcludePaths: []string{"*.md"},
+			HandlerFiles: []string{"handler.go"},
+			Progress:     func(event BuildEvent) {},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if len(stdout) > 0 {
+		t.Errorf("want no output with a ProgressFunc, got:\n%s", stdout)
+	}
+}
+
+func Test_BuildPhase_String(t *testing.T) {
+	if got := PhaseBuildFinished.String(); got != "build-finished" {
+		t.Errorf("want build-finished, got %q", got)
+	}
+	if got := BuildPhase(10).String(); got != "BuildPhase(10)" {
+		t.Errorf("want BuildPhase(10), got %q", got)
+	}
+}
@@ -6,6 +6,7 @@ package builder
 import (
 	"fmt"
 	"os"
+	"path"
 	"strings"
 
 	v1execute "github.com/alexellis/go-execute/pkg/v1"
@@ -16,20 +17,26 @@ import (
 // PublishImage will publish images as multi-arch
 // TODO: refactor signature to a struct to simplify the length of the method header
 func PublishImage(image string, handler string, functionName string, language string, nocache bool, squash bool, shrinkwrap bool, buildArgMap map[string]string,
-	buildOptions []string, tagMode schema.BuildFormat, buildLabelMap map[string]string, quietBuild bool, copyExtraPaths []string, platforms string, extraTags []string) error {
+	buildOptions []string, tagMode schema.BuildFormat, buildLabelMap map[string]string, quietBuild bool, copyExtraPaths []string, platforms string, extraTags []string, checkRegistry bool, checkPlatforms bool, buildNetwork string, describeAlwaysDirty bool, dockerfileOverlay string, templateDir string, allowNoVCS bool, fallbackVersion string) error {
 
-	if stack.IsValidTemplate(language) {
-		pathToTemplateYAML := fmt.Sprintf("./template/%s/template.yml", language)
-		if _, err := os.Stat(pathToTemplateYAML); os.IsNotExist(err) {
+	templateDir = templateDirOrDefault(templateDir)
+
+	if stack.IsValidTemplateIn(templateDir, language) {
+		langTemplate, err := readLanguageTemplate(templateDir, language)
+		if err != nil {
 			return err
 		}
 
-		langTemplate, err := stack.ParseYAMLForLanguageTemplate(pathToTemplateYAML)
-		if err != nil {
-			return fmt.Errorf("error reading language template: %s", err.Error())
+		if err := checkMinCLIVersion(language, langTemplate.MinFaaSCLIVersion); err != nil {
+			return err
+		}
+
+		buildArgMap = withTemplateBuildArgs(langTemplate.BuildArgs, buildArgMap)
+		if err := checkRequiredBuildArgs(language, langTemplate.RequiredBuildArgs, buildArgMap); err != nil {
+			return err
 		}
 
-		branch, version, err := GetImageTagValues(tagMode)
+		branch, version, err := GetImageTagValuesWithFallback(tagMode, describeAlwaysDirty, allowNoVCS, fallbackVersion)
 		if err != nil {
 			return err
 		}
@@ -40,7 +47,23 @@ func PublishImage(image string, handler string, functionName string, language st
 			return fmt.Errorf("building %s, %s is an invalid path", imageName, handler)
 		}
 
-		tempPath, buildErr := createBuildContext(functionName, handler, language, isLanguageTemplate(language), langTemplate.HandlerFolder, copyExtraPaths)
+		if checkRegistry && !shrinkwrap {
+			if err := CheckRegistryAuth(imageName); err != nil {
+				return err
+			}
+		}
+
+		tempPath, buildErr := createBuildContext(buildContextOptions{
+			FunctionName:      functionName,
+			Handler:           handler,
+			TemplateDir:       templateDir,
+			Language:          language,
+			UseFunction:       isLanguageTemplate(language),
+			HandlerFolder:     langTemplate.HandlerFolder,
+			CopyExtraPaths:    copyExtraPaths,
+			HandlerFiles:      expectedHandlerFiles(language, langTemplate.HandlerFiles),
+			DockerfileOverlay: dockerfileOverlay,
+		})
 		fmt.Printf("Building: %s with %s template. Please wait..\n", imageName, language)
 		if buildErr != nil {
 			return buildErr
@@ -51,6 +74,16 @@ func PublishImage(image string, handler string, functionName string, language st
 			return nil
 		}
 
+		if err := requireDockerVersion(BuildImageConfig{}, "buildx", minBuildxVersion); err != nil {
+			return err
+		}
+
+		if checkPlatforms {
+			if err := CheckBaseImagePlatforms(BuildImageConfig{}, path.Join(tempPath, "Dockerfile"), platforms, buildArgMap); err != nil {
+				return err
+			}
+		}
+
 		buildOptPackages, buildPackageErr := getBuildOptionPackages(buildOptions, language, langTemplate.BuildOptions)
 
 		if buildPackageErr != nil {
@@ -69,6 +102,11 @@ func PublishImage(image string, handler string, functionName string, language st
 			BuildLabelMap:    buildLabelMap,
 			Platforms:        platforms,
 			ExtraTags:        extraTags,
+			BuildNetwork:     buildNetwork,
+		}
+
+		if err := validateBuildxNetwork(dockerBuildVal); err != nil {
+			return err
 		}
 
 		command, args := getDockerBuildxCommand(dockerBuildVal)
@@ -100,6 +138,15 @@ func PublishImage(image string, handler string, functionName string, language st
 	return nil
 }
 
+// validateBuildxNetwork returns an error when host networking is requested for a
+// multi-platform build, which buildx does not support
+func validateBuildxNetwork(build dockerBuild) error {
+	if build.BuildNetwork == "host" && strings.Contains(build.Platforms, ",") {
+		return fmt.Errorf("--build-network host is only supported by the classic builder and cannot be used with multiple --platforms: %s", build.Platforms)
+	}
+	return nil
+}
+
 func getDockerBuildxCommand(build dockerBuild) (string, []string) {
 	flagSlice := buildFlagSlice(build)
 
@@ -110,19 +157,12 @@ func getDockerBuildxCommand(build dockerBuild) (string, []string) {
 
 	args = append(args, flagSlice...)
 
-	args = append(args, "--tag", build.Image, ".")
-
-	for _, t := range build.ExtraTags {
-
-		var tag string
-		if i := strings.LastIndex(build.Image, ":"); i > -1 {
-			tag = applyTag(i, build.Image, t)
-		} else {
-			tag = applyTag(len(build.Image)-1, build.Image, t)
-		}
+	for _, tag := range getImageTags(build) {
 		args = append(args, "--tag", tag)
 	}
 
+	args = append(args, ".")
+
 	command := "docker"
 
 	return command, args
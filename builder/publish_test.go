@@ -0,0 +1,62 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openfaas/faas-cli/schema"
+)
+
+func Test_PublishImage_TemplateDir(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	if err := os.MkdirAll("infra", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename("template", filepath.Join("infra", "template")); err != nil {
+		t.Fatal(err)
+	}
+
+	publish := func(templateDir string) error {
+		return PublishImage("fn", "handler", "fn", "go", false, false, true, nil,
+			nil, schema.DefaultFormat, nil, false, nil, "", nil, false, false, "", false, "", templateDir, false, "")
+	}
+
+	if err := publish(filepath.Join("infra", "template")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	dockerfile, err := ioutil.ReadFile(filepath.Join("build", "fn", "Dockerfile"))
+	if err != nil {
+		t.Fatalf("want the template's Dockerfile in the build context: %s", err)
+	}
+	if string(dockerfile) != "FROM scratch\n" {
+		t.Errorf("want the Dockerfile from the template folder, got %q", dockerfile)
+	}
+
+	t.Run("the default template folder is not used", func(t *testing.T) {
+		if err := publish(""); err == nil {
+			t.Errorf("want an error as ./template does not exist")
+		}
+	})
+}
+
+func Test_PublishImage_AllowNoVCS(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubGit(t, "", "", "")
+
+	publish := func(allowNoVCS bool) error {
+		return PublishImage("fn", "handler", "fn", "go", false, false, true, nil,
+			nil, schema.SHAFormat, nil, false, nil, "", nil, false, false, "", false, "", "", allowNoVCS, "0.1.0")
+	}
+
+	if err := publish(false); err == nil {
+		t.Errorf("want an error for --tag sha outside of a Git repository")
+	}
+
+	if err := publish(true); err != nil {
+		t.Errorf("want the fallback version to be used, got: %s", err)
+	}
+}
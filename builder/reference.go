@@ -0,0 +1,75 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The patterns follow the grammar for image references used by Docker, see:
+// https://github.com/distribution/distribution/blob/main/reference/reference.go
+var (
+	domainRegexp        = regexp.MustCompile(`^(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?$`)
+	pathComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	tagRegexp           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp        = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+)
+
+// maxImageNameLength is the longest repository name, excluding the tag, accepted by Docker
+const maxImageNameLength = 255
+
+// ValidateImageReference checks that image is a valid reference for Docker, i.e.
+// registry:5000/org/name:tag and returns an error naming the invalid component
+func ValidateImageReference(image string) error {
+	if len(image) == 0 {
+		return fmt.Errorf("invalid image reference: image name is empty")
+	}
+
+	name := image
+
+	if i := strings.Index(name, "@"); i > -1 {
+		digest := name[i+1:]
+		name = name[:i]
+		if !digestRegexp.MatchString(digest) {
+			return fmt.Errorf("invalid image reference %q: invalid digest %q", image, digest)
+		}
+	}
+
+	if i := strings.LastIndex(name, ":"); i > -1 && !strings.Contains(name[i+1:], "/") {
+		tag := name[i+1:]
+		name = name[:i]
+		if !tagRegexp.MatchString(tag) {
+			return fmt.Errorf("invalid image reference %q: invalid tag %q, a tag may contain up to 128 letters, digits, underscores, periods and dashes and must not start with a period or dash", image, tag)
+		}
+	}
+
+	if len(name) > maxImageNameLength {
+		return fmt.Errorf("invalid image reference %q: repository name must not be more than %d characters", image, maxImageNameLength)
+	}
+
+	components := strings.Split(name, "/")
+	if len(components) > 1 && isDomain(components[0]) {
+		if !domainRegexp.MatchString(components[0]) {
+			return fmt.Errorf("invalid image reference %q: invalid registry %q", image, components[0])
+		}
+		components = components[1:]
+	}
+
+	for _, component := range components {
+		if !pathComponentRegexp.MatchString(component) {
+			return fmt.Errorf("invalid image reference %q: invalid repository name component %q, must be lowercase letters, digits and separators", image, component)
+		}
+	}
+
+	return nil
+}
+
+// isDomain returns true when the first component of an image name is a registry
+func isDomain(component string) bool {
+	return strings.ContainsAny(component, ".:") ||
+		component == "localhost" ||
+		strings.ToLower(component) != component
+}
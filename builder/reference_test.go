@@ -0,0 +1,93 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_ValidateImageReference_Valid(t *testing.T) {
+	references := []string{
+		"fn",
+		"fn:latest",
+		"alexellis/fn:latest-a1b2c3d",
+		"alexellis/fn:latest-master-a1b2c3d",
+		"docker.io/library/fn:0.1.0",
+		"localhost/fn:dev",
+		"localhost:5000/org/team/fn:1.2.3",
+		"registry.example.com:443/fn_name/sub-path:v1.0.0-1-ga1b2c3d",
+		"ghcr.io/openfaas/fn@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"ghcr.io/openfaas/fn:0.1@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}
+
+	for _, reference := range references {
+		if err := ValidateImageReference(reference); err != nil {
+			t.Errorf("want %q to be valid, got: %s", reference, err)
+		}
+	}
+}
+
+func Test_ValidateImageReference_Invalid(t *testing.T) {
+	cases := []struct {
+		name      string
+		reference string
+		wantErr   string
+	}{
+		{
+			name:      "empty",
+			reference: "",
+			wantErr:   "image name is empty",
+		},
+		{
+			name:      "branch name with a slash in the tag",
+			reference: "alexellis/fn:latest-feature/login-a1b2c3d",
+			wantErr:   `invalid repository name component "fn:latest-feature"`,
+		},
+		{
+			name:      "tag with illegal characters",
+			reference: "alexellis/fn:latest-fix#12-a1b2c3d",
+			wantErr:   `invalid tag "latest-fix#12-a1b2c3d"`,
+		},
+		{
+			name:      "tag starting with a dash",
+			reference: "alexellis/fn:-latest",
+			wantErr:   `invalid tag "-latest"`,
+		},
+		{
+			name:      "uppercase repository",
+			reference: "alexellis/MyFunction:latest",
+			wantErr:   `invalid repository name component "MyFunction"`,
+		},
+		{
+			name:      "bad registry",
+			reference: "-registry.example.com/fn:latest",
+			wantErr:   `invalid registry "-registry.example.com"`,
+		},
+		{
+			name:      "bad registry port",
+			reference: "registry.example.com:port/fn:latest",
+			wantErr:   `invalid registry "registry.example.com:port"`,
+		},
+		{
+			name:      "bad digest",
+			reference: "alexellis/fn@sha256:xyz",
+			wantErr:   `invalid digest "sha256:xyz"`,
+		},
+		{
+			name:      "empty path component",
+			reference: "alexellis//fn:latest",
+			wantErr:   `invalid repository name component ""`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateImageReference(tc.reference)
+			if err == nil {
+				t.Fatalf("want error for %q", tc.reference)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("want error containing %q, got %q", tc.wantErr, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+const (
+	// defaultRegistry is used for images without a registry component
+	defaultRegistry = "docker.io"
+
+	// dockerHubAuthKey is the key Docker uses for the Hub in config.json
+	dockerHubAuthKey = "index.docker.io"
+)
+
+// dockerConfig holds the fields of ~/.docker/config.json needed to find credentials
+type dockerConfig struct {
+	Auths       map[string]json.RawMessage `json:"auths"`
+	CredsStore  string                     `json:"credsStore,omitempty"`
+	CredHelpers map[string]string          `json:"credHelpers,omitempty"`
+}
+
+// registryDomain returns the registry that image will be pushed to
+func registryDomain(image string) string {
+	components := strings.Split(image, "/")
+	if len(components) > 1 && isDomain(components[0]) {
+		return components[0]
+	}
+
+	return defaultRegistry
+}
+
+// normalizeRegistry strips the scheme and path from a registry as it may be
+// written in config.json, i.e. https://index.docker.io/v1/
+func normalizeRegistry(registry string) string {
+	registry = strings.TrimPrefix(registry, "https://")
+	registry = strings.TrimPrefix(registry, "http://")
+	if i := strings.Index(registry, "/"); i > -1 {
+		registry = registry[:i]
+	}
+
+	if registry == defaultRegistry || registry == "registry-1.docker.io" {
+		return dockerHubAuthKey
+	}
+
+	return registry
+}
+
+// dockerConfigPath returns the path to the Docker client's config.json
+func dockerConfigPath() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); len(dir) > 0 {
+		return filepath.Join(dir, "config.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+// registryCredential is the login stored by the Docker client for a registry
+type registryCredential struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// dockerAuth is an entry of auths in config.json
+type dockerAuth struct {
+	Auth          string `json:"auth"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// identityTokenUser is the username given with an identity token rather than a password
+const identityTokenUser = "<token>"
+
+// registryClient is used to check a login against the registry
+var registryClient = &http.Client{Timeout: 10 * time.Second}
+
+// registryURL returns the base URL of the API of registry, it can be replaced in tests
+var registryURL = func(registry string) string {
+	if normalizeRegistry(registry) == dockerHubAuthKey {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + registry
+}
+
+// CheckRegistryAuth checks that the registry that image will be pushed to accepts
+// the login stored by the Docker client, so that a missing or expired login is
+// found before a build rather than at push time. The login is read from auths,
+// credHelpers or the credsStore of config.json, and is sent to the /v2/ endpoint
+// of the registry, or to its token service. A login with an identity token is
+// only checked for presence.
+func CheckRegistryAuth(image string) error {
+	registry := registryDomain(image)
+
+	credential, err := findRegistryCredential(registry)
+	if err != nil {
+		return err
+	}
+
+	if credential.Username == identityTokenUser {
+		return nil
+	}
+
+	return checkRegistryLogin(registry, credential)
+}
+
+// findRegistryCredential returns the login of the Docker client for registry
+func findRegistryCredential(registry string) (registryCredential, error) {
+	configPath, err := dockerConfigPath()
+	if err != nil {
+		return registryCredential{}, fmt.Errorf("unable to find the Docker config: %s", err.Error())
+	}
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return registryCredential{}, fmt.Errorf("no credentials found for registry %s, run: docker login %s", registry, registry)
+		}
+		return registryCredential{}, fmt.Errorf("unable to read the Docker config %s: %s", configPath, err.Error())
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return registryCredential{}, fmt.Errorf("unable to parse the Docker config %s: %s", configPath, err.Error())
+	}
+
+	want := normalizeRegistry(registry)
+
+	for key, helper := range config.CredHelpers {
+		if normalizeRegistry(key) == want {
+			return helperCredential(helper, key, registry)
+		}
+	}
+
+	for key, raw := range config.Auths {
+		if normalizeRegistry(key) != want {
+			continue
+		}
+
+		var auth dockerAuth
+		if err := json.Unmarshal(raw, &auth); err != nil {
+			return registryCredential{}, fmt.Errorf("unable to parse the credentials for %s in %s: %s", key, configPath, err.Error())
+		}
+
+		if len(auth.IdentityToken) > 0 {
+			return registryCredential{Username: identityTokenUser, Secret: auth.IdentityToken}, nil
+		}
+
+		if len(auth.Auth) > 0 {
+			return decodeDockerAuth(key, auth.Auth)
+		}
+
+		// An empty entry is written for a login kept in the credsStore
+		if len(config.CredsStore) > 0 {
+			return helperCredential(config.CredsStore, key, registry)
+		}
+	}
+
+	if len(config.CredsStore) > 0 {
+		return helperCredential(config.CredsStore, registryServerURL(registry), registry)
+	}
+
+	return registryCredential{}, fmt.Errorf("no credentials found for registry %s in %s, run: docker login %s", registry, configPath, registry)
+}
+
+// registryServerURL returns the server that docker login stores a login for
+// registry under
+func registryServerURL(registry string) string {
+	if normalizeRegistry(registry) == dockerHubAuthKey {
+		return "https://index.docker.io/v1/"
+	}
+	return registry
+}
+
+// decodeDockerAuth decodes the base64 user:password of an auths entry
+func decodeDockerAuth(key, encoded string) (registryCredential, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return registryCredential{}, fmt.Errorf("unable to decode the credentials for %s: %s", key, err.Error())
+	}
+
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return registryCredential{}, fmt.Errorf("unable to decode the credentials for %s: expected user:password", key)
+	}
+
+	return registryCredential{Username: parts[0], Secret: parts[1]}, nil
+}
+
+// helperCredential reads the login for server from the docker-credential-<helper>
+// credential helper
+func helperCredential(helper, server, registry string) (registryCredential, error) {
+	res, err := execTask(v1execute.ExecTask{
+		Command:     "docker-credential-" + helper,
+		Args:        []string{"get"},
+		Stdin:       strings.NewReader(server),
+		StreamStdio: false,
+	})
+	if err != nil {
+		return registryCredential{}, fmt.Errorf("unable to run the %s credential helper: %s", helper, err.Error())
+	}
+
+	if res.ExitCode != 0 {
+		return registryCredential{}, fmt.Errorf("no credentials found for registry %s in the %s credential helper, run: docker login %s", registry, helper, registry)
+	}
+
+	var credential registryCredential
+	if err := json.Unmarshal([]byte(res.Stdout), &credential); err != nil {
+		return registryCredential{}, fmt.Errorf("unable to parse the output of the %s credential helper: %s", helper, err.Error())
+	}
+
+	return credential, nil
+}
+
+// checkRegistryLogin sends credential to registry, as per the token authentication
+// of the registry API: the /v2/ endpoint either accepts basic authentication, or
+// names the token service which is asked for a token
+func checkRegistryLogin(registry string, credential registryCredential) error {
+	endpoint := registryURL(registry) + "/v2/"
+
+	res, err := registryClient.Get(endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to reach registry %s: %s", registry, err.Error())
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	if res.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("unexpected status from registry %s: %d", registry, res.StatusCode)
+	}
+
+	challenge := res.Header.Get("WWW-Authenticate")
+	loginURL := endpoint
+	if strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		loginURL, err = tokenURL(challenge, credential.Username)
+		if err != nil {
+			return fmt.Errorf("unable to log into registry %s: %s", registry, err.Error())
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, loginURL, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(credential.Username, credential.Secret)
+
+	res, err = registryClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to log into registry %s: %s", registry, err.Error())
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("the credentials for registry %s were rejected, they may have expired, run: docker login %s", registry, registry)
+	}
+
+	return fmt.Errorf("unable to log into registry %s, status: %d", registry, res.StatusCode)
+}
+
+// challengeParam matches a key="value" parameter of a WWW-Authenticate challenge
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// tokenURL returns the URL of the token service from a Bearer challenge, i.e.
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func tokenURL(challenge, username string) (string, error) {
+	params := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+
+	realm, ok := params["realm"]
+	if !ok {
+		return "", fmt.Errorf("no realm in the challenge: %s", challenge)
+	}
+
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("account", username)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,180 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+func Test_registryDomain(t *testing.T) {
+	cases := map[string]string{
+		"alexellis/figlet:latest":             "docker.io",
+		"figlet":                              "docker.io",
+		"ghcr.io/openfaas/figlet:0.1.0":       "ghcr.io",
+		"localhost:5000/figlet":               "localhost:5000",
+		"registry.example.com:443/org/fn:dev": "registry.example.com:443",
+	}
+
+	for image, want := range cases {
+		if got := registryDomain(image); got != want {
+			t.Errorf("registryDomain(%q) want %q, got %q", image, want, got)
+		}
+	}
+}
+
+func writeDockerConfig(t *testing.T, config string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_CONFIG", dir)
+}
+
+// stubRegistry starts a registry which asks for a token from its token service,
+// which accepts user:pass, and points registryURL at it
+func stubRegistry(t *testing.T, challenge string) {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		authorized := ok && user == "user" && pass == "pass"
+
+		switch {
+		case r.URL.Path == "/v2/" && challenge == "Basic" && authorized:
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/" && challenge == "Basic":
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry.test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/token" && r.URL.Query().Get("service") == "registry.test" && authorized:
+			fmt.Fprint(w, `{"token": "abc"}`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	orig := registryURL
+	registryURL = func(registry string) string { return server.URL }
+	t.Cleanup(func() { registryURL = orig })
+}
+
+// stubCredentialHelpers answers docker-credential-<helper> get with user:pass for
+// each of the servers, and as not found for any other
+func stubCredentialHelpers(t *testing.T, servers ...string) *[]string {
+	var asked []string
+
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		data, _ := ioutil.ReadAll(task.Stdin)
+		asked = append(asked, task.Command+" "+string(data))
+
+		for _, server := range servers {
+			if string(data) == server {
+				return v1execute.ExecResult{Stdout: `{"ServerURL": "` + server + `", "Username": "user", "Secret": "pass"}`}, nil
+			}
+		}
+		return v1execute.ExecResult{Stdout: "credentials not found in native keychain", ExitCode: 1}, nil
+	})
+
+	return &asked
+}
+
+func Test_CheckRegistryAuth(t *testing.T) {
+	stubRegistry(t, "Bearer")
+	asked := stubCredentialHelpers(t, "ghcr.io", "123456789.dkr.ecr.eu-west-1.amazonaws.com")
+
+	writeDockerConfig(t, `{
+	"auths": {
+		"https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNz"},
+		"ghcr.io": {}
+	},
+	"credsStore": "desktop",
+	"credHelpers": {
+		"123456789.dkr.ecr.eu-west-1.amazonaws.com": "ecr-login"
+	}
+}`)
+
+	for _, image := range []string{
+		"alexellis/figlet:latest",
+		"ghcr.io/openfaas/figlet:0.1.0",
+		"123456789.dkr.ecr.eu-west-1.amazonaws.com/figlet:latest",
+	} {
+		if err := CheckRegistryAuth(image); err != nil {
+			t.Errorf("want the login to be accepted for %s, got: %s", image, err)
+		}
+	}
+
+	want := []string{
+		"docker-credential-desktop ghcr.io",
+		"docker-credential-ecr-login 123456789.dkr.ecr.eu-west-1.amazonaws.com",
+	}
+	if !reflect.DeepEqual(*asked, want) {
+		t.Errorf("want the credential helpers to be asked %v, got %v", want, *asked)
+	}
+
+	err := CheckRegistryAuth("quay.io/openfaas/figlet:latest")
+	if err == nil {
+		t.Fatalf("want error for a registry without credentials")
+	}
+	if !strings.Contains(err.Error(), "docker login quay.io") {
+		t.Errorf("want a docker login hint, got: %s", err)
+	}
+}
+
+func Test_CheckRegistryAuth_CredsStoreOnly(t *testing.T) {
+	stubRegistry(t, "Bearer")
+	asked := stubCredentialHelpers(t, "https://index.docker.io/v1/")
+
+	writeDockerConfig(t, `{"credsStore": "desktop"}`)
+
+	if err := CheckRegistryAuth("alexellis/figlet:latest"); err != nil {
+		t.Errorf("want the login from the credsStore to be accepted, got: %s", err)
+	}
+
+	if want := []string{"docker-credential-desktop https://index.docker.io/v1/"}; !reflect.DeepEqual(*asked, want) {
+		t.Errorf("want the credsStore to be asked %v, got %v", want, *asked)
+	}
+}
+
+func Test_CheckRegistryAuth_Rejected(t *testing.T) {
+	for _, challenge := range []string{"Bearer", "Basic"} {
+		t.Run(challenge, func(t *testing.T) {
+			stubRegistry(t, challenge)
+
+			// user:expired
+			writeDockerConfig(t, `{"auths": {"registry.test": {"auth": "dXNlcjpleHBpcmVk"}}}`)
+
+			err := CheckRegistryAuth("registry.test/figlet:latest")
+			if err == nil || !strings.Contains(err.Error(), "were rejected") {
+				t.Errorf("want the login to be rejected, got: %v", err)
+			}
+
+			// user:pass
+			writeDockerConfig(t, `{"auths": {"registry.test": {"auth": "dXNlcjpwYXNz"}}}`)
+
+			if err := CheckRegistryAuth("registry.test/figlet:latest"); err != nil {
+				t.Errorf("want the login to be accepted, got: %s", err)
+			}
+		})
+	}
+}
+
+func Test_CheckRegistryAuth_NoConfig(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	if err := CheckRegistryAuth("alexellis/figlet:latest"); err == nil {
+		t.Errorf("want error when there is no Docker config")
+	}
+}
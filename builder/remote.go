@@ -0,0 +1,66 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	vcs "github.com/openfaas/faas-cli/versioncontrol"
+)
+
+// cloneRepository clones repo into dir at refName, or the default branch when
+// refName is empty. It can be replaced in tests.
+var cloneRepository = func(repo, refName, dir string) error {
+	args := map[string]string{"dir": dir, "repo": repo}
+	cmd := vcs.GitCloneDefault
+
+	if refName != "" {
+		if err := vcs.GitCheckRefName.Invoke(".", map[string]string{"refname": refName}); err != nil {
+			return fmt.Errorf("invalid Git reference: %s", refName)
+		}
+
+		args["refname"] = refName
+		cmd = vcs.GitClone
+	}
+
+	return cmd.Invoke(".", args)
+}
+
+// isRemoteHandler returns true when the handler is a Git URL, optionally pinned
+// to a ref with a # suffix, i.e. https://github.com/org/repo.git#main
+func isRemoteHandler(handler string) bool {
+	return vcs.IsGitRemote(handler) || vcs.IsPinnedGitRemote(handler)
+}
+
+// fetchRemoteHandler clones a remote Git handler into a temporary folder and returns
+// its path. The caller is responsible for removing the folder.
+func fetchRemoteHandler(handler string) (string, error) {
+	repo, refName := vcs.ParsePinnedRemote(handler)
+	if !vcs.IsGitRemote(repo) {
+		return "", fmt.Errorf("invalid Git URL for handler: %s", handler)
+	}
+
+	dir, err := ioutil.TempDir("", "openfaas-handler")
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Cloning handler from: %s\n", handler)
+
+	if err := cloneRepository(repo, refName, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("unable to clone handler from %s: %s", handler, err.Error())
+	}
+
+	// The Git metadata is not part of the function's source
+	if err := os.RemoveAll(filepath.Join(dir, ".git")); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
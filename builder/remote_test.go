@@ -0,0 +1,90 @@
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_isRemoteHandler(t *testing.T) {
+	cases := []struct {
+		handler string
+		want    bool
+	}{
+		{"./handler", false},
+		{"/path/to/fn/", false},
+		{"https://github.com/openfaas/faas-cli.git", true},
+		{"https://github.com/openfaas/faas-cli#master", true},
+		{"git@github.com:openfaas/faas-cli.git", true},
+	}
+
+	for _, tc := range cases {
+		if got := isRemoteHandler(tc.handler); got != tc.want {
+			t.Errorf("isRemoteHandler(%q) want %v, got %v", tc.handler, tc.want, got)
+		}
+	}
+}
+
+func Test_fetchRemoteHandler(t *testing.T) {
+	var gotRepo, gotRef string
+
+	orig := cloneRepository
+	defer func() { cloneRepository = orig }()
+
+	cloneRepository = func(repo, refName, dir string) error {
+		gotRepo, gotRef = repo, refName
+
+		if err := os.MkdirAll(filepath.Join(dir, ".git"), 0700); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dir, "handler.py"), []byte("def handle(req):\n"), 0600)
+	}
+
+	dir, err := fetchRemoteHandler("https://github.com/org/fn.git#v1.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if gotRepo != "https://github.com/org/fn.git" {
+		t.Errorf("want repo https://github.com/org/fn.git, got %q", gotRepo)
+	}
+	if gotRef != "v1.0.0" {
+		t.Errorf("want ref v1.0.0, got %q", gotRef)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "handler.py")); err != nil {
+		t.Errorf("want handler.py in the cloned handler: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); !os.IsNotExist(err) {
+		t.Errorf("want .git folder to be removed from the cloned handler")
+	}
+}
+
+func Test_fetchRemoteHandler_CloneFailure(t *testing.T) {
+	var clonedDir string
+
+	orig := cloneRepository
+	defer func() { cloneRepository = orig }()
+
+	cloneRepository = func(repo, refName, dir string) error {
+		clonedDir = dir
+		return fmt.Errorf("exit status 128")
+	}
+
+	_, err := fetchRemoteHandler("https://github.com/org/missing.git")
+	if err == nil {
+		t.Fatalf("want error when the clone fails")
+	}
+
+	want := "unable to clone handler from https://github.com/org/missing.git: exit status 128"
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+
+	if _, err := os.Stat(clonedDir); !os.IsNotExist(err) {
+		t.Errorf("want temporary clone folder to be removed after a failure")
+	}
+}
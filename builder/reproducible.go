@@ -0,0 +1,97 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sourceDateEpochEnv is the build-arg and environment variable which reproducible
+	// builds use in place of the current time, see https://reproducible-builds.org/
+	sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+	// CreatedLabel records when an image was created, which changes the image on
+	// every build unless it is set to the time of the commit
+	CreatedLabel = "org.opencontainers.image.created"
+
+	// rewriteTimestamp has buildx set the timestamps of files to SOURCE_DATE_EPOCH
+	rewriteTimestamp = "rewrite-timestamp=true"
+)
+
+// getSourceDateEpoch returns SOURCE_DATE_EPOCH from the environment when set, or
+// the time of the last Git commit
+func getSourceDateEpoch() (string, error) {
+	if epoch := os.Getenv(sourceDateEpochEnv); len(epoch) > 0 {
+		if _, err := strconv.ParseInt(epoch, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid %s: %q, must be seconds since the Unix epoch", sourceDateEpochEnv, epoch)
+		}
+		return epoch, nil
+	}
+
+	commitTime, err := getGitCommitTime()
+	if err != nil {
+		return "", fmt.Errorf("--reproducible needs the time of the last commit from Git, or %s to be set: %s", sourceDateEpochEnv, err.Error())
+	}
+
+	return strconv.FormatInt(commitTime, 10), nil
+}
+
+// reproducibleOutput adds rewrite-timestamp to the buildx output, an image is
+// loaded into the Docker daemon when no output is given
+func reproducibleOutput(output string) string {
+	if len(output) == 0 {
+		return "type=docker," + rewriteTimestamp
+	}
+
+	if strings.Contains(output, "rewrite-timestamp=") {
+		return output
+	}
+
+	return output + "," + rewriteTimestamp
+}
+
+// outputLoadsImage returns true when a buildx output loads the image into the
+// Docker daemon
+func outputLoadsImage(output string) bool {
+	for _, option := range strings.Split(output, ",") {
+		if option == "type=docker" {
+			return true
+		}
+	}
+	return false
+}
+
+// withSourceDateEpoch returns copies of buildArgs with SOURCE_DATE_EPOCH added, unless
+// already given, and of labels with any CreatedLabel set to the time of epoch
+func withSourceDateEpoch(epoch string, buildArgs, labels map[string]string, warnings *[]Warning) (map[string]string, map[string]string) {
+	args := make(map[string]string, len(buildArgs)+1)
+	for k, v := range buildArgs {
+		args[k] = v
+	}
+	if _, ok := args[sourceDateEpochEnv]; !ok {
+		args[sourceDateEpochEnv] = epoch
+	}
+
+	merged := make(map[string]string, len(labels))
+	for k, v := range labels {
+		merged[k] = v
+	}
+
+	if created, ok := merged[CreatedLabel]; ok {
+		seconds, _ := strconv.ParseInt(epoch, 10, 64)
+		commitTime := time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+
+		if created != commitTime {
+			warn(warnings, WarnCreatedLabel, "setting the %s label to %s for a reproducible build, instead of %s", CreatedLabel, commitTime, created)
+			merged[CreatedLabel] = commitTime
+		}
+	}
+
+	return args, merged
+}
@@ -0,0 +1,164 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// stubGitCommitTime replaces the Git commit time lookup for the duration of a test
+func stubGitCommitTime(t *testing.T, commitTime int64, err error) {
+	orig := getGitCommitTime
+	getGitCommitTime = func() (int64, error) { return commitTime, err }
+	t.Cleanup(func() { getGitCommitTime = orig })
+}
+
+func Test_getSourceDateEpoch(t *testing.T) {
+	t.Run("from the last commit", func(t *testing.T) {
+		t.Setenv(sourceDateEpochEnv, "")
+		stubGitCommitTime(t, 1656633600, nil)
+
+		got, err := getSourceDateEpoch()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != "1656633600" {
+			t.Errorf("want 1656633600, got %q", got)
+		}
+	})
+
+	t.Run("from the environment", func(t *testing.T) {
+		t.Setenv(sourceDateEpochEnv, "1600000000")
+		stubGitCommitTime(t, 1656633600, nil)
+
+		got, err := getSourceDateEpoch()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != "1600000000" {
+			t.Errorf("want 1600000000, got %q", got)
+		}
+	})
+
+	t.Run("invalid environment", func(t *testing.T) {
+		t.Setenv(sourceDateEpochEnv, "yesterday")
+
+		if _, err := getSourceDateEpoch(); err == nil || !strings.Contains(err.Error(), "invalid SOURCE_DATE_EPOCH") {
+			t.Errorf("want error for an invalid epoch, got %v", err)
+		}
+	})
+
+	t.Run("not a Git repository", func(t *testing.T) {
+		t.Setenv(sourceDateEpochEnv, "")
+		stubGitCommitTime(t, 0, fmt.Errorf("not a git repository"))
+
+		if _, err := getSourceDateEpoch(); err == nil || !strings.HasPrefix(err.Error(), "--reproducible needs the time of the last commit") {
+			t.Errorf("want error without Git, got %v", err)
+		}
+	})
+}
+
+func Test_reproducibleOutput(t *testing.T) {
+	cases := map[string]string{
+		"":                     "type=docker,rewrite-timestamp=true",
+		"type=oci,dest=fn.tar": "type=oci,dest=fn.tar,rewrite-timestamp=true",
+		"type=oci,dest=fn.tar,rewrite-timestamp=false": "type=oci,dest=fn.tar,rewrite-timestamp=false",
+	}
+
+	for output, want := range cases {
+		if got := reproducibleOutput(output); got != want {
+			t.Errorf("reproducibleOutput(%q) want %q, got %q", output, want, got)
+		}
+	}
+}
+
+func Test_withSourceDateEpoch(t *testing.T) {
+	args, labels := withSourceDateEpoch("1656633600",
+		map[string]string{"GO111MODULE": "on"},
+		map[string]string{CreatedLabel: "2022-07-04T10:00:00Z", "team": "a"}, nil)
+
+	if args[sourceDateEpochEnv] != "1656633600" || args["GO111MODULE"] != "on" {
+		t.Errorf("want SOURCE_DATE_EPOCH added to the build-args, got %v", args)
+	}
+
+	if labels[CreatedLabel] != "2022-07-01T00:00:00Z" {
+		t.Errorf("want %s set to the commit time, got %q", CreatedLabel, labels[CreatedLabel])
+	}
+	if labels["team"] != "a" {
+		t.Errorf("want other labels kept, got %v", labels)
+	}
+
+	args, labels = withSourceDateEpoch("1656633600", map[string]string{sourceDateEpochEnv: "1"}, nil, nil)
+	if args[sourceDateEpochEnv] != "1" {
+		t.Errorf("want a SOURCE_DATE_EPOCH build-arg to take precedence, got %q", args[sourceDateEpochEnv])
+	}
+	if _, ok := labels[CreatedLabel]; ok {
+		t.Errorf("want no %s label to be added", CreatedLabel)
+	}
+}
+
+func Test_BuildImage_Reproducible(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	t.Setenv(sourceDateEpochEnv, "")
+	stubGitCommitTime(t, 1656633600, nil)
+	builds := stubBuildxBuild(t)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		Reproducible: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(*builds) != 2 {
+		t.Fatalf("want a build and an image inspect, got %d tasks", len(*builds))
+	}
+
+	task := (*builds)[0]
+	want := "buildx build --output type=docker,rewrite-timestamp=true --build-arg SOURCE_DATE_EPOCH=1656633600 --tag fn:latest ."
+	if got := strings.Join(task.Args, " "); got != want {
+		t.Errorf("want args %q, got %q", want, got)
+	}
+
+	found := false
+	for _, env := range task.Env {
+		if env == "SOURCE_DATE_EPOCH=1656633600" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want SOURCE_DATE_EPOCH in the environment of docker, got %v", task.Env)
+	}
+
+	if inspect := strings.Join((*builds)[1].Args, " "); !strings.HasPrefix(inspect, "image inspect") {
+		t.Errorf("want the image loaded by type=docker to be inspected, got %q", inspect)
+	}
+}
+
+func Test_BuildImage_ReproducibleWithoutGit(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	t.Setenv(sourceDateEpochEnv, "")
+	stubGitCommitTime(t, 0, fmt.Errorf("not a git repository"))
+	builds := stubBuildxBuild(t)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		Reproducible: true,
+	})
+	if err == nil {
+		t.Fatalf("want error without a commit time")
+	}
+
+	if len(*builds) != 0 {
+		t.Errorf("want no build, got %d", len(*builds))
+	}
+}
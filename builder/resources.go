@@ -0,0 +1,119 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// buildMemoryFormat matches a memory limit for docker build --memory, a number of
+// bytes with an optional b, k, m or g suffix, i.e. 512m or 2g
+var buildMemoryFormat = regexp.MustCompile(`^[0-9]+[bkmgBKMG]?$`)
+
+// cpuPeriod is the CFS scheduler period in microseconds, the same default that
+// docker run uses to convert --cpus into --cpu-period and --cpu-quota
+const cpuPeriod = 100000
+
+// ValidateBuildResources returns an error when memory is not a valid --memory
+// value or cpus is not a positive number of CPUs
+func ValidateBuildResources(memory, cpus string) error {
+	if len(memory) > 0 && !buildMemoryFormat.MatchString(memory) {
+		return fmt.Errorf("invalid memory limit: %q, use a number with an optional b, k, m or g suffix, i.e. 512m or 2g", memory)
+	}
+
+	if len(cpus) > 0 {
+		if _, err := parseBuildCPUs(cpus); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseBuildCPUs returns the --cpu-quota for cpus over a cpuPeriod, "docker build"
+// does not accept --cpus, i.e. 1.5 gives a quota of 150000
+func parseBuildCPUs(cpus string) (int64, error) {
+	value, err := strconv.ParseFloat(cpus, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid cpus: %q, use a positive number of CPUs, i.e. 0.5 or 2", cpus)
+	}
+
+	quota := int64(value * cpuPeriod)
+	if quota < 1000 {
+		return 0, fmt.Errorf("invalid cpus: %q, the minimum is 0.01", cpus)
+	}
+
+	return quota, nil
+}
+
+// ulimitNames are the resources accepted by docker build --ulimit
+var ulimitNames = []string{"core", "cpu", "data", "fsize", "locks", "memlock", "msgqueue", "nice",
+	"nofile", "nproc", "rss", "rtprio", "rttime", "sigpending", "stack"}
+
+// ValidateUlimits returns an error for any entry which is not in the form
+// name=soft:hard, or name=limit for the same soft and hard limit, where the
+// limits are numbers and the soft limit does not exceed the hard limit
+func ValidateUlimits(ulimits []string) error {
+	for _, entry := range ulimits {
+		i := strings.Index(entry, "=")
+		if i < 1 {
+			return fmt.Errorf("invalid ulimit: %q, must take the form name=soft:hard, i.e. nofile=65536:65536", entry)
+		}
+
+		name, limits := entry[:i], strings.SplitN(entry[i+1:], ":", 2)
+		if !isUlimitName(name) {
+			return fmt.Errorf("invalid ulimit: %q, unknown name: %q, use one of: %s", entry, name, strings.Join(ulimitNames, ", "))
+		}
+
+		values := []int64{}
+		for _, limit := range limits {
+			value, err := strconv.ParseInt(limit, 10, 64)
+			if err != nil || value < -1 {
+				return fmt.Errorf("invalid ulimit: %q, invalid limit: %q, use a number or -1 for unlimited", entry, limit)
+			}
+			values = append(values, value)
+		}
+
+		if len(values) == 2 && values[1] != -1 && (values[0] == -1 || values[0] > values[1]) {
+			return fmt.Errorf("invalid ulimit: %q, the soft limit cannot exceed the hard limit", entry)
+		}
+	}
+
+	return nil
+}
+
+// isUlimitName returns true when name is one of the ulimitNames
+func isUlimitName(name string) bool {
+	for _, ulimitName := range ulimitNames {
+		if name == ulimitName {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBuildResources returns an error when resource limits are requested for a
+// build that uses buildx, which only the classic builder supports
+func checkBuildResources(config BuildImageConfig) error {
+	if len(config.BuildMemory) == 0 && len(config.BuildCPUs) == 0 && len(config.Ulimits) == 0 {
+		return nil
+	}
+
+	if flag := buildxFlag(config); len(flag) > 0 {
+		if len(config.Ulimits) > 0 {
+			// buildx sets ulimits on its builder rather than on each build
+			return fmt.Errorf("--ulimit is only supported by the classic builder, and cannot be used with %s", flag)
+		}
+		return fmt.Errorf("--memory and --cpus are only supported by the classic builder, and cannot be used with %s", flag)
+	}
+
+	if err := ValidateBuildResources(config.BuildMemory, config.BuildCPUs); err != nil {
+		return err
+	}
+
+	return ValidateUlimits(config.Ulimits)
+}
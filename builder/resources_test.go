@@ -0,0 +1,152 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_ValidateBuildResources(t *testing.T) {
+	cases := []struct {
+		name    string
+		memory  string
+		cpus    string
+		wantErr string
+	}{
+		{name: "no limits"},
+		{name: "megabytes", memory: "512m"},
+		{name: "gigabytes", memory: "2G"},
+		{name: "bytes", memory: "1073741824"},
+		{name: "fractional cpus", cpus: "1.5"},
+		{name: "unknown suffix", memory: "2gb", wantErr: `invalid memory limit: "2gb"`},
+		{name: "fractional memory", memory: "1.5g", wantErr: `invalid memory limit: "1.5g"`},
+		{name: "negative cpus", cpus: "-1", wantErr: `invalid cpus: "-1"`},
+		{name: "non-numeric cpus", cpus: "two", wantErr: `invalid cpus: "two"`},
+		{name: "too few cpus", cpus: "0.001", wantErr: `invalid cpus: "0.001", the minimum is 0.01`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateBuildResources(tc.memory, tc.cpus)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				t.Errorf("want error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_getDockerBuildCommand_WithResources(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "imagename:latest",
+		BuildArgMap:      make(map[string]string),
+		BuildOptPackages: []string{},
+		Memory:           "512m",
+		CPUs:             "1.5",
+	}
+
+	want := "build --memory 512m --cpu-period 100000 --cpu-quota 150000 --tag imagename:latest ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	if joined := strings.Join(args, " "); joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_checkBuildResources_Buildx(t *testing.T) {
+	err := checkBuildResources(BuildImageConfig{BuildMemory: "512m", Output: "type=oci,dest=fn.tar"})
+	if err == nil {
+		t.Fatalf("want error for resource limits with buildx")
+	}
+
+	want := "--memory and --cpus are only supported by the classic builder, and cannot be used with --output"
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+
+	if err := checkBuildResources(BuildImageConfig{Output: "type=oci,dest=fn.tar"}); err != nil {
+		t.Errorf("unexpected error without limits: %s", err)
+	}
+}
+
+func Test_ValidateUlimits(t *testing.T) {
+	cases := []struct {
+		name    string
+		ulimits []string
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "soft and hard", ulimits: []string{"nofile=65536:65536", "nproc=1024:2048"}},
+		{name: "single limit", ulimits: []string{"nofile=65536"}},
+		{name: "unlimited hard limit", ulimits: []string{"memlock=1024:-1"}},
+		{name: "no name", ulimits: []string{"=1024:1024"}, wantErr: `invalid ulimit: "=1024:1024", must take the form name=soft:hard`},
+		{name: "no limit", ulimits: []string{"nofile"}, wantErr: `invalid ulimit: "nofile", must take the form name=soft:hard`},
+		{name: "unknown name", ulimits: []string{"files=1024:1024"}, wantErr: `invalid ulimit: "files=1024:1024", unknown name: "files"`},
+		{name: "non-numeric limit", ulimits: []string{"nofile=lots:1024"}, wantErr: `invalid ulimit: "nofile=lots:1024", invalid limit: "lots"`},
+		{name: "too many limits", ulimits: []string{"nofile=1:2:3"}, wantErr: `invalid ulimit: "nofile=1:2:3", invalid limit: "2:3"`},
+		{name: "empty hard limit", ulimits: []string{"nofile=1024:"}, wantErr: `invalid ulimit: "nofile=1024:", invalid limit: ""`},
+		{name: "soft over hard", ulimits: []string{"nofile=2048:1024"}, wantErr: `invalid ulimit: "nofile=2048:1024", the soft limit cannot exceed the hard limit`},
+		{name: "second entry", ulimits: []string{"nofile=1024", "nproc=-2"}, wantErr: `invalid ulimit: "nproc=-2", invalid limit: "-2"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateUlimits(tc.ulimits)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+				t.Errorf("want error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_getDockerBuildCommand_WithUlimits(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "imagename:latest",
+		BuildArgMap:      make(map[string]string),
+		BuildOptPackages: []string{},
+		Ulimits:          []string{"nofile=65536:65536", "nproc=4096"},
+	}
+
+	want := "build --ulimit nofile=65536:65536 --ulimit nproc=4096 --tag imagename:latest ."
+
+	_, args := getDockerBuildCommand(dockerBuildVal)
+
+	if joined := strings.Join(args, " "); joined != want {
+		t.Errorf("getDockerBuildCommand want: \"%s\", got: \"%s\"", want, joined)
+	}
+}
+
+func Test_checkBuildResources_CacheDir(t *testing.T) {
+	err := checkBuildResources(BuildImageConfig{BuildCPUs: "2", CacheDir: ".cache"})
+
+	want := "--memory and --cpus are only supported by the classic builder, and cannot be used with --cache-dir"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
+
+func Test_checkBuildResources_UlimitsWithBuildx(t *testing.T) {
+	err := checkBuildResources(BuildImageConfig{Ulimits: []string{"nofile=65536:65536"}, Output: "type=oci,dest=fn.tar"})
+
+	want := "--ulimit is only supported by the classic builder, and cannot be used with --output"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+
+	if err := checkBuildResources(BuildImageConfig{Ulimits: []string{"nofile=65536:65536"}}); err != nil {
+		t.Errorf("unexpected error with the classic builder: %s", err)
+	}
+}
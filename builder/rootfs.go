@@ -0,0 +1,83 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rootFSOutput returns the buildx --output which exports the filesystem of the
+// final stage as a tar at dest. The path is made absolute as docker is run from
+// within the build context.
+func rootFSOutput(dest string) (string, error) {
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return "", err
+	}
+
+	if info, err := os.Stat(abs); err == nil && info.IsDir() {
+		return "", fmt.Errorf("--export-rootfs must be the path of a file, but %s is a folder", dest)
+	}
+
+	if info, err := os.Stat(filepath.Dir(abs)); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("--export-rootfs folder does not exist: %s", filepath.Dir(abs))
+	}
+
+	return fmt.Sprintf("type=tar,dest=%s", abs), nil
+}
+
+// checkFinalStageExportable returns an error when the Dockerfile has no final stage,
+// or when the final stage is FROM scratch without any instructions, so that its
+// filesystem would be empty
+func checkFinalStageExportable(dockerfilePath string) error {
+	data, err := ioutil.ReadFile(dockerfilePath)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	empty := false
+	for _, line := range dockerfileInstructions(string(data)) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if strings.EqualFold(fields[0], "FROM") {
+			found = true
+			empty = isScratchStage(fields[1:])
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "COPY", "ADD", "RUN":
+			empty = false
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("unable to export the root filesystem, %s has no FROM instruction", dockerfilePath)
+	}
+
+	if empty {
+		return fmt.Errorf("unable to export the root filesystem, the final stage of %s is FROM scratch and adds no files", dockerfilePath)
+	}
+
+	return nil
+}
+
+// isScratchStage returns true when the arguments of a FROM instruction refer to scratch
+func isScratchStage(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			continue
+		}
+		return strings.EqualFold(arg, "scratch")
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+func Test_rootFSOutput(t *testing.T) {
+	dir := t.TempDir()
+
+	got, err := rootFSOutput(filepath.Join(dir, "rootfs.tar"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := "type=tar,dest=" + filepath.Join(dir, "rootfs.tar")
+	if got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if _, err := rootFSOutput(dir); err == nil || !strings.Contains(err.Error(), "is a folder") {
+		t.Errorf("want error for a folder, got %v", err)
+	}
+
+	if _, err := rootFSOutput(filepath.Join(dir, "missing", "rootfs.tar")); err == nil || !strings.Contains(err.Error(), "folder does not exist") {
+		t.Errorf("want error for a missing folder, got %v", err)
+	}
+}
+
+func Test_checkFinalStageExportable(t *testing.T) {
+	cases := []struct {
+		name       string
+		dockerfile string
+		wantErr    string
+	}{
+		{
+			name:       "base image",
+			dockerfile: "FROM alpine:3.16\nCMD [\"sh\"]\n",
+		},
+		{
+			name:       "scratch with files",
+			dockerfile: "FROM golang:1.18 AS build\nRUN go build -o /fn\nFROM scratch\nCOPY --from=build /fn /fn\n",
+		},
+		{
+			name:       "empty scratch stage",
+			dockerfile: "FROM alpine:3.16 AS build\nRUN touch /fn\nFROM --platform=$TARGETPLATFORM scratch\nENV fprocess=/fn\n",
+			wantErr:    "is FROM scratch and adds no files",
+		},
+		{
+			name:       "no FROM",
+			dockerfile: "# syntax=docker/dockerfile:1\n",
+			wantErr:    "has no FROM instruction",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Dockerfile")
+			if err := ioutil.WriteFile(path, []byte(tc.dockerfile), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := checkFinalStageExportable(path)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("want error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// stubBuildxBuild replaces execTask with docker and buildx versions that support
+// --output, and records each build
+func stubBuildxBuild(t *testing.T) *[]v1execute.ExecTask {
+	var builds []v1execute.ExecTask
+
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		switch task.Args[0] {
+		case "version":
+			return v1execute.ExecResult{Stdout: "20.10.17 20.10.17\n"}, nil
+		case "buildx":
+			if task.Args[1] == "version" {
+				return v1execute.ExecResult{Stdout: "github.com/docker/buildx v0.8.2 6224def\n"}, nil
+			}
+			if task.Args[1] == "inspect" {
+				return v1execute.ExecResult{Stdout: "Name: builder\nDriver: docker-container\n"}, nil
+			}
+		}
+
+		builds = append(builds, task)
+		return v1execute.ExecResult{}, nil
+	})
+
+	return &builds
+}
+
+func Test_BuildImage_ExportRootFS(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	if err := ioutil.WriteFile(filepath.Join("template", "go", "Dockerfile"), []byte("FROM alpine:3.16\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	builds := stubBuildxBuild(t)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		ExportRootFS: "rootfs.tar",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(*builds) != 1 {
+		t.Fatalf("want 1 build, got %d", len(*builds))
+	}
+
+	wd, _ := os.Getwd()
+	want := "buildx build --output type=tar,dest=" + filepath.Join(wd, "rootfs.tar") + " --tag fn:latest ."
+	if got := strings.Join((*builds)[0].Args, " "); got != want {
+		t.Errorf("want args %q, got %q", want, got)
+	}
+}
+
+func Test_BuildImage_ExportRootFS_EmptyFinalStage(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubBuildxBuild(t)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		ExportRootFS: "rootfs.tar",
+	})
+	if err == nil || !strings.Contains(err.Error(), "is FROM scratch and adds no files") {
+		t.Fatalf("want error for an empty final stage, got %v", err)
+	}
+
+	if len(*builds) != 0 {
+		t.Errorf("want no build, got %d", len(*builds))
+	}
+}
+
+func Test_BuildImage_ExportRootFSWithOutput(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubBuildxBuild(t)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		ExportRootFS: "rootfs.tar",
+		Output:       "type=oci,dest=fn.tar",
+	})
+	if err == nil || err.Error() != "--export-rootfs cannot be used with --output" {
+		t.Errorf("want error for --export-rootfs with --output, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// scanner is the vulnerability scanner run against built images
+const scanner = "grype"
+
+// Severities are the vulnerability severities accepted by ScanFailOn, from lowest
+// to highest
+var Severities = []string{"negligible", "low", "medium", "high", "critical"}
+
+// maxScanFindings is the number of vulnerabilities listed in a failed scan
+const maxScanFindings = 10
+
+// lookPath finds the scanner or docker binary on the PATH, it can be replaced in tests
+var lookPath = exec.LookPath
+
+// runScanner returns the JSON report of the scanner for image, which is killed
+// when ctx is cancelled, it can be replaced in tests
+var runScanner = func(ctx context.Context, image string) ([]byte, error) {
+	task := v1execute.ExecTask{
+		Command:     scanner,
+		Args:        []string{image, "--output", "json", "--quiet"},
+		StreamStdio: false,
+	}
+
+	res, err := execTaskContext(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("%s %s failed: %s", scanner, image, strings.TrimSpace(res.Stderr))
+	}
+
+	return []byte(res.Stdout), nil
+}
+
+// vulnerability is a single finding of a scan
+type vulnerability struct {
+	ID       string
+	Severity string
+	Package  string
+	Version  string
+}
+
+// scanReport holds the fields needed from the scanner's JSON output
+type scanReport struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID       string `json:"id"`
+			Severity string `json:"severity"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"artifact"`
+	} `json:"matches"`
+}
+
+// ValidateSeverity returns an error when severity is not one of the Severities
+func ValidateSeverity(severity string) error {
+	if severityRank(severity) < 0 {
+		return fmt.Errorf("unknown severity %q, valid values are: %s", severity, strings.Join(Severities, ", "))
+	}
+	return nil
+}
+
+// severityRank returns the index of severity within Severities, or -1 for an
+// unknown severity such as "Unknown"
+func severityRank(severity string) int {
+	for i, s := range Severities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseScanReport returns the vulnerabilities from the scanner's JSON output
+func parseScanReport(data []byte) ([]vulnerability, error) {
+	var report scanReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("unable to parse the %s report: %s", scanner, err.Error())
+	}
+
+	vulnerabilities := make([]vulnerability, 0, len(report.Matches))
+	for _, match := range report.Matches {
+		vulnerabilities = append(vulnerabilities, vulnerability{
+			ID:       match.Vulnerability.ID,
+			Severity: strings.ToLower(match.Vulnerability.Severity),
+			Package:  match.Artifact.Name,
+			Version:  match.Artifact.Version,
+		})
+	}
+
+	return vulnerabilities, nil
+}
+
+// vulnerabilitiesAtOrAbove returns the vulnerabilities with a severity of at least
+// threshold, the most severe first
+func vulnerabilitiesAtOrAbove(vulnerabilities []vulnerability, threshold string) []vulnerability {
+	minRank := severityRank(threshold)
+
+	found := []vulnerability{}
+	for _, v := range vulnerabilities {
+		if rank := severityRank(v.Severity); rank >= 0 && rank >= minRank {
+			found = append(found, v)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return severityRank(found[i].Severity) > severityRank(found[j].Severity)
+	})
+
+	return found
+}
+
+// scanSummary counts the vulnerabilities by severity, i.e. "1 critical, 3 high"
+func scanSummary(vulnerabilities []vulnerability) string {
+	counts := map[string]int{}
+	for _, v := range vulnerabilities {
+		counts[v.Severity]++
+	}
+
+	parts := []string{}
+	for i := len(Severities) - 1; i >= 0; i-- {
+		if n := counts[Severities[i]]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, Severities[i]))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "no vulnerabilities found"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// scanImage scans image for vulnerabilities when config.Scan is set, and returns an
+// ErrVulnerabilitiesFound error when any are at or above config.ScanFailOn. When the
+// scanner is not installed, a warning is printed, unless config.ScanRequired is set.
+func scanImage(config BuildImageConfig, image string, warnings *[]Warning) error {
+	if !config.Scan {
+		return nil
+	}
+
+	if _, err := lookPath(scanner); err != nil {
+		if config.ScanRequired {
+			return fmt.Errorf("--scan requires %s to be installed: %s", scanner, err.Error())
+		}
+		warn(warnings, WarnScanSkipped, "unable to scan %s, %s is not installed", image, scanner)
+		return nil
+	}
+
+	fmt.Printf("Scanning: %s with %s\n", image, scanner)
+
+	data, err := runScanner(config.Context, image)
+	if err != nil {
+		return err
+	}
+
+	vulnerabilities, err := parseScanReport(data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Scan of %s: %s\n", image, scanSummary(vulnerabilities))
+
+	if len(config.ScanFailOn) == 0 {
+		return nil
+	}
+
+	found := vulnerabilitiesAtOrAbove(vulnerabilities, config.ScanFailOn)
+	if len(found) == 0 {
+		return nil
+	}
+
+	lines := []string{}
+	for i, v := range found {
+		if i == maxScanFindings {
+			lines = append(lines, fmt.Sprintf("- and %d more", len(found)-maxScanFindings))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("- %s (%s) in %s %s", v.ID, v.Severity, v.Package, v.Version))
+	}
+
+	return newBuildError(ErrVulnerabilitiesFound, "%s has %d vulnerabilities of %s severity or above:\n%s",
+		image, len(found), strings.ToLower(config.ScanFailOn), strings.Join(lines, "\n"))
+}
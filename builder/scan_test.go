@@ -0,0 +1,192 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+// testScanReport has one vulnerability of each severity, and one of unknown severity
+const testScanReport = `{"matches": [
+	{"vulnerability": {"id": "CVE-2022-0001", "severity": "Low"}, "artifact": {"name": "zlib", "version": "1.2.11"}},
+	{"vulnerability": {"id": "CVE-2022-0002", "severity": "Critical"}, "artifact": {"name": "openssl", "version": "1.1.1n"}},
+	{"vulnerability": {"id": "CVE-2022-0003", "severity": "Medium"}, "artifact": {"name": "curl", "version": "7.79.1"}},
+	{"vulnerability": {"id": "CVE-2022-0004", "severity": "High"}, "artifact": {"name": "busybox", "version": "1.34.1"}},
+	{"vulnerability": {"id": "CVE-2022-0005", "severity": "Unknown"}, "artifact": {"name": "musl", "version": "1.2.2"}},
+	{"vulnerability": {"id": "CVE-2022-0006", "severity": "Negligible"}, "artifact": {"name": "tzdata", "version": "2022a"}}
+]}`
+
+// stubScanner stubs the scanner to be installed, or not, and return report
+func stubScanner(t *testing.T, installed bool, report string) *[]string {
+	var scanned []string
+
+	origLookPath, origRunScanner := lookPath, runScanner
+	lookPath = func(file string) (string, error) {
+		if !installed {
+			return "", exec.ErrNotFound
+		}
+		return "/usr/local/bin/" + file, nil
+	}
+	runScanner = func(ctx context.Context, image string) ([]byte, error) {
+		scanned = append(scanned, image)
+		return []byte(report), nil
+	}
+
+	t.Cleanup(func() { lookPath, runScanner = origLookPath, origRunScanner })
+
+	return &scanned
+}
+
+func Test_vulnerabilitiesAtOrAbove(t *testing.T) {
+	vulnerabilities, err := parseScanReport([]byte(testScanReport))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		threshold string
+		want      []string
+	}{
+		{threshold: "critical", want: []string{"CVE-2022-0002"}},
+		{threshold: "HIGH", want: []string{"CVE-2022-0002", "CVE-2022-0004"}},
+		{threshold: "medium", want: []string{"CVE-2022-0002", "CVE-2022-0004", "CVE-2022-0003"}},
+		{threshold: "negligible", want: []string{"CVE-2022-0002", "CVE-2022-0004", "CVE-2022-0003", "CVE-2022-0001", "CVE-2022-0006"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.threshold, func(t *testing.T) {
+			got := []string{}
+			for _, v := range vulnerabilitiesAtOrAbove(vulnerabilities, tc.threshold) {
+				got = append(got, v.ID)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_scanSummary(t *testing.T) {
+	vulnerabilities, err := parseScanReport([]byte(testScanReport))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := "1 critical, 1 high, 1 medium, 1 low, 1 negligible"
+	if got := scanSummary(vulnerabilities); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	if got := scanSummary(nil); got != "no vulnerabilities found" {
+		t.Errorf("want no vulnerabilities found, got %q", got)
+	}
+}
+
+func Test_ValidateSeverity(t *testing.T) {
+	if err := ValidateSeverity("High"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	err := ValidateSeverity("severe")
+	want := `unknown severity "severe", valid values are: negligible, low, medium, high, critical`
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
+
+func Test_scanImage_FailsAboveThreshold(t *testing.T) {
+	stubScanner(t, true, testScanReport)
+
+	var err error
+	test.CaptureStdout(func() {
+		err = scanImage(BuildImageConfig{Scan: true, ScanFailOn: "high"}, "alexellis/fn:0.1", nil)
+	})
+
+	if !errors.Is(err, ErrVulnerabilitiesFound) {
+		t.Fatalf("want ErrVulnerabilitiesFound, got %v", err)
+	}
+
+	want := `alexellis/fn:0.1 has 2 vulnerabilities of high severity or above:
+- CVE-2022-0002 (critical) in openssl 1.1.1n
+- CVE-2022-0004 (high) in busybox 1.34.1`
+	if err.Error() != want {
+		t.Errorf("want error:\n%s\ngot:\n%s", want, err.Error())
+	}
+}
+
+func Test_scanImage_BelowThreshold(t *testing.T) {
+	stubScanner(t, true, `{"matches": [{"vulnerability": {"id": "CVE-2022-0001", "severity": "Low"}}]}`)
+
+	var err error
+	out := test.CaptureStdout(func() {
+		err = scanImage(BuildImageConfig{Scan: true, ScanFailOn: "critical"}, "alexellis/fn:0.1", nil)
+	})
+
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if !strings.Contains(out, "Scan of alexellis/fn:0.1: 1 low") {
+		t.Errorf("want a scan summary, got: %s", out)
+	}
+}
+
+func Test_scanImage_NotInstalled(t *testing.T) {
+	scanned := stubScanner(t, false, "")
+
+	var err error
+	out := test.CaptureStderr(func() {
+		err = scanImage(BuildImageConfig{Scan: true, ScanFailOn: "high"}, "alexellis/fn:0.1", nil)
+	})
+	if err != nil {
+		t.Errorf("want a warning when grype is not installed, got: %s", err)
+	}
+	if !strings.Contains(out, "Warning: unable to scan alexellis/fn:0.1, grype is not installed") {
+		t.Errorf("want a warning, got: %s", out)
+	}
+
+	err = scanImage(BuildImageConfig{Scan: true, ScanRequired: true}, "alexellis/fn:0.1", nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "--scan requires grype to be installed") {
+		t.Errorf("want an error with ScanRequired, got: %v", err)
+	}
+
+	if len(*scanned) != 0 {
+		t.Errorf("want no scan, got %v", *scanned)
+	}
+}
+
+func Test_BuildImage_ScanFailureFailsBuild(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+	scanned := stubScanner(t, true, testScanReport)
+
+	called := false
+	err := BuildImage(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		Scan:         true,
+		ScanFailOn:   "critical",
+		OnSuccess: func(ctx context.Context, result BuildResult) error {
+			called = true
+			return nil
+		},
+	})
+
+	if !errors.Is(err, ErrVulnerabilitiesFound) {
+		t.Fatalf("want ErrVulnerabilitiesFound, got %v", err)
+	}
+	if fmt.Sprint(*scanned) != "[alexellis/fn:0.1]" {
+		t.Errorf("want the built image scanned, got %v", *scanned)
+	}
+	if called {
+		t.Errorf("want the success handler skipped when the scan fails")
+	}
+}
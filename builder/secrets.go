@@ -0,0 +1,79 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// redactedValue replaces the value of a build-arg secret in any output
+const redactedValue = "<redacted>"
+
+// readBuildArgSecrets reads the file for each build-arg secret, given as a map of
+// build-arg name to file path, and returns a map of build-arg name to its value
+func readBuildArgSecrets(secretFiles map[string]string, buildArgMap map[string]string, verbose bool) (map[string]string, error) {
+	secrets := make(map[string]string, len(secretFiles))
+
+	for _, key := range sortedKeys(secretFiles) {
+		if _, ok := buildArgMap[key]; ok {
+			return nil, fmt.Errorf("build-arg %s cannot be set by both --build-arg and --build-arg-secret", key)
+		}
+
+		file := secretFiles[key]
+		verbosePrintf(verbose, "Reading build-arg secret: %s from %s\n", key, file)
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read build-arg secret %s: %s", key, err.Error())
+		}
+
+		secrets[key] = strings.TrimRight(string(data), "\r\n")
+	}
+
+	return secrets, nil
+}
+
+// buildArgSecretEnv returns the build-arg secrets as environment variables for
+// docker, which reads the value of "--build-arg KEY" from its environment so
+// that the secret is not given on the command line
+func buildArgSecretEnv(secrets map[string]string) []string {
+	env := []string{}
+	for _, key := range sortedKeys(secrets) {
+		env = append(env, fmt.Sprintf("%s=%s", key, secrets[key]))
+	}
+	return env
+}
+
+// redactBuildArgs returns a copy of args with the value of any build-arg secret
+// replaced, for use in logs
+func redactBuildArgs(args []string, secrets map[string]string) []string {
+	redacted := make([]string, len(args))
+
+	for i, arg := range args {
+		redacted[i] = arg
+
+		for key, value := range secrets {
+			if strings.HasPrefix(arg, key+"=") {
+				redacted[i] = key + "=" + redactedValue
+			} else if len(value) > 0 && strings.Contains(redacted[i], value) {
+				redacted[i] = strings.ReplaceAll(redacted[i], value, redactedValue)
+			}
+		}
+	}
+
+	return redacted
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
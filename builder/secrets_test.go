@@ -0,0 +1,102 @@
+package builder
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+const secretValue = "s3cr3t-t0k3n"
+
+func writeSecret(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(file, []byte(secretValue+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func Test_readBuildArgSecrets(t *testing.T) {
+	file := writeSecret(t)
+
+	got, err := readBuildArgSecrets(map[string]string{"NPM_TOKEN": file}, nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]string{"NPM_TOKEN": secretValue}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if _, err := readBuildArgSecrets(map[string]string{"NPM_TOKEN": file}, map[string]string{"NPM_TOKEN": "plain"}, false); err == nil {
+		t.Errorf("want error when a build-arg is also given as a secret")
+	}
+
+	if _, err := readBuildArgSecrets(map[string]string{"NPM_TOKEN": filepath.Join(t.TempDir(), "missing")}, nil, false); err == nil {
+		t.Errorf("want error for a missing secret file")
+	}
+}
+
+func Test_redactBuildArgs(t *testing.T) {
+	secrets := map[string]string{"NPM_TOKEN": secretValue}
+	args := []string{"build", "--build-arg", "NPM_TOKEN=" + secretValue, "--label", "note=" + secretValue, "--build-arg", "NPM_TOKEN", "."}
+
+	got := redactBuildArgs(args, secrets)
+	want := []string{"build", "--build-arg", "NPM_TOKEN=<redacted>", "--label", "note=<redacted>", "--build-arg", "NPM_TOKEN", "."}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func Test_BuildImage_BuildArgSecret(t *testing.T) {
+	secretFile := writeSecret(t)
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	out := test.CaptureStdout(func() {
+		err := BuildImage(BuildImageConfig{
+			Image:           "fn",
+			Handler:         "handler",
+			FunctionName:    "fn",
+			Language:        "go",
+			QuiteBuild:      true,
+			Verbose:         true,
+			BuildArgSecrets: map[string]string{"NPM_TOKEN": secretFile},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	// Verbose output also runs "docker version"
+	if len(*builds) != 2 {
+		t.Fatalf("want docker version and docker build to run, got %d", len(*builds))
+	}
+	task := (*builds)[1]
+
+	args := strings.Join(task.Args, " ")
+	if !strings.Contains(args, "--build-arg NPM_TOKEN ") {
+		t.Errorf("want --build-arg NPM_TOKEN without a value, got: %s", args)
+	}
+	if strings.Contains(args, secretValue) {
+		t.Errorf("want the secret to be absent from the command line, got: %s", args)
+	}
+
+	wantEnv := []string{"NPM_TOKEN=" + secretValue}
+	if !reflect.DeepEqual(wantEnv, task.Env) {
+		t.Errorf("want env %v, got %v", wantEnv, task.Env)
+	}
+
+	if strings.Contains(out, secretValue) {
+		t.Errorf("want the secret to be absent from verbose output, got: %s", out)
+	}
+	if !strings.Contains(out, "Build command: docker build") {
+		t.Errorf("want the build command in verbose output, got: %s", out)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// splitShellWords splits s into words in the same way as a POSIX shell, without
+// any expansion. Single quotes preserve their contents, double quotes allow
+// \" and \\ to be escaped and a backslash outside of quotes escapes the next
+// character, i.e. --label description="my service" gives two words.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+
+	inWord := false
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+
+		case r == '\\':
+			inWord = true
+			if i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			}
+
+		case r == '\'':
+			inWord = true
+			end := indexRune(runes, i+1, '\'')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated single quote in: %s", s)
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			i = end
+
+		case r == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '"' {
+					closed = true
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\\\"$`", runes[i+1]) {
+					i++
+				}
+				word.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated double quote in: %s", s)
+			}
+
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// indexRune returns the index of the first r in runes at or after start, or -1
+func indexRune(runes []rune, start int, r rune) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,46 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_splitShellWords(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", input: "", want: nil},
+		{name: "single flag", input: "--disable-content-trust", want: []string{"--disable-content-trust"}},
+		{name: "flag and value", input: "--progress plain", want: []string{"--progress", "plain"}},
+		{name: "repeated spaces", input: "  --progress   plain ", want: []string{"--progress", "plain"}},
+		{name: "double quoted value", input: `--label description="my service"`, want: []string{"--label", "description=my service"}},
+		{name: "single quoted value", input: `--label 'description=my "quoted" service'`, want: []string{"--label", `description=my "quoted" service`}},
+		{name: "escaped space", input: `--label description=my\ service`, want: []string{"--label", "description=my service"}},
+		{name: "escaped quote in double quotes", input: `--label "msg=say \"hi\""`, want: []string{"--label", `msg=say "hi"`}},
+		{name: "backslash kept in double quotes", input: `"C:\path"`, want: []string{`C:\path`}},
+		{name: "empty quotes", input: `--build-arg ''`, want: []string{"--build-arg", ""}},
+		{name: "unterminated double quote", input: `--label "description=my service`, wantErr: true},
+		{name: "unterminated single quote", input: `--label 'description`, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := splitShellWords(tc.input)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+const (
+	// DefaultSmokeTestPort is the port of the of-watchdog
+	DefaultSmokeTestPort = 8080
+
+	// DefaultSmokeTestPath is the health endpoint of the of-watchdog
+	DefaultSmokeTestPath = "/_/health"
+
+	// DefaultSmokeTestTimeout is the time the health endpoint has to return 200 OK
+	DefaultSmokeTestTimeout = 10 * time.Second
+)
+
+// smokeTestInterval is the time between each check of the container
+var smokeTestInterval = 250 * time.Millisecond
+
+// smokeTestGet returns the status code of a GET request to url, it can be
+// replaced in tests
+var smokeTestGet = func(url string) (int, error) {
+	client := http.Client{Timeout: time.Second}
+
+	res, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	return res.StatusCode, nil
+}
+
+// smokeTestRunArgs returns the arguments to docker to start image in the
+// background, with port published on a random port of the loopback interface
+func smokeTestRunArgs(image string, port int) []string {
+	return []string{"run", "--detach", "--publish", fmt.Sprintf("127.0.0.1::%d", port), image}
+}
+
+// dockerCommand returns the DockerBinary of config, or docker, with args, after
+// the --context of config when it is set
+func dockerCommand(config BuildImageConfig, args ...string) (string, []string) {
+	command := "docker"
+	if len(config.DockerBinary) > 0 {
+		command = config.DockerBinary
+	}
+
+	if len(config.DockerContext) > 0 {
+		args = append([]string{"--context", config.DockerContext}, args...)
+	}
+
+	return command, args
+}
+
+// runDocker runs docker with args for config and returns its output
+func runDocker(config BuildImageConfig, args ...string) (v1execute.ExecResult, error) {
+	subcommand := args[0]
+	command, args := dockerCommand(config, args...)
+
+	res, err := execTaskContext(config.Context, v1execute.ExecTask{
+		Command:     command,
+		Args:        args,
+		StreamStdio: false,
+	})
+	if err != nil {
+		return res, err
+	}
+
+	if res.ExitCode != 0 {
+		return res, fmt.Errorf("%s %s failed: %s", command, subcommand, strings.TrimSpace(res.Stderr))
+	}
+
+	return res, nil
+}
+
+// isLocalDaemon returns true when the docker host is on this machine, i.e. a
+// unix socket, a named pipe or a loopback address, or when host is empty
+func isLocalDaemon(host string) bool {
+	for _, prefix := range []string{"unix://", "npipe://", "tcp://127.0.0.1:", "tcp://localhost:", "tcp://[::1]:"} {
+		if strings.HasPrefix(host, prefix) {
+			return true
+		}
+	}
+	return len(host) == 0
+}
+
+// checkSmokeTestDaemon returns an error when the daemon for config is on another
+// host, as the smoke test publishes the container's port on the loopback interface
+// of the daemon's host and checks it from this one. The host is read from the
+// DockerContext of config, or DOCKER_HOST without one.
+func checkSmokeTestDaemon(config BuildImageConfig) error {
+	host := os.Getenv("DOCKER_HOST")
+
+	if len(config.DockerContext) > 0 {
+		command, args := dockerCommand(BuildImageConfig{DockerBinary: config.DockerBinary},
+			"context", "inspect", "--format", "{{.Endpoints.docker.Host}}", config.DockerContext)
+
+		res, err := execTask(v1execute.ExecTask{
+			Command:     command,
+			Args:        args,
+			StreamStdio: false,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to inspect the docker context %s: %s", config.DockerContext, err.Error())
+		}
+		if res.ExitCode != 0 {
+			return fmt.Errorf("unable to inspect the docker context %s: %s", config.DockerContext, strings.TrimSpace(res.Stderr))
+		}
+		host = strings.TrimSpace(res.Stdout)
+	}
+
+	if !isLocalDaemon(host) {
+		return fmt.Errorf("--smoke-test needs a local docker daemon, %s is on another host", host)
+	}
+	return nil
+}
+
+// smokeTest starts the image built for config when SmokeTest is set, and returns
+// an ErrSmokeTestFailed error when the container exits, or its health endpoint does
+// not return 200 OK within the timeout. The container is removed afterwards.
+func smokeTest(config BuildImageConfig, image string) error {
+	if !config.SmokeTest {
+		return nil
+	}
+
+	port, path, timeout := config.SmokeTestPort, config.SmokeTestPath, config.SmokeTestTimeout
+	if port == 0 {
+		port = DefaultSmokeTestPort
+	}
+	if timeout == 0 {
+		timeout = DefaultSmokeTestTimeout
+	}
+
+	fmt.Printf("Smoke testing: %s\n", image)
+
+	res, err := runDocker(config, smokeTestRunArgs(image, port)...)
+	if err != nil {
+		return newBuildError(ErrSmokeTestFailed, "unable to start %s for a smoke test: %s", image, err.Error())
+	}
+	id := strings.TrimSpace(res.Stdout)
+
+	// The container is removed even when the build has been interrupted
+	cleanup := config
+	cleanup.Context = nil
+	defer runDocker(cleanup, "rm", "--force", id)
+
+	running := func() (bool, error) {
+		res, err := runDocker(config, "inspect", "--format", "{{.State.Running}}", id)
+		return strings.TrimSpace(res.Stdout) == "true", err
+	}
+
+	url := ""
+	if len(path) > 0 {
+		res, err := runDocker(config, "port", id, fmt.Sprintf("%d/tcp", port))
+		if err != nil {
+			return smokeTestFailure(config, image, id, err)
+		}
+
+		address := strings.TrimSpace(strings.Split(res.Stdout, "\n")[0])
+		url = "http://" + address + "/" + strings.TrimPrefix(path, "/")
+	}
+
+	if err := waitForHealthy(config.Context, url, timeout, running); err != nil {
+		if interruptErr := checkInterrupted(config); interruptErr != nil {
+			return interruptErr
+		}
+		return smokeTestFailure(config, image, id, err)
+	}
+
+	fmt.Printf("Smoke test passed: %s\n", image)
+	return nil
+}
+
+// smokeTestFailure returns an ErrSmokeTestFailed error for image with err and the
+// end of the logs of the container id
+func smokeTestFailure(config BuildImageConfig, image, id string, err error) error {
+	message := fmt.Sprintf("smoke test of %s failed: %s", image, err.Error())
+
+	if res, logsErr := runDocker(config, "logs", id); logsErr == nil {
+		if logs := tailLines(strings.TrimSpace(res.Stdout+"\n"+res.Stderr), buildFailureLines); len(logs) > 0 {
+			message += "\n" + logs
+		}
+	}
+
+	return newBuildError(ErrSmokeTestFailed, "%s", message)
+}
+
+// waitForHealthy checks the container until url returns 200 OK, or until timeout
+// when there is no url. An error is returned when the container stops running, or
+// url has not returned 200 OK within timeout, or ctx is cancelled.
+func waitForHealthy(ctx context.Context, url string, timeout time.Duration, running func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if ctx != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		ok, err := running()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("the container exited")
+		}
+
+		if len(url) > 0 {
+			if status, err := smokeTestGet(url); err == nil && status == http.StatusOK {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if len(url) == 0 {
+				return nil
+			}
+			return fmt.Errorf("%s did not return 200 OK within %s", url, timeout)
+		}
+
+		time.Sleep(smokeTestInterval)
+	}
+}
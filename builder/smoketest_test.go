@@ -0,0 +1,313 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+func Test_smokeTestRunArgs(t *testing.T) {
+	got := smokeTestRunArgs("alexellis/fn:0.1", 8080)
+	want := []string{"run", "--detach", "--publish", "127.0.0.1::8080", "alexellis/fn:0.1"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func Test_dockerCommand(t *testing.T) {
+	command, args := dockerCommand(BuildImageConfig{}, "ps")
+	if command != "docker" || !reflect.DeepEqual(args, []string{"ps"}) {
+		t.Errorf("want docker ps, got %s %v", command, args)
+	}
+
+	command, args = dockerCommand(BuildImageConfig{DockerBinary: "/usr/local/bin/podman", DockerContext: "remote"}, "ps")
+	if command != "/usr/local/bin/podman" || !reflect.DeepEqual(args, []string{"--context", "remote", "ps"}) {
+		t.Errorf("want the docker binary and context, got %s %v", command, args)
+	}
+}
+
+func Test_runDocker_FailedSubcommand(t *testing.T) {
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		return v1execute.ExecResult{ExitCode: 1, Stderr: "No such container: c0ffee\n"}, nil
+	})
+
+	_, err := runDocker(BuildImageConfig{DockerBinary: "podman", DockerContext: "remote"}, "logs", "c0ffee")
+
+	want := "podman logs failed: No such container: c0ffee"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
+
+func Test_isLocalDaemon(t *testing.T) {
+	cases := []struct {
+		host string
+		want bool
+	}{
+		{host: "", want: true},
+		{host: "unix:///var/run/docker.sock", want: true},
+		{host: "npipe:////./pipe/docker_engine", want: true},
+		{host: "tcp://127.0.0.1:2375", want: true},
+		{host: "tcp://localhost:2376", want: true},
+		{host: "tcp://192.168.0.10:2376", want: false},
+		{host: "ssh://builder@build-host", want: false},
+	}
+
+	for _, tc := range cases {
+		if got := isLocalDaemon(tc.host); got != tc.want {
+			t.Errorf("%q: want %t, got %t", tc.host, tc.want, got)
+		}
+	}
+}
+
+func Test_checkSmokeTestDaemon(t *testing.T) {
+	t.Run("a remote context is rejected", func(t *testing.T) {
+		var inspected []string
+		stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+			inspected = append([]string{task.Command}, task.Args...)
+			return v1execute.ExecResult{Stdout: "ssh://builder@build-host\n"}, nil
+		})
+
+		err := checkSmokeTestDaemon(BuildImageConfig{DockerBinary: "podman", DockerContext: "remote"})
+
+		want := "--smoke-test needs a local docker daemon, ssh://builder@build-host is on another host"
+		if err == nil || err.Error() != want {
+			t.Errorf("want error %q, got %v", want, err)
+		}
+
+		wantInspect := []string{"podman", "context", "inspect", "--format", "{{.Endpoints.docker.Host}}", "remote"}
+		if !reflect.DeepEqual(inspected, wantInspect) {
+			t.Errorf("want %v, got %v", wantInspect, inspected)
+		}
+	})
+
+	t.Run("a local context is allowed", func(t *testing.T) {
+		stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+			return v1execute.ExecResult{Stdout: "unix:///var/run/docker.sock\n"}, nil
+		})
+
+		if err := checkSmokeTestDaemon(BuildImageConfig{DockerContext: "default"}); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("a remote DOCKER_HOST is rejected", func(t *testing.T) {
+		t.Setenv("DOCKER_HOST", "tcp://192.168.0.10:2376")
+
+		if err := checkSmokeTestDaemon(BuildImageConfig{}); err == nil {
+			t.Errorf("want an error for a remote DOCKER_HOST")
+		}
+	})
+}
+
+func stubSmokeTestGet(t *testing.T, fn func(url string) (int, error)) {
+	origGet, origInterval := smokeTestGet, smokeTestInterval
+	smokeTestGet, smokeTestInterval = fn, time.Millisecond
+	t.Cleanup(func() { smokeTestGet, smokeTestInterval = origGet, origInterval })
+}
+
+func alwaysRunning() (bool, error) {
+	return true, nil
+}
+
+func Test_waitForHealthy(t *testing.T) {
+	t.Run("healthy after a few attempts", func(t *testing.T) {
+		attempts := 0
+		stubSmokeTestGet(t, func(url string) (int, error) {
+			attempts++
+			if attempts < 3 {
+				return 0, fmt.Errorf("connection refused")
+			}
+			return 200, nil
+		})
+
+		if err := waitForHealthy(context.Background(), "http://127.0.0.1:49153/_/health", time.Second, alwaysRunning); err != nil {
+			t.Fatalf("want healthy, got: %s", err)
+		}
+		if attempts != 3 {
+			t.Errorf("want 3 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		stubSmokeTestGet(t, func(url string) (int, error) {
+			return 503, nil
+		})
+
+		started := time.Now()
+		err := waitForHealthy(context.Background(), "http://127.0.0.1:49153/_/health", 20*time.Millisecond, alwaysRunning)
+
+		want := "http://127.0.0.1:49153/_/health did not return 200 OK within 20ms"
+		if err == nil || err.Error() != want {
+			t.Errorf("want error %q, got %v", want, err)
+		}
+		if elapsed := time.Since(started); elapsed < 20*time.Millisecond {
+			t.Errorf("want to wait for the timeout, returned after %s", elapsed)
+		}
+	})
+
+	t.Run("container exited", func(t *testing.T) {
+		stubSmokeTestGet(t, func(url string) (int, error) {
+			t.Fatal("want no health check once the container has exited")
+			return 0, nil
+		})
+
+		err := waitForHealthy(context.Background(), "http://127.0.0.1:49153/_/health", time.Second, func() (bool, error) {
+			return false, nil
+		})
+		if err == nil || err.Error() != "the container exited" {
+			t.Errorf("want the container exited, got %v", err)
+		}
+	})
+
+	t.Run("no health path only checks the container keeps running", func(t *testing.T) {
+		stubSmokeTestGet(t, func(url string) (int, error) {
+			t.Fatal("want no health check without a path")
+			return 0, nil
+		})
+
+		checks := 0
+		err := waitForHealthy(context.Background(), "", 10*time.Millisecond, func() (bool, error) {
+			checks++
+			return true, nil
+		})
+		if err != nil {
+			t.Fatalf("want the smoke test to pass, got: %s", err)
+		}
+		if checks < 2 {
+			t.Errorf("want the container checked until the timeout, got %d checks", checks)
+		}
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		stubSmokeTestGet(t, func(url string) (int, error) {
+			return 503, nil
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := waitForHealthy(ctx, "http://127.0.0.1:49153/_/health", time.Minute, alwaysRunning)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("want the context's error, got %v", err)
+		}
+	})
+}
+
+// stubSmokeTestDocker stubs docker for a build followed by a smoke test, running
+// reports whether the container is running, and each command is recorded
+func stubSmokeTestDocker(t *testing.T, running bool) *[]string {
+	commands := []string{}
+	t.Setenv("DOCKER_HOST", "")
+
+	origInspect := inspectImageDigest
+	inspectImageDigest = func(config BuildImageConfig, image string) (string, error) {
+		return testImageID + "\n", nil
+	}
+	t.Cleanup(func() { inspectImageDigest = origInspect })
+
+	stubExec(t, func(task v1execute.ExecTask) (v1execute.ExecResult, error) {
+		if task.Shell {
+			return task.Execute()
+		}
+		commands = append(commands, strings.Join(task.Args, " "))
+
+		switch task.Args[0] {
+		case "run":
+			return v1execute.ExecResult{Stdout: "c0ffee\n"}, nil
+		case "inspect":
+			return v1execute.ExecResult{Stdout: fmt.Sprintf("%t\n", running)}, nil
+		case "port":
+			return v1execute.ExecResult{Stdout: "127.0.0.1:49153\n"}, nil
+		case "logs":
+			return v1execute.ExecResult{Stderr: "panic: handler not found\n"}, nil
+		}
+		return v1execute.ExecResult{}, nil
+	})
+
+	return &commands
+}
+
+func Test_BuildImage_SmokeTest(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	commands := stubSmokeTestDocker(t, true)
+
+	var checked string
+	stubSmokeTestGet(t, func(url string) (int, error) {
+		checked = url
+		return 200, nil
+	})
+
+	err := BuildImage(BuildImageConfig{
+		Image:         "fn",
+		Handler:       "handler",
+		FunctionName:  "fn",
+		Language:      "go",
+		QuiteBuild:    true,
+		SmokeTest:     true,
+		SmokeTestPath: "/_/health",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if want := "http://127.0.0.1:49153/_/health"; checked != want {
+		t.Errorf("want %s checked, got %q", want, checked)
+	}
+
+	want := []string{
+		"run --detach --publish 127.0.0.1::8080 fn:latest",
+		"port c0ffee 8080/tcp",
+		"inspect --format {{.State.Running}} c0ffee",
+		"rm --force c0ffee",
+	}
+	if got := (*commands)[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("want commands %v, got %v", want, got)
+	}
+}
+
+func Test_BuildImage_SmokeTestExited(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	commands := stubSmokeTestDocker(t, false)
+	stubSmokeTestGet(t, func(url string) (int, error) {
+		return 200, nil
+	})
+
+	succeeded := false
+	err := BuildImage(BuildImageConfig{
+		Image:         "fn",
+		Handler:       "handler",
+		FunctionName:  "fn",
+		Language:      "go",
+		QuiteBuild:    true,
+		SmokeTest:     true,
+		SmokeTestPath: "/_/health",
+		OnSuccess: func(ctx context.Context, result BuildResult) error {
+			succeeded = true
+			return nil
+		},
+	})
+	if !errors.Is(err, ErrSmokeTestFailed) {
+		t.Fatalf("want ErrSmokeTestFailed, got: %v", err)
+	}
+
+	want := "smoke test of fn:latest failed: the container exited\npanic: handler not found"
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+
+	if succeeded {
+		t.Error("want the build not to be reported as a success")
+	}
+
+	if last := (*commands)[len(*commands)-1]; last != "rm --force c0ffee" {
+		t.Errorf("want the container removed, got %q", last)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1execute "github.com/alexellis/go-execute/pkg/v1"
+)
+
+// buildFromReader builds the image for config from the tar stream of its
+// ContextReader, which docker reads from stdin. The caller has already assembled
+// the build context, so no template is read or copied, nothing is written to
+// ./build/ and the PreBuild and PostBuild hooks are not run.
+func buildFromReader(config BuildImageConfig, result *BuildResult) error {
+	if len(config.BuildOptions) > 0 {
+		return fmt.Errorf("build options cannot be used with a build context from stdin, as their packages come from the template")
+	}
+
+	if config.FreezeBaseImages {
+		return fmt.Errorf("base images cannot be frozen with a build context from stdin, as its Dockerfile is not staged")
+	}
+
+	if config.ShrinkWrap {
+		return fmt.Errorf("a build context from stdin cannot be shrink-wrapped")
+	}
+
+	config.BuildArgMap = withBuildArgDefaults(config.BuildArgDefaults, config.BuildArgMap, config.BuildArgSecrets)
+
+	imageName, alsoTags, err := resolveBuildImage(config, result)
+	if err != nil {
+		return err
+	}
+
+	if config.Verbose {
+		printDockerVersion(config)
+	}
+
+	if err := validateBuild(config); err != nil {
+		return err
+	}
+
+	var sourceDateEpoch string
+	config, sourceDateEpoch, err = prepareDockerBuild(config, result)
+	if err != nil {
+		return err
+	}
+
+	buildArgMap, buildLabelMap, err := resolveBuildArgsAndLabels(config, sourceDateEpoch, &result.Warnings)
+	if err != nil {
+		return err
+	}
+
+	buildArgSecrets, err := readBuildArgSecrets(config.BuildArgSecrets, buildArgMap, config.Verbose)
+	if err != nil {
+		return err
+	}
+
+	dockerBuildVal, err := withBuildCache(config, newDockerBuild(config, imageName, alsoTags, nil, buildArgMap, buildLabelMap, buildArgSecrets))
+	if err != nil {
+		return err
+	}
+	dockerBuildVal.ContextFromStdin = true
+
+	command, args := getDockerBuildCommand(dockerBuildVal)
+	verbosePrintf(config.Verbose, "Build command: %s %s\n", command, strings.Join(redactBuildArgs(args, buildArgSecrets), " "))
+
+	env := buildArgSecretEnv(buildArgSecrets)
+	if len(sourceDateEpoch) > 0 {
+		env = append(env, fmt.Sprintf("%s=%s", sourceDateEpochEnv, sourceDateEpoch))
+	}
+	if config.InlineCache {
+		env = append(env, buildkitEnv+"=1")
+	}
+
+	task := v1execute.ExecTask{
+		Cwd:         config.WorkingDir,
+		Command:     command,
+		Args:        args,
+		Env:         env,
+		Stdin:       config.ContextReader,
+		StreamStdio: !config.QuiteBuild,
+	}
+
+	printProgress(config.ProgressFunc, "Building: %s from a build context on stdin. Please wait..\n", imageName)
+	reportProgress(config.ProgressFunc, BuildEvent{Phase: PhaseBuildStarted, FunctionName: config.FunctionName, Image: imageName, Language: config.Language})
+	started := time.Now()
+
+	res, err := execTaskContext(config.Context, task)
+	duration := time.Since(started)
+	reportProgress(config.ProgressFunc, BuildEvent{Phase: PhaseBuildFinished, FunctionName: config.FunctionName, Image: imageName, Language: config.Language, ExitCode: finishedExitCode(res, err), Duration: duration})
+
+	if interruptErr := checkInterrupted(config); interruptErr != nil {
+		return interruptErr
+	}
+	if err != nil {
+		return err
+	}
+
+	result.ExitCode, result.Duration = res.ExitCode, duration
+
+	if res.ExitCode != 0 {
+		return &BuildFailedError{FunctionName: config.FunctionName, ExitCode: res.ExitCode, Stderr: buildFailureOutput(res)}
+	}
+
+	if len(config.CacheDir) > 0 {
+		if err := commitCache(config.CacheDir, config.FunctionName); err != nil {
+			return err
+		}
+	}
+
+	_, err = completeBuild(config, imageName, result)
+	return err
+}
@@ -0,0 +1,133 @@
+package builder
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_getDockerBuildCommand_ContextFromStdin(t *testing.T) {
+	dockerBuildVal := dockerBuild{
+		Image:            "imagename:latest",
+		ContextFromStdin: true,
+	}
+
+	_, values := getDockerBuildCommand(dockerBuildVal)
+
+	want := []string{"build", "--tag", "imagename:latest", "-"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("want args %v, got %v", want, values)
+	}
+
+	dockerBuildVal.Output = "type=oci,dest=fn.tar"
+	_, values = getDockerBuildCommand(dockerBuildVal)
+
+	want = []string{"buildx", "build", "--output", "type=oci,dest=fn.tar", "--tag", "imagename:latest", "-"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("want args %v, got %v", want, values)
+	}
+}
+
+func Test_BuildImage_ContextReader(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	context := strings.NewReader("context.tar")
+
+	result, err := BuildImageWithResult(BuildImageConfig{
+		Image:         "alexellis/fn:0.1",
+		FunctionName:  "fn",
+		Language:      "go",
+		QuiteBuild:    true,
+		BuildArgMap:   map[string]string{"GO111MODULE": "on"},
+		ContextReader: context,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(*builds) != 1 {
+		t.Fatalf("want 1 build, got %d", len(*builds))
+	}
+
+	task := (*builds)[0]
+	want := []string{"build", "--build-arg", "GO111MODULE=on", "--tag", "alexellis/fn:0.1", "-"}
+	if !reflect.DeepEqual(task.Args, want) {
+		t.Errorf("want args %v, got %v", want, task.Args)
+	}
+	if task.Stdin != context {
+		t.Errorf("want the context reader on stdin of the build")
+	}
+
+	if _, err := os.Stat("build"); !os.IsNotExist(err) {
+		t.Errorf("want no build folder to be staged, got: %v", err)
+	}
+
+	if result.Image != "alexellis/fn:0.1" || len(result.ContextPath) > 0 || result.Digest != testImageID {
+		t.Errorf("want the image and digest without a context path, got %+v", *result)
+	}
+}
+
+func Test_BuildImage_ContextReaderWithoutTemplate(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:         "fn",
+		FunctionName:  "fn",
+		Language:      "dotnet",
+		QuiteBuild:    true,
+		ContextReader: strings.NewReader("context.tar"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(*builds) != 1 {
+		t.Errorf("want 1 build, got %d", len(*builds))
+	}
+}
+
+func Test_BuildImage_ContextReaderWithBuildOptions(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:         "fn",
+		FunctionName:  "fn",
+		Language:      "go",
+		QuiteBuild:    true,
+		BuildOptions:  []string{"dev"},
+		ContextReader: strings.NewReader("context.tar"),
+	})
+
+	want := "build options cannot be used with a build context from stdin, as their packages come from the template"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+	if len(*builds) != 0 {
+		t.Errorf("want no build, got %d", len(*builds))
+	}
+}
+
+func Test_BuildImage_ContextReaderValidatesFlags(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:         "fn",
+		FunctionName:  "fn",
+		Language:      "go",
+		QuiteBuild:    true,
+		ExcludePaths:  []string{"["},
+		ContextReader: strings.NewReader("context.tar"),
+	})
+
+	if err == nil {
+		t.Errorf("want an error for an invalid exclude pattern")
+	}
+	if len(*builds) != 0 {
+		t.Errorf("want no build, got %d", len(*builds))
+	}
+}
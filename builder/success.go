@@ -0,0 +1,79 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// successDurationEnv is set to the duration of the build in seconds for the
+// --on-success command
+const successDurationEnv = "FAAS_BUILD_DURATION"
+
+// BuildResult describes a build, it is returned by BuildImageWithResult and passed
+// to BuildImageConfig.OnSuccess
+type BuildResult struct {
+	FunctionName string
+	Image        string
+
+	// ContextPath is the build context, i.e. ./build/fn/
+	ContextPath string
+
+	// ExitCode is the exit code of docker, it is only meaningful once Duration is set
+	ExitCode int
+
+	// Digest is empty when the image was not loaded into the Docker daemon, or
+	// its digest could not be found
+	Digest string
+
+	// Output is the buildx --output the image was written to, if any
+	Output string
+
+	// Duration is the time taken by docker to build the image
+	Duration time.Duration
+
+	// Warnings are the problems found during the build which did not fail it, in
+	// the order they were printed
+	Warnings []Warning
+}
+
+// reportSuccess calls onSuccess with ctx and result, or prints that the image was
+// built when there is no success handler. A nil ctx is passed on as
+// context.Background().
+func reportSuccess(ctx context.Context, onSuccess func(ctx context.Context, result BuildResult) error, result BuildResult) error {
+	if onSuccess != nil {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return onSuccess(ctx, result)
+	}
+
+	if len(result.Output) > 0 {
+		fmt.Printf("Image: %s built to %s.\n", result.Image, result.Output)
+	} else {
+		fmt.Printf("Image: %s built.\n", result.Image)
+	}
+	return nil
+}
+
+// SuccessCommand returns a success handler which runs command in a shell, with the
+// image in FAAS_IMAGE, its digest in FAAS_IMAGE_DIGEST when known and the build's
+// duration in seconds in FAAS_BUILD_DURATION. The command is killed when ctx is
+// cancelled, as per the pre_build and post_build hooks.
+func SuccessCommand(command string, quiet bool) func(ctx context.Context, result BuildResult) error {
+	return func(ctx context.Context, result BuildResult) error {
+		env := []string{
+			fmt.Sprintf("%s=%s", hookImageEnv, result.Image),
+			fmt.Sprintf("%s=%s", successDurationEnv, strconv.FormatFloat(result.Duration.Seconds(), 'f', 2, 64)),
+		}
+		if len(result.Digest) > 0 {
+			env = append(env, fmt.Sprintf("%s=%s", hookImageDigestEnv, result.Digest))
+		}
+
+		return runHooks(ctx, "on_success", result.FunctionName, "", []string{command}, env, quiet)
+	}
+}
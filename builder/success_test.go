@@ -0,0 +1,261 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+func Test_BuildImage_OnSuccessCalledWithResult(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	var results []BuildResult
+	out := test.CaptureStdout(func() {
+		err := BuildImage(BuildImageConfig{
+			Image:        "alexellis/fn:0.1",
+			Handler:      "handler",
+			FunctionName: "fn",
+			Language:     "go",
+			QuiteBuild:   true,
+			OnSuccess: func(ctx context.Context, result BuildResult) error {
+				results = append(results, result)
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if len(results) != 1 {
+		t.Fatalf("want the success handler called once, got %d", len(results))
+	}
+
+	result := results[0]
+	if result.FunctionName != "fn" || result.Image != "alexellis/fn:0.1" || result.Digest != testImageID {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	if strings.Contains(out, "Image: alexellis/fn:0.1 built.") {
+		t.Errorf("want the success handler to replace the built message, got: %s", out)
+	}
+}
+
+func Test_BuildImage_OnSuccessErrorFailsBuild(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		OnSuccess: func(ctx context.Context, result BuildResult) error {
+			return fmt.Errorf("webhook unavailable")
+		},
+		PostBuild: []string{"touch ran.txt"},
+	})
+	if err == nil || err.Error() != "webhook unavailable" {
+		t.Fatalf("want the success handler's error, got: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join("handler", "ran.txt")); !os.IsNotExist(err) {
+		t.Errorf("want post_build to be skipped after the success handler fails")
+	}
+}
+
+func Test_BuildImage_OnSuccessSkippedWhenBuildFails(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 1)
+
+	called := false
+	err := BuildImage(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		OnSuccess: func(ctx context.Context, result BuildResult) error {
+			called = true
+			return nil
+		},
+	})
+	if err == nil {
+		t.Fatalf("want error from the failed build")
+	}
+	if called {
+		t.Errorf("want the success handler skipped after a failed build")
+	}
+}
+
+func Test_BuildImage_WithoutOnSuccessPrintsBuilt(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	out := test.CaptureStdout(func() {
+		err := BuildImage(BuildImageConfig{
+			Image:        "alexellis/fn:0.1",
+			Handler:      "handler",
+			FunctionName: "fn",
+			Language:     "go",
+			QuiteBuild:   true,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if !strings.Contains(out, "Image: alexellis/fn:0.1 built.\n") {
+		t.Errorf("want the built message, got: %s", out)
+	}
+}
+
+func Test_SuccessCommand_ReceivesImage(t *testing.T) {
+	dir := t.TempDir()
+	stubDockerBuild(t, 0)
+
+	onSuccess := SuccessCommand(fmt.Sprintf("echo -n $FAAS_IMAGE $FAAS_IMAGE_DIGEST $FAAS_BUILD_DURATION > %s", filepath.Join(dir, "result.txt")), true)
+	err := onSuccess(context.Background(), BuildResult{FunctionName: "fn", Image: "alexellis/fn:0.1", Digest: testImageID, Duration: 1500 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "result.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "alexellis/fn:0.1 " + testImageID + " 1.50"
+	if string(got) != want {
+		t.Errorf("want %q, got %q", want, string(got))
+	}
+}
+
+func Test_SuccessCommand_Failure(t *testing.T) {
+	stubDockerBuild(t, 0)
+
+	onSuccess := SuccessCommand("echo notify failed >&2; exit 2", true)
+	err := onSuccess(context.Background(), BuildResult{FunctionName: "fn", Image: "alexellis/fn:0.1"})
+	if err == nil {
+		t.Fatalf("want error from a failing on-success command")
+	}
+
+	want := "[fn] on_success command failed: echo notify failed >&2; exit 2, exit code: 2, error: notify failed"
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
+
+func Test_SuccessCommand_Interrupted(t *testing.T) {
+	if _, err := exec.LookPath("/bin/bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := SuccessCommand("sleep 30", true)(ctx, BuildResult{FunctionName: "fn", Image: "alexellis/fn:0.1"})
+	if err == nil {
+		t.Fatalf("want an error when the on-success command is interrupted")
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("want the on-success command to be stopped, it ran for %s", elapsed)
+	}
+}
+
+func Test_BuildImageWithResult(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	var result *BuildResult
+	var err error
+	test.CaptureStdout(func() {
+		result, err = BuildImageWithResult(BuildImageConfig{
+			Image:        "alexellis/fn:0.1",
+			Handler:      "handler",
+			FunctionName: "fn",
+			Language:     "go",
+			QuiteBuild:   true,
+		})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := BuildResult{
+		FunctionName: "fn",
+		Image:        "alexellis/fn:0.1",
+		ContextPath:  "./build/fn/",
+		Digest:       testImageID,
+		Duration:     result.Duration,
+		Warnings: []Warning{
+			{Code: WarnHandlerFilesMissing, Message: "none of the expected files (handler.go) were found in the handler: handler"},
+		},
+	}
+	if !reflect.DeepEqual(*result, want) {
+		t.Errorf("want result %+v, got %+v", want, *result)
+	}
+	if result.Duration <= 0 {
+		t.Errorf("want the duration of the build, got %s", result.Duration)
+	}
+}
+
+func Test_BuildImageWithResult_Failure(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 2)
+
+	result, err := BuildImageWithResult(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+	})
+	if err == nil {
+		t.Fatalf("want error from the failed build")
+	}
+
+	if result.ExitCode != 2 || result.Image != "alexellis/fn:0.1" || result.ContextPath != "./build/fn/" {
+		t.Errorf("want the exit code, image and context of the failed build, got %+v", *result)
+	}
+	if len(result.Digest) > 0 {
+		t.Errorf("want no digest for a failed build, got %s", result.Digest)
+	}
+}
+
+func Test_BuildImageWithResult_ShrinkWrap(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	result, err := BuildImageWithResult(BuildImageConfig{
+		Image:        "alexellis/fn:0.1",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		ShrinkWrap:   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.ContextPath != "./build/fn/" || result.Duration != 0 {
+		t.Errorf("want only the context path for a shrink-wrap, got %+v", *result)
+	}
+	if len(*builds) != 0 {
+		t.Errorf("want no docker build, got %d", len(*builds))
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Placeholders which are substituted within an --also-tag pattern
+const (
+	tagPatternBranch = "{branch}"
+	tagPatternSHA    = "{sha}"
+)
+
+// maxTagLength is the longest tag accepted by a registry
+const maxTagLength = 128
+
+// invalidTagCharacters matches the characters which cannot be used in an image tag
+var invalidTagCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// sanitizeTag replaces characters which cannot be used in an image tag with "-",
+// i.e. a branch of feature/login gives feature-login
+func sanitizeTag(tag string) string {
+	tag = invalidTagCharacters.ReplaceAllString(tag, "-")
+	tag = strings.TrimLeft(tag, ".-")
+
+	if len(tag) > maxTagLength {
+		tag = tag[:maxTagLength]
+	}
+
+	return tag
+}
+
+// expandTagPatterns returns the tags for each of patterns, with {branch} and {sha}
+// replaced by the current Git branch and short SHA, so that a mutable tag such as
+// {branch}-latest can be applied by the same build as the immutable tag
+func expandTagPatterns(patterns []string) ([]string, error) {
+	tags := []string{}
+
+	for _, pattern := range patterns {
+		tag := pattern
+
+		if strings.Contains(tag, tagPatternBranch) {
+			branch := getGitBranch()
+			if len(branch) == 0 {
+				return nil, fmt.Errorf("cannot use %s in the tag %s as this is not a Git repository", tagPatternBranch, pattern)
+			}
+			tag = strings.ReplaceAll(tag, tagPatternBranch, branch)
+		}
+
+		if strings.Contains(tag, tagPatternSHA) {
+			sha := getGitSHA()
+			if len(sha) == 0 {
+				return nil, fmt.Errorf("cannot use %s in the tag %s as this is not a Git repository", tagPatternSHA, pattern)
+			}
+			tag = strings.ReplaceAll(tag, tagPatternSHA, sha)
+		}
+
+		tag = sanitizeTag(tag)
+		if len(tag) == 0 {
+			return nil, fmt.Errorf("the tag %s is empty once expanded", pattern)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
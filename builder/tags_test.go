@@ -0,0 +1,124 @@
+package builder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/schema"
+	"github.com/openfaas/faas-cli/test"
+)
+
+func Test_expandTagPatterns(t *testing.T) {
+	cases := []struct {
+		name     string
+		branch   string
+		patterns []string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "literal tag",
+			branch:   "master",
+			patterns: []string{"latest"},
+			want:     []string{"latest"},
+		},
+		{
+			name:     "branch and sha",
+			branch:   "master",
+			patterns: []string{"{branch}", "{branch}-{sha}"},
+			want:     []string{"master", "master-a1b2c3d"},
+		},
+		{
+			name:     "branch with a slash",
+			branch:   "feature/login",
+			patterns: []string{"{branch}-latest"},
+			want:     []string{"feature-login-latest"},
+		},
+		{
+			name:     "branch outside of a git repository",
+			patterns: []string{"{branch}"},
+			wantErr:  "cannot use {branch} in the tag {branch} as this is not a Git repository",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stubGit(t, "a1b2c3d", tc.branch, "")
+
+			got, err := expandTagPatterns(tc.patterns)
+			if len(tc.wantErr) > 0 {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("want error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_sanitizeTag(t *testing.T) {
+	cases := map[string]string{
+		"latest":                 "latest",
+		"feature/login":          "feature-login",
+		"-leading":               "leading",
+		"user@fix#1":             "user-fix-1",
+		strings.Repeat("a", 200): strings.Repeat("a", maxTagLength),
+	}
+
+	for tag, want := range cases {
+		if got := sanitizeTag(tag); got != want {
+			t.Errorf("sanitizeTag(%q) want %q, got %q", tag, want, got)
+		}
+	}
+}
+
+func Test_BuildImage_AlsoTags(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubGit(t, "a1b2c3d", "feature/login", "")
+	builds := stubDockerBuild(t, 0)
+
+	test.CaptureStdout(func() {
+		err := BuildImage(BuildImageConfig{
+			Image:        "alexellis/fn",
+			Handler:      "handler",
+			FunctionName: "fn",
+			Language:     "go",
+			TagMode:      schema.SHAFormat,
+			ExtraTags:    []string{"0.1.0"},
+			AlsoTags:     []string{"latest", "{branch}"},
+			GitLabels:    false,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if len(*builds) != 1 {
+		t.Fatalf("want docker build to run once, got %d", len(*builds))
+	}
+
+	var tags []string
+	args := (*builds)[0].Args
+	for i, arg := range args {
+		if arg == "--tag" && i+1 < len(args) {
+			tags = append(tags, args[i+1])
+		}
+	}
+
+	want := []string{
+		"alexellis/fn:latest-a1b2c3d",
+		"alexellis/fn:0.1.0",
+		"alexellis/fn:latest",
+		"alexellis/fn:feature-login",
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("want tags %v, got %v", want, tags)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"path"
+
+	"github.com/openfaas/faas-cli/stack"
+	"github.com/openfaas/faas-cli/version"
+)
+
+// resolveLanguageTemplate returns the template for language within templateDir,
+// merged with the templates it extends, each of which is read through the cache
+func resolveLanguageTemplate(templateDir, language string) (*stack.LanguageTemplate, error) {
+	return stack.ResolveTemplateExtends(language, func(name string) (*stack.LanguageTemplate, error) {
+		return parseLanguageTemplateCached(name, path.Join(templateDirOrDefault(templateDir), name, "template.yml"))
+	})
+}
+
+// withTemplateDefaults returns config with the template's no_cache and squash
+// applied, unless NoCache or Squash were given explicitly. When neither sets them,
+// they are off.
+func withTemplateDefaults(config BuildImageConfig, langTemplate *stack.LanguageTemplate) BuildImageConfig {
+	if langTemplate.NoCache != nil && !config.NoCacheSet {
+		config.NoCache = *langTemplate.NoCache
+	}
+
+	if langTemplate.Squash != nil && !config.SquashSet {
+		config.Squash = *langTemplate.Squash
+	}
+
+	return config
+}
+
+// cliVersion returns the version of the running faas-cli, it can be replaced in tests
+var cliVersion = version.BuildVersion
+
+// checkMinCLIVersion returns an error when the running faas-cli is older than the
+// min_faas_cli_version of the template for language. A development build, whose
+// version is "dev", is assumed to be new enough.
+func checkMinCLIVersion(language, minVersion string) error {
+	if len(minVersion) == 0 {
+		return nil
+	}
+
+	if _, err := parseVersion(minVersion); err != nil {
+		return newBuildError(ErrTemplateInvalid, "the %s template has an invalid min_faas_cli_version: %q", language, minVersion)
+	}
+
+	current := cliVersion()
+	if current == "dev" {
+		return nil
+	}
+
+	if compareVersions(current, minVersion) < 0 {
+		return newBuildError(ErrCLITooOld, "the %s template requires faas-cli %s or newer, found: %s, upgrade from https://github.com/openfaas/faas-cli/releases",
+			language, minVersion, current)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+// templateCacheKey identifies a parsed template.yml
+type templateCacheKey struct {
+	Language string
+	Path     string
+}
+
+// templateCacheEntry is a parsed template.yml along with the file's details
+// when it was read, so that changes to the file can be detected
+type templateCacheEntry struct {
+	ModTime  time.Time
+	Size     int64
+	Template stack.LanguageTemplate
+}
+
+// templateCache holds the parsed template.yml of each language, so that a stack
+// with many functions reads and parses each template once
+var (
+	templateCacheLock sync.Mutex
+	templateCache     = map[templateCacheKey]templateCacheEntry{}
+)
+
+// parseLanguageTemplateCached parses the template.yml at pathToTemplateYAML, or
+// returns the cached result when the file has not been modified since it was read
+func parseLanguageTemplateCached(language, pathToTemplateYAML string) (*stack.LanguageTemplate, error) {
+	info, err := os.Stat(pathToTemplateYAML)
+	if err != nil {
+		return nil, err
+	}
+
+	key := templateCacheKey{Language: language, Path: pathToTemplateYAML}
+
+	templateCacheLock.Lock()
+	entry, ok := templateCache[key]
+	templateCacheLock.Unlock()
+
+	if ok && entry.ModTime.Equal(info.ModTime()) && entry.Size == info.Size() {
+		return copyLanguageTemplate(entry.Template), nil
+	}
+
+	parsed, err := stack.ParseYAMLForLanguageTemplate(pathToTemplateYAML)
+	if err != nil {
+		return nil, err
+	}
+
+	templateCacheLock.Lock()
+	templateCache[key] = templateCacheEntry{ModTime: info.ModTime(), Size: info.Size(), Template: *copyLanguageTemplate(*parsed)}
+	templateCacheLock.Unlock()
+
+	return parsed, nil
+}
+
+// copyLanguageTemplate returns a deep copy of langTemplate, so that a caller which
+// changes its maps or slices does not change the cached template
+func copyLanguageTemplate(langTemplate stack.LanguageTemplate) *stack.LanguageTemplate {
+	copied := langTemplate
+
+	if langTemplate.BuildOptions != nil {
+		copied.BuildOptions = make([]stack.BuildOption, len(langTemplate.BuildOptions))
+		for i, option := range langTemplate.BuildOptions {
+			copied.BuildOptions[i] = stack.BuildOption{Name: option.Name, Packages: append([]string(nil), option.Packages...)}
+		}
+	}
+
+	if langTemplate.BuildArgs != nil {
+		copied.BuildArgs = make(map[string]string, len(langTemplate.BuildArgs))
+		for k, v := range langTemplate.BuildArgs {
+			copied.BuildArgs[k] = v
+		}
+	}
+
+	copied.HandlerFiles = append([]string(nil), langTemplate.HandlerFiles...)
+	copied.RequiredBuildArgs = append([]string(nil), langTemplate.RequiredBuildArgs...)
+
+	if langTemplate.NoCache != nil {
+		noCache := *langTemplate.NoCache
+		copied.NoCache = &noCache
+	}
+	if langTemplate.Squash != nil {
+		squash := *langTemplate.Squash
+		copied.Squash = &squash
+	}
+
+	return &copied
+}
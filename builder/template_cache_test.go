@@ -0,0 +1,111 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_getBuildOptionsFor_RereadsModifiedTemplate(t *testing.T) {
+	templateDir := t.TempDir()
+	templateYAML := filepath.Join(templateDir, "python3", "template.yml")
+	if err := os.MkdirAll(filepath.Dir(templateYAML), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTemplate := func(content string, modTime time.Time) {
+		if err := ioutil.WriteFile(templateYAML, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(templateYAML, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	modTime := time.Now().Add(-time.Hour)
+	writeTemplate("language: python3\nbuild_options:\n- name: dev\n  packages:\n  - make\n", modTime)
+
+	options, err := getBuildOptionsFor(templateDir, "python3")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(options) != 1 || options[0].Name != "dev" {
+		t.Fatalf("want the dev build option, got %v", options)
+	}
+
+	writeTemplate("language: python3\nbuild_options:\n- name: debug\n  packages:\n  - gdb\n", modTime.Add(time.Minute))
+
+	options, err = getBuildOptionsFor(templateDir, "python3")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(options) != 1 || options[0].Name != "debug" {
+		t.Errorf("want the modified template to be re-read, got %v", options)
+	}
+}
+
+func Test_parseLanguageTemplateCached_Concurrent(t *testing.T) {
+	templateDir := t.TempDir()
+	templateYAML := filepath.Join(templateDir, "go", "template.yml")
+	if err := os.MkdirAll(filepath.Dir(templateYAML), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(templateYAML, []byte("language: go\nhandler_folder: handler\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			langTemplate, err := parseLanguageTemplateCached("go", templateYAML)
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if langTemplate.HandlerFolder != "handler" {
+				t.Errorf("want handler folder %q, got %q", "handler", langTemplate.HandlerFolder)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func Test_parseLanguageTemplateCached_ReturnsCopies(t *testing.T) {
+	templateDir := t.TempDir()
+	templateYAML := filepath.Join(templateDir, "go", "template.yml")
+	if err := os.MkdirAll(filepath.Dir(templateYAML), 0700); err != nil {
+		t.Fatal(err)
+	}
+	template := `language: go
+handler_files: [handler.go]
+build_args:
+  GO111MODULE: "on"
+build_options:
+  - name: dev
+    packages: [git]
+`
+	if err := ioutil.WriteFile(templateYAML, []byte(template), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		langTemplate, err := parseLanguageTemplateCached("go", templateYAML)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if langTemplate.BuildArgs["GO111MODULE"] != "on" || langTemplate.HandlerFiles[0] != "handler.go" || langTemplate.BuildOptions[0].Packages[0] != "git" {
+			t.Fatalf("want the template as written on read %d, got %+v", i+1, langTemplate)
+		}
+
+		langTemplate.BuildArgs["GO111MODULE"] = "off"
+		langTemplate.HandlerFiles[0] = "main.go"
+		langTemplate.BuildOptions[0].Packages[0] = "make"
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"github.com/openfaas/faas-cli/stack"
+)
+
+// InspectTemplate returns the template.yml of the language template within
+// templateDir, or the default template folder when it is empty, merged with the
+// templates that it extends. An empty handler_folder is returned as the folder
+// the handler is copied into, "function".
+func InspectTemplate(templateDir, language string) (*stack.LanguageTemplate, error) {
+	templateDir = templateDirOrDefault(templateDir)
+
+	if !stack.IsValidTemplateIn(templateDir, language) {
+		if err := templateParseError(templateDir, language); err != nil {
+			return nil, err
+		}
+		return nil, newBuildError(ErrTemplateNotSupported, "language template: %s not found in %s", language, templateDir)
+	}
+
+	langTemplate, err := readLanguageTemplate(templateDir, language)
+	if err != nil {
+		return nil, err
+	}
+
+	// The parsed template may be shared through the template cache
+	inspected := *langTemplate
+	if len(inspected.HandlerFolder) == 0 {
+		inspected.HandlerFolder = defaultHandlerFolder
+	}
+
+	return &inspected, nil
+}
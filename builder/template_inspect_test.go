@@ -0,0 +1,74 @@
+package builder
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+func Test_InspectTemplate(t *testing.T) {
+	templateDir := writeLintTemplate(t, "python3", map[string]string{
+		"template.yml":   "language: python3\nfprocess: python3 index.py\nhandler_folder: src\nbuild_options:\n  - name: dev\n    packages:\n      - make\n      - automake\n",
+		"Dockerfile":     "FROM python:3\n",
+		"src/handler.py": "",
+	})
+
+	got, err := InspectTemplate(templateDir, "python3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &stack.LanguageTemplate{
+		Language:      "python3",
+		FProcess:      "python3 index.py",
+		HandlerFolder: "src",
+		BuildOptions: []stack.BuildOption{
+			{Name: "dev", Packages: []string{"make", "automake"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func Test_InspectTemplate_DefaultHandlerFolder(t *testing.T) {
+	templateDir := writeLintTemplate(t, "go", map[string]string{
+		"template.yml": "language: go\n",
+		"Dockerfile":   "FROM golang\n",
+	})
+
+	got, err := InspectTemplate(templateDir, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.HandlerFolder != "function" {
+		t.Errorf("want the default handler folder, got %q", got.HandlerFolder)
+	}
+}
+
+func Test_InspectTemplate_DefaultTemplateDir(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	got, err := InspectTemplate("", "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Language != "go" {
+		t.Errorf("want the template from ./template, got language %q", got.Language)
+	}
+}
+
+func Test_InspectTemplate_NotFound(t *testing.T) {
+	_, err := InspectTemplate(t.TempDir(), "cobol")
+	if err == nil {
+		t.Fatal("want an error for a missing template")
+	}
+
+	if !errors.Is(err, ErrTemplateNotSupported) {
+		t.Errorf("want ErrTemplateNotSupported, got: %s", err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+// LintTemplate checks the template for language within templateDir and returns
+// every problem found, or none for a template which can be built. The template.yml
+// must parse and set its language, the handler_folder it names and a Dockerfile
+// must exist, and each build option must have a name and packages without spaces.
+func LintTemplate(templateDir, language string) []string {
+	dir := path.Join(templateDirOrDefault(templateDir), language)
+	problems := []string{}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return append(problems, fmt.Sprintf("template folder %s not found", dir))
+	}
+
+	if _, err := os.Stat(path.Join(dir, "Dockerfile")); err != nil {
+		problems = append(problems, fmt.Sprintf("no Dockerfile found in %s", dir))
+	}
+
+	langTemplate, err := stack.ParseYAMLForLanguageTemplate(path.Join(dir, "template.yml"))
+	if err != nil {
+		return append(problems, fmt.Sprintf("unable to parse template.yml: %s", err.Error()))
+	}
+
+	if len(strings.TrimSpace(langTemplate.Language)) == 0 {
+		problems = append(problems, "template.yml does not set a language")
+	}
+
+	if len(langTemplate.MinFaaSCLIVersion) > 0 {
+		if _, err := parseVersion(langTemplate.MinFaaSCLIVersion); err != nil {
+			problems = append(problems, fmt.Sprintf("min_faas_cli_version %q is not a valid version", langTemplate.MinFaaSCLIVersion))
+		}
+	}
+
+	if len(langTemplate.HandlerFolder) > 0 {
+		handlerFolder, err := resolveHandlerFolder(langTemplate.HandlerFolder, "")
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else if info, err := os.Stat(path.Join(dir, handlerFolder)); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("handler_folder %s not found in %s", langTemplate.HandlerFolder, dir))
+		}
+	}
+
+	buildOptions, err := getBuildOptionsFor(templateDir, language)
+	if err != nil {
+		return append(problems, fmt.Sprintf("unable to read the build options: %s", err.Error()))
+	}
+
+	return append(problems, lintBuildOptions(buildOptions)...)
+}
+
+// lintBuildOptions returns a problem for each build option without a name, with
+// a duplicate name, or with an empty package or one containing whitespace, as the
+// packages are passed to the Dockerfile separated by spaces
+func lintBuildOptions(buildOptions []stack.BuildOption) []string {
+	problems := []string{}
+	seen := map[string]bool{}
+
+	for i, option := range buildOptions {
+		name := strings.TrimSpace(option.Name)
+		if len(name) == 0 {
+			problems = append(problems, fmt.Sprintf("build option %d has no name", i+1))
+			name = fmt.Sprintf("%d", i+1)
+		} else if seen[name] {
+			problems = append(problems, fmt.Sprintf("build option %s is declared more than once", name))
+		}
+		seen[name] = true
+
+		if len(option.Packages) == 0 {
+			problems = append(problems, fmt.Sprintf("build option %s has no packages", name))
+		}
+
+		for _, pkg := range option.Packages {
+			if len(strings.TrimSpace(pkg)) == 0 {
+				problems = append(problems, fmt.Sprintf("build option %s has an empty package", name))
+			} else if strings.ContainsAny(pkg, " \t\n") {
+				problems = append(problems, fmt.Sprintf("build option %s has a package containing whitespace: %q", name, pkg))
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,144 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeLintTemplate writes files into the template for language within a new
+// template folder, and returns the folder
+func writeLintTemplate(t *testing.T, language string, files map[string]string) string {
+	t.Helper()
+
+	templateDir := t.TempDir()
+	for name, content := range files {
+		name = filepath.Join(templateDir, language, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return templateDir
+}
+
+func Test_LintTemplate(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "valid",
+			files: map[string]string{
+				"template.yml":   "language: python3\nhandler_folder: src\nbuild_options:\n  - name: dev\n    packages:\n      - make\n      - automake\n",
+				"Dockerfile":     "FROM python:3\n",
+				"src/handler.py": "",
+			},
+			want: []string{},
+		},
+		{
+			name: "no language, Dockerfile or handler folder",
+			files: map[string]string{
+				"template.yml": "fprocess: python3 index.py\nhandler_folder: src\n",
+			},
+			want: []string{
+				"no Dockerfile found in TEMPLATE",
+				"template.yml does not set a language",
+				"handler_folder src not found in TEMPLATE",
+			},
+		},
+		{
+			name: "invalid min_faas_cli_version",
+			files: map[string]string{
+				"template.yml": "language: python3\nmin_faas_cli_version: latest\n",
+				"Dockerfile":   "FROM python:3\n",
+			},
+			want: []string{
+				`min_faas_cli_version "latest" is not a valid version`,
+			},
+		},
+		{
+			name: "handler folder outside of the template",
+			files: map[string]string{
+				"template.yml": "language: python3\nhandler_folder: ../src\n",
+				"Dockerfile":   "FROM python:3\n",
+			},
+			want: []string{"handler folder override must be a relative path within the build context: ../src"},
+		},
+		{
+			name: "malformed build options",
+			files: map[string]string{
+				"template.yml": `language: python3
+build_options:
+  - name: dev
+    packages:
+      - make
+  - name: dev
+    packages:
+      - gcc
+  - packages:
+      - musl-dev
+  - name: pillow
+  - name: db
+    packages:
+      - ""
+      - postgresql dev
+`,
+				"Dockerfile": "FROM python:3\n",
+			},
+			want: []string{
+				"build option dev is declared more than once",
+				"build option 3 has no name",
+				"build option pillow has no packages",
+				"build option db has an empty package",
+				`build option db has a package containing whitespace: "postgresql dev"`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			templateDir := writeLintTemplate(t, "python3", tc.files)
+
+			got := LintTemplate(templateDir, "python3")
+
+			want := []string{}
+			for _, problem := range tc.want {
+				want = append(want, strings.ReplaceAll(problem, "TEMPLATE", filepath.Join(templateDir, "python3")))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("want problems:\n%v\ngot:\n%v", want, got)
+			}
+		})
+	}
+}
+
+func Test_LintTemplate_Unparseable(t *testing.T) {
+	templateDir := writeLintTemplate(t, "python3", map[string]string{
+		"template.yml": "language: [python3\n",
+		"Dockerfile":   "FROM python:3\n",
+	})
+
+	got := LintTemplate(templateDir, "python3")
+
+	if len(got) != 1 || !strings.HasPrefix(got[0], "unable to parse template.yml: ") {
+		t.Errorf("want a parse error, got %v", got)
+	}
+}
+
+func Test_LintTemplate_Missing(t *testing.T) {
+	templateDir := t.TempDir()
+
+	got := LintTemplate(templateDir, "python3")
+
+	want := []string{"template folder " + filepath.Join(templateDir, "python3") + " not found"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,191 @@
+package builder
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+func Test_BuildImage_TemplateExtends(t *testing.T) {
+	setupBuildContextTest(t, "go-http")
+	builds := stubDockerBuild(t, 0)
+
+	files := map[string]string{
+		"template/go/template.yml":      "language: go\nbuild_args:\n  GO111MODULE: \"on\"\n  CGO_ENABLED: \"0\"\nbuild_options:\n  - name: git\n    packages:\n      - git\n",
+		"template/go-http/template.yml": "language: go-http\nextends: go\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go-http",
+		QuiteBuild:   true,
+		BuildOptions: []string{"git"},
+		BuildArgMap:  map[string]string{"CGO_ENABLED": "1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(*builds) != 1 {
+		t.Fatalf("want 1 build, got %d", len(*builds))
+	}
+
+	args := strings.Join((*builds)[0].Args, " ")
+	for _, want := range []string{"--build-arg CGO_ENABLED=1", "--build-arg GO111MODULE=on", "--build-arg ADDITIONAL_PACKAGE=git"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("want %q in the build args, got: %s", want, args)
+		}
+	}
+}
+
+func Test_withTemplateDefaults(t *testing.T) {
+	on, off := true, false
+
+	cases := []struct {
+		name        string
+		template    *bool
+		flag        bool
+		flagSet     bool
+		wantNoCache bool
+	}{
+		{name: "hard default", wantNoCache: false},
+		{name: "template on", template: &on, wantNoCache: true},
+		{name: "template off", template: &off, wantNoCache: false},
+		{name: "flag on", flag: true, flagSet: true, wantNoCache: true},
+		{name: "flag on over template off", template: &off, flag: true, flagSet: true, wantNoCache: true},
+		{name: "flag off over template on", template: &on, flag: false, flagSet: true, wantNoCache: false},
+		{name: "unset flag ignored for template on", template: &on, flag: false, flagSet: false, wantNoCache: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := withTemplateDefaults(
+				BuildImageConfig{NoCache: tc.flag, NoCacheSet: tc.flagSet, Squash: tc.flag, SquashSet: tc.flagSet},
+				&stack.LanguageTemplate{NoCache: tc.template, Squash: tc.template},
+			)
+
+			if config.NoCache != tc.wantNoCache {
+				t.Errorf("want NoCache %t, got %t", tc.wantNoCache, config.NoCache)
+			}
+			if config.Squash != tc.wantNoCache {
+				t.Errorf("want Squash %t, got %t", tc.wantNoCache, config.Squash)
+			}
+		})
+	}
+}
+
+func Test_BuildImage_TemplateNoCache(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  BuildImageConfig
+		wantArg bool
+	}{
+		{name: "from template", wantArg: true},
+		{name: "overridden by flag", config: BuildImageConfig{NoCache: false, NoCacheSet: true}, wantArg: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setupBuildContextTest(t, "go")
+			builds := stubDockerBuild(t, 0)
+
+			if err := ioutil.WriteFile("template/go/template.yml", []byte("language: go\nno_cache: true\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			config := tc.config
+			config.Image, config.Handler, config.FunctionName, config.Language, config.QuiteBuild = "fn", "handler", "fn", "go", true
+
+			if err := BuildImage(config); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			args := strings.Join((*builds)[0].Args, " ")
+			if got := strings.Contains(args, "--no-cache"); got != tc.wantArg {
+				t.Errorf("want --no-cache %t, got args: %s", tc.wantArg, args)
+			}
+		})
+	}
+}
+
+func Test_checkMinCLIVersion(t *testing.T) {
+	cases := []struct {
+		name       string
+		cliVersion string
+		minVersion string
+		wantKind   error
+	}{
+		{name: "no minimum", cliVersion: "0.14.10"},
+		{name: "older", cliVersion: "0.14.10", minVersion: "0.15.0", wantKind: ErrCLITooOld},
+		{name: "older patch", cliVersion: "0.14.9", minVersion: "0.14.10", wantKind: ErrCLITooOld},
+		{name: "equal", cliVersion: "0.14.10", minVersion: "0.14.10"},
+		{name: "equal with a v prefix", cliVersion: "0.14.10", minVersion: "v0.14.10"},
+		{name: "newer", cliVersion: "0.15.1", minVersion: "0.14.10"},
+		{name: "development build", cliVersion: "dev", minVersion: "99.0.0"},
+		{name: "invalid minimum", cliVersion: "0.14.10", minVersion: "latest", wantKind: ErrTemplateInvalid},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			orig := cliVersion
+			cliVersion = func() string { return tc.cliVersion }
+			defer func() { cliVersion = orig }()
+
+			err := checkMinCLIVersion("go", tc.minVersion)
+			if tc.wantKind == nil {
+				if err != nil {
+					t.Fatalf("want no error, got: %s", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, tc.wantKind) {
+				t.Errorf("want %v, got: %v", tc.wantKind, err)
+			}
+		})
+	}
+}
+
+func Test_BuildImage_MinCLIVersion(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	builds := stubDockerBuild(t, 0)
+
+	orig := cliVersion
+	cliVersion = func() string { return "0.14.10" }
+	defer func() { cliVersion = orig }()
+
+	if err := ioutil.WriteFile("template/go/template.yml", []byte("language: go\nmin_faas_cli_version: 0.15.0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := BuildImage(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+	})
+
+	want := "the go template requires faas-cli 0.15.0 or newer, found: 0.14.10, upgrade from https://github.com/openfaas/faas-cli/releases"
+	if err == nil || err.Error() != want {
+		t.Fatalf("want error %q, got %v", want, err)
+	}
+	if len(*builds) != 0 {
+		t.Errorf("want no build, got %d", len(*builds))
+	}
+}
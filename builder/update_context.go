@@ -0,0 +1,150 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// contextChanges records how updateBuildContext changed a build folder, each path
+// is relative to the folder
+type contextChanges struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+// stagingPath returns the folder that a build context is staged in before it is
+// merged into contextPath with NoClear, a hidden sibling of contextPath
+func stagingPath(contextPath string) string {
+	clean := filepath.Clean(contextPath)
+	return filepath.Join(filepath.Dir(clean), "."+filepath.Base(clean)+".staging") + string(filepath.Separator)
+}
+
+// updateBuildContext makes dest match the freshly staged build context in src, and
+// removes src. Rather than clearing dest:
+// - a file only in src is added
+// - a file whose contents or mode differ is overwritten
+// - an identical file is left alone, so that its modification time is kept
+// - a file or folder only in dest is removed
+// - a file which has become a folder, or the reverse, is replaced
+func updateBuildContext(src, dest string) (contextChanges, error) {
+	var changes contextChanges
+
+	dirPermissions, err := buildDirPermissions()
+	if err != nil {
+		return changes, err
+	}
+
+	if err := os.MkdirAll(dest, dirPermissions); err != nil {
+		return changes, fmt.Errorf("error creating path: %s - %s", dest, err.Error())
+	}
+
+	if err := reconcileDir(src, dest, "", &changes); err != nil {
+		return changes, err
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Updated)
+	sort.Strings(changes.Removed)
+
+	return changes, os.RemoveAll(src)
+}
+
+// reconcileDir updates the folder dest to match src, rel is the path of both
+// relative to the root of the build context
+func reconcileDir(src, dest, rel string, changes *contextChanges) error {
+	srcInfos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	destInfos, err := ioutil.ReadDir(dest)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]os.FileInfo{}
+	for _, info := range srcInfos {
+		wanted[info.Name()] = info
+	}
+
+	for _, destInfo := range destInfos {
+		srcInfo, ok := wanted[destInfo.Name()]
+		if ok && srcInfo.IsDir() == destInfo.IsDir() {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(dest, destInfo.Name())); err != nil {
+			return err
+		}
+		if !ok {
+			changes.Removed = append(changes.Removed, filepath.Join(rel, destInfo.Name()))
+		}
+	}
+
+	for _, srcInfo := range srcInfos {
+		srcPath := filepath.Join(src, srcInfo.Name())
+		destPath := filepath.Join(dest, srcInfo.Name())
+		childRel := filepath.Join(rel, srcInfo.Name())
+
+		if srcInfo.IsDir() {
+			if err := os.MkdirAll(destPath, srcInfo.Mode().Perm()); err != nil {
+				return fmt.Errorf("error creating path: %s - %s", destPath, err.Error())
+			}
+			if err := reconcileDir(srcPath, destPath, childRel, changes); err != nil {
+				return err
+			}
+			continue
+		}
+
+		destInfo, err := os.Stat(destPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if destInfo == nil {
+			changes.Added = append(changes.Added, childRel)
+		} else {
+			same, err := sameFile(srcPath, srcInfo, destPath, destInfo)
+			if err != nil {
+				return err
+			}
+			if same {
+				continue
+			}
+			changes.Updated = append(changes.Updated, childRel)
+		}
+
+		if err := copyFile(srcPath, destPath, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sameFile returns true when the two files have the same mode and contents
+func sameFile(aPath string, a os.FileInfo, bPath string, b os.FileInfo) (bool, error) {
+	if a.Size() != b.Size() || a.Mode() != b.Mode() {
+		return false, nil
+	}
+
+	aData, err := ioutil.ReadFile(aPath)
+	if err != nil {
+		return false, err
+	}
+
+	bData, err := ioutil.ReadFile(bPath)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(aData, bData), nil
+}
@@ -0,0 +1,152 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+// writeContextFiles writes each file under dir, creating its folders
+func writeContextFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_updateBuildContext(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "staging")
+	dest := filepath.Join(dir, "fn")
+
+	writeContextFiles(t, dest, map[string]string{
+		"Dockerfile":            "FROM scratch\n",
+		"function/handler.go":   "package function\n",
+		"function/old.go":       "package function\n",
+		"function/stale/a.txt":  "stale\n",
+		"function/assets":       "now a folder\n",
+		"function/vendor/b.txt": "kept\n",
+	})
+	writeContextFiles(t, src, map[string]string{
+		"Dockerfile":            "FROM scratch\n",
+		"function/handler.go":   "package function\n\nfunc Handle() {}\n",
+		"function/new.go":       "package function\n",
+		"function/assets/c.txt": "asset\n",
+		"function/vendor/b.txt": "kept\n",
+	})
+
+	unchanged := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(dest, "Dockerfile"), unchanged, unchanged); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := updateBuildContext(src, dest)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := contextChanges{
+		Added:   []string{filepath.Join("function", "assets", "c.txt"), filepath.Join("function", "new.go")},
+		Updated: []string{filepath.Join("function", "handler.go")},
+		Removed: []string{filepath.Join("function", "old.go"), filepath.Join("function", "stale")},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("want changes %+v, got %+v", want, changes)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dest, "function", "handler.go"))
+	if err != nil || string(got) != "package function\n\nfunc Handle() {}\n" {
+		t.Errorf("want the changed handler to be updated, got %q, %v", string(got), err)
+	}
+
+	for _, removed := range []string{"function/old.go", "function/stale"} {
+		if _, err := os.Stat(filepath.Join(dest, removed)); !os.IsNotExist(err) {
+			t.Errorf("want %s removed", removed)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(dest, "Dockerfile")); err != nil || !info.ModTime().Equal(unchanged) {
+		t.Errorf("want the unchanged Dockerfile left alone, got %v, %v", info, err)
+	}
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("want the staging folder removed")
+	}
+}
+
+func Test_updateBuildContext_ModeChange(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "staging")
+	dest := filepath.Join(dir, "fn")
+
+	writeContextFiles(t, dest, map[string]string{"entrypoint.sh": "#!/bin/sh\n"})
+	writeContextFiles(t, src, map[string]string{"entrypoint.sh": "#!/bin/sh\n"})
+	if err := os.Chmod(filepath.Join(src, "entrypoint.sh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := updateBuildContext(src, dest)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(changes.Updated, []string{"entrypoint.sh"}) {
+		t.Errorf("want entrypoint.sh updated for its mode, got %+v", changes)
+	}
+
+	if info, _ := os.Stat(filepath.Join(dest, "entrypoint.sh")); info.Mode().Perm() != 0700 {
+		t.Errorf("want mode 0700, got %v", info.Mode().Perm())
+	}
+}
+
+func Test_createBuildContext_NoClear(t *testing.T) {
+	setupBuildContextTest(t, "go")
+
+	test.CaptureStdout(func() {
+		if _, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, NoClear: true}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		writeContextFiles(t, "handler", map[string]string{"extra.txt": "extra\n"})
+
+		tempPath, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, NoClear: true})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if tempPath != "./build/fn/" {
+			t.Errorf("want ./build/fn/, got %s", tempPath)
+		}
+
+		if err := os.Remove(filepath.Join("handler", "extra.txt")); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := createBuildContext(buildContextOptions{FunctionName: "fn", Handler: "handler", TemplateDir: "./template", Language: "go", UseFunction: true, NoClear: true}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	if _, err := os.Stat(filepath.Join("build", "fn", "function", "extra.txt")); !os.IsNotExist(err) {
+		t.Errorf("want the stale extra.txt removed from the build folder")
+	}
+
+	if _, err := os.Stat(filepath.Join("build", "fn", "function", "handler.txt")); err != nil {
+		t.Errorf("want handler.txt in the build folder: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join("build", ".fn.staging")); !os.IsNotExist(err) {
+		t.Errorf("want no staging folder left behind")
+	}
+}
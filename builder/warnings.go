@@ -0,0 +1,67 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"os"
+)
+
+// WarningCode identifies the kind of a Warning
+type WarningCode string
+
+const (
+	// WarnBuildArgWhitespace is given when trailing whitespace is removed from a build-arg
+	WarnBuildArgWhitespace WarningCode = "build-arg-whitespace"
+
+	// WarnSquashSkipped is given when the image is built without --squash, as it
+	// is not supported by the Docker daemon
+	WarnSquashSkipped WarningCode = "squash-skipped"
+
+	// WarnHandlerFilesMissing is given when the handler contains none of the files
+	// expected by the template
+	WarnHandlerFilesMissing WarningCode = "handler-files-missing"
+
+	// WarnTemplateLanguage is given when the template declares another language
+	WarnTemplateLanguage WarningCode = "template-language"
+
+	// WarnAnnotationsIgnored is given when annotations are set without an Output
+	WarnAnnotationsIgnored WarningCode = "annotations-ignored"
+
+	// WarnCreatedLabel is given when the created label is replaced for a
+	// reproducible build
+	WarnCreatedLabel WarningCode = "created-label"
+
+	// WarnBaseImageNotFrozen is given when a FROM cannot be pinned by FreezeBaseImages
+	WarnBaseImageNotFrozen WarningCode = "base-image-not-frozen"
+
+	// WarnScanSkipped is given when the image cannot be scanned
+	WarnScanSkipped WarningCode = "scan-skipped"
+
+	// WarnSmokeTestSkipped is given when the image cannot be smoke tested
+	WarnSmokeTestSkipped WarningCode = "smoke-test-skipped"
+
+	// WarnDigestUnavailable is given when the digest of the image cannot be found
+	WarnDigestUnavailable WarningCode = "digest-unavailable"
+)
+
+// Warning is a problem found during a build which does not fail it
+type Warning struct {
+	Code    WarningCode
+	Message string
+}
+
+// recordWarning appends a Warning to warnings, when they are being collected
+func recordWarning(warnings *[]Warning, code WarningCode, format string, a ...interface{}) {
+	if warnings != nil {
+		*warnings = append(*warnings, Warning{Code: code, Message: fmt.Sprintf(format, a...)})
+	}
+}
+
+// warn prints the formatted message as a warning to stderr, so that it is kept
+// apart from output such as --print-image-name, and records it in warnings
+func warn(warnings *[]Warning, code WarningCode, format string, a ...interface{}) {
+	recordWarning(warnings, code, format, a...)
+	fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", a...)
+}
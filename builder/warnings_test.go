@@ -0,0 +1,94 @@
+package builder
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/test"
+)
+
+func Test_BuildImageWithResult_Warnings(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	if err := ioutil.WriteFile("handler/handler.go", []byte("package function\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var succeeded BuildResult
+	result, err := BuildImageWithResult(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+		BuildArgMap:  map[string]string{"VERSION": "1.0\n"},
+		Annotations:  map[string]string{"owner": "alex"},
+		OnSuccess: func(ctx context.Context, result BuildResult) error {
+			succeeded = result
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []Warning{
+		{Code: WarnAnnotationsIgnored, Message: "annotations require buildx, set --output to build fn with buildx, the annotations are ignored"},
+		{Code: WarnBuildArgWhitespace, Message: "removed trailing whitespace from build-arg VERSION, use --keep-build-arg-whitespace to keep it"},
+	}
+	if !reflect.DeepEqual(result.Warnings, want) {
+		t.Errorf("want warnings %v, got %v", want, result.Warnings)
+	}
+
+	if !reflect.DeepEqual(succeeded.Warnings, want) {
+		t.Errorf("want the warnings passed to OnSuccess, got %v", succeeded.Warnings)
+	}
+}
+
+func Test_BuildImageWithResult_NoWarnings(t *testing.T) {
+	setupBuildContextTest(t, "go")
+	stubDockerBuild(t, 0)
+
+	if err := ioutil.WriteFile("handler/handler.go", []byte("package function\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := BuildImageWithResult(BuildImageConfig{
+		Image:        "fn",
+		Handler:      "handler",
+		FunctionName: "fn",
+		Language:     "go",
+		QuiteBuild:   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(result.Warnings) != 0 {
+		t.Errorf("want no warnings, got %v", result.Warnings)
+	}
+}
+
+func Test_warn(t *testing.T) {
+	warnings := []Warning{}
+
+	out := test.CaptureStderr(func() {
+		warn(&warnings, WarnScanSkipped, "unable to scan %s", "fn")
+		warn(nil, WarnScanSkipped, "printed without being recorded")
+	})
+
+	want := []Warning{{Code: WarnScanSkipped, Message: "unable to scan fn"}}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("want warnings %v, got %v", want, warnings)
+	}
+
+	for _, line := range []string{"Warning: unable to scan fn\n", "Warning: printed without being recorded\n"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("want %q printed to stderr, got: %s", line, out)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package builder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// applyWorkingDir resolves the relative paths of config against config.WorkingDir,
+// so that the handler, template folder, extra paths and cache folder are found, and
+// scoped, as if faas-cli was run from there. The process's working directory is
+// left alone, so that builds with different working directories can run in parallel.
+func applyWorkingDir(config BuildImageConfig) BuildImageConfig {
+	if len(config.WorkingDir) == 0 {
+		return config
+	}
+
+	if !isRemoteHandler(config.Handler) {
+		config.Handler = inWorkingDir(config.WorkingDir, config.Handler)
+	}
+
+	config.TemplateDir = inWorkingDir(config.WorkingDir, templateDirOrDefault(config.TemplateDir))
+
+	copyExtraPaths := make([]string, 0, len(config.CopyExtraPaths))
+	for _, extraPath := range config.CopyExtraPaths {
+		copyExtraPaths = append(copyExtraPaths, inWorkingDir(config.WorkingDir, extraPath))
+	}
+	config.CopyExtraPaths = copyExtraPaths
+
+	copyExtraScopes := []string{config.WorkingDir}
+	if len(config.CopyExtraScopes) > 0 {
+		copyExtraScopes = make([]string, 0, len(config.CopyExtraScopes))
+		for _, scope := range config.CopyExtraScopes {
+			copyExtraScopes = append(copyExtraScopes, inWorkingDir(config.WorkingDir, scope))
+		}
+	}
+	config.CopyExtraScopes = copyExtraScopes
+
+	if len(config.CacheDir) > 0 {
+		config.CacheDir = inWorkingDir(config.WorkingDir, config.CacheDir)
+	}
+
+	return config
+}
+
+// inWorkingDir returns p relative to workingDir, an absolute p is returned as-is
+func inWorkingDir(workingDir, p string) string {
+	if len(workingDir) == 0 || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(workingDir, filepath.FromSlash(p))
+}
+
+// outputInWorkingDir returns the buildx output with a relative dest made absolute,
+// against workingDir when it is set, or the current directory. Otherwise the file
+// would be written within the build context, as docker is run from there.
+func outputInWorkingDir(workingDir, output string) (string, error) {
+	if len(output) == 0 {
+		return output, nil
+	}
+
+	options := strings.Split(output, ",")
+	for i, option := range options {
+		dest := strings.TrimPrefix(option, "dest=")
+		if dest == option || len(dest) == 0 || dest == "-" {
+			continue
+		}
+
+		abs, err := filepath.Abs(inWorkingDir(workingDir, dest))
+		if err != nil {
+			return "", fmt.Errorf("unable to resolve the output dest %s: %s", dest, err.Error())
+		}
+		options[i] = "dest=" + abs
+	}
+
+	return strings.Join(options, ","), nil
+}
+
+// buildContextPath returns the temporary build folder for a function, which is
+// within the build folder of workingDir, or of the current directory
+func buildContextPath(workingDir, functionName string) string {
+	if len(workingDir) == 0 {
+		return fmt.Sprintf("./build/%s/", functionName)
+	}
+	return filepath.Join(workingDir, "build", functionName) + string(filepath.Separator)
+}
@@ -0,0 +1,196 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// setupWorkingDirTest creates a monorepo with a project in each of dirs, each with
+// its own template, handler and common folder, and changes into its root
+func setupWorkingDirTest(t *testing.T, dirs ...string) {
+	t.Helper()
+
+	setupBuildContextTest(t, "go")
+
+	for _, dir := range dirs {
+		files := map[string]string{
+			"template/go/template.yml":         "language: go\n",
+			"template/go/Dockerfile":           "FROM scratch\n# " + dir + "\n",
+			"template/go/function/handler.txt": "template handler\n",
+			"handler/handler.txt":              dir + " handler\n",
+			"common/shared.txt":                dir + " shared\n",
+		}
+
+		for name, content := range files {
+			name = filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func Test_BuildImage_WorkingDirs(t *testing.T) {
+	setupWorkingDirTest(t, filepath.Join("services", "a"), filepath.Join("services", "b"))
+	builds := stubDockerBuild(t, 0)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			errs[i] = BuildImage(BuildImageConfig{
+				Image:          "fn-" + name,
+				Handler:        "./handler",
+				FunctionName:   "fn-" + name,
+				Language:       "go",
+				QuiteBuild:     true,
+				CopyExtraPaths: []string{"common"},
+				WorkingDir:     filepath.Join("services", name),
+			})
+		}(i, name)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if len(*builds) != 2 {
+		t.Fatalf("want 2 builds, got %d", len(*builds))
+	}
+
+	for _, name := range []string{"a", "b"} {
+		context := filepath.Join("services", name, "build", "fn-"+name)
+		want := map[string]string{
+			"Dockerfile":                 "FROM scratch\n# " + filepath.Join("services", name) + "\n",
+			"function/handler.txt":       filepath.Join("services", name) + " handler\n",
+			"function/common/shared.txt": filepath.Join("services", name) + " shared\n",
+		}
+
+		for file, content := range want {
+			got, err := ioutil.ReadFile(filepath.Join(context, filepath.FromSlash(file)))
+			if err != nil {
+				t.Errorf("want %s in the build context of fn-%s: %s", file, name, err)
+				continue
+			}
+			if string(got) != content {
+				t.Errorf("want %s in fn-%s to be %q, got %q", file, name, content, string(got))
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join("build", "fn-a")); !os.IsNotExist(err) {
+		t.Errorf("want no build folder in the current directory")
+	}
+
+	cwds := map[string]bool{}
+	for _, build := range *builds {
+		cwds[build.Cwd] = true
+	}
+	for _, name := range []string{"a", "b"} {
+		if want := buildContextPath(filepath.Join("services", name), "fn-"+name); !cwds[want] {
+			t.Errorf("want docker run in %s, got %v", want, cwds)
+		}
+	}
+}
+
+func Test_CreateBuildContext_WorkingDirScope(t *testing.T) {
+	setupWorkingDirTest(t, filepath.Join("services", "a"), filepath.Join("services", "b"))
+
+	_, err := CreateBuildContext(BuildImageConfig{
+		Image:          "fn-a",
+		Handler:        "./handler",
+		FunctionName:   "fn-a",
+		Language:       "go",
+		CopyExtraPaths: []string{"../b/common"},
+		WorkingDir:     filepath.Join("services", "a"),
+	})
+	if err == nil {
+		t.Fatal("want an error for an extra path outside of the working directory")
+	}
+	if !strings.Contains(err.Error(), "forbidden path appears to be outside of the build context") {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func Test_applyWorkingDir(t *testing.T) {
+	config := applyWorkingDir(BuildImageConfig{
+		Handler:         "./fn",
+		CopyExtraPaths:  []string{"common", "/abs/models"},
+		CopyExtraScopes: []string{".", "../vendor"},
+		WorkingDir:      "services/a",
+	})
+
+	if config.Handler != filepath.Join("services", "a", "fn") {
+		t.Errorf("want handler within the working directory, got %s", config.Handler)
+	}
+	if config.TemplateDir != filepath.Join("services", "a", "template") {
+		t.Errorf("want the template folder within the working directory, got %s", config.TemplateDir)
+	}
+
+	wantPaths := []string{filepath.Join("services", "a", "common"), "/abs/models"}
+	wantScopes := []string{filepath.Join("services", "a"), filepath.Join("services", "vendor")}
+	for i := range wantPaths {
+		if config.CopyExtraPaths[i] != wantPaths[i] {
+			t.Errorf("want extra path %s, got %s", wantPaths[i], config.CopyExtraPaths[i])
+		}
+		if config.CopyExtraScopes[i] != wantScopes[i] {
+			t.Errorf("want scope %s, got %s", wantScopes[i], config.CopyExtraScopes[i])
+		}
+	}
+}
+
+func Test_applyWorkingDir_RemoteHandler(t *testing.T) {
+	config := applyWorkingDir(BuildImageConfig{
+		Handler:    "https://github.com/org/fn.git",
+		WorkingDir: "services/a",
+	})
+
+	if config.Handler != "https://github.com/org/fn.git" {
+		t.Errorf("want a Git URL handler unchanged, got %s", config.Handler)
+	}
+}
+
+func Test_outputInWorkingDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		workingDir string
+		output     string
+		want       string
+	}{
+		{name: "no output"},
+		{name: "no dest", output: "type=docker", want: "type=docker"},
+		{name: "relative dest", output: "type=oci,dest=./fn.tar", want: "type=oci,dest=" + filepath.Join(wd, "fn.tar")},
+		{name: "relative dest within the working dir", workingDir: "services", output: "type=oci,dest=fn.tar,name=fn", want: "type=oci,dest=" + filepath.Join(wd, "services", "fn.tar") + ",name=fn"},
+		{name: "absolute dest", workingDir: "services", output: "type=tar,dest=" + filepath.Join(wd, "out", "fn.tar"), want: "type=tar,dest=" + filepath.Join(wd, "out", "fn.tar")},
+		{name: "stdout", output: "type=tar,dest=-", want: "type=tar,dest=-"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := outputInWorkingDir(tc.workingDir, tc.output)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("want output %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -4,11 +4,14 @@
 package commands
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/morikuni/aec"
@@ -36,29 +39,161 @@ var (
 	envsubst         bool
 	quietBuild       bool
 	disableStackPull bool
+	allowNoVCS       bool
+	fallbackVersion  string
+	keepTemp         bool
+	pull             bool
+	handlerFolder    string
+	verifyTemplate   bool
+	noProxyForward   bool
+	printImageName   bool
+	offline          bool
+	squashMode       string
+	checkRegistry    bool
+	failFast         bool
+	gitLabels        bool
+	buildArgSecrets  []string
+	buildSecretMap   map[string]string
+	keepArgSpace     bool
+	expandArgs       bool
+	isolation        string
+	templateDir      string
+	addHosts         []string
+	buildNetwork     string
+	changedOnly      string
+	excludePaths     []string
+	compress         bool
+	describeDirty    bool
+	labelFiles       []string
+	copyExtraScopes  []string
+	shrinkwrapTar    bool
+	shrinkwrapComp   string
+	alsoTags         []string
+	strictTemplate   bool
+	buildOutput      string
+	buildMemory      string
+	buildCPUs        string
+	exportRootFS     string
+	handlersGlob     string
+	reproducible     bool
+	noOverlay        bool
+	gitDirtyLabel    bool
+	planBuild        bool
+	printCtxHash     bool
+	onSuccess        string
+	chdir            string
+	verifyCopies     bool
+	dockerContext    string
+	scanBuild        bool
+	scanFailOn       string
+	scanRequired     bool
+	noClear          bool
+	contextStdin     bool
+	nocacheSet       bool
+	squashSet        bool
+	pullSet          bool
+	compressSet      bool
+	imageAnnotations []string
+	annotationMap    map[string]string
+	ulimits          []string
+	cacheDir         string
+	dockerBinary     string
+	buildArgDefaults []string
+	argDefaultMap    map[string]string
+	freezeBase       bool
+	inlineCache      bool
+	failUnpinned     bool
+	smokeTest        bool
+	smokePort        int
+	smokePath        string
+	smokeTimeout     time.Duration
 )
 
 func init() {
 	// Setup flags that are used by multiple commands (variables defined in faas.go)
 	buildCmd.Flags().StringVar(&image, "image", "", "Docker image name to build")
-	buildCmd.Flags().StringVar(&handler, "handler", "", "Directory with handler for function, e.g. handler.js")
+	buildCmd.Flags().StringVar(&handler, "handler", "", "Directory with handler for function, e.g. handler.js, or a Git URL with an optional #ref")
 	buildCmd.Flags().StringVar(&functionName, "name", "", "Name of the deployed function")
 	buildCmd.Flags().StringVar(&language, "lang", "", "Programming language template")
 
 	// Setup flags that are used only by this command (variables defined above)
 	buildCmd.Flags().BoolVar(&nocache, "no-cache", false, "Do not use Docker's build cache")
 	buildCmd.Flags().BoolVar(&squash, "squash", false, `Use Docker's squash flag for smaller images [experimental] `)
+	buildCmd.Flags().StringVar(&squashMode, "squash-mode", builder.SquashRequire, `When the Docker daemon cannot --squash, "require" fails the build and "best-effort" warns and builds without it`)
+	buildCmd.Flags().BoolVar(&pull, "pull", false, "Always attempt to pull newer versions of the base images")
+	buildCmd.Flags().BoolVar(&compress, "compress", false, "Compress the build context sent to the Docker daemon using gzip, useful for a remote daemon")
+	buildCmd.Flags().StringArrayVar(&addHosts, "add-host", []string{}, "Add a custom host-to-IP mapping to the build (HOST:IP)")
+	buildCmd.Flags().StringVar(&buildNetwork, "build-network", "", "Set the networking mode for RUN instructions during the build, i.e. host. Host networking removes the build's network isolation and is not supported with buildx multi-platform builds. Named --build-network so it does not clash with deploy's --network under faas-cli up")
+	buildCmd.Flags().StringVar(&dockerContext, "docker-context", "", "Build with the Docker daemon of this context from \"docker context ls\", rather than the current context")
+	buildCmd.Flags().StringArrayVar(&imageAnnotations, "image-annotation", []string{}, "Add an OCI annotation to the image manifest (KEY=VALUE), requires --output as annotations are written by buildx")
+	buildCmd.Flags().StringVar(&buildOutput, "output", "", "Write the image with docker buildx instead of loading it into the Docker daemon, i.e. type=oci,dest=./fn.tar, a relative dest is written relative to the current folder, or --chdir")
+	buildCmd.Flags().StringVar(&exportRootFS, "export-rootfs", "", "Export the root filesystem of the final stage as a tar to the given path with docker buildx, instead of building an image")
+	buildCmd.Flags().BoolVar(&reproducible, "reproducible", false, "Set SOURCE_DATE_EPOCH from the time of the last commit and rewrite file timestamps with docker buildx, so that builds of the same commit give the same image")
+	buildCmd.Flags().StringVar(&buildMemory, "memory", "", "Limit the memory available to the build's RUN instructions, i.e. 512m or 2g, not supported with --output")
+	buildCmd.Flags().StringVar(&dockerBinary, "docker-binary", "", "Run this docker binary for the build rather than docker from the PATH, or set "+dockerBinaryEnvironment)
+	buildCmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Import and export a local BuildKit cache for each function within this folder, i.e. ./.cache, builds with buildx and requires a builder with the docker-container driver")
+	buildCmd.Flags().BoolVar(&smokeTest, "smoke-test", false, "Start each built image and fail the build if the container exits, or its health endpoint does not return 200 OK within --smoke-test-timeout, the docker daemon must be local")
+	buildCmd.Flags().IntVar(&smokePort, "smoke-test-port", builder.DefaultSmokeTestPort, "Port of the health endpoint for --smoke-test")
+	buildCmd.Flags().StringVar(&smokePath, "smoke-test-path", builder.DefaultSmokeTestPath, "Path of the health endpoint for --smoke-test, when empty the container only needs to keep running until the timeout")
+	buildCmd.Flags().DurationVar(&smokeTimeout, "smoke-test-timeout", builder.DefaultSmokeTestTimeout, "Time for the health endpoint to return 200 OK with --smoke-test")
+	buildCmd.Flags().BoolVar(&inlineCache, "inline-cache", false, "Write BuildKit's cache into the image and tag it as IMAGE:buildcache, then import the cache from that tag with --cache-from, requires BuildKit")
+	buildCmd.Flags().StringArrayVar(&ulimits, "ulimit", []string{}, "Set a ulimit for the build's RUN instructions (NAME=SOFT:HARD), i.e. nofile=65536:65536, not supported with --output")
+	buildCmd.Flags().StringVar(&buildCPUs, "cpus", "", "Limit the CPUs available to the build's RUN instructions, i.e. 1.5, not supported with --output")
+	buildCmd.Flags().StringVar(&isolation, "isolation", "", "Container isolation technology for Windows containers: "+strings.Join(builder.IsolationModes, ", "))
+	buildCmd.Flags().BoolVar(&noProxyForward, "no-proxy-forward", false, "Do not forward the http_proxy and https_proxy environment variables as build-args")
+	buildCmd.Flags().BoolVar(&offline, "offline", false, "Build without network access or Git lookups: disables --pull, template pulls, proxy forwarding, Git URL handlers and Git labels")
+	buildCmd.Flags().StringVar(&chdir, "chdir", "", "Build as if run from this folder: the stack file, handlers, templates and extra paths are relative to it and the build folder is created in it, templates are not pulled")
+	buildCmd.Flags().StringVar(&handlersGlob, "handlers-glob", "", "Without a stack file, build a function for each folder matching the glob pattern, named after the folder, i.e. ./functions/*, use --image as a registry prefix")
+	buildCmd.Flags().StringVar(&onSuccess, "on-success", "", "Run a shell command after each successful build, with the image in $FAAS_IMAGE, its digest in $FAAS_IMAGE_DIGEST and the build time in seconds in $FAAS_BUILD_DURATION")
+	buildCmd.Flags().BoolVar(&verifyCopies, "verify-copies", false, "Compare the checksum of each file copied into the build context with its source, to catch corrupt copies on unreliable filesystems")
+	buildCmd.Flags().BoolVar(&scanBuild, "scan", false, "Scan each built image for vulnerabilities with grype")
+	buildCmd.Flags().StringVar(&scanFailOn, "fail-on", "", "With --scan, fail the build for a vulnerability of this severity or above: "+strings.Join(builder.Severities, ", "))
+	buildCmd.Flags().BoolVar(&scanRequired, "scan-required", false, "With --scan, fail the build when grype is not installed, rather than printing a warning")
+	buildCmd.Flags().BoolVar(&planBuild, "plan", false, "Print the language, image, build-args, labels and docker command for each function without building anything")
+	buildCmd.Flags().BoolVar(&printCtxHash, "print-context-hash", false, "Create the build context of each function and print a hash of it and of the image, build-args and labels, then exit without building, for use as an external cache key")
 	buildCmd.Flags().IntVar(&parallel, "parallel", 1, "Build in parallel to depth specified.")
+	buildCmd.Flags().BoolVar(&failFast, "fail-fast", false, "Stop starting new builds after the first function fails to build")
+	buildCmd.Flags().StringVar(&changedOnly, "changed-only", "", "Only build functions whose handler, template or copied paths changed since the merge base with a Git ref, defaults to HEAD~1 when given without a ref")
+	buildCmd.Flags().Lookup("changed-only").NoOptDefVal = "HEAD~1"
 	buildCmd.Flags().BoolVar(&shrinkwrap, "shrinkwrap", false, "Just write files to ./build/ folder for shrink-wrapping")
+	buildCmd.Flags().BoolVar(&contextStdin, "context-from-stdin", false, "Build a single function from a tar of its build context piped to stdin, rather than staging ./build/ from its template and handler")
+	buildCmd.Flags().BoolVar(&noClear, "no-clear", false, "Update the existing ./build/ folder of each function in place, rather than clearing it: unchanged files are kept and stale files removed")
+	buildCmd.Flags().BoolVar(&failUnpinned, "fail-on-unpinned-template", false, "Fail unless the template folder is a git checkout, such as a submodule, without uncommitted changes, and at the configuration.template_revision of the stack file when it is set")
+	buildCmd.Flags().BoolVar(&freezeBase, "freeze-base-images", false, "Pin each FROM of the staged Dockerfile to the current digest of its base image, the digests are recorded in ./build/NAME.manifest.json")
+	buildCmd.Flags().BoolVar(&shrinkwrapTar, "shrinkwrap-tar", false, "With --shrinkwrap, also write each build context to an archive such as ./build/NAME.tar.gz")
+	buildCmd.Flags().StringVar(&shrinkwrapComp, "shrinkwrap-compression", builder.ShrinkWrapCompressionGzip, "Compression for the --shrinkwrap-tar archive, one of: "+strings.Join(builder.ShrinkWrapCompressions, ", "))
 	buildCmd.Flags().StringArrayVarP(&buildArgs, "build-arg", "b", []string{}, "Add a build-arg for Docker (KEY=VALUE)")
+	buildCmd.Flags().StringArrayVar(&buildArgDefaults, "build-arg-default", []string{}, "Add a build-arg for Docker (KEY=VALUE) only when it is not otherwise set. From highest to lowest precedence, build-args come from: --build-arg or --build-arg-secret, the function's build_args, the template's build_args, then --build-arg-default")
+	buildCmd.Flags().StringArrayVar(&buildArgSecrets, "build-arg-secret", []string{}, "Add a build-arg for Docker with its value read from a file at build time, without showing it on the command line (KEY=@/path/to/file)")
+	buildCmd.Flags().BoolVar(&keepArgSpace, "keep-build-arg-whitespace", false, "Keep trailing whitespace and newlines in build-arg values, instead of removing them with a warning")
+	buildCmd.Flags().BoolVar(&expandArgs, "expand-build-args", false, "Resolve {{.Git.SHA}}, {{.Git.Branch}}, {{.Git.Describe}}, {{.Function.Name}}, {{.Env.NAME}} and ${NAME} in build-arg values, including build_args from the stack")
 	buildCmd.Flags().StringArrayVar(&buildFlags, "build-flags", []string{}, "Add a flags for Docker eg. --ssh or --secure")
 	buildCmd.Flags().StringArrayVarP(&buildOptions, "build-option", "o", []string{}, "Set a build option, e.g. dev")
 	buildCmd.Flags().Var(&tagFormat, "tag", "Override latest tag on function Docker image, accepts 'latest', 'sha', 'branch', or 'describe'")
+	buildCmd.Flags().BoolVar(&describeDirty, "describe-always-dirty", false, "With --tag describe, include the commit SHA even when on a tag, and add -dirty for uncommitted changes")
 	buildCmd.Flags().StringArrayVar(&buildLabels, "build-label", []string{}, "Add a label for Docker image (LABEL=VALUE)")
+	buildCmd.Flags().StringArrayVar(&labelFiles, "label-file", []string{}, "Read labels for the Docker image from a file of LABEL=VALUE lines, --build-label takes precedence")
+	buildCmd.Flags().BoolVar(&gitLabels, "git-labels", true, "Add the faas.git.branch, faas.git.sha and faas.git.describe labels when building from a Git repository")
+	buildCmd.Flags().BoolVar(&gitDirtyLabel, "label-git-dirty", true, "Add the faas.git.dirty label, true when building with uncommitted changes, when building from a Git repository")
+	buildCmd.Flags().StringArrayVar(&extraTags, "extra-tag", []string{}, "Additional extra image tag, applied alongside the tag from --tag")
+	buildCmd.Flags().StringArrayVar(&alsoTags, "also-tag", []string{}, "Additional image tag applied by the same build, where {branch} and {sha} are replaced from Git, e.g. {branch}-latest")
 	buildCmd.Flags().StringArrayVar(&copyExtra, "copy-extra", []string{}, "Extra paths that will be copied into the function build context")
+	buildCmd.Flags().StringArrayVar(&copyExtraScopes, "copy-extra-scope", []string{}, "Folders that extra paths may be copied from, defaults to the current directory, or the "+copyExtraScopeEnvironment+" environment variable as a list of paths")
+	buildCmd.Flags().StringArrayVar(&excludePaths, "exclude", []string{}, "Exclude a file or folder of the handler from the build context, relative to the handler and using glob syntax, e.g. fixtures or testdata/*.json")
 	buildCmd.Flags().BoolVar(&envsubst, "envsubst", true, "Substitute environment variables in stack.yml file")
 	buildCmd.Flags().BoolVar(&quietBuild, "quiet", false, "Perform a quiet build, without showing output from Docker")
 	buildCmd.Flags().BoolVar(&disableStackPull, "disable-stack-pull", false, "Disables the template configuration in the stack.yml")
+	buildCmd.Flags().BoolVar(&allowNoVCS, "allow-no-vcs", false, "Use the --fallback-version for the image tag when --tag needs Git, but this is not a Git repository")
+	buildCmd.Flags().StringVar(&fallbackVersion, "fallback-version", "", "Version used with --allow-no-vcs, defaults to the "+fallbackVersionEnvironment+" environment variable")
+	buildCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Print additional information about the build, such as the detected Docker version")
+	buildCmd.Flags().BoolVar(&printImageName, "print-image-name", false, "Print the image name that would be built for each function and exit")
+	buildCmd.Flags().BoolVar(&keepTemp, "keep-temp", false, "Keep temporary files, such as a handler cloned from a Git URL")
+	buildCmd.Flags().StringVar(&templateDir, "template-dir", "", "Folder to read language templates from instead of ./template, defaults to the "+templateDirEnvironment+" environment variable")
+	buildCmd.Flags().BoolVar(&noOverlay, "no-template-overlay", false, "Build from the handler alone, which must contain a Dockerfile, instead of overlaying it onto the language template")
+	buildCmd.Flags().StringVar(&handlerFolder, "handler-folder", "", "Override the folder the handler is copied into within the template, instead of the template's handler_folder")
+	buildCmd.Flags().BoolVar(&verifyTemplate, "verify-template", false, "Fail the build if the template does not match its checksum, see: faas-cli template checksum")
+	buildCmd.Flags().BoolVar(&strictTemplate, "strict-template", false, "Fail the build if the language in the template's template.yml does not match --lang, instead of printing a warning")
+	buildCmd.Flags().BoolVar(&checkRegistry, "check-registry", false, "Check that the registry accepts the stored docker login before building, so that a push does not fail after a long build")
 
 	// Set bash-completion.
 	_ = buildCmd.Flags().SetAnnotation("handler", cobra.BashCompSubdirsInDir, []string{})
@@ -73,29 +208,74 @@ var buildCmd = &cobra.Command{
                  --handler HANDLER_DIR
                  --name FUNCTION_NAME
                  [--lang <ruby|python|python3|node|csharp|dockerfile>]
-                 [--no-cache] [--squash]
+                 [--no-cache] [--squash] [--pull] [--compress]
+                 [--isolation <process|hyperv>]
+                 [--add-host HOST:IP]
+                 [--build-network NETWORK]
+                 [--docker-context CONTEXT]
+                 [--output type=oci,dest=PATH | --export-rootfs PATH]
+                 [--memory LIMIT] [--cpus CPUS]
+                 [--reproducible]
+                 [--scan [--fail-on SEVERITY] [--scan-required]]
+                 [--handlers-glob "PATTERN"]
                  [--regex "REGEX"]
                  [--filter "WILDCARD"]
-                 [--parallel PARALLEL_DEPTH]
+                 [--parallel PARALLEL_DEPTH] [--fail-fast]
+                 [--changed-only[=REF]]
+                 [--plan]
+                 [--on-success COMMAND]
+                 [--chdir DIR]
                  [--build-arg KEY=VALUE]
+                 [--build-arg-default KEY=VALUE]
+                 [--build-arg-secret KEY=@FILE]
                  [--build-option VALUE]
                  [--copy-extra PATH]
-                 [--tag <sha|branch|describe>]`,
+                 [--exclude PATTERN]
+                 [--tag <sha|branch|describe>]
+                 [--extra-tag TAG]
+                 [--also-tag PATTERN]
+                 [--allow-no-vcs --fallback-version VERSION]`,
 	Short: "Builds OpenFaaS function containers",
 	Long: `Builds OpenFaaS function containers either via the supplied YAML config using
 the "--yaml" flag (which may contain multiple function definitions), or directly
 via flags.`,
 	Example: `  faas-cli build -f https://domain/path/myfunctions.yml
   faas-cli build -f ./stack.yml --no-cache --build-arg NPM_VERSION=0.2.2
+  faas-cli build -f ./stack.yml --build-arg-secret NPM_TOKEN=@$HOME/.npm-token
+  faas-cli build -f ./stack.yml --expand-build-args --build-arg VERSION={{.Git.Describe}}
+  faas-cli build -f ./stack.yml --build-arg-default GO_VERSION=1.19
   faas-cli build -f ./stack.yml --build-option dev
   faas-cli build -f ./stack.yml --tag sha
   faas-cli build -f ./stack.yml --tag branch
   faas-cli build -f ./stack.yml --tag describe
+  faas-cli build -f ./stack.yml --tag sha --extra-tag latest
+  faas-cli build -f ./stack.yml --tag sha --print-image-name
+  faas-cli build -f ./stack.yml --offline --no-cache
+  faas-cli build -f ./stack.yml --check-registry
+  faas-cli build -f ./stack.yml --scan --fail-on high
+  faas-cli build -f ./stack.yml --output type=oci,dest=./fn.tar
+  faas-cli build -f ./stack.yml --filter fn --export-rootfs ./rootfs.tar
+  faas-cli build -f ./stack.yml --tag sha --allow-no-vcs --fallback-version 0.1.0
   faas-cli build -f ./stack.yml --filter "*gif*"
+  faas-cli build -f ./stack.yml --parallel 4 --fail-fast
+  faas-cli build -f ./stack.yml --changed-only=origin/master
+  faas-cli build -f ./stack.yml --plan
+  faas-cli build -f ./stack.yml --on-success 'echo $FAAS_IMAGE >> images.txt'
   faas-cli build -f ./stack.yml --regex "fn[0-9]_.*"
   faas-cli build --image=my_image --lang=python --handler=/path/to/fn/
                  --name=my_fn --squash
-  faas-cli build -f ./stack.yml --build-label org.label-schema.label-name="value"`,
+  faas-cli build -f ./stack.yml --squash --squash-mode best-effort
+  faas-cli build -f ./stack.yml --isolation process
+  faas-cli build -f ./stack.yml --add-host registry.internal:10.0.0.10
+  faas-cli build -f ./stack.yml --build-network host
+  faas-cli build -f ./stack.yml --docker-context remote-builder
+  faas-cli build -f ./stack.yml --template-dir ./infra/faas/template
+  faas-cli build --chdir ./services/billing -f stack.yml
+  faas-cli build --image=my_image --lang=python --name=my_fn
+                 --handler=https://github.com/org/fn.git#main
+  faas-cli build --lang=python3 --handlers-glob "./functions/*" --image=ghcr.io/org
+  faas-cli build -f ./stack.yml --build-label org.label-schema.label-name="value"
+  faas-cli build -f ./stack.yml --git-labels=false`,
 	PreRunE: preRunBuild,
 	RunE:    runBuild,
 }
@@ -104,21 +284,138 @@ via flags.`,
 func preRunBuild(cmd *cobra.Command, args []string) error {
 	language, _ = validateLanguageFlag(language)
 
-	mapped, err := parseBuildArgs(buildArgs)
+	// The function's build_flags and the template's no_cache and squash apply
+	// unless the flags are given
+	nocacheSet, squashSet = cmd.Flags().Changed("no-cache"), cmd.Flags().Changed("squash")
+	pullSet, compressSet = cmd.Flags().Changed("pull"), cmd.Flags().Changed("compress")
 
-	if err == nil {
-		buildArgMap = mapped
+	mapped, err := parseBuildArgs(buildArgs)
+	if err != nil {
+		return err
 	}
+	buildArgMap = mapped
 
-	buildLabelMap, err = parseMap(buildLabels, "build-label")
+	buildLabelMap, err = loadBuildLabels(labelFiles, buildLabels)
 
 	if parallel < 1 {
 		return fmt.Errorf("the --parallel flag must be great than 0")
 	}
 
+	annotations, annotationErr := parseMap(imageAnnotations, "image-annotation")
+	if annotationErr != nil {
+		return annotationErr
+	}
+	annotationMap = annotations
+
+	defaults, defaultsErr := parseBuildArgs(buildArgDefaults)
+	if defaultsErr != nil {
+		return fmt.Errorf("invalid --build-arg-default: %s", defaultsErr.Error())
+	}
+	argDefaultMap = defaults
+
+	secretMap, secretErr := parseBuildArgSecrets(buildArgSecrets)
+	if secretErr != nil {
+		return secretErr
+	}
+	buildSecretMap = secretMap
+
+	if len(templateDir) == 0 {
+		templateDir = os.Getenv(templateDirEnvironment)
+	}
+
+	if len(dockerBinary) == 0 {
+		dockerBinary = os.Getenv(dockerBinaryEnvironment)
+	}
+
+	if !shrinkwrap {
+		if err := builder.ValidateDockerBinary(dockerBinary); err != nil {
+			return err
+		}
+	}
+
+	if smokeTest && (smokePort < 1 || smokePort > 65535) {
+		return fmt.Errorf("--smoke-test-port must be between 1 and 65535, got: %d", smokePort)
+	}
+
+	if inlineCache && len(cacheDir) > 0 {
+		return fmt.Errorf("--inline-cache cannot be used with --cache-dir, choose one cache")
+	}
+
+	if len(copyExtraScopes) == 0 {
+		copyExtraScopes = filepath.SplitList(os.Getenv(copyExtraScopeEnvironment))
+	}
+
+	if err := builder.ValidateSquashMode(squashMode); err != nil {
+		return err
+	}
+
+	if err := builder.ValidateIsolation(isolation); err != nil {
+		return err
+	}
+
+	if err := builder.ValidateAddHosts(addHosts); err != nil {
+		return err
+	}
+
+	if err := builder.ValidateBuildResources(buildMemory, buildCPUs); err != nil {
+		return err
+	}
+
+	if err := builder.ValidateUlimits(ulimits); err != nil {
+		return err
+	}
+
+	if err := builder.ValidateExcludePaths(excludePaths); err != nil {
+		return err
+	}
+
+	if err := builder.ValidateShrinkWrapCompression(shrinkwrapComp); err != nil {
+		return err
+	}
+
+	if shrinkwrapTar && !shrinkwrap {
+		return fmt.Errorf("the --shrinkwrap-tar flag requires --shrinkwrap")
+	}
+
+	if contextStdin && (shrinkwrap || planBuild) {
+		return fmt.Errorf("the --context-from-stdin flag cannot be used with --shrinkwrap or --plan")
+	}
+
+	if printCtxHash && (shrinkwrap || planBuild || contextStdin) {
+		return fmt.Errorf("the --print-context-hash flag cannot be used with --shrinkwrap, --plan or --context-from-stdin")
+	}
+
+	if (len(scanFailOn) > 0 || scanRequired) && !scanBuild {
+		return fmt.Errorf("the --fail-on and --scan-required flags require --scan")
+	}
+
+	if len(scanFailOn) > 0 {
+		if err := builder.ValidateSeverity(scanFailOn); err != nil {
+			return err
+		}
+	}
+
+	if fallbackErr := resolveFallbackVersion(); fallbackErr != nil {
+		return fallbackErr
+	}
+
 	return err
 }
 
+// resolveFallbackVersion reads --fallback-version from its environment variable
+// when the flag is not given, and checks that one is set for --allow-no-vcs
+func resolveFallbackVersion() error {
+	if len(fallbackVersion) == 0 {
+		fallbackVersion = os.Getenv(fallbackVersionEnvironment)
+	}
+
+	if allowNoVCS && len(fallbackVersion) == 0 {
+		return fmt.Errorf("the --allow-no-vcs flag requires --fallback-version or %s to be set", fallbackVersionEnvironment)
+	}
+
+	return nil
+}
+
 func parseBuildArgs(args []string) (map[string]string, error) {
 	mapped := make(map[string]string)
 
@@ -150,11 +447,82 @@ func parseBuildArgs(args []string) (map[string]string, error) {
 	return mapped, nil
 }
 
+// parseBuildArgSecrets parses each KEY=@/path/to/file into a map of build-arg name
+// to the file which holds its value
+func parseBuildArgSecrets(args []string) (map[string]string, error) {
+	mapped := make(map[string]string)
+
+	for _, kvp := range args {
+		index := strings.Index(kvp, "=")
+		if index == -1 || !strings.HasPrefix(kvp[index+1:], "@") {
+			return nil, fmt.Errorf("each build-arg-secret must take the form KEY=@/path/to/file")
+		}
+
+		k := strings.TrimSpace(kvp[:index])
+		file := strings.TrimSpace(kvp[index+2:])
+
+		if len(k) == 0 {
+			return nil, fmt.Errorf("build-arg-secret must have a non-empty key")
+		}
+		if len(file) == 0 {
+			return nil, fmt.Errorf("build-arg-secret %s must have a non-empty file path", k)
+		}
+
+		mapped[k] = file
+	}
+
+	return mapped, nil
+}
+
+// mergeBuildArgs merges the build_args from a function's stack definition with those
+// given via flags, flags take precedence except for ADDITIONAL_PACKAGE, where the
+// packages from both are combined
+func mergeBuildArgs(stackArgs map[string]string, flagArgs map[string]string) map[string]string {
+	merged := mergeMap(stackArgs, flagArgs)
+
+	stackPackages := stackArgs[builder.AdditionalPackageBuildArg]
+	flagPackages := flagArgs[builder.AdditionalPackageBuildArg]
+	if len(stackPackages) > 0 && len(flagPackages) > 0 {
+		merged[builder.AdditionalPackageBuildArg] = stackPackages + " " + flagPackages
+	}
+
+	return merged
+}
+
+// mergeFunctionBuildFlags returns config with the build_flags of a function's stack
+// definition applied. A scalar, such as squash, applies unless its flag was given,
+// and then takes precedence over the template. The flags of the function are
+// passed to docker build before those given via --build-flags, without duplicates.
+func mergeFunctionBuildFlags(config builder.BuildImageConfig, flags *stack.FunctionBuildFlags) builder.BuildImageConfig {
+	if flags == nil {
+		return config
+	}
+
+	if flags.NoCache != nil && !nocacheSet {
+		config.NoCache, config.NoCacheSet = *flags.NoCache, true
+	}
+	if flags.Squash != nil && !squashSet {
+		config.Squash, config.SquashSet = *flags.Squash, true
+	}
+	if flags.Pull != nil && !pullSet {
+		config.Pull = *flags.Pull
+	}
+	if flags.Compress != nil && !compressSet {
+		config.Compress = *flags.Compress
+	}
+
+	if len(flags.Flags) > 0 {
+		config.BuildFlags = mergeSlice(config.BuildFlags, flags.Flags)
+	}
+
+	return config
+}
+
 func runBuild(cmd *cobra.Command, args []string) error {
 
 	var services stack.Services
-	if len(yamlFile) > 0 {
-		parsedServices, err := stack.ParseYAMLFile(yamlFile, regex, filter, envsubst)
+	if stackFile := stackFileInWorkingDir(yamlFile); len(stackFile) > 0 {
+		parsedServices, err := stack.ParseYAMLFile(stackFile, regex, filter, envsubst)
 		if err != nil {
 			return err
 		}
@@ -164,47 +532,83 @@ func runBuild(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	templateAddress := getTemplateURL("", os.Getenv(templateURLEnvironment), DefaultTemplateRepository)
-	if pullErr := PullTemplates(templateAddress); pullErr != nil {
-		return fmt.Errorf("could not pull templates for OpenFaaS: %v", pullErr)
+	if len(services.Functions) == 0 && len(handlersGlob) > 0 {
+		functions, err := discoverHandlers(handlersGlob, language, image)
+		if err != nil {
+			return err
+		}
+		services.Functions = functions
+	}
+
+	if printImageName {
+		return printImageNames(cmd.OutOrStdout(), services)
+	}
+
+	// Templates are only pulled into the default folder of the current directory,
+	// and are not needed for a build context from stdin, or pulled when offline
+	if len(templateDir) == 0 && len(chdir) == 0 && !contextStdin && !offline {
+		templateAddress := getTemplateURL("", os.Getenv(templateURLEnvironment), DefaultTemplateRepository)
+		if pullErr := PullTemplates(templateAddress); pullErr != nil {
+			return fmt.Errorf("could not pull templates for OpenFaaS: %v", pullErr)
+		}
 	}
 
 	if len(services.Functions) == 0 {
 		if len(image) == 0 {
 			return fmt.Errorf("please provide a valid --image name for your Docker image")
 		}
-		if len(handler) == 0 {
+		if len(handler) == 0 && !contextStdin {
 			return fmt.Errorf("please provide the full path to your function's handler")
 		}
 		if len(functionName) == 0 {
 			return fmt.Errorf("please provide the deployed --name of your function")
 		}
 
-		err := builder.BuildImage(
-			builder.BuildImageConfig{
-				Image:          image,
-				Handler:        handler,
-				FunctionName:   functionName,
-				Language:       language,
-				NoCache:        nocache,
-				Squash:         squash,
-				ShrinkWrap:     shrinkwrap,
-				BuildArgMap:    buildArgMap,
-				BuildFlags:     buildFlags,
-				BuildOptions:   buildOptions,
-				TagMode:        tagFormat,
-				BuildLabelMap:  buildLabelMap,
-				QuiteBuild:     quietBuild,
-				CopyExtraPaths: copyExtra,
-			},
-		)
+		if failUnpinned && !contextStdin {
+			if err := checkTemplatePinned(pinnedTemplateDir(), services.StackConfiguration.TemplateRevision); err != nil {
+				return err
+			}
+		}
+
+		config := flagBuildConfig()
+		if contextStdin {
+			config.ContextReader = cmd.InOrStdin()
+		}
+		if planBuild {
+			return printBuildPlan(cmd.OutOrStdout(), []builder.BuildImageConfig{config}, nil)
+		}
+		if printCtxHash {
+			return printContextHashes(cmd.OutOrStdout(), []builder.BuildImageConfig{config})
+		}
+
+		ctx, stop := interruptContext()
+		defer stop()
+		config.Context = ctx
+
+		err := builder.BuildImage(config)
+		if ctx.Err() != nil {
+			return errBuildInterrupted
+		}
 		if err != nil {
 			return err
 		}
 		return nil
 	}
 
-	if len(services.StackConfiguration.TemplateConfigs) != 0 && !disableStackPull {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if contextStdin {
+		if err := buildFromStdin(ctx, cmd.InOrStdin(), &services); err != nil {
+			if ctx.Err() != nil {
+				return errBuildInterrupted
+			}
+			return err
+		}
+		return nil
+	}
+
+	if len(services.StackConfiguration.TemplateConfigs) != 0 && !disableStackPull && len(templateDir) == 0 && len(chdir) == 0 && !offline {
 		newTemplateInfos, err := filterExistingTemplates(services.StackConfiguration.TemplateConfigs, "./template")
 		if err != nil {
 			return fmt.Errorf("already pulled templates directory has issue: %s", err.Error())
@@ -216,89 +620,323 @@ func runBuild(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	errors := build(&services, parallel, shrinkwrap, quietBuild)
-	if len(errors) > 0 {
-		errorSummary := "Errors received during build:\n"
-		for _, err := range errors {
-			errorSummary = errorSummary + "- " + err.Error() + "\n"
+	if failUnpinned {
+		if err := checkTemplatePinned(pinnedTemplateDir(), services.StackConfiguration.TemplateRevision); err != nil {
+			return err
 		}
-		return fmt.Errorf("%s", aec.Apply(errorSummary, aec.RedF))
+	}
+
+	if planBuild {
+		return printStackBuildPlan(cmd.OutOrStdout(), &services)
+	}
+
+	if printCtxHash {
+		return printStackContextHashes(cmd.OutOrStdout(), &services)
+	}
+
+	if err := build(ctx, &services, parallel, failFast, shrinkwrap, quietBuild); err != nil {
+		return fmt.Errorf("%s", aec.Apply(err.Error(), aec.RedF))
 	}
 	return nil
 }
 
-func build(services *stack.Services, queueDepth int, shrinkwrap, quietBuild bool) []error {
+// build builds each of the functions selected from services, the functions not
+// yet started are skipped once ctx is cancelled
+func build(ctx context.Context, services *stack.Services, queueDepth int, failFast, shrinkwrap, quietBuild bool) error {
 	startOuter := time.Now()
 
-	errors := []error{}
-
-	wg := sync.WaitGroup{}
-
-	workChannel := make(chan stack.Function)
-
-	wg.Add(queueDepth)
-	for i := 0; i < queueDepth; i++ {
-		go func(index int) {
-			for function := range workChannel {
-				start := time.Now()
-
-				fmt.Printf(aec.YellowF.Apply("[%d] > Building %s.\n"), index, function.Name)
-				if len(function.Language) == 0 {
-					fmt.Println("Please provide a valid language for your function.")
-				} else {
-					combinedBuildOptions := combineBuildOpts(function.BuildOptions, buildOptions)
-					combinedBuildArgMap := mergeMap(function.BuildArgs, buildArgMap)
-					combinedExtraPaths := mergeSlice(services.StackConfiguration.CopyExtraPaths, copyExtra)
-					err := builder.BuildImage(
-						builder.BuildImageConfig{
-							Image:          function.Image,
-							Handler:        function.Handler,
-							FunctionName:   function.Name,
-							Language:       function.Language,
-							NoCache:        nocache,
-							Squash:         squash,
-							ShrinkWrap:     shrinkwrap,
-							BuildArgMap:    combinedBuildArgMap,
-							BuildFlags:     buildFlags,
-							BuildOptions:   combinedBuildOptions,
-							TagMode:        tagFormat,
-							BuildLabelMap:  buildLabelMap,
-							QuiteBuild:     quietBuild,
-							CopyExtraPaths: combinedExtraPaths,
-						},
-					)
-
-					if err != nil {
-						errors = append(errors, err)
-					}
-				}
-
-				duration := time.Since(start)
-				fmt.Printf(aec.YellowF.Apply("[%d] < Building %s done in %1.2fs.\n"), index, function.Name, duration.Seconds())
-			}
+	functions, skipped, err := selectBuildFunctions(services)
+	if err != nil {
+		return err
+	}
 
-			fmt.Printf(aec.YellowF.Apply("[%d] Worker done.\n"), index)
-			wg.Done()
-		}(i)
+	for _, name := range sortedSkipped(skipped) {
+		if reason := skipped[name]; len(reason) > 0 {
+			fmt.Printf("Skipping build of: %s, %s.\n", name, reason)
+		} else {
+			fmt.Printf("Skipping build of: %s.\n", name)
+		}
+	}
+
+	err = runStackBuild(functions, queueDepth, failFast, func(function stack.Function) error {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		start := time.Now()
+
+		fmt.Printf(aec.YellowF.Apply("> Building %s.\n"), function.Name)
+		defer func() {
+			duration := time.Since(start)
+			fmt.Printf(aec.YellowF.Apply("< Building %s done in %1.2fs.\n"), function.Name, duration.Seconds())
+		}()
+
+		if len(function.Language) == 0 {
+			fmt.Println("Please provide a valid language for your function.")
+			return nil
+		}
+
+		config := stackBuildConfig(services, function)
+		config.ShrinkWrap, config.QuiteBuild = shrinkwrap, quietBuild
+		config.Context = ctx
+
+		return builder.BuildImage(config)
+	})
+
+	duration := time.Since(startOuter)
+	fmt.Printf("\n%s\n", aec.Apply(fmt.Sprintf("Total build time: %1.2fs", duration.Seconds()), aec.YellowF))
+
+	if ctx.Err() != nil {
+		return errBuildInterrupted
+	}
+	return err
+}
+
+// buildFromStdin builds the one function selected from services with the tar of
+// its build context read from in
+func buildFromStdin(ctx context.Context, in io.Reader, services *stack.Services) error {
+	functions, _, err := selectBuildFunctions(services)
+	if err != nil {
+		return err
+	}
 
+	if len(functions) != 1 {
+		names := []string{}
+		for _, function := range functions {
+			names = append(names, function.Name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("the --context-from-stdin flag builds a single function, use --filter to select one of: %s", strings.Join(names, ", "))
 	}
 
+	config := stackBuildConfig(services, functions[0])
+	config.QuiteBuild = quietBuild
+	config.ContextReader = in
+	config.Context = ctx
+
+	return builder.BuildImage(config)
+}
+
+// flagBuildConfig returns the BuildImageConfig for a single function given by flags
+func flagBuildConfig() builder.BuildImageConfig {
+	return builder.BuildImageConfig{
+		Image:                  image,
+		Handler:                handler,
+		FunctionName:           functionName,
+		Language:               language,
+		NoCache:                nocache,
+		Squash:                 squash,
+		ShrinkWrap:             shrinkwrap,
+		ShrinkWrapTar:          shrinkwrapTar,
+		ShrinkWrapCompression:  shrinkwrapComp,
+		BuildArgMap:            buildArgMap,
+		BuildArgSecrets:        buildSecretMap,
+		KeepBuildArgWhitespace: keepArgSpace,
+		ExpandBuildArgs:        expandArgs,
+		BuildFlags:             buildFlags,
+		BuildOptions:           buildOptions,
+		TagMode:                tagFormat,
+		DescribeAlwaysDirty:    describeDirty,
+		BuildLabelMap:          buildLabelMap,
+		QuiteBuild:             quietBuild,
+		CopyExtraPaths:         copyExtra,
+		CopyExtraScopes:        copyExtraScopes,
+		ExcludePaths:           excludePaths,
+		AllowNoVCS:             allowNoVCS,
+		FallbackVersion:        fallbackVersion,
+		Verbose:                verbose,
+		KeepTemp:               keepTemp,
+		Pull:                   pull,
+		Compress:               compress,
+		Output:                 buildOutput,
+		BuildMemory:            buildMemory,
+		BuildCPUs:              buildCPUs,
+		ExportRootFS:           exportRootFS,
+		Reproducible:           reproducible,
+		NoTemplateOverlay:      noOverlay,
+		Isolation:              isolation,
+		AddHosts:               addHosts,
+		BuildNetwork:           buildNetwork,
+		TemplateDir:            templateDir,
+		HandlerFolderOverride:  handlerFolder,
+		GitLabels:              gitLabels,
+		GitDirtyLabel:          gitDirtyLabel,
+		OnSuccess:              successHandler(),
+		WorkingDir:             chdir,
+		VerifyCopies:           verifyCopies,
+		DockerContext:          dockerContext,
+		Scan:                   scanBuild,
+		ScanFailOn:             scanFailOn,
+		ScanRequired:           scanRequired,
+		NoClear:                noClear,
+		NoCacheSet:             nocacheSet,
+		SquashSet:              squashSet,
+		Annotations:            annotationMap,
+		Ulimits:                ulimits,
+		CacheDir:               cacheDir,
+		InlineCache:            inlineCache,
+		SmokeTest:              smokeTest,
+		SmokeTestPort:          smokePort,
+		SmokeTestPath:          smokePath,
+		SmokeTestTimeout:       smokeTimeout,
+		DockerBinary:           dockerBinary,
+		BuildArgDefaults:       argDefaultMap,
+		FreezeBaseImages:       freezeBase,
+		CheckRegistry:          checkRegistry,
+		VerifyTemplate:         verifyTemplate,
+		StrictTemplate:         strictTemplate,
+		ExtraTags:              extraTags,
+		AlsoTags:               alsoTags,
+		SkipProxy:              noProxyForward,
+		Offline:                offline,
+		SquashMode:             squashMode,
+	}
+}
+
+// stackFileInWorkingDir returns the path to a local stack file within --chdir, or
+// the default stack file of --chdir when no file is given
+func stackFileInWorkingDir(file string) string {
+	if len(chdir) == 0 || filepath.IsAbs(file) || strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://") {
+		return file
+	}
+
+	if len(file) == 0 {
+		if _, err := stat(filepath.Join(chdir, defaultYAML)); err != nil {
+			return ""
+		}
+		file = defaultYAML
+	}
+	return filepath.Join(chdir, file)
+}
+
+// successHandler returns the handler for --on-success, or nil to print that the
+// image was built
+func successHandler() func(ctx context.Context, result builder.BuildResult) error {
+	if len(onSuccess) == 0 {
+		return nil
+	}
+	return builder.SuccessCommand(onSuccess, quietBuild)
+}
+
+// selectBuildFunctions returns the functions of the stack to build, ordered by name,
+// and the functions which are skipped, with the reason when --changed-only is set
+func selectBuildFunctions(services *stack.Services) ([]stack.Function, map[string]string, error) {
+	var affected map[string]bool
+	if len(changedOnly) > 0 {
+		repoDir := chdir
+		if len(repoDir) == 0 {
+			repoDir = "."
+		}
+		changedFiles, err := versioncontrol.GetChangedFilesIn(repoDir, changedOnly)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		dir := templateDir
+		if len(dir) == 0 {
+			dir = stack.DefaultTemplateDir
+		}
+		extraPaths := mergeSlice(services.StackConfiguration.CopyExtraPaths, copyExtra)
+		affected = changedFunctions(services.Functions, changedFiles, chdir, dir, extraPaths)
+	}
+
+	functions := []stack.Function{}
+	skipped := map[string]string{}
 	for k, function := range services.Functions {
 		if function.SkipBuild {
-			fmt.Printf("Skipping build of: %s.\n", function.Name)
+			skipped[k] = ""
+		} else if affected != nil && !affected[k] {
+			skipped[k] = fmt.Sprintf("no changes since %s", changedOnly)
 		} else {
 			function.Name = k
-			workChannel <- function
+			functions = append(functions, function)
 		}
 	}
 
-	close(workChannel)
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
 
-	wg.Wait()
+	return functions, skipped, nil
+}
 
-	duration := time.Since(startOuter)
-	fmt.Printf("\n%s\n", aec.Apply(fmt.Sprintf("Total build time: %1.2fs", duration.Seconds()), aec.YellowF))
-	return errors
+// sortedSkipped returns the names of the skipped functions in order
+func sortedSkipped(skipped map[string]string) []string {
+	names := make([]string, 0, len(skipped))
+	for name := range skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stackBuildConfig returns the configuration to build function from the stack,
+// which is that of the flags with the function's image, handler and language, and
+// its build options, build-args and extra paths combined with those of the flags
+func stackBuildConfig(services *stack.Services, function stack.Function) builder.BuildImageConfig {
+	config := flagBuildConfig()
+
+	config.Image = function.Image
+	config.Handler = function.Handler
+	config.FunctionName = function.Name
+	config.Language = function.Language
+	config.BuildArgMap = mergeBuildArgs(function.BuildArgs, buildArgMap)
+	config.BuildOptions = combineBuildOpts(function.BuildOptions, buildOptions)
+	config.CopyExtraPaths = mergeSlice(services.StackConfiguration.CopyExtraPaths, copyExtra)
+	config.PreBuild = function.PreBuild
+	config.PostBuild = function.PostBuild
+	config.DockerfileOverlay = function.DockerfileOverlay
+
+	return mergeFunctionBuildFlags(config, function.BuildFlags)
+}
+
+// printImageNames prints the image name that would be built for each function in
+// the stack, ordered by function name, or for the --image flag without a stack
+func printImageNames(w io.Writer, services stack.Services) error {
+	if len(services.Functions) == 0 {
+		if len(image) == 0 {
+			return fmt.Errorf("please provide a valid --image name for your Docker image")
+		}
+
+		imageName, err := builder.ResolveImageName(builder.BuildImageConfig{
+			Image:               image,
+			TagMode:             tagFormat,
+			DescribeAlwaysDirty: describeDirty,
+			AllowNoVCS:          allowNoVCS,
+			FallbackVersion:     fallbackVersion,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, imageName)
+		return nil
+	}
+
+	names := []string{}
+	for name, function := range services.Functions {
+		if !function.SkipBuild {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		imageName, err := builder.ResolveImageName(builder.BuildImageConfig{
+			Image:               services.Functions[name].Image,
+			TagMode:             tagFormat,
+			DescribeAlwaysDirty: describeDirty,
+			AllowNoVCS:          allowNoVCS,
+			FallbackVersion:     fallbackVersion,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, imageName)
+	}
+
+	return nil
 }
 
 // PullTemplates pulls templates from specified git remote. templateURL may be a pinned repository.
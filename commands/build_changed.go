@@ -0,0 +1,77 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+// changedFunctions returns the names of the functions affected by the changed files.
+// A function is affected when a file changes within its handler, its language
+// template or any of the extraPaths copied into every build context. The changed
+// files are absolute paths, as per versioncontrol.GetChangedFilesIn, while the
+// handlers, templateDir and extraPaths are relative to workingDir, i.e. --chdir.
+func changedFunctions(functions map[string]stack.Function, changedFiles []string, workingDir, templateDir string, extraPaths []string) map[string]bool {
+	changed := map[string]bool{}
+
+	for _, extraPath := range extraPaths {
+		if anyFileWithin(changedFiles, changedPath(workingDir, extraPath)) {
+			for name := range functions {
+				changed[name] = true
+			}
+			return changed
+		}
+	}
+
+	for name, function := range functions {
+		if anyFileWithin(changedFiles, changedPath(workingDir, function.Handler)) {
+			changed[name] = true
+			continue
+		}
+
+		if languageExistsNotDockerfile(function.Language) && anyFileWithin(changedFiles, changedPath(workingDir, path.Join(templateDir, strings.ToLower(function.Language)))) {
+			changed[name] = true
+		}
+	}
+
+	return changed
+}
+
+// changedPath returns p as an absolute path, relative to workingDir unless it is
+// already absolute. Symlinks are resolved when p exists, as Git gives the real
+// path of the repository.
+func changedPath(workingDir, p string) string {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(workingDir, filepath.FromSlash(p))
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.Clean(p)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+// anyFileWithin returns true when any of files is dir, or is within dir, both are
+// absolute paths
+func anyFileWithin(files []string, dir string) bool {
+	prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if file == dir || strings.HasPrefix(file, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,177 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+func Test_changedFunctions(t *testing.T) {
+	functions := map[string]stack.Function{
+		"api":     {Handler: "./api", Language: "golang-middleware"},
+		"api-v2":  {Handler: "./api-v2", Language: "golang-middleware"},
+		"resizer": {Handler: "./functions/resizer", Language: "python3"},
+		"legacy":  {Handler: "./legacy", Language: "dockerfile"},
+	}
+
+	cases := []struct {
+		name         string
+		changedFiles []string
+		extraPaths   []string
+		want         map[string]bool
+	}{
+		{
+			name:         "no changes",
+			changedFiles: []string{},
+			want:         map[string]bool{},
+		},
+		{
+			name:         "handler file",
+			changedFiles: []string{"api/handler.go"},
+			want:         map[string]bool{"api": true},
+		},
+		{
+			name:         "handler prefix does not match a sibling folder",
+			changedFiles: []string{"api-v2/handler.go"},
+			want:         map[string]bool{"api-v2": true},
+		},
+		{
+			name:         "nested handler",
+			changedFiles: []string{"functions/resizer/requirements.txt", "README.md"},
+			want:         map[string]bool{"resizer": true},
+		},
+		{
+			name:         "shared template",
+			changedFiles: []string{"template/golang-middleware/main.go"},
+			want:         map[string]bool{"api": true, "api-v2": true},
+		},
+		{
+			name:         "dockerfile function ignores templates",
+			changedFiles: []string{"template/dockerfile/Dockerfile", "legacy/Dockerfile"},
+			want:         map[string]bool{"legacy": true},
+		},
+		{
+			name:         "copied extra path rebuilds every function",
+			changedFiles: []string{"common/utils.go"},
+			extraPaths:   []string{"common"},
+			want:         map[string]bool{"api": true, "api-v2": true, "resizer": true, "legacy": true},
+		},
+		{
+			name:         "unrelated files",
+			changedFiles: []string{"stack.yml", "docs/index.md", "apis/readme.md"},
+			extraPaths:   []string{"common"},
+			want:         map[string]bool{},
+		},
+	}
+
+	root := t.TempDir()
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := changedFunctions(functions, inRoot(root, tc.changedFiles...), root, "./template", tc.extraPaths)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_changedFunctions_TemplateDir(t *testing.T) {
+	functions := map[string]stack.Function{
+		"api": {Handler: "./api", Language: "Golang-Middleware"},
+	}
+
+	root := t.TempDir()
+
+	got := changedFunctions(functions, inRoot(root, "infra/faas/template/golang-middleware/go.mod"), root, "infra/faas/template", nil)
+	if !got["api"] {
+		t.Errorf("want api to be affected by a change to its template, got %v", got)
+	}
+
+	got = changedFunctions(functions, inRoot(root, "template/golang-middleware/go.mod"), root, "infra/faas/template", nil)
+	if got["api"] {
+		t.Errorf("want api to be unaffected by the default template folder, got %v", got)
+	}
+
+	absolute := filepath.Join(root, "infra", "faas", "template")
+	got = changedFunctions(functions, inRoot(root, "infra/faas/template/golang-middleware/go.mod"), filepath.Join(root, "services"), absolute, nil)
+	if !got["api"] {
+		t.Errorf("want api to be affected by a change to an absolute template folder, got %v", got)
+	}
+}
+
+func Test_selectBuildFunctions_ChangedOnlyWithChdir(t *testing.T) {
+	if _, err := osexec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	root := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	for _, dir := range []string{"services/billing/invoice", "services/billing/refund"} {
+		if err := os.MkdirAll(filepath.FromSlash(dir), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(filepath.FromSlash(dir), "handler.go"), []byte("package function\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.email=test@example.com", "-c", "user.name=test", "commit", "--quiet", "-m", "initial"},
+	} {
+		if out, err := osexec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join("services", "billing", "invoice", "handler.go"), []byte("package function // changed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	origChdir, origChanged := chdir, changedOnly
+	chdir, changedOnly = filepath.Join("services", "billing"), "HEAD"
+	defer func() {
+		chdir, changedOnly = origChdir, origChanged
+	}()
+
+	services := &stack.Services{Functions: map[string]stack.Function{
+		"invoice": {Handler: "./invoice", Language: "dockerfile"},
+		"refund":  {Handler: "./refund", Language: "dockerfile"},
+	}}
+
+	functions, skipped, err := selectBuildFunctions(services)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(functions) != 1 || functions[0].Name != "invoice" {
+		t.Errorf("want only invoice to be built, got %v", functions)
+	}
+	if _, ok := skipped["refund"]; !ok {
+		t.Errorf("want refund to be skipped, got %v", skipped)
+	}
+}
+
+// inRoot returns each of files within root
+func inRoot(root string, files ...string) []string {
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, filepath.Join(root, filepath.FromSlash(file)))
+	}
+	return paths
+}
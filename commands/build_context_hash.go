@@ -0,0 +1,50 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/openfaas/faas-cli/builder"
+	"github.com/openfaas/faas-cli/stack"
+)
+
+// printStackContextHashes prints the context hash of each function within services,
+// as selected by --filter, --regex and --changed-only
+func printStackContextHashes(w io.Writer, services *stack.Services) error {
+	functions, _, err := selectBuildFunctions(services)
+	if err != nil {
+		return err
+	}
+
+	configs := []builder.BuildImageConfig{}
+	for _, function := range functions {
+		if len(function.Language) == 0 {
+			continue
+		}
+		configs = append(configs, stackBuildConfig(services, function))
+	}
+
+	return printContextHashes(w, configs)
+}
+
+// printContextHashes stages the build context of each of configs and prints its
+// function name and hash, ordered by function name
+func printContextHashes(w io.Writer, configs []builder.BuildImageConfig) error {
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].FunctionName < configs[j].FunctionName
+	})
+
+	for _, config := range configs {
+		hash, err := builder.ContextHash(config)
+		if err != nil {
+			return fmt.Errorf("unable to hash the build context of %s: %s", config.FunctionName, err.Error())
+		}
+		fmt.Fprintf(w, "%s %s\n", config.FunctionName, hash)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// errBuildInterrupted is returned by faas-cli build after SIGINT or SIGTERM
+var errBuildInterrupted = fmt.Errorf("the build was interrupted, run faas-cli build again to complete it")
+
+// interruptSignals are the signals which stop a build
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// interruptContext returns a context which is cancelled on the first of the
+// interruptSignals, so that running builds are stopped and their build contexts
+// removed. The default handlers are restored after the first signal, so a second
+// Ctrl+C exits straight away. The returned function stops listening for signals.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, interruptSignals...)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			signal.Stop(signals)
+			fmt.Printf("\nReceived %s, stopping the build and removing its build context, press Ctrl+C again to exit now.\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+func Test_interruptContext_CancelledBySignal(t *testing.T) {
+	ctx, stop := interruptContext()
+	defer stop()
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Skipf("unable to send an interrupt: %s", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("want the context to be cancelled by the interrupt")
+	}
+}
+
+func Test_interruptContext_StopCancels(t *testing.T) {
+	ctx, stop := interruptContext()
+	stop()
+
+	if ctx.Err() == nil {
+		t.Error("want the context to be cancelled once stopped")
+	}
+}
+
+func Test_build_InterruptedSkipsFunctions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	services := stack.Services{
+		Functions: map[string]stack.Function{
+			"fn1": {Name: "fn1", Language: "missing-lang", Handler: "./fn1", Image: "fn1"},
+			"fn2": {Name: "fn2", Language: "missing-lang", Handler: "./fn2", Image: "fn2"},
+		},
+	}
+
+	err := build(ctx, &services, 1, false, false, true)
+	if err != errBuildInterrupted {
+		t.Errorf("want error %q, got %v", errBuildInterrupted, err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/openfaas/faas-cli/stack"
+	"github.com/openfaas/faas-cli/versioncontrol"
+)
+
+// templateGitState returns the commit the template folder is checked out at and
+// whether it has uncommitted changes, it can be replaced in tests
+var templateGitState = func(dir string) (revision string, dirty bool, err error) {
+	revision, err = versioncontrol.GetGitRevisionIn(dir)
+	if err != nil {
+		return "", false, err
+	}
+
+	dirty, err = versioncontrol.IsGitDirtyIn(dir)
+	return revision, dirty, err
+}
+
+// pinnedTemplateDir returns the template folder used by the build, within --chdir
+// when it is set
+func pinnedTemplateDir() string {
+	dir := templateDir
+	if len(dir) == 0 {
+		dir = stack.DefaultTemplateDir
+	}
+
+	if len(chdir) > 0 && !filepath.IsAbs(dir) {
+		return filepath.Join(chdir, dir)
+	}
+	return dir
+}
+
+// checkTemplatePinned returns an error unless the template folder dir is within a
+// git checkout, such as a submodule, without uncommitted changes. When expected is
+// set, the checkout must also be at that revision, a short SHA is accepted.
+func checkTemplatePinned(dir, expected string) error {
+	revision, dirty, err := templateGitState(dir)
+	if err != nil {
+		return fmt.Errorf("unable to check the templates in %s are pinned, they must be a git checkout: %s", dir, err.Error())
+	}
+
+	if dirty {
+		return fmt.Errorf("the templates in %s have uncommitted changes, commit or revert them before building", dir)
+	}
+
+	if len(expected) > 0 && !strings.HasPrefix(revision, strings.ToLower(strings.TrimSpace(expected))) {
+		return fmt.Errorf("the templates in %s are at revision %s, but the stack file expects %s", dir, revision, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func stubTemplateGitState(t *testing.T, revision string, dirty bool, err error) {
+	orig := templateGitState
+	templateGitState = func(dir string) (string, bool, error) {
+		return revision, dirty, err
+	}
+	t.Cleanup(func() { templateGitState = orig })
+}
+
+func Test_checkTemplatePinned(t *testing.T) {
+	const revision = "3f5c1a9d2e8b7c6a5f4e3d2c1b0a998877665544"
+
+	cases := []struct {
+		name     string
+		revision string
+		dirty    bool
+		err      error
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "pinned without an expected revision",
+			revision: revision,
+		},
+		{
+			name:     "pinned at the expected revision",
+			revision: revision,
+			expected: revision,
+		},
+		{
+			name:     "pinned at the expected short revision",
+			revision: revision,
+			expected: "3F5C1A9",
+		},
+		{
+			name:     "uncommitted changes",
+			revision: revision,
+			dirty:    true,
+			wantErr:  "the templates in template have uncommitted changes, commit or revert them before building",
+		},
+		{
+			name:     "mismatched revision",
+			revision: revision,
+			expected: "0123456",
+			wantErr:  "the templates in template are at revision " + revision + ", but the stack file expects 0123456",
+		},
+		{
+			name:    "not a git checkout",
+			err:     fmt.Errorf("not a git repository"),
+			wantErr: "unable to check the templates in template are pinned, they must be a git checkout: not a git repository",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stubTemplateGitState(t, tc.revision, tc.dirty, tc.err)
+
+			err := checkTemplatePinned("template", tc.expected)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("want no error, got: %s", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("want error %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_pinnedTemplateDir(t *testing.T) {
+	origTemplateDir, origChdir := templateDir, chdir
+	defer func() { templateDir, chdir = origTemplateDir, origChdir }()
+
+	cases := []struct {
+		templateDir string
+		chdir       string
+		want        string
+	}{
+		{want: "./template"},
+		{templateDir: "./templates", want: "./templates"},
+		{chdir: "services", want: filepath.Join("services", "template")},
+		{templateDir: "/opt/templates", chdir: "services", want: "/opt/templates"},
+	}
+
+	for _, tc := range cases {
+		templateDir, chdir = tc.templateDir, tc.chdir
+		if got := pinnedTemplateDir(); got != tc.want {
+			t.Errorf("templateDir %q, chdir %q: want %q, got %q", tc.templateDir, tc.chdir, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/openfaas/faas-cli/builder"
+	"github.com/openfaas/faas-cli/stack"
+)
+
+// printStackBuildPlan prints the build plan of each function within services, as
+// selected by --filter, --regex and --changed-only, with the reason for any skipped
+func printStackBuildPlan(w io.Writer, services *stack.Services) error {
+	functions, skipped, err := selectBuildFunctions(services)
+	if err != nil {
+		return err
+	}
+
+	configs := []builder.BuildImageConfig{}
+	for _, function := range functions {
+		if len(function.Language) == 0 {
+			skipped[function.Name] = "no language given"
+			continue
+		}
+		configs = append(configs, stackBuildConfig(services, function))
+	}
+
+	return printBuildPlan(w, configs, skipped)
+}
+
+// printBuildPlan prints what would be built for each of configs, and the functions
+// which are skipped, ordered by function name
+func printBuildPlan(w io.Writer, configs []builder.BuildImageConfig, skipped map[string]string) error {
+	plans := map[string]*builder.BuildPlan{}
+	names := []string{}
+
+	for _, config := range configs {
+		plan, err := builder.PlanBuild(config)
+		if err != nil {
+			return fmt.Errorf("unable to plan the build of %s: %s", config.FunctionName, err.Error())
+		}
+		plans[config.FunctionName] = plan
+		names = append(names, config.FunctionName)
+	}
+
+	for name := range skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		plan, ok := plans[name]
+		if !ok {
+			reason := skipped[name]
+			if len(reason) == 0 {
+				reason = "skip_build is set"
+			}
+			fmt.Fprintf(w, "%s: skipped, %s\n", name, reason)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s:\n", name)
+		fmt.Fprintf(w, "  Language:      %s\n", plan.Language)
+		fmt.Fprintf(w, "  Image:         %s\n", plan.Image)
+		if len(plan.BuildOptions) > 0 {
+			fmt.Fprintf(w, "  Build options: %s\n", strings.Join(plan.BuildOptions, ", "))
+			fmt.Fprintf(w, "  Packages:      %s\n", strings.Join(plan.Packages, " "))
+		}
+		printPlanMap(w, "Build args:", plan.BuildArgs)
+		printPlanMap(w, "Labels:", plan.Labels)
+		fmt.Fprintf(w, "  Command:       %s\n", plan.Command)
+	}
+
+	return nil
+}
+
+// printPlanMap prints each KEY=VALUE of values in order under title
+func printPlanMap(w io.Writer, title string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "  %s\n", title)
+	for _, k := range keys {
+		fmt.Fprintf(w, "    %s=%s\n", k, values[k])
+	}
+}
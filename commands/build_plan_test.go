@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+func writePlanTemplate(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	lang := filepath.Join(dir, "python3")
+	if err := os.MkdirAll(lang, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	templateYAML := `language: python3
+build_options:
+  - name: dev
+    packages:
+      - make
+      - gcc
+`
+	if err := ioutil.WriteFile(filepath.Join(lang, "template.yml"), []byte(templateYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(lang, "Dockerfile"), []byte("FROM scratch\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func Test_printStackBuildPlan(t *testing.T) {
+	templateDir = writePlanTemplate(t)
+	gitLabels, gitDirtyLabel = false, false
+	defer func() {
+		templateDir = ""
+		gitLabels, gitDirtyLabel = true, true
+	}()
+
+	services := stack.Services{
+		Functions: map[string]stack.Function{
+			"resize": {
+				Language:     "python3",
+				Image:        "ghcr.io/org/resize:0.1",
+				Handler:      "./resize",
+				BuildOptions: []string{"dev"},
+				BuildArgs:    map[string]string{"MODE": "fast"},
+			},
+			"echo":   {Language: "python3", Image: "ghcr.io/org/echo", Handler: "./echo"},
+			"legacy": {Language: "python3", Image: "ghcr.io/org/legacy", Handler: "./legacy", SkipBuild: true},
+			"nolang": {Image: "ghcr.io/org/nolang", Handler: "./nolang"},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := printStackBuildPlan(&out, &services); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := `echo:
+  Language:      python3
+  Image:         ghcr.io/org/echo:latest
+  Command:       docker build --tag ghcr.io/org/echo:latest .
+
+legacy: skipped, skip_build is set
+
+nolang: skipped, no language given
+
+resize:
+  Language:      python3
+  Image:         ghcr.io/org/resize:0.1
+  Build options: dev
+  Packages:      make gcc
+  Build args:
+    MODE=fast
+  Command:       docker build --build-arg MODE=fast --build-arg 'ADDITIONAL_PACKAGE=make gcc' --tag ghcr.io/org/resize:0.1 .
+`
+	if out.String() != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, out.String())
+	}
+}
+
+func Test_printStackBuildPlan_UnknownBuildOption(t *testing.T) {
+	templateDir = writePlanTemplate(t)
+	gitLabels, gitDirtyLabel = false, false
+	defer func() {
+		templateDir = ""
+		gitLabels, gitDirtyLabel = true, true
+	}()
+
+	services := stack.Services{
+		Functions: map[string]stack.Function{
+			"resize": {Language: "python3", Image: "resize", Handler: "./resize", BuildOptions: []string{"prod"}},
+		},
+	}
+
+	var out bytes.Buffer
+	err := printStackBuildPlan(&out, &services)
+	if err == nil {
+		t.Fatal("want an error for an unknown build option")
+	}
+	if !strings.HasPrefix(err.Error(), "unable to plan the build of resize:") {
+		t.Errorf("want the function named in the error, got: %s", err.Error())
+	}
+}
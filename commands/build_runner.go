@@ -0,0 +1,120 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/openfaas/faas-cli/builder"
+	"github.com/openfaas/faas-cli/stack"
+)
+
+// functionBuildError records the failed build of a function within a stack
+type functionBuildError struct {
+	Function string
+	Err      error
+}
+
+// stackBuildError aggregates every failed build of a stack into a single error
+type stackBuildError struct {
+	Failures []functionBuildError
+
+	// Skipped functions were not built because of --fail-fast
+	Skipped []string
+}
+
+func (e *stackBuildError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString("Errors received during build:\n")
+
+	for _, failure := range e.Failures {
+		var buildErr *builder.BuildFailedError
+		if errors.As(failure.Err, &buildErr) {
+			fmt.Fprintf(&sb, "- %s: exit code: %d\n", failure.Function, buildErr.ExitCode)
+			for _, line := range strings.Split(strings.TrimSpace(buildErr.Stderr), "\n") {
+				fmt.Fprintf(&sb, "    %s\n", line)
+			}
+			continue
+		}
+
+		fmt.Fprintf(&sb, "- %s: %s\n", failure.Function, failure.Err.Error())
+	}
+
+	if len(e.Skipped) > 0 {
+		fmt.Fprintf(&sb, "Skipped due to --fail-fast: %s\n", strings.Join(e.Skipped, ", "))
+	}
+
+	return sb.String()
+}
+
+// runStackBuild calls buildFn for each function, with up to parallel builds at once.
+// When failFast is set, no more builds are started after the first failure. Every
+// failure is returned within a *stackBuildError.
+func runStackBuild(functions []stack.Function, parallel int, failFast bool, buildFn func(function stack.Function) error) error {
+	var (
+		mu      sync.Mutex
+		stopped bool
+		result  stackBuildError
+	)
+
+	skip := func(function stack.Function) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if stopped {
+			result.Skipped = append(result.Skipped, function.Name)
+		}
+		return stopped
+	}
+
+	workChannel := make(chan stack.Function)
+	wg := sync.WaitGroup{}
+
+	wg.Add(parallel)
+	for i := 0; i < parallel; i++ {
+		go func() {
+			defer wg.Done()
+
+			for function := range workChannel {
+				if skip(function) {
+					continue
+				}
+
+				if err := buildFn(function); err != nil {
+					mu.Lock()
+					result.Failures = append(result.Failures, functionBuildError{Function: function.Name, Err: err})
+					if failFast {
+						stopped = true
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, function := range functions {
+		if skip(function) {
+			continue
+		}
+		workChannel <- function
+	}
+
+	close(workChannel)
+	wg.Wait()
+
+	if len(result.Failures) == 0 {
+		return nil
+	}
+
+	sort.Slice(result.Failures, func(i, j int) bool {
+		return result.Failures[i].Function < result.Failures[j].Function
+	})
+	sort.Strings(result.Skipped)
+
+	return &result
+}
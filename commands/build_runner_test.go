@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/openfaas/faas-cli/builder"
+	"github.com/openfaas/faas-cli/stack"
+)
+
+func stackFunctions(names ...string) []stack.Function {
+	functions := []stack.Function{}
+	for _, name := range names {
+		functions = append(functions, stack.Function{Name: name})
+	}
+	return functions
+}
+
+// fakeBuild fails the functions named in failures and records every function built
+func fakeBuild(failures map[string]error) (func(stack.Function) error, func() []string) {
+	var mu sync.Mutex
+	built := []string{}
+
+	buildFn := func(function stack.Function) error {
+		mu.Lock()
+		built = append(built, function.Name)
+		mu.Unlock()
+
+		return failures[function.Name]
+	}
+
+	return buildFn, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return built
+	}
+}
+
+func Test_runStackBuild_AllSucceed(t *testing.T) {
+	buildFn, built := fakeBuild(nil)
+
+	if err := runStackBuild(stackFunctions("a", "b", "c"), 2, false, buildFn); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(built()) != 3 {
+		t.Errorf("want 3 builds, got %v", built())
+	}
+}
+
+func Test_runStackBuild_ReportsAllFailures(t *testing.T) {
+	buildFn, built := fakeBuild(map[string]error{
+		"b": &builder.BuildFailedError{FunctionName: "b", ExitCode: 1, Stderr: "step 3/4 failed\nno such file"},
+		"d": fmt.Errorf("handler invalid"),
+	})
+
+	for _, parallel := range []int{1, 3} {
+		t.Run(fmt.Sprintf("parallel %d", parallel), func(t *testing.T) {
+			err := runStackBuild(stackFunctions("a", "b", "c", "d"), parallel, false, buildFn)
+			if err == nil {
+				t.Fatalf("want error")
+			}
+
+			stackErr, ok := err.(*stackBuildError)
+			if !ok {
+				t.Fatalf("want *stackBuildError, got %T", err)
+			}
+			if len(stackErr.Failures) != 2 || stackErr.Failures[0].Function != "b" || stackErr.Failures[1].Function != "d" {
+				t.Errorf("want failures for b and d, got %v", stackErr.Failures)
+			}
+
+			want := `Errors received during build:
+- b: exit code: 1
+    step 3/4 failed
+    no such file
+- d: handler invalid
+`
+			if err.Error() != want {
+				t.Errorf("want summary:\n%s\ngot:\n%s", want, err.Error())
+			}
+		})
+	}
+
+	if len(built()) != 8 {
+		t.Errorf("want every function to be built without --fail-fast, got %v", built())
+	}
+}
+
+func Test_runStackBuild_FailFast(t *testing.T) {
+	buildFn, built := fakeBuild(map[string]error{
+		"b": fmt.Errorf("handler invalid"),
+	})
+
+	err := runStackBuild(stackFunctions("a", "b", "c", "d"), 1, true, buildFn)
+	if err == nil {
+		t.Fatalf("want error")
+	}
+
+	if got := strings.Join(built(), ","); got != "a,b" {
+		t.Errorf("want builds to stop after b, got: %s", got)
+	}
+
+	stackErr := err.(*stackBuildError)
+	if got := strings.Join(stackErr.Skipped, ","); got != "c,d" {
+		t.Errorf("want c and d to be skipped, got: %s", got)
+	}
+
+	if !strings.Contains(err.Error(), "Skipped due to --fail-fast: c, d") {
+		t.Errorf("want skipped functions in summary, got:\n%s", err.Error())
+	}
+}
@@ -4,7 +4,16 @@
 package commands
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/openfaas/faas-cli/builder"
+	"github.com/openfaas/faas-cli/stack"
 )
 
 func Test_build(t *testing.T) {
@@ -91,3 +100,352 @@ func Test_parseBuildArgs_MultipleSeparators(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_printImageNames_Stack(t *testing.T) {
+	services := stack.Services{
+		Functions: map[string]stack.Function{
+			"fn-b":    {Image: "alexellis/fn-b:0.2"},
+			"fn-a":    {Image: "alexellis/fn-a"},
+			"skipped": {Image: "alexellis/skipped", SkipBuild: true},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := printImageNames(&out, services); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := "alexellis/fn-a:latest\nalexellis/fn-b:0.2\n"
+	if out.String() != want {
+		t.Errorf("want %q, got %q", want, out.String())
+	}
+}
+
+func Test_printImageNames_ImageFlag(t *testing.T) {
+	image = "alexellis/fn"
+	defer func() { image = "" }()
+
+	var out bytes.Buffer
+	if err := printImageNames(&out, stack.Services{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if out.String() != "alexellis/fn:latest\n" {
+		t.Errorf("want %q, got %q", "alexellis/fn:latest\n", out.String())
+	}
+}
+
+func Test_mergeBuildArgs(t *testing.T) {
+	cases := []struct {
+		name      string
+		stackArgs map[string]string
+		flagArgs  map[string]string
+		want      map[string]string
+	}{
+		{
+			name:      "stack file only",
+			stackArgs: map[string]string{"GO111MODULE": "on"},
+			want:      map[string]string{"GO111MODULE": "on"},
+		},
+		{
+			name:     "flags only",
+			flagArgs: map[string]string{"GO111MODULE": "off"},
+			want:     map[string]string{"GO111MODULE": "off"},
+		},
+		{
+			name:      "flags override the stack file",
+			stackArgs: map[string]string{"GO111MODULE": "on", "CGO_ENABLED": "0"},
+			flagArgs:  map[string]string{"GO111MODULE": "off"},
+			want:      map[string]string{"GO111MODULE": "off", "CGO_ENABLED": "0"},
+		},
+		{
+			name:      "additional packages from the stack file are kept",
+			stackArgs: map[string]string{"ADDITIONAL_PACKAGE": "curl"},
+			want:      map[string]string{"ADDITIONAL_PACKAGE": "curl"},
+		},
+		{
+			name:      "additional packages are combined",
+			stackArgs: map[string]string{"ADDITIONAL_PACKAGE": "curl jq"},
+			flagArgs:  map[string]string{"ADDITIONAL_PACKAGE": "git"},
+			want:      map[string]string{"ADDITIONAL_PACKAGE": "curl jq git"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := mergeBuildArgs(tc.stackArgs, tc.flagArgs)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_parseBuildArgSecrets(t *testing.T) {
+	got, err := parseBuildArgSecrets([]string{"NPM_TOKEN=@/run/secrets/npm", " PIP_TOKEN =@ ./pip-token "})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]string{
+		"NPM_TOKEN": "/run/secrets/npm",
+		"PIP_TOKEN": "./pip-token",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	for _, invalid := range []string{"NPM_TOKEN", "NPM_TOKEN=/run/secrets/npm", "=@/run/secrets/npm", "NPM_TOKEN=@"} {
+		if _, err := parseBuildArgSecrets([]string{invalid}); err == nil {
+			t.Errorf("want error for %q", invalid)
+		}
+	}
+}
+
+func Test_stackFileInWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, defaultYAML), []byte("version: 1.0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name  string
+		chdir string
+		file  string
+		want  string
+	}{
+		{name: "no chdir", file: "stack.yml", want: "stack.yml"},
+		{name: "relative file", chdir: dir, file: "fns.yml", want: filepath.Join(dir, "fns.yml")},
+		{name: "absolute file", chdir: dir, file: "/etc/fns.yml", want: "/etc/fns.yml"},
+		{name: "URL", chdir: dir, file: "https://domain/fns.yml", want: "https://domain/fns.yml"},
+		{name: "default stack file", chdir: dir, want: filepath.Join(dir, defaultYAML)},
+		{name: "no default stack file", chdir: filepath.Join(dir, "missing")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			chdir = tc.chdir
+			defer func() { chdir = "" }()
+
+			if got := stackFileInWorkingDir(tc.file); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_preRunBuild_ContextFromStdinWithShrinkWrap(t *testing.T) {
+	origParallel := parallel
+	parallel, contextStdin, shrinkwrap = 1, true, true
+	defer func() {
+		parallel, contextStdin, shrinkwrap = origParallel, false, false
+	}()
+
+	got := preRunBuild(buildCmd, nil)
+
+	want := "the --context-from-stdin flag cannot be used with --shrinkwrap or --plan"
+	if got == nil || got.Error() != want {
+		t.Errorf("want error %q, got %v", want, got)
+	}
+}
+
+func Test_preRunBuild_MalformedBuildArg(t *testing.T) {
+	origParallel := parallel
+	parallel, buildArgs = 1, []string{"VERSION"}
+	defer func() {
+		parallel, buildArgs = origParallel, nil
+	}()
+
+	got := preRunBuild(buildCmd, nil)
+	if got == nil {
+		t.Errorf("want an error for a --build-arg without a value")
+	}
+}
+
+func Test_preRunBuild_InlineCacheWithCacheDir(t *testing.T) {
+	origParallel := parallel
+	parallel, inlineCache, cacheDir = 1, true, "./.cache"
+	defer func() {
+		parallel, inlineCache, cacheDir = origParallel, false, ""
+	}()
+
+	got := preRunBuild(buildCmd, nil)
+
+	want := "--inline-cache cannot be used with --cache-dir, choose one cache"
+	if got == nil || got.Error() != want {
+		t.Errorf("want error %q, got %v", want, got)
+	}
+}
+
+func Test_buildFromStdin_MultipleFunctions(t *testing.T) {
+	services := stack.Services{
+		Functions: map[string]stack.Function{
+			"fn2": {Name: "fn2", Language: "go", Image: "fn2"},
+			"fn1": {Name: "fn1", Language: "go", Image: "fn1"},
+		},
+	}
+
+	err := buildFromStdin(context.Background(), bytes.NewReader(nil), &services)
+
+	want := "the --context-from-stdin flag builds a single function, use --filter to select one of: fn1, fn2"
+	if err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
+
+func Test_stackBuildConfig_BuildArgDefaults(t *testing.T) {
+	buildArgMap = map[string]string{"FROM_FLAG": "flag"}
+	argDefaultMap = map[string]string{"FROM_FLAG": "default", "FROM_STACK": "default", "ONLY_DEFAULT": "default"}
+	defer func() {
+		buildArgMap, argDefaultMap = nil, nil
+	}()
+
+	function := stack.Function{
+		Name:      "fn",
+		Language:  "go",
+		Image:     "fn",
+		BuildArgs: map[string]string{"FROM_STACK": "stack"},
+	}
+
+	config := stackBuildConfig(&stack.Services{}, function)
+
+	wantArgs := map[string]string{"FROM_FLAG": "flag", "FROM_STACK": "stack"}
+	if !reflect.DeepEqual(config.BuildArgMap, wantArgs) {
+		t.Errorf("want build args %v, got %v", wantArgs, config.BuildArgMap)
+	}
+	if !reflect.DeepEqual(config.BuildArgDefaults, argDefaultMap) {
+		t.Errorf("want the defaults to be passed separately, got %v", config.BuildArgDefaults)
+	}
+}
+
+func Test_stackBuildConfig_FlagsAndFunction(t *testing.T) {
+	image, handler, functionName, language = "flag-image", "./flag-handler", "flag-fn", "flag-lang"
+	smokeTest, cacheDir, dockerContext = true, "./.cache", "remote"
+	defer func() {
+		image, handler, functionName, language = "", "", "", ""
+		smokeTest, cacheDir, dockerContext = false, "", ""
+	}()
+
+	function := stack.Function{
+		Name:              "fn",
+		Language:          "go",
+		Handler:           "./fn",
+		Image:             "ghcr.io/org/fn",
+		PreBuild:          []string{"make generate"},
+		DockerfileOverlay: "Dockerfile.overlay",
+	}
+
+	want := flagBuildConfig()
+	want.Image, want.Handler, want.FunctionName, want.Language = function.Image, function.Handler, function.Name, function.Language
+	want.BuildArgMap = map[string]string{}
+	want.BuildOptions, want.CopyExtraPaths = []string{}, []string{}
+	want.PreBuild, want.DockerfileOverlay = function.PreBuild, function.DockerfileOverlay
+
+	got := stackBuildConfig(&stack.Services{}, function)
+
+	// OnSuccess is a func, which cannot be compared
+	got.OnSuccess, want.OnSuccess = nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want the flags with the function's fields:\n%+v\ngot:\n%+v", want, got)
+	}
+}
+
+func Test_preRunBuild_PrintContextHashWithPlan(t *testing.T) {
+	origParallel := parallel
+	parallel, printCtxHash, planBuild = 1, true, true
+	defer func() {
+		parallel, printCtxHash, planBuild = origParallel, false, false
+	}()
+
+	got := preRunBuild(buildCmd, nil)
+
+	want := "the --print-context-hash flag cannot be used with --shrinkwrap, --plan or --context-from-stdin"
+	if got == nil || got.Error() != want {
+		t.Errorf("want error %q, got %v", want, got)
+	}
+}
+
+func Test_mergeFunctionBuildFlags(t *testing.T) {
+	yes, no := true, false
+
+	cases := []struct {
+		name      string
+		config    builder.BuildImageConfig
+		flags     *stack.FunctionBuildFlags
+		squashSet bool
+		pullSet   bool
+		want      builder.BuildImageConfig
+	}{
+		{
+			name:   "no build_flags",
+			config: builder.BuildImageConfig{Squash: true, BuildFlags: []string{"--ssh=default"}},
+			want:   builder.BuildImageConfig{Squash: true, BuildFlags: []string{"--ssh=default"}},
+		},
+		{
+			name:   "scalars apply and take precedence over the template",
+			config: builder.BuildImageConfig{},
+			flags:  &stack.FunctionBuildFlags{Squash: &yes, NoCache: &no, Pull: &yes, Compress: &yes},
+			want:   builder.BuildImageConfig{Squash: true, SquashSet: true, NoCacheSet: true, Pull: true, Compress: true},
+		},
+		{
+			name:      "flags given to faas-cli override scalars",
+			config:    builder.BuildImageConfig{SquashSet: true},
+			flags:     &stack.FunctionBuildFlags{Squash: &yes, Pull: &yes},
+			squashSet: true,
+			pullSet:   true,
+			want:      builder.BuildImageConfig{SquashSet: true},
+		},
+		{
+			name:   "lists are combined, the function's first, without duplicates",
+			config: builder.BuildImageConfig{BuildFlags: []string{"--ssh=default", "--progress=plain"}},
+			flags:  &stack.FunctionBuildFlags{Flags: []string{"--ssh=default", "--secret=id=npm"}},
+			want:   builder.BuildImageConfig{BuildFlags: []string{"--ssh=default", "--secret=id=npm", "--progress=plain"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			squashSet, pullSet = tc.squashSet, tc.pullSet
+			defer func() { squashSet, pullSet = false, false }()
+
+			got := mergeFunctionBuildFlags(tc.config, tc.flags)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_runBuild_OfflineSkipsStackTemplatePull(t *testing.T) {
+	stackFile := setupUpTest(t)
+
+	content, err := ioutil.ReadFile(stackFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content = append(content, []byte(`configuration:
+  templates:
+    - name: other-lang
+      source: https://127.0.0.1:1/templates.git
+`)...)
+	if err := ioutil.WriteFile(stackFile, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	origYAML := yamlFile
+	yamlFile, offline, planBuild = stackFile, true, true
+	defer func() {
+		yamlFile, offline, planBuild = origYAML, false, false
+	}()
+
+	var out bytes.Buffer
+	buildCmd.SetOut(&out)
+	defer buildCmd.SetOut(nil)
+
+	if err := runBuild(buildCmd, nil); err != nil {
+		t.Fatalf("want no template pull when offline, got: %s", err)
+	}
+	if !strings.Contains(out.String(), "fn") {
+		t.Errorf("want the plan for fn, got %q", out.String())
+	}
+}
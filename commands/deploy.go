@@ -64,6 +64,9 @@ func init() {
 	deployCmd.Flags().BoolVar(&deployFlags.readOnlyRootFilesystem, "readonly", false, "Force the root container filesystem to be read only")
 
 	deployCmd.Flags().Var(&tagFormat, "tag", "Override latest tag on function Docker image, accepts 'latest', 'sha', 'branch', or 'describe'")
+	deployCmd.Flags().BoolVar(&describeDirty, "describe-always-dirty", false, "With --tag describe, include the commit SHA even when on a tag, and add -dirty for uncommitted changes")
+	deployCmd.Flags().BoolVar(&allowNoVCS, "allow-no-vcs", false, "Use the --fallback-version for the image tag when --tag needs Git, but this is not a Git repository")
+	deployCmd.Flags().StringVar(&fallbackVersion, "fallback-version", "", "Version used with --allow-no-vcs, defaults to the "+fallbackVersionEnvironment+" environment variable")
 
 	deployCmd.Flags().BoolVar(&tlsInsecure, "tls-no-verify", false, "Disable TLS validation")
 	deployCmd.Flags().BoolVar(&envsubst, "envsubst", true, "Substitute environment variables in stack.yml file")
@@ -125,7 +128,7 @@ via flags. Note: --replace and --update are mutually exclusive.`,
 func preRunDeploy(cmd *cobra.Command, args []string) error {
 	language, _ = validateLanguageFlag(language)
 
-	return nil
+	return resolveFallbackVersion()
 }
 
 func runDeploy(cmd *cobra.Command, args []string) error {
@@ -243,7 +246,7 @@ Error: %s`, fprocessErr.Error())
 
 			allAnnotations := mergeMap(annotations, annotationArgs)
 
-			branch, sha, err := builder.GetImageTagValues(tagMode)
+			branch, sha, err := builder.GetImageTagValuesWithFallback(tagMode, describeDirty, allowNoVCS, fallbackVersion)
 			if err != nil {
 				return err
 			}
@@ -471,7 +474,7 @@ func deriveFprocess(function stack.Function) (string, error) {
 	}
 
 	var langTemplate stack.LanguageTemplate
-	parsedLangTemplate, err := stack.ParseYAMLForLanguageTemplate(pathToTemplateYAML)
+	parsedLangTemplate, err := stack.ParseLanguageTemplateIn(stack.DefaultTemplateDir, function.Language)
 
 	if err != nil {
 		return "", err
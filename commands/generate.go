@@ -43,6 +43,7 @@ func init() {
 	generateCmd.Flags().StringVar(&api, "api", defaultAPIVersion, "CRD API version e.g openfaas.com/v1, serving.knative.dev/v1")
 	generateCmd.Flags().StringVarP(&crdFunctionNamespace, "namespace", "n", "openfaas-fn", "Kubernetes namespace for functions")
 	generateCmd.Flags().Var(&tagFormat, "tag", "Override latest tag on function Docker image, accepts 'latest', 'sha', 'branch', 'describe'")
+	generateCmd.Flags().BoolVar(&describeDirty, "describe-always-dirty", false, "With --tag describe, include the commit SHA even when on a tag, and add -dirty for uncommitted changes")
 	generateCmd.Flags().BoolVar(&envsubst, "envsubst", true, "Substitute environment variables in stack.yml file")
 	generateCmd.Flags().StringVar(&desiredArch, "arch", "x86_64", "Desired image arch. (Default x86_64)")
 	generateCmd.Flags().StringArrayVar(&annotationArgs, "annotation", []string{}, "Any annotations you want to add (to store functions only)")
@@ -155,7 +156,7 @@ Use "--yaml" to pass a file or "--from-store" to generate using function store.`
 		os.Exit(1)
 	}
 
-	branch, version, err := builder.GetImageTagValues(tagFormat)
+	branch, version, err := builder.GetImageTagValuesWithDescribe(tagFormat, describeDirty)
 	if err != nil {
 		return err
 	}
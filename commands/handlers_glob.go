@@ -0,0 +1,120 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/openfaas/faas-cli/stack"
+)
+
+// handlerSourceFiles are names which mark a folder as a function handler
+var handlerSourceFiles = []string{"Dockerfile", "package.json", "requirements.txt", "go.mod", "Gemfile", "pom.xml", "build.gradle"}
+
+// handlerSourceExtensions are the extensions of source files which mark a folder as
+// a function handler
+var handlerSourceExtensions = []string{".py", ".js", ".ts", ".mjs", ".go", ".rb", ".cs", ".java", ".php", ".rs", ".sh"}
+
+// invalidFunctionNameChars matches runs of characters which are not valid in a function name
+var invalidFunctionNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// discoverHandlers returns a function for each folder matching pattern which holds
+// recognisable source, named after the folder and built with language. The image
+// is the function name, within imagePrefix when given, i.e. ghcr.io/org/fn.
+// Folders without any source are skipped with a message.
+func discoverHandlers(pattern, language, imagePrefix string) (map[string]stack.Function, error) {
+	if len(language) == 0 {
+		return nil, fmt.Errorf("please provide the --lang of the functions found by --handlers-glob")
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --handlers-glob %q: %s", pattern, err.Error())
+	}
+	sort.Strings(matches)
+
+	functions := map[string]stack.Function{}
+	for _, match := range matches {
+		infos, err := ioutil.ReadDir(match)
+		if err != nil {
+			// Files matched by the pattern are not handlers
+			continue
+		}
+
+		if !isHandlerFolder(infos, language) {
+			fmt.Printf("Skipping %s, no function source found\n", match)
+			continue
+		}
+
+		name := functionNameFromFolder(filepath.Base(match))
+		if err := validateFunctionName(name); err != nil {
+			return nil, fmt.Errorf("unable to name a function after %s: %s", match, err.Error())
+		}
+
+		if existing, ok := functions[name]; ok {
+			return nil, fmt.Errorf("both %s and %s give the function name %q", existing.Handler, match, name)
+		}
+
+		image := name
+		if len(imagePrefix) > 0 {
+			image = strings.TrimSuffix(imagePrefix, "/") + "/" + name
+		}
+
+		functions[name] = stack.Function{
+			Name:     name,
+			Handler:  match,
+			Language: language,
+			Image:    image,
+		}
+	}
+
+	if len(functions) == 0 {
+		return nil, fmt.Errorf("no function handlers found matching --handlers-glob %q", pattern)
+	}
+
+	return functions, nil
+}
+
+// isHandlerFolder returns true when the folder holds recognisable source, only a
+// Dockerfile is recognised for the dockerfile language
+func isHandlerFolder(infos []os.FileInfo, language string) bool {
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+
+		if language == "dockerfile" {
+			if info.Name() == "Dockerfile" {
+				return true
+			}
+			continue
+		}
+
+		for _, name := range handlerSourceFiles {
+			if info.Name() == name {
+				return true
+			}
+		}
+		for _, ext := range handlerSourceExtensions {
+			if filepath.Ext(info.Name()) == ext {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// functionNameFromFolder derives a function name from a folder name, in lower-case
+// with any other characters replaced by dashes, i.e. Resize_Image becomes resize-image
+func functionNameFromFolder(folder string) string {
+	name := invalidFunctionNameChars.ReplaceAllString(strings.ToLower(folder), "-")
+	return strings.Trim(name, "-")
+}
@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeHandlerFile(t *testing.T, path string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_discoverHandlers(t *testing.T) {
+	dir := t.TempDir()
+	writeHandlerFile(t, filepath.Join(dir, "Resize_Image", "handler.py"))
+	writeHandlerFile(t, filepath.Join(dir, "echo", "requirements.txt"))
+	writeHandlerFile(t, filepath.Join(dir, "docs", "README.md"))
+	writeHandlerFile(t, filepath.Join(dir, "notes.txt"))
+
+	functions, err := discoverHandlers(filepath.Join(dir, "*"), "python3", "ghcr.io/org/")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(functions) != 2 {
+		t.Fatalf("want 2 functions, got %d: %v", len(functions), functions)
+	}
+
+	resize, ok := functions["resize-image"]
+	if !ok {
+		t.Fatalf("want resize-image function, got %v", functions)
+	}
+	if resize.Handler != filepath.Join(dir, "Resize_Image") {
+		t.Errorf("want handler %s, got %s", filepath.Join(dir, "Resize_Image"), resize.Handler)
+	}
+	if resize.Image != "ghcr.io/org/resize-image" {
+		t.Errorf("want image ghcr.io/org/resize-image, got %s", resize.Image)
+	}
+	if resize.Language != "python3" {
+		t.Errorf("want language python3, got %s", resize.Language)
+	}
+
+	if echo := functions["echo"]; echo.Image != "ghcr.io/org/echo" {
+		t.Errorf("want image ghcr.io/org/echo, got %q", echo.Image)
+	}
+}
+
+func Test_discoverHandlers_Dockerfile(t *testing.T) {
+	dir := t.TempDir()
+	writeHandlerFile(t, filepath.Join(dir, "api", "Dockerfile"))
+	writeHandlerFile(t, filepath.Join(dir, "script", "main.sh"))
+
+	functions, err := discoverHandlers(filepath.Join(dir, "*"), "dockerfile", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(functions) != 1 || functions["api"].Image != "api" {
+		t.Errorf("want only the api function with image api, got %v", functions)
+	}
+}
+
+func Test_discoverHandlers_Errors(t *testing.T) {
+	dir := t.TempDir()
+	writeHandlerFile(t, filepath.Join(dir, "empty", "README.md"))
+	writeHandlerFile(t, filepath.Join(dir, "dupes", "Fn", "handler.go"))
+	writeHandlerFile(t, filepath.Join(dir, "dupes", "fn_", "handler.go"))
+
+	cases := []struct {
+		name     string
+		pattern  string
+		language string
+		wantErr  string
+	}{
+		{
+			name:     "no language",
+			pattern:  filepath.Join(dir, "*"),
+			language: "",
+			wantErr:  "please provide the --lang",
+		},
+		{
+			name:     "no handlers",
+			pattern:  filepath.Join(dir, "empty*"),
+			language: "go",
+			wantErr:  "no function handlers found",
+		},
+		{
+			name:     "duplicate names",
+			pattern:  filepath.Join(dir, "dupes", "*"),
+			language: "go",
+			wantErr:  `give the function name "fn"`,
+		},
+		{
+			name:     "invalid pattern",
+			pattern:  "[",
+			language: "go",
+			wantErr:  "invalid --handlers-glob",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := discoverHandlers(tc.pattern, tc.language, "")
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("want error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_functionNameFromFolder(t *testing.T) {
+	cases := map[string]string{
+		"echo":         "echo",
+		"Resize_Image": "resize-image",
+		"my fn.v2":     "my-fn-v2",
+		"__private__":  "private",
+	}
+
+	for folder, want := range cases {
+		if got := functionNameFromFolder(folder); got != want {
+			t.Errorf("functionNameFromFolder(%q) want %q, got %q", folder, want, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// parseLabelFile parses KEY=VALUE label definitions, one per line. Blank lines and
+// lines starting with # are ignored, and a value may be wrapped in single or double
+// quotes, where double quotes allow escapes such as \" and \n.
+func parseLabelFile(name string, data string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	for i, line := range strings.Split(data, "\n") {
+		lineNumber := i + 1
+
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		index := strings.Index(line, "=")
+		if index == -1 {
+			return nil, fmt.Errorf("%s:%d: label must take the form KEY=VALUE", name, lineNumber)
+		}
+
+		key := strings.TrimSpace(line[:index])
+		value := strings.TrimSpace(line[index+1:])
+
+		if len(key) == 0 {
+			return nil, fmt.Errorf("%s:%d: label must have a non-empty key", name, lineNumber)
+		}
+
+		unquoted, err := unquoteLabelValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: label %s: %s", name, lineNumber, key, err.Error())
+		}
+
+		if len(unquoted) == 0 {
+			return nil, fmt.Errorf("%s:%d: label %s must have a non-empty value", name, lineNumber, key)
+		}
+
+		labels[key] = unquoted
+	}
+
+	return labels, nil
+}
+
+// unquoteLabelValue removes the quotes around a value, if it has any
+func unquoteLabelValue(value string) (string, error) {
+	if len(value) == 0 || (value[0] != '"' && value[0] != '\'') {
+		return value, nil
+	}
+
+	quote := value[0]
+	if len(value) < 2 || value[len(value)-1] != quote {
+		return "", fmt.Errorf("unterminated quote in value: %s", value)
+	}
+
+	if quote == '\'' {
+		return value[1 : len(value)-1], nil
+	}
+
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted value: %s", value)
+	}
+
+	return unquoted, nil
+}
+
+// loadBuildLabels reads each of the label files in turn, then applies the
+// --build-label flags, so that a flag takes precedence over a file
+func loadBuildLabels(labelFiles []string, flagLabels []string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	for _, labelFile := range labelFiles {
+		data, err := ioutil.ReadFile(labelFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read label file: %s", err.Error())
+		}
+
+		fileLabels, err := parseLabelFile(labelFile, string(data))
+		if err != nil {
+			return nil, err
+		}
+
+		labels = mergeMap(labels, fileLabels)
+	}
+
+	parsed, err := parseMap(flagLabels, "build-label")
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeMap(labels, parsed), nil
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseLabelFile(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "comments and blank lines",
+			data: "# compliance labels\n\norg.opencontainers.image.vendor=OpenFaaS Ltd\n  team = platform  \n",
+			want: map[string]string{
+				"org.opencontainers.image.vendor": "OpenFaaS Ltd",
+				"team":                            "platform",
+			},
+		},
+		{
+			name: "quoted values",
+			data: "description=\"a \\\"quoted\\\" value\"\nliteral='no \\n escapes'\nequals=\"a=b\"\n",
+			want: map[string]string{
+				"description": "a \"quoted\" value",
+				"literal":     "no \\n escapes",
+				"equals":      "a=b",
+			},
+		},
+		{
+			name:    "missing equals",
+			data:    "team=platform\n\nvendor\n",
+			wantErr: "labels.env:3: label must take the form KEY=VALUE",
+		},
+		{
+			name:    "empty key",
+			data:    "=platform\n",
+			wantErr: "labels.env:1: label must have a non-empty key",
+		},
+		{
+			name:    "empty value",
+			data:    "team=\n",
+			wantErr: "labels.env:1: label team must have a non-empty value",
+		},
+		{
+			name:    "unterminated quote",
+			data:    "# header\nteam=\"platform\n",
+			wantErr: "labels.env:2: label team: unterminated quote",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseLabelFile("labels.env", tc.data)
+			if len(tc.wantErr) > 0 {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+					t.Fatalf("want error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_loadBuildLabels(t *testing.T) {
+	dir := t.TempDir()
+
+	org := filepath.Join(dir, "org.env")
+	if err := ioutil.WriteFile(org, []byte("vendor=OpenFaaS Ltd\nteam=platform\ntier=gold\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	project := filepath.Join(dir, "project.env")
+	if err := ioutil.WriteFile(project, []byte("team=functions\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadBuildLabels([]string{org, project}, []string{"tier=silver"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]string{
+		"vendor": "OpenFaaS Ltd",
+		"team":   "functions",
+		"tier":   "silver",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if _, err := loadBuildLabels([]string{filepath.Join(dir, "missing.env")}, nil); err == nil {
+		t.Errorf("want error for a missing label file")
+	}
+}
@@ -12,6 +12,10 @@ const (
 	openFaaSURLEnvironment      = "OPENFAAS_URL"
 	templateURLEnvironment      = "OPENFAAS_TEMPLATE_URL"
 	templateStoreURLEnvironment = "OPENFAAS_TEMPLATE_STORE_URL"
+	fallbackVersionEnvironment  = "OPENFAAS_FALLBACK_VERSION"
+	templateDirEnvironment      = "FAAS_TEMPLATE_DIR"
+	copyExtraScopeEnvironment   = "FAAS_COPY_EXTRA_SCOPES"
+	dockerBinaryEnvironment     = "FAAS_DOCKER_BINARY"
 )
 
 func getGatewayURL(argumentURL, defaultURL, yamlURL, environmentURL string) string {
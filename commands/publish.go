@@ -17,9 +17,10 @@ import (
 )
 
 var (
-	platforms string
-	extraTags []string
-	resetQemu bool
+	platforms      string
+	extraTags      []string
+	resetQemu      bool
+	checkPlatforms bool
 )
 
 func init() {
@@ -37,13 +38,21 @@ func init() {
 	publishCmd.Flags().StringArrayVarP(&buildArgs, "build-arg", "b", []string{}, "Add a build-arg for Docker (KEY=VALUE)")
 	publishCmd.Flags().StringArrayVarP(&buildOptions, "build-option", "o", []string{}, "Set a build option, e.g. dev")
 	publishCmd.Flags().Var(&tagFormat, "tag", "Override latest tag on function Docker image, accepts 'latest', 'sha', 'branch', or 'describe'")
+	publishCmd.Flags().BoolVar(&describeDirty, "describe-always-dirty", false, "With --tag describe, include the commit SHA even when on a tag, and add -dirty for uncommitted changes")
+	publishCmd.Flags().BoolVar(&allowNoVCS, "allow-no-vcs", false, "Use the --fallback-version for the image tag when --tag needs Git, but this is not a Git repository")
+	publishCmd.Flags().StringVar(&fallbackVersion, "fallback-version", "", "Version used with --allow-no-vcs, defaults to the "+fallbackVersionEnvironment+" environment variable")
 	publishCmd.Flags().StringArrayVar(&buildLabels, "build-label", []string{}, "Add a label for Docker image (LABEL=VALUE)")
+	publishCmd.Flags().StringArrayVar(&labelFiles, "label-file", []string{}, "Read labels for the Docker image from a file of LABEL=VALUE lines, --build-label takes precedence")
 	publishCmd.Flags().StringArrayVar(&copyExtra, "copy-extra", []string{}, "Extra paths that will be copied into the function build context")
 	publishCmd.Flags().BoolVar(&envsubst, "envsubst", true, "Substitute environment variables in stack.yml file")
 	publishCmd.Flags().BoolVar(&quietBuild, "quiet", false, "Perform a quiet build, without showing output from Docker")
 	publishCmd.Flags().BoolVar(&disableStackPull, "disable-stack-pull", false, "Disables the template configuration in the stack.yml")
+	publishCmd.Flags().StringVar(&templateDir, "template-dir", "", "Folder to read language templates from instead of ./template, defaults to the "+templateDirEnvironment+" environment variable")
 	publishCmd.Flags().StringVar(&platforms, "platforms", "linux/amd64", "A set of platforms to publish")
+	publishCmd.Flags().StringVar(&buildNetwork, "build-network", "", "Set the networking mode for RUN instructions during the build, host networking cannot be used with multiple platforms. Named --build-network so it does not clash with deploy's --network")
+	publishCmd.Flags().BoolVar(&checkPlatforms, "check-platforms", false, "Check that the base images in the Dockerfile support each of the --platforms before building")
 	publishCmd.Flags().StringArrayVar(&extraTags, "extra-tag", []string{}, "Additional extra image tag")
+	publishCmd.Flags().BoolVar(&checkRegistry, "check-registry", false, "Check that the registry accepts the stored docker login before building, so that a push does not fail after a long build")
 
 	publishCmd.Flags().BoolVar(&resetQemu, "reset-qemu", false, "Runs \"docker run multiarch/qemu-user-static --reset -p yes`\" to enable multi-arch builds. Compatible with AMD64 machines only.")
 
@@ -68,7 +77,7 @@ var publishCmd = &cobra.Command{
                    [--build-option VALUE]
                    [--copy-extra PATH]
                    [--tag <sha|branch|describe>]
-                   [--platforms linux/arm/v7]
+                   [--platforms linux/arm/v7] [--check-platforms]
 				   [--resetQemu]`,
 	Short: "Builds and pushes multi-arch OpenFaaS container images",
 	Long: `Builds and pushes multi-arch OpenFaaS container images using Docker buildx.
@@ -84,9 +93,11 @@ correctly configured TARGETPLATFORM and BUILDPLATFORM arguments.
 See also: faas-cli build`,
 	Example: `  faas-cli publish --platforms linux/amd64,linux/arm64,linux/arm/7
   faas-cli publish --platforms linux/arm/7 --filter webhook
+  faas-cli publish --platforms linux/amd64,linux/arm64 --check-platforms
   faas-cli publish -f go.yml --no-cache --build-arg NPM_VERSION=0.2.2
   faas-cli publish --build-option dev
   faas-cli publish --tag sha
+  faas-cli publish --check-registry
   faas-cli publish --reset-qemu
   `,
 	PreRunE: preRunPublish,
@@ -98,12 +109,20 @@ func preRunPublish(cmd *cobra.Command, args []string) error {
 	language, _ = validateLanguageFlag(language)
 
 	mapped, err := parseBuildArgs(buildArgs)
+	if err != nil {
+		return err
+	}
+	buildArgMap = mapped
 
-	if err == nil {
-		buildArgMap = mapped
+	buildLabelMap, err = loadBuildLabels(labelFiles, buildLabels)
+
+	if len(templateDir) == 0 {
+		templateDir = os.Getenv(templateDirEnvironment)
 	}
 
-	buildLabelMap, err = parseMap(buildLabels, "build-label")
+	if fallbackErr := resolveFallbackVersion(); fallbackErr != nil {
+		return fallbackErr
+	}
 
 	if parallel < 1 {
 		return fmt.Errorf("the --parallel flag must be great than 0")
@@ -130,9 +149,12 @@ func runPublish(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	templateAddress := getTemplateURL("", os.Getenv(templateURLEnvironment), DefaultTemplateRepository)
-	if pullErr := PullTemplates(templateAddress); pullErr != nil {
-		return fmt.Errorf("could not pull templates for OpenFaaS: %v", pullErr)
+	// Templates are only pulled into the default folder
+	if len(templateDir) == 0 {
+		templateAddress := getTemplateURL("", os.Getenv(templateURLEnvironment), DefaultTemplateRepository)
+		if pullErr := PullTemplates(templateAddress); pullErr != nil {
+			return fmt.Errorf("could not pull templates for OpenFaaS: %v", pullErr)
+		}
 	}
 
 	if resetQemu {
@@ -175,7 +197,7 @@ func runPublish(cmd *cobra.Command, args []string) error {
 
 	fmt.Printf("Created buildx node: \"multiarch\"\n")
 
-	if len(services.StackConfiguration.TemplateConfigs) != 0 && !disableStackPull {
+	if len(services.StackConfiguration.TemplateConfigs) != 0 && !disableStackPull && len(templateDir) == 0 {
 		newTemplateInfos, err := filterExistingTemplates(services.StackConfiguration.TemplateConfigs, "./template")
 		if err != nil {
 			return fmt.Errorf("already pulled templates directory has issue: %s", err.Error())
@@ -218,7 +240,7 @@ func publish(services *stack.Services, queueDepth int, shrinkwrap, quietBuild bo
 					fmt.Println("Please provide a valid language for your function.")
 				} else {
 					combinedBuildOptions := combineBuildOpts(function.BuildOptions, buildOptions)
-					combinedBuildArgMap := mergeMap(function.BuildArgs, buildArgMap)
+					combinedBuildArgMap := mergeBuildArgs(function.BuildArgs, buildArgMap)
 					combinedExtraPaths := mergeSlice(services.StackConfiguration.CopyExtraPaths, copyExtra)
 					err := builder.PublishImage(function.Image,
 						function.Handler,
@@ -235,6 +257,14 @@ func publish(services *stack.Services, queueDepth int, shrinkwrap, quietBuild bo
 						combinedExtraPaths,
 						platforms,
 						extraTags,
+						checkRegistry,
+						checkPlatforms,
+						buildNetwork,
+						describeDirty,
+						function.DockerfileOverlay,
+						templateDir,
+						allowNoVCS,
+						fallbackVersion,
 					)
 
 					if err != nil {
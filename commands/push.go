@@ -22,6 +22,10 @@ func init() {
 
 	pushCmd.Flags().IntVar(&parallel, "parallel", 1, "Push images in parallel to depth specified.")
 	pushCmd.Flags().Var(&tagFormat, "tag", "Override latest tag on function Docker image, accepts 'latest', 'sha', 'branch', 'describe'")
+	pushCmd.Flags().BoolVar(&describeDirty, "describe-always-dirty", false, "With --tag describe, include the commit SHA even when on a tag, and add -dirty for uncommitted changes")
+	pushCmd.Flags().BoolVar(&allowNoVCS, "allow-no-vcs", false, "Use the --fallback-version for the image tag when --tag needs Git, but this is not a Git repository")
+	pushCmd.Flags().StringVar(&fallbackVersion, "fallback-version", "", "Version used with --allow-no-vcs, defaults to the "+fallbackVersionEnvironment+" environment variable")
+	pushCmd.Flags().BoolVar(&inlineCache, "inline-cache", false, "Also push the IMAGE:buildcache tag written by a build with --inline-cache")
 	pushCmd.Flags().BoolVar(&envsubst, "envsubst", true, "Substitute environment variables in stack.yml file")
 
 }
@@ -43,7 +47,13 @@ These container images must already be present in your local image cache.`,
   faas-cli push -f ./stack.yml --tag sha
   faas-cli push -f ./stack.yml --tag branch
   faas-cli push -f ./stack.yml --tag describe`,
-	RunE: runPush,
+	PreRunE: preRunPush,
+	RunE:    runPush,
+}
+
+// preRunPush validates args & flags
+func preRunPush(cmd *cobra.Command, args []string) error {
+	return resolveFallbackVersion()
 }
 
 func runPush(cmd *cobra.Command, args []string) error {
@@ -91,7 +101,7 @@ func pushStack(services *stack.Services, queueDepth int, tagMode schema.BuildFor
 	for i := 0; i < queueDepth; i++ {
 		go func(index int) {
 			for function := range workChannel {
-				branch, sha, err := builder.GetImageTagValues(tagMode)
+				branch, sha, err := builder.GetImageTagValuesWithFallback(tagMode, describeDirty, allowNoVCS, fallbackVersion)
 				if err != nil {
 					tagMode = schema.DefaultFormat
 				}
@@ -105,6 +115,9 @@ func pushStack(services *stack.Services, queueDepth int, tagMode schema.BuildFor
 				} else {
 
 					pushImage(imageName)
+					if inlineCache {
+						pushImage(builder.InlineCacheImage(imageName))
+					}
 					fmt.Printf(aec.YellowF.Apply("[%d] < Pushing %s [%s] done.\n"), index, function.Name, imageName)
 				}
 			}
@@ -40,3 +40,18 @@ func Test_PushValidation(t *testing.T) {
 
 	}
 }
+
+func Test_preRunPush_AllowNoVCSWithoutVersion(t *testing.T) {
+	allowNoVCS, fallbackVersion = true, ""
+	defer func() {
+		allowNoVCS, fallbackVersion = false, ""
+	}()
+	t.Setenv(fallbackVersionEnvironment, "")
+
+	got := preRunPush(pushCmd, nil)
+
+	want := "the --allow-no-vcs flag requires --fallback-version or " + fallbackVersionEnvironment + " to be set"
+	if got == nil || got.Error() != want {
+		t.Errorf("want error %q, got %v", want, got)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/openfaas/faas-cli/builder"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	templateCmd.AddCommand(templateChecksumCmd)
+}
+
+// templateChecksumCmd records the checksum of one or more pulled templates
+var templateChecksumCmd = &cobra.Command{
+	Use:   `checksum LANGUAGE [LANGUAGE...]`,
+	Short: `Records the checksum of a pulled template`,
+	Long: `Records the checksum of the files within ./template/LANGUAGE, so that builds
+using --verify-template fail if the template is later modified.`,
+	Example: `  faas-cli template checksum python3
+  faas-cli build --verify-template`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTemplateChecksum,
+}
+
+func runTemplateChecksum(cmd *cobra.Command, args []string) error {
+	for _, language := range args {
+		checksum, err := builder.WriteTemplateChecksum(filepath.Join(templateDirectory, language))
+		if err != nil {
+			return fmt.Errorf("unable to write checksum for template %s: %s", language, err.Error())
+		}
+
+		fmt.Printf("%s: %s\n", language, checksum)
+	}
+
+	return nil
+}
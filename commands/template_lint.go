@@ -0,0 +1,59 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/openfaas/faas-cli/builder"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	templateCmd.AddCommand(templateLintCmd)
+}
+
+// templateLintCmd checks one or more templates for problems before they are used
+var templateLintCmd = &cobra.Command{
+	Use:   `lint LANGUAGE [LANGUAGE...]`,
+	Short: `Checks a template for problems`,
+	Long: `Checks that ./template/LANGUAGE has a template.yml which parses and sets its
+language, a Dockerfile, the handler_folder it names and well-formed build options.
+Every problem found is reported.`,
+	Example: `  faas-cli template lint python3
+  faas-cli template lint node18 golang-middleware`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTemplateLint,
+}
+
+func runTemplateLint(cmd *cobra.Command, args []string) error {
+	return lintTemplates(cmd.OutOrStdout(), templateDirectory, args)
+}
+
+// lintTemplates writes the problems found in each of the languages' templates to w,
+// and returns an error when there are any
+func lintTemplates(w io.Writer, templateDir string, languages []string) error {
+	failed := 0
+
+	for _, language := range languages {
+		problems := builder.LintTemplate(templateDir, language)
+		if len(problems) == 0 {
+			fmt.Fprintf(w, "%s: ok\n", language)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(w, "%s: %d problem(s)\n", language, len(problems))
+		for _, problem := range problems {
+			fmt.Fprintf(w, "  - %s\n", problem)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d template(s) have problems", failed, len(languages))
+	}
+
+	return nil
+}
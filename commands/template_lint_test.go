@@ -0,0 +1,45 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_lintTemplates(t *testing.T) {
+	templateDir := t.TempDir()
+	files := map[string]string{
+		"go/template.yml":     "language: go\n",
+		"go/Dockerfile":       "FROM golang\n",
+		"broken/template.yml": "fprocess: ./handler\n",
+	}
+	for name, content := range files {
+		name = filepath.Join(templateDir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	err := lintTemplates(&out, templateDir, []string{"go", "broken"})
+
+	if err == nil || err.Error() != "1 of 2 template(s) have problems" {
+		t.Errorf("want an error for the broken template, got %v", err)
+	}
+
+	want := "go: ok\n" +
+		"broken: 2 problem(s)\n" +
+		"  - no Dockerfile found in " + filepath.Join(templateDir, "broken") + "\n" +
+		"  - template.yml does not set a language\n"
+	if out.String() != want {
+		t.Errorf("want output:\n%s\ngot:\n%s", want, out.String())
+	}
+}
@@ -67,6 +67,11 @@ func upHandler(cmd *cobra.Command, args []string) error {
 	if err := runBuild(cmd, args); err != nil {
 		return err
 	}
+	if planBuild || printCtxHash || printImageName {
+		// The plan, context hashes and image names are a preview, so nothing is
+		// pushed or deployed
+		return nil
+	}
 	fmt.Println()
 	if !skipPush {
 		if err := runPush(cmd, args); err != nil {
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupUpTest chdirs into a temp folder with a stack file for one function, its
+// handler and its template, and returns the stack file. The image has no registry
+// prefix, so that runPush fails if it is reached.
+func setupUpTest(t *testing.T) string {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	files := map[string]string{
+		"stack.yml": `version: 1.0
+provider:
+  name: openfaas
+functions:
+  fn:
+    lang: up-lang
+    handler: ./fn
+    image: fn:latest
+`,
+		"template/up-lang/template.yml": "language: up-lang\n",
+		"template/up-lang/Dockerfile":   "FROM scratch\n",
+		"fn/handler.txt":                "handler\n",
+	}
+
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return filepath.Join(dir, "stack.yml")
+}
+
+func Test_upHandler_PrintContextHashSkipsPushAndDeploy(t *testing.T) {
+	stackFile := setupUpTest(t)
+
+	origYAML, origTemplateDir := yamlFile, templateDir
+	yamlFile, templateDir, printCtxHash = stackFile, "./template", true
+	defer func() {
+		yamlFile, templateDir, printCtxHash = origYAML, origTemplateDir, false
+	}()
+
+	var out bytes.Buffer
+	upCmd.SetOut(&out)
+	defer upCmd.SetOut(nil)
+
+	if err := upHandler(upCmd, nil); err != nil {
+		t.Fatalf("want no push or deploy, got: %s", err)
+	}
+
+	if got := out.String(); !strings.HasPrefix(got, "fn sha256:") {
+		t.Errorf("want the context hash of fn, got %q", got)
+	}
+}
+
+func Test_upHandler_PrintImageNameSkipsPushAndDeploy(t *testing.T) {
+	stackFile := setupUpTest(t)
+
+	origYAML := yamlFile
+	yamlFile, printImageName = stackFile, true
+	defer func() {
+		yamlFile, printImageName = origYAML, false
+	}()
+
+	var out bytes.Buffer
+	upCmd.SetOut(&out)
+	defer upCmd.SetOut(nil)
+
+	if err := upHandler(upCmd, nil); err != nil {
+		t.Fatalf("want no push or deploy, got: %s", err)
+	}
+
+	if got, want := out.String(), "fn:latest\n"; got != want {
+		t.Errorf("want image names %q, got %q", want, got)
+	}
+}
@@ -74,9 +74,13 @@ func New(filePath string) (*ConfigFile, error) {
 // 1. CI = "true" and OPENFAAS_CONFIG="", then it will return `.openfaas`, which is located in the current working directory.
 // 2. CI = "true" and OPENFAAS_CONFIG="<path>", then it will return the path value in  OPENFAAS_CONFIG
 // 3. CI = "" and OPENFAAS_CONFIG="", then it will return the default location ~/.openfaas
+//
+// Only the CI variable moves the config directory, the variables of other CI
+// systems in CIEnvironmentVariables do not, so that a login on a Jenkins or
+// TeamCity agent keeps using ~/.openfaas.
 func ConfigDir() string {
 	override := os.Getenv(ConfigLocationEnv)
-	ci := isRunningInCI()
+	ci := ciVariableSet()
 
 	switch {
 	// case (1) from docs string
@@ -91,10 +95,41 @@ func ConfigDir() string {
 	}
 }
 
-// isRunningInCI checks the ENV var CI and returns true if it's set to true or 1
-func isRunningInCI() bool {
-	if env, ok := os.LookupEnv("CI"); ok {
-		if env == "true" || env == "1" {
+// CIEnvironmentVariables are set by CI systems which do not set CI, such as Jenkins
+// and TeamCity, any non-empty value is taken to mean a CI build
+var CIEnvironmentVariables = []string{
+	"JENKINS_URL",
+	"TEAMCITY_VERSION",
+	"BUILDKITE",
+	"GITHUB_ACTIONS",
+	"GITLAB_CI",
+	"CIRCLECI",
+	"TRAVIS",
+	"TF_BUILD",
+	"BITBUCKET_BUILD_NUMBER",
+	"CODEBUILD_BUILD_ID",
+	"DRONE",
+}
+
+// ciVariableSet checks the ENV var CI and returns true if it's set to true or 1
+func ciVariableSet() bool {
+	env := os.Getenv("CI")
+	return env == "true" || env == "1"
+}
+
+// IsRunningInCI checks the ENV var CI and returns true if it's set to true or 1, or
+// false if it's set to false or 0. Otherwise, any of CIEnvironmentVariables being
+// set means that it's running in CI.
+func IsRunningInCI() bool {
+	switch os.Getenv("CI") {
+	case "true", "1":
+		return true
+	case "false", "0":
+		return false
+	}
+
+	for _, name := range CIEnvironmentVariables {
+		if len(os.Getenv(name)) > 0 {
 			return true
 		}
 	}
@@ -105,7 +140,7 @@ func isRunningInCI() bool {
 func EnsureFile() (string, error) {
 	permission := DefaultPermissions
 	dir := ConfigDir()
-	if isRunningInCI() {
+	if ciVariableSet() {
 		permission = DefaultCIPermissions
 	}
 	dirPath, err := homedir.Expand(dir)
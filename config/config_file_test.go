@@ -388,6 +388,13 @@ func Test_ConfigDir(t *testing.T) {
 			name:         "when no other env variables are set, the default path is returned",
 			expectedPath: DefaultDir,
 		},
+		{
+			name: "when only a CI system's variable such as JENKINS_URL is set, the default path is returned",
+			env: map[string]string{
+				"JENKINS_URL": "http://jenkins:8080/",
+			},
+			expectedPath: DefaultDir,
+		},
 	}
 
 	for _, tc := range cases {
@@ -406,3 +413,50 @@ func Test_ConfigDir(t *testing.T) {
 	}
 
 }
+
+// clearCIEnvironment unsets CI and each of CIEnvironmentVariables for the test
+func clearCIEnvironment(t *testing.T) {
+	t.Setenv("CI", "")
+	for _, name := range CIEnvironmentVariables {
+		t.Setenv(name, "")
+	}
+}
+
+func Test_IsRunningInCI(t *testing.T) {
+	for _, name := range CIEnvironmentVariables {
+		t.Run(name, func(t *testing.T) {
+			clearCIEnvironment(t)
+			t.Setenv(name, "1")
+
+			if !IsRunningInCI() {
+				t.Errorf("want %s to be recognised as CI", name)
+			}
+		})
+	}
+
+	cases := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{name: "nothing set", want: false},
+		{name: "CI true", env: map[string]string{"CI": "true"}, want: true},
+		{name: "CI 1", env: map[string]string{"CI": "1"}, want: true},
+		{name: "CI false overrides an indicator", env: map[string]string{"CI": "false", "JENKINS_URL": "http://jenkins:8080/"}, want: false},
+		{name: "CI 0 overrides an indicator", env: map[string]string{"CI": "0", "TEAMCITY_VERSION": "2022.04"}, want: false},
+		{name: "unrecognised CI value falls back to indicators", env: map[string]string{"CI": "yes", "TEAMCITY_VERSION": "2022.04"}, want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clearCIEnvironment(t)
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
+			if got := IsRunningInCI(); got != tc.want {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	osexec "os/exec"
+	"strings"
 
 	"github.com/morikuni/aec"
 )
@@ -36,3 +37,13 @@ func CommandWithOutput(builder []string, skipFailure bool) string {
 	}
 	return string(output)
 }
+
+// CommandWithError runs a system command and returns its stdout, or an error with
+// the command's stderr when it fails
+func CommandWithError(builder []string) (string, error) {
+	output, err := osexec.Command(builder[0], builder[1:]...).Output()
+	if exitErr, ok := err.(*osexec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return string(output), fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return string(output), err
+}
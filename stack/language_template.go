@@ -8,11 +8,14 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"path"
 	"strings"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
+// ParseYAMLForLanguageTemplate parses the template.yml at file, which may be a URL.
+// A parse error is returned as a *LanguageTemplateError with the file and line.
 func ParseYAMLForLanguageTemplate(file string) (*LanguageTemplate, error) {
 	var err error
 	var fileData []byte
@@ -31,7 +34,12 @@ func ParseYAMLForLanguageTemplate(file string) (*LanguageTemplate, error) {
 		}
 	}
 
-	return ParseYAMLDataForLanguageTemplate(fileData)
+	langTemplate, err := ParseYAMLDataForLanguageTemplate(fileData)
+	if err != nil {
+		return nil, newLanguageTemplateError(file, fileData, err)
+	}
+
+	return langTemplate, nil
 }
 
 // ParseYAMLDataForLanguageTemplate parses YAML data into language template
@@ -48,13 +56,22 @@ func ParseYAMLDataForLanguageTemplate(fileData []byte) (*LanguageTemplate, error
 	return &langTemplate, err
 }
 
+// DefaultTemplateDir is the folder that language templates are read from by default
+const DefaultTemplateDir = "./template"
+
 func IsValidTemplate(lang string) bool {
+	return IsValidTemplateIn(DefaultTemplateDir, lang)
+}
+
+// IsValidTemplateIn returns true when templateDir contains a template for lang
+// with a valid template.yml
+func IsValidTemplateIn(templateDir, lang string) bool {
 	var found bool
 
 	lang = strings.ToLower(lang)
 
-	if _, err := os.Stat("./template/" + lang); err == nil {
-		templateYAMLPath := "./template/" + lang + "/template.yml"
+	if _, err := os.Stat(path.Join(templateDir, lang)); err == nil {
+		templateYAMLPath := path.Join(templateDir, lang, "template.yml")
 
 		if _, err := ParseYAMLForLanguageTemplate(templateYAMLPath); err == nil {
 			found = true
@@ -70,8 +87,7 @@ func LoadLanguageTemplate(lang string) (*LanguageTemplate, error) {
 	_, err := os.Stat("./template/" + lang)
 
 	if err == nil {
-		templateYAMLPath := "./template/" + lang + "/template.yml"
-		languageTemplate, err := ParseYAMLForLanguageTemplate(templateYAMLPath)
+		languageTemplate, err := ParseLanguageTemplateIn(DefaultTemplateDir, lang)
 		return languageTemplate, err
 	}
 	return nil, err
@@ -3,8 +3,12 @@
 package stack
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -40,6 +44,18 @@ fprocess: python index.py
 				FProcess: "python index.py",
 			},
 		},
+		{
+			`
+language: python3
+handler_files:
+- index.py
+- main.py
+`,
+			&LanguageTemplate{
+				Language:     "python3",
+				HandlerFiles: []string{"index.py", "main.py"},
+			},
+		},
 	}
 
 	for k, i := range langTemplateTest {
@@ -71,3 +87,83 @@ func Test_IsValidTemplate(t *testing.T) {
 		t.Fatalf("python must is not valid because it does not contain template.yml")
 	}
 }
+
+func Test_IsValidTemplateIn(t *testing.T) {
+	templateDir := filepath.Join(t.TempDir(), "infra", "faas", "template")
+
+	if err := os.MkdirAll(filepath.Join(templateDir, "python"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if IsValidTemplateIn(templateDir, "python") {
+		t.Fatalf("python must not be valid because it does not contain template.yml")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(templateDir, "python", "template.yml"), []byte("language: python\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !IsValidTemplateIn(templateDir, "python") {
+		t.Fatalf("python must be valid in %s", templateDir)
+	}
+	if !IsValidTemplateIn(templateDir, "Python") {
+		t.Fatalf("the language must be matched case-insensitively")
+	}
+	if IsValidTemplate("python") {
+		t.Fatalf("python must not be found in the default template folder")
+	}
+}
+
+func Test_ParseYAMLForLanguageTemplate_Malformed(t *testing.T) {
+	cases := []struct {
+		fixture   string
+		wantLine  int
+		wantField string
+		want      string
+	}{
+		{
+			fixture:   "wrong-type.yml",
+			wantLine:  4,
+			wantField: "build_options",
+			want:      `invalid testdata/templates/wrong-type.yml, line 4, field "build_options": cannot unmarshal !!map into []stack.BuildOption`,
+		},
+		{
+			fixture:   "list-for-string.yml",
+			wantLine:  4,
+			wantField: "fprocess",
+			want:      `invalid testdata/templates/list-for-string.yml, line 4, field "fprocess": cannot unmarshal !!seq into string`,
+		},
+		{
+			fixture:   "bad-indent.yml",
+			wantLine:  3,
+			wantField: "handler_folder",
+			want:      `invalid testdata/templates/bad-indent.yml, line 3, field "handler_folder": mapping values are not allowed in this context`,
+		},
+		{
+			fixture:  "unterminated-quote.yml",
+			wantLine: 4,
+			want:     `invalid testdata/templates/unterminated-quote.yml, line 4: found unexpected end of stream`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.fixture, func(t *testing.T) {
+			_, err := ParseYAMLForLanguageTemplate(path.Join("testdata", "templates", tc.fixture))
+			if err == nil {
+				t.Fatalf("want error for %s", tc.fixture)
+			}
+
+			var templateErr *LanguageTemplateError
+			if !errors.As(err, &templateErr) {
+				t.Fatalf("want a *LanguageTemplateError, got %T", err)
+			}
+			if templateErr.Line != tc.wantLine {
+				t.Errorf("want line %d, got %d", tc.wantLine, templateErr.Line)
+			}
+			if templateErr.Field != tc.wantField {
+				t.Errorf("want field %q, got %q", tc.wantField, templateErr.Field)
+			}
+			if err.Error() != tc.want {
+				t.Errorf("want error:\n%s\ngot:\n%s", tc.want, err.Error())
+			}
+		})
+	}
+}
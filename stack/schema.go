@@ -62,6 +62,40 @@ type Function struct {
 
 	// Platforms for use with buildx and faas-cli publish
 	Platforms string `yaml:"platforms,omitempty"`
+
+	// PreBuild shell commands run in the handler folder before the build
+	PreBuild []string `yaml:"pre_build,omitempty"`
+
+	// PostBuild shell commands run in the handler folder after a successful build
+	PostBuild []string `yaml:"post_build,omitempty"`
+
+	// DockerfileOverlay is a file in the handler which is merged into the template's
+	// Dockerfile at build time, to customise it for this function
+	DockerfileOverlay string `yaml:"dockerfile_overlay,omitempty"`
+
+	// BuildFlags are the settings of faas-cli build for this function, the flags
+	// given to faas-cli build add to or override them
+	BuildFlags *FunctionBuildFlags `yaml:"build_flags,omitempty"`
+}
+
+// FunctionBuildFlags are the settings of faas-cli build for a function. Each of
+// the scalars is left as nil when it is not given, so that the flag or template
+// applies instead.
+type FunctionBuildFlags struct {
+	// NoCache builds without the Docker layer cache
+	NoCache *bool `yaml:"no_cache,omitempty"`
+
+	// Squash squashes the layers of the image
+	Squash *bool `yaml:"squash,omitempty"`
+
+	// Pull always pulls newer versions of the base images
+	Pull *bool `yaml:"pull,omitempty"`
+
+	// Compress compresses the build context sent to the Docker daemon
+	Compress *bool `yaml:"compress,omitempty"`
+
+	// Flags are passed to docker build, i.e. --ssh=default
+	Flags []string `yaml:"flags,omitempty"`
 }
 
 // Configuration for the stack.yml file
@@ -80,6 +114,10 @@ type StackConfiguration struct {
 	//
 	// The yaml uses the shorter name `copy` to make it easier for developers to read and use
 	CopyExtraPaths []string `yaml:"copy"`
+
+	// TemplateRevision is the commit the template folder is expected to be checked
+	// out at, when building with --fail-on-unpinned-template
+	TemplateRevision string `yaml:"template_revision,omitempty"`
 }
 
 // TemplateSource for build templates
@@ -117,6 +155,23 @@ type LanguageTemplate struct {
 	WelcomeMessage string `yaml:"welcome_message,omitempty"`
 	// HandlerFolder to copy the function code into
 	HandlerFolder string `yaml:"handler_folder,omitempty"`
+	// HandlerFiles are expected within a function's handler, a warning is printed
+	// at build time when none of them are found
+	HandlerFiles []string `yaml:"handler_files,omitempty"`
+	// Extends names another template in the same folder, whose build options, build
+	// args, handler folder, handler files and fprocess are used when not set here
+	Extends string `yaml:"extends,omitempty"`
+	// BuildArgs are passed to the build, unless overridden by the function's own
+	BuildArgs map[string]string `yaml:"build_args,omitempty"`
+	// RequiredBuildArgs must each be given a value, by the function or by BuildArgs,
+	// for the build to start
+	RequiredBuildArgs []string `yaml:"required_build_args,omitempty"`
+	// NoCache and Squash are the defaults for builds of the template, when not
+	// given as flags
+	NoCache *bool `yaml:"no_cache,omitempty"`
+	Squash  *bool `yaml:"squash,omitempty"`
+	// MinFaaSCLIVersion is the oldest faas-cli which can build the template
+	MinFaaSCLIVersion string `yaml:"min_faas_cli_version,omitempty"`
 }
 
 // BuildOption a named build option for one or more packages
@@ -500,3 +500,112 @@ func Test_substituteEnvironment_DefaultLeftWhenNil(t *testing.T) {
 		t.Errorf("subst, want: %s, got: %s", want, string(res))
 	}
 }
+
+func Test_ParseYAMLData_BuildHooks(t *testing.T) {
+	file := `version: 1.0
+provider:
+  name: openfaas
+  gateway: http://127.0.0.1:8080
+
+functions:
+  grpc-fn:
+    lang: go
+    handler: ./grpc-fn
+    image: alexellis/grpc-fn
+    pre_build:
+      - protoc --go_out=. api.proto
+      - make assets
+    post_build:
+      - ./smoke-test.sh
+`
+
+	services, err := ParseYAMLData([]byte(file), "", "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"protoc --go_out=. api.proto", "make assets"}
+	got := services.Functions["grpc-fn"].PreBuild
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want pre_build %v, got %v", want, got)
+	}
+
+	wantPost := []string{"./smoke-test.sh"}
+	gotPost := services.Functions["grpc-fn"].PostBuild
+	if !reflect.DeepEqual(wantPost, gotPost) {
+		t.Errorf("want post_build %v, got %v", wantPost, gotPost)
+	}
+}
+
+func Test_ParseYAMLData_BuildArgs(t *testing.T) {
+	file := `version: 1.0
+provider:
+  name: openfaas
+  gateway: http://127.0.0.1:8080
+
+functions:
+  go-fn:
+    lang: go
+    handler: ./go-fn
+    image: alexellis/go-fn
+    environment:
+      write_debug: true
+    build_args:
+      GO111MODULE: "on"
+      ADDITIONAL_PACKAGE: curl jq
+`
+
+	services, err := ParseYAMLData([]byte(file), "", "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	function := services.Functions["go-fn"]
+
+	want := map[string]string{"GO111MODULE": "on", "ADDITIONAL_PACKAGE": "curl jq"}
+	if !reflect.DeepEqual(want, function.BuildArgs) {
+		t.Errorf("want build_args %v, got %v", want, function.BuildArgs)
+	}
+
+	if _, ok := function.Environment["GO111MODULE"]; ok {
+		t.Errorf("want build_args to be kept separate from the runtime environment")
+	}
+}
+
+func Test_ParseYAMLData_BuildFlags(t *testing.T) {
+	file := `version: 1.0
+provider:
+  name: openfaas
+  gateway: http://127.0.0.1:8080
+
+functions:
+  ssh-fn:
+    lang: go
+    handler: ./ssh-fn
+    image: alexellis/ssh-fn
+    build_flags:
+      squash: true
+      no_cache: false
+      flags:
+        - --ssh=default
+  plain-fn:
+    lang: go
+    handler: ./plain-fn
+    image: alexellis/plain-fn
+`
+
+	services, err := ParseYAMLData([]byte(file), "", "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	yes, no := true, false
+	want := &FunctionBuildFlags{Squash: &yes, NoCache: &no, Flags: []string{"--ssh=default"}}
+	if got := services.Functions["ssh-fn"].BuildFlags; !reflect.DeepEqual(want, got) {
+		t.Errorf("want build_flags %+v, got %+v", want, got)
+	}
+
+	if got := services.Functions["plain-fn"].BuildFlags; got != nil {
+		t.Errorf("want no build_flags, got %+v", got)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package stack
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// yamlErrorLine matches the line number within an error from the YAML parser
+var yamlErrorLine = regexp.MustCompile(`line (\d+):\s*`)
+
+// LanguageTemplateError is returned when a template.yml cannot be parsed, with
+// the line and field of the first problem when they can be found
+type LanguageTemplateError struct {
+	Path  string
+	Line  int
+	Field string
+	Err   error
+}
+
+func (e *LanguageTemplateError) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString("invalid " + e.Path)
+
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, ", line %d", e.Line)
+	}
+	if len(e.Field) > 0 {
+		fmt.Fprintf(&sb, ", field %q", e.Field)
+	}
+
+	sb.WriteString(": " + e.reason())
+	return sb.String()
+}
+
+func (e *LanguageTemplateError) Unwrap() error {
+	return e.Err
+}
+
+// reason returns the message from the YAML parser without its "yaml:" prefix
+// and line number, which are given separately
+func (e *LanguageTemplateError) reason() string {
+	messages := []string{e.Err.Error()}
+	if typeErr, ok := e.Err.(*yaml.TypeError); ok && len(typeErr.Errors) > 0 {
+		messages = typeErr.Errors[:1]
+	}
+
+	reason := strings.TrimPrefix(messages[0], "yaml: ")
+	return yamlErrorLine.ReplaceAllString(reason, "")
+}
+
+// newLanguageTemplateError wraps err from parsing the template.yml at path, the
+// field is read from the line of data that the error refers to
+func newLanguageTemplateError(path string, data []byte, err error) error {
+	templateErr := &LanguageTemplateError{Path: path, Err: err}
+
+	message := err.Error()
+	if typeErr, ok := err.(*yaml.TypeError); ok && len(typeErr.Errors) > 0 {
+		message = typeErr.Errors[0]
+	}
+
+	match := yamlErrorLine.FindStringSubmatch(message)
+	if match == nil {
+		return templateErr
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	templateErr.Line = line
+
+	lines := strings.Split(string(data), "\n")
+	if line > 0 && line <= len(lines) {
+		// A map or list of the wrong type starts on the line after its field
+		nested := strings.Contains(message, "!!map") || strings.Contains(message, "!!seq")
+		templateErr.Field = yamlFieldAt(lines, line-1, nested)
+	}
+
+	return templateErr
+}
+
+// yamlFieldAt returns the field of the value at lines[index], or of its parent
+// when nested is set, by walking up to the first line with less indentation
+func yamlFieldAt(lines []string, index int, nested bool) string {
+	if !nested {
+		return yamlFieldName(lines[index])
+	}
+
+	indent := yamlIndent(lines[index])
+	listItem := strings.HasPrefix(strings.TrimSpace(lines[index]), "- ")
+
+	for i := index - 1; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		parentIndent := yamlIndent(lines[i])
+		if parentIndent < indent || (listItem && parentIndent == indent && !strings.HasPrefix(trimmed, "- ")) {
+			return yamlFieldName(lines[i])
+		}
+	}
+
+	return ""
+}
+
+// yamlIndent returns the number of leading spaces of line
+func yamlIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// yamlFieldName returns the key of a "key: value" line, or an empty string
+func yamlFieldName(line string) string {
+	trimmed := strings.TrimLeft(strings.TrimSpace(line), "- ")
+
+	i := strings.Index(trimmed, ":")
+	if i < 1 {
+		return ""
+	}
+
+	key := strings.Trim(trimmed[:i], `"'`)
+	if strings.ContainsAny(key, " \t") {
+		return ""
+	}
+	return key
+}
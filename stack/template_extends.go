@@ -0,0 +1,125 @@
+// Copyright (c) OpenFaaS Author(s) 2022. All rights reserved.
+// Licensed under the MIT license. See LICENSE file in the project root for full license information.
+
+package stack
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ResolveTemplateExtends returns the template for language with the values of the
+// templates it extends merged in, as per MergeLanguageTemplates. Each template is
+// loaded by name with load, and a template which extends itself, directly or
+// through others, is an error.
+func ResolveTemplateExtends(language string, load func(language string) (*LanguageTemplate, error)) (*LanguageTemplate, error) {
+	chain := []string{}
+	seen := map[string]bool{}
+	templates := []*LanguageTemplate{}
+
+	for name := language; len(name) > 0; {
+		key := strings.ToLower(name)
+		chain = append(chain, name)
+		if seen[key] {
+			return nil, fmt.Errorf("template %s has an extends cycle: %s", language, strings.Join(chain, " -> "))
+		}
+		seen[key] = true
+
+		langTemplate, err := load(name)
+		if err != nil {
+			if len(templates) > 0 {
+				return nil, fmt.Errorf("template %s extends %s, which cannot be read: %s", chain[len(chain)-2], name, err.Error())
+			}
+			return nil, err
+		}
+
+		templates = append(templates, langTemplate)
+		name = langTemplate.Extends
+	}
+
+	resolved := templates[len(templates)-1]
+	for i := len(templates) - 2; i >= 0; i-- {
+		resolved = MergeLanguageTemplates(resolved, templates[i])
+	}
+
+	return resolved, nil
+}
+
+// MergeLanguageTemplates returns child with the build options, build args, handler
+// folder, handler files, fprocess, no_cache, squash and min_faas_cli_version it
+// does not set taken from parent. A build option or build arg of the child replaces
+// the parent's of the same name, and the required build args of both apply. The
+// min_faas_cli_version of the child wins whenever it is set, even when it is older
+// than the parent's, rather than the stricter of the two. The language and welcome
+// message are not inherited.
+func MergeLanguageTemplates(parent, child *LanguageTemplate) *LanguageTemplate {
+	merged := *child
+
+	if len(merged.FProcess) == 0 {
+		merged.FProcess = parent.FProcess
+	}
+
+	if len(merged.HandlerFolder) == 0 {
+		merged.HandlerFolder = parent.HandlerFolder
+	}
+
+	if len(merged.HandlerFiles) == 0 {
+		merged.HandlerFiles = parent.HandlerFiles
+	}
+
+	if merged.NoCache == nil {
+		merged.NoCache = parent.NoCache
+	}
+
+	if merged.Squash == nil {
+		merged.Squash = parent.Squash
+	}
+
+	if len(merged.MinFaaSCLIVersion) == 0 {
+		merged.MinFaaSCLIVersion = parent.MinFaaSCLIVersion
+	}
+
+	merged.BuildOptions = []BuildOption{}
+	overridden := map[string]bool{}
+	for _, option := range child.BuildOptions {
+		overridden[option.Name] = true
+	}
+	for _, option := range parent.BuildOptions {
+		if !overridden[option.Name] {
+			merged.BuildOptions = append(merged.BuildOptions, option)
+		}
+	}
+	merged.BuildOptions = append(merged.BuildOptions, child.BuildOptions...)
+
+	if len(parent.BuildArgs) > 0 {
+		merged.BuildArgs = map[string]string{}
+		for k, v := range parent.BuildArgs {
+			merged.BuildArgs[k] = v
+		}
+		for k, v := range child.BuildArgs {
+			merged.BuildArgs[k] = v
+		}
+	}
+
+	if len(parent.RequiredBuildArgs) > 0 {
+		merged.RequiredBuildArgs = []string{}
+		required := map[string]bool{}
+		for _, name := range append(append([]string{}, parent.RequiredBuildArgs...), child.RequiredBuildArgs...) {
+			if !required[name] {
+				required[name] = true
+				merged.RequiredBuildArgs = append(merged.RequiredBuildArgs, name)
+			}
+		}
+	}
+
+	return &merged
+}
+
+// ParseLanguageTemplateIn parses the template.yml of lang within templateDir, and of
+// each template that it extends
+func ParseLanguageTemplateIn(templateDir, lang string) (*LanguageTemplate, error) {
+	return ResolveTemplateExtends(lang, func(language string) (*LanguageTemplate, error) {
+		return ParseYAMLForLanguageTemplate(path.Join(templateDir, strings.ToLower(language), "template.yml"))
+	})
+}
@@ -0,0 +1,229 @@
+package stack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTemplates writes the template.yml of each template into a new folder
+func writeTemplates(t *testing.T, templates map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, templateYAML := range templates {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name, "template.yml"), []byte(templateYAML), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const baseTemplate = `language: python3
+fprocess: python3 index.py
+handler_folder: function
+handler_files:
+  - handler.py
+build_args:
+  PYTHON_VERSION: "3.10"
+  PIP_INDEX: https://pypi.org/simple
+build_options:
+  - name: dev
+    packages:
+      - make
+  - name: pillow
+    packages:
+      - libjpeg-dev
+`
+
+func Test_ParseLanguageTemplateIn_Extends(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"python3": baseTemplate,
+		"python3-flask": `language: python3-flask
+extends: python3
+`,
+	})
+
+	langTemplate, err := ParseLanguageTemplateIn(dir, "python3-flask")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if langTemplate.Language != "python3-flask" {
+		t.Errorf("want the language of the child, got %s", langTemplate.Language)
+	}
+	if langTemplate.FProcess != "python3 index.py" || langTemplate.HandlerFolder != "function" {
+		t.Errorf("want fprocess and handler folder from the parent, got %q and %q", langTemplate.FProcess, langTemplate.HandlerFolder)
+	}
+	if !reflect.DeepEqual(langTemplate.HandlerFiles, []string{"handler.py"}) {
+		t.Errorf("want handler files from the parent, got %v", langTemplate.HandlerFiles)
+	}
+	if len(langTemplate.BuildOptions) != 2 {
+		t.Errorf("want 2 build options from the parent, got %v", langTemplate.BuildOptions)
+	}
+	if langTemplate.BuildArgs["PYTHON_VERSION"] != "3.10" {
+		t.Errorf("want build args from the parent, got %v", langTemplate.BuildArgs)
+	}
+}
+
+func Test_ParseLanguageTemplateIn_ChildOverrides(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"python3": baseTemplate,
+		"python3-http": `language: python3-http
+extends: python3
+handler_folder: src
+build_args:
+  PYTHON_VERSION: "3.11"
+build_options:
+  - name: dev
+    packages:
+      - make
+      - gcc
+  - name: psycopg
+    packages:
+      - libpq-dev
+`,
+		"python3-http-debian": `language: python3-http-debian
+extends: python3-http
+fprocess: gunicorn index:app
+`,
+	})
+
+	langTemplate, err := ParseLanguageTemplateIn(dir, "python3-http-debian")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if langTemplate.FProcess != "gunicorn index:app" {
+		t.Errorf("want the child's fprocess, got %s", langTemplate.FProcess)
+	}
+	if langTemplate.HandlerFolder != "src" {
+		t.Errorf("want the nearest handler folder, got %s", langTemplate.HandlerFolder)
+	}
+
+	wantArgs := map[string]string{"PYTHON_VERSION": "3.11", "PIP_INDEX": "https://pypi.org/simple"}
+	if !reflect.DeepEqual(langTemplate.BuildArgs, wantArgs) {
+		t.Errorf("want build args %v, got %v", wantArgs, langTemplate.BuildArgs)
+	}
+
+	wantOptions := []BuildOption{
+		{Name: "pillow", Packages: []string{"libjpeg-dev"}},
+		{Name: "dev", Packages: []string{"make", "gcc"}},
+		{Name: "psycopg", Packages: []string{"libpq-dev"}},
+	}
+	if !reflect.DeepEqual(langTemplate.BuildOptions, wantOptions) {
+		t.Errorf("want build options %v, got %v", wantOptions, langTemplate.BuildOptions)
+	}
+}
+
+func Test_ParseLanguageTemplateIn_ExtendsCycle(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"a":    "language: a\nextends: b\n",
+		"b":    "language: b\nextends: c\n",
+		"c":    "language: c\nextends: a\n",
+		"self": "language: self\nextends: self\n",
+	})
+
+	cases := []struct {
+		language string
+		want     string
+	}{
+		{language: "a", want: "template a has an extends cycle: a -> b -> c -> a"},
+		{language: "self", want: "template self has an extends cycle: self -> self"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.language, func(t *testing.T) {
+			_, err := ParseLanguageTemplateIn(dir, tc.language)
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("want error %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func Test_ParseLanguageTemplateIn_MissingParent(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"go-http": "language: go-http\nextends: go\n",
+	})
+
+	_, err := ParseLanguageTemplateIn(dir, "go-http")
+	if err == nil {
+		t.Fatal("want an error when the parent template is missing")
+	}
+
+	want := "template go-http extends go, which cannot be read: open " + filepath.Join(dir, "go", "template.yml") + ": no such file or directory"
+	if err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
+
+func Test_ParseLanguageTemplateIn_RequiredBuildArgs(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"node": `language: node
+required_build_args:
+  - NODE_VERSION
+  - REGISTRY
+`,
+		"node-express": `language: node-express
+extends: node
+required_build_args:
+  - REGISTRY
+  - EXPRESS_VERSION
+`,
+	})
+
+	langTemplate, err := ParseLanguageTemplateIn(dir, "node-express")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{"NODE_VERSION", "REGISTRY", "EXPRESS_VERSION"}
+	if !reflect.DeepEqual(langTemplate.RequiredBuildArgs, want) {
+		t.Errorf("want required build args %v, got %v", want, langTemplate.RequiredBuildArgs)
+	}
+}
+
+func Test_ParseLanguageTemplateIn_BuildDefaults(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"node":         "language: node\nno_cache: true\nsquash: true\n",
+		"node-express": "language: node-express\nextends: node\nsquash: false\n",
+	})
+
+	langTemplate, err := ParseLanguageTemplateIn(dir, "node-express")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if langTemplate.NoCache == nil || !*langTemplate.NoCache {
+		t.Errorf("want no_cache inherited from the parent, got %v", langTemplate.NoCache)
+	}
+	if langTemplate.Squash == nil || *langTemplate.Squash {
+		t.Errorf("want squash: false of the child, got %v", langTemplate.Squash)
+	}
+}
+
+func Test_ParseLanguageTemplateIn_MinFaaSCLIVersion(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"node":         "language: node\nmin_faas_cli_version: 0.14.0\n",
+		"node-express": "language: node-express\nextends: node\n",
+		"node-koa":     "language: node-koa\nextends: node\nmin_faas_cli_version: 0.15.0\n",
+		"node-legacy":  "language: node-legacy\nextends: node\nmin_faas_cli_version: 0.13.0\n",
+	})
+
+	for language, want := range map[string]string{"node-express": "0.14.0", "node-koa": "0.15.0", "node-legacy": "0.13.0"} {
+		langTemplate, err := ParseLanguageTemplateIn(dir, language)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if langTemplate.MinFaaSCLIVersion != want {
+			t.Errorf("%s: want min_faas_cli_version %q, got %q", language, want, langTemplate.MinFaaSCLIVersion)
+		}
+	}
+}
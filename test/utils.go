@@ -135,3 +135,20 @@ func CaptureStdout(f func()) string {
 
 	return b.String()
 }
+
+func CaptureStderr(f func()) string {
+	stdErr := os.Stderr
+	r, w, _ := os.Pipe()
+	defer r.Close()
+	os.Stderr = w
+
+	f()
+
+	w.Close()
+	os.Stderr = stdErr
+
+	var b bytes.Buffer
+	io.Copy(&b, r)
+
+	return b.String()
+}
@@ -1,6 +1,9 @@
 package versioncontrol
 
 import (
+	"fmt"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/openfaas/faas-cli/exec"
@@ -85,6 +88,43 @@ func GetGitSHA() string {
 	return sha
 }
 
+// IsGitDirty returns true when the working tree has uncommitted changes to tracked files
+func IsGitDirty() bool {
+	out, err := exec.CommandWithError([]string{"git", "status", "--porcelain", "--untracked-files=no"})
+	return err == nil && len(strings.TrimSpace(out)) > 0
+}
+
+// GetGitCommitTime returns the committer time of HEAD as seconds since the Unix epoch
+func GetGitCommitTime() (int64, error) {
+	out, err := exec.CommandWithError([]string{"git", "log", "-1", "--format=%ct", "HEAD"})
+	if err != nil {
+		return 0, fmt.Errorf("unable to find the time of the last commit: %s", err.Error())
+	}
+
+	return strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+}
+
+// GetGitRevisionIn returns the full commit SHA of HEAD for the checkout containing dir
+func GetGitRevisionIn(dir string) (string, error) {
+	out, err := exec.CommandWithError([]string{"git", "-C", dir, "rev-parse", "HEAD"})
+	if err != nil {
+		return "", fmt.Errorf("unable to find the revision of %s: %s", dir, err.Error())
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// IsGitDirtyIn returns true when dir has uncommitted changes, including files
+// which are not tracked
+func IsGitDirtyIn(dir string) (bool, error) {
+	out, err := exec.CommandWithError([]string{"git", "-C", dir, "status", "--porcelain", "--", "."})
+	if err != nil {
+		return false, fmt.Errorf("unable to find the status of %s: %s", dir, err.Error())
+	}
+
+	return len(strings.TrimSpace(out)) > 0, nil
+}
+
 func GetGitBranch() string {
 	getBranchCommand := []string{"git", "rev-parse", "--symbolic-full-name", "--abbrev-ref", "HEAD"}
 	branch := exec.CommandWithOutput(getBranchCommand, true)
@@ -94,3 +134,41 @@ func GetGitBranch() string {
 	branch = strings.TrimSuffix(branch, "\n")
 	return branch
 }
+
+// GetChangedFilesIn returns the files which have changed since the merge base of ref
+// and HEAD in the checkout containing dir, including uncommitted changes and untracked
+// files which are not ignored. The paths are absolute, so that they can be compared
+// with paths relative to any folder, and cover the whole of the checkout.
+func GetChangedFilesIn(dir, ref string) ([]string, error) {
+	root, err := exec.CommandWithError([]string{"git", "-C", dir, "rev-parse", "--show-toplevel"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the Git repository of %s: %s", dir, err.Error())
+	}
+	root = strings.TrimSpace(root)
+
+	base, err := exec.CommandWithError([]string{"git", "-C", root, "merge-base", ref, "HEAD"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the merge base of %s and HEAD: %s", ref, err.Error())
+	}
+
+	changed, err := exec.CommandWithError([]string{"git", "-C", root, "diff", "--name-only", strings.TrimSpace(base)})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the files changed since %s: %s", ref, err.Error())
+	}
+
+	untracked, err := exec.CommandWithError([]string{"git", "-C", root, "ls-files", "--others", "--exclude-standard"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the untracked files: %s", err.Error())
+	}
+
+	files := []string{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(changed+"\n"+untracked, "\n") {
+		if file := strings.TrimSpace(line); len(file) > 0 && !seen[file] {
+			seen[file] = true
+			files = append(files, filepath.Join(root, filepath.FromSlash(file)))
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,161 @@
+package versioncontrol
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// setupGitRepo creates a repository with one commit in a temporary directory,
+// and changes into it for the test
+func setupGitRepo(t *testing.T) {
+	if _, err := osexec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	writeFile(t, "committed.txt", "v1")
+	writeFile(t, ".gitignore", "ignored.txt\n")
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.email=test@example.com", "-c", "user.name=test", "commit", "--quiet", "-m", "initial"},
+	} {
+		if out, err := osexec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(".", name), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_GetChangedFiles(t *testing.T) {
+	setupGitRepo(t)
+
+	writeFile(t, "committed.txt", "v2")
+	writeFile(t, "untracked.txt", "new")
+	writeFile(t, "ignored.txt", "ignored")
+
+	root := repoRoot(t)
+
+	files, err := GetChangedFilesIn(".", "HEAD")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sort.Strings(files)
+
+	want := []string{filepath.Join(root, "committed.txt"), filepath.Join(root, "untracked.txt")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("want %v, got %v", want, files)
+	}
+}
+
+func Test_GetChangedFilesIn_Subfolder(t *testing.T) {
+	setupGitRepo(t)
+	root := repoRoot(t)
+
+	if err := os.MkdirAll(filepath.Join("services", "billing"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "committed.txt", "v2")
+	writeFile(t, filepath.Join("services", "billing", "handler.go"), "package function")
+
+	files, err := GetChangedFilesIn(filepath.Join("services", "billing"), "HEAD")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sort.Strings(files)
+
+	want := []string{filepath.Join(root, "committed.txt"), filepath.Join(root, "services", "billing", "handler.go")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("want the changes of the whole checkout %v, got %v", want, files)
+	}
+}
+
+// repoRoot returns the real path of the repository created by setupGitRepo
+func repoRoot(t *testing.T) string {
+	root, err := filepath.EvalSymlinks(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abs
+}
+
+func Test_GetChangedFiles_UnknownRef(t *testing.T) {
+	setupGitRepo(t)
+
+	if _, err := GetChangedFilesIn(".", "no-such-ref"); err == nil {
+		t.Errorf("want an error for an unknown ref")
+	}
+}
+
+func Test_GitRevisionAndStatus(t *testing.T) {
+	setupGitRepo(t)
+
+	revision, err := GetGitRevisionIn(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(revision) != 40 {
+		t.Errorf("want the full commit SHA, got %q", revision)
+	}
+
+	if _, err := GetGitCommitTime(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if IsGitDirty() {
+		t.Errorf("want a clean working tree after the commit")
+	}
+
+	writeFile(t, "untracked.txt", "new")
+	if IsGitDirty() {
+		t.Errorf("want untracked files not to make the working tree dirty")
+	}
+	dirty, err := IsGitDirtyIn(".")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !dirty {
+		t.Errorf("want untracked files to make the directory dirty")
+	}
+
+	writeFile(t, "committed.txt", "v2")
+	if !IsGitDirty() {
+		t.Errorf("want a changed tracked file to make the working tree dirty")
+	}
+}
+
+func Test_GetGitRevisionIn_NotARepository(t *testing.T) {
+	if _, err := osexec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	_, err := GetGitRevisionIn(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("want git's error for a directory outside a repository, got %v", err)
+	}
+}